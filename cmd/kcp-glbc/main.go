@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"flag"
 	"fmt"
 	"net/url"
@@ -26,19 +27,24 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 
+	kcp "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	kcpinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
 	"github.com/kcp-dev/logicalcluster"
 
 	kuadrantv1 "github.com/kuadrant/kcp-glbc/pkg/client/kuadrant/clientset/versioned"
 	"github.com/kuadrant/kcp-glbc/pkg/client/kuadrant/informers/externalversions"
+	dnsprovider "github.com/kuadrant/kcp-glbc/pkg/dns"
 	"github.com/kuadrant/kcp-glbc/pkg/log"
 	"github.com/kuadrant/kcp-glbc/pkg/metrics"
 	"github.com/kuadrant/kcp-glbc/pkg/net"
 	"github.com/kuadrant/kcp-glbc/pkg/reconciler/deployment"
 	"github.com/kuadrant/kcp-glbc/pkg/reconciler/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/reconciler/domainverification"
 	"github.com/kuadrant/kcp-glbc/pkg/reconciler/ingress"
 	"github.com/kuadrant/kcp-glbc/pkg/reconciler/service"
 	"github.com/kuadrant/kcp-glbc/pkg/tls"
 	"github.com/kuadrant/kcp-glbc/pkg/util/env"
+	"github.com/kuadrant/kcp-glbc/pkg/webhook"
 )
 
 const (
@@ -65,12 +71,40 @@ var options struct {
 	Domain string
 	// Whether custom hosts are permitted
 	EnableCustomHosts bool
+	// The interval the TXT records of the custom domains not verified yet are checked at
+	DomainVerificationInterval time.Duration
+	// The interval the TXT records of the verified custom domains are checked at
+	DomainVerificationVerifiedInterval time.Duration
+	// The secret the domain verification tokens are computed with
+	DomainVerificationSecret string
 	// The DNS provider
 	DNSProvider string
+	// The path of the DNS zones configuration file
+	DNSZonesConfig string
+	// Whether the GLBC fails to start if the DNS zone of the domain can't be found
+	DNSRequireZone bool
+	// The interval the DNS records are checked for drift at
+	DNSDriftCheckInterval time.Duration
+	// The interval the health of the health checked endpoints is refreshed at
+	DNSHealthCheckStatusInterval time.Duration
+	// The identifier of the GLBC instance in the DNS records and health checks it owns
+	DNSOwnerID string
+	// The interval the orphaned DNS records and health checks are deleted at
+	DNSOrphanSweepInterval time.Duration
+	// The time a DNS record or health check must be orphaned for before being deleted
+	DNSOrphanGracePeriod time.Duration
+	// Whether the orphaned DNS records and health checks are only logged
+	DNSOrphanSweepDryRun bool
+	// The interval the endpoints are probed at by the GLBC itself
+	DNSHealthProbeInterval time.Duration
 	// The AWS Route53 region
 	Region string
 	// The port number of the metrics endpoint
 	MonitoringPort int
+	// The port number of the webhook endpoints
+	WebhookPort int
+	// The directory of the TLS certificate and key of the webhook endpoints
+	WebhookCertDir string
 }
 
 func init() {
@@ -88,11 +122,26 @@ func init() {
 	// DNS management options
 	flagSet.StringVar(&options.Domain, "domain", env.GetEnvString("GLBC_DOMAIN", "dev.hcpapps.net"), "The domain to use to expose ingresses")
 	flagSet.BoolVar(&options.EnableCustomHosts, "enable-custom-hosts", env.GetEnvBool("GLBC_ENABLE_CUSTOM_HOSTS", false), "Flag to enable hosts to be custom")
-	flag.StringVar(&options.DNSProvider, "dns-provider", env.GetEnvString("GLBC_DNS_PROVIDER", "fake"), "The DNS provider being used [aws, fake]")
+	flagSet.DurationVar(&options.DomainVerificationInterval, "domain-verification-interval", env.GetEnvDuration("GLBC_DOMAIN_VERIFICATION_INTERVAL", domainverification.DefaultCheckInterval), "The interval the TXT records of the custom domains are checked at, until their ownership is verified")
+	flagSet.DurationVar(&options.DomainVerificationVerifiedInterval, "domain-verification-verified-interval", env.GetEnvDuration("GLBC_DOMAIN_VERIFICATION_VERIFIED_INTERVAL", domainverification.DefaultVerifiedCheckInterval), "The interval the TXT records of the verified custom domains are checked at, for their ownership to remain verified")
+	flagSet.StringVar(&options.DomainVerificationSecret, "domain-verification-secret", env.GetEnvString("GLBC_DOMAIN_VERIFICATION_SECRET", ""), "The secret the domain verification tokens are computed with, required when custom hosts are enabled")
+	flag.StringVar(&options.DNSProvider, "dns-provider", env.GetEnvString("GLBC_DNS_PROVIDER", "fake"), "The DNS provider being used [aws, azure, google, rfc2136, embedded, fake]")
+	flag.StringVar(&options.DNSZonesConfig, "dns-zones-config", env.GetEnvString("GLBC_DNS_ZONES_CONFIG", ""), "The path of the configuration file mapping domains to DNS zones, instead of the DNS zone of the DNS provider")
+	flag.BoolVar(&options.DNSRequireZone, "dns-require-zone", env.GetEnvBool("GLBC_DNS_REQUIRE_ZONE", false), "Whether the GLBC fails to start if the DNS zone of the domain can't be found, or isn't writable, rather than logging a warning")
+	flag.DurationVar(&options.DNSDriftCheckInterval, "dns-drift-check-interval", env.GetEnvDuration("GLBC_DNS_DRIFT_CHECK_INTERVAL", 5*time.Minute), "The interval the published DNS records are checked for changes made outside of the GLBC at (can be set to \"0\" to disable the drift checks)")
+	flag.DurationVar(&options.DNSHealthCheckStatusInterval, "dns-health-check-status-interval", env.GetEnvDuration("GLBC_DNS_HEALTH_CHECK_STATUS_INTERVAL", dns.DefaultHealthCheckStatusInterval), "The interval the health of the health checked endpoints is refreshed at in the DNSRecord status")
+	flag.StringVar(&options.DNSOwnerID, "dns-owner-id", env.GetEnvString("GLBC_DNS_OWNER_ID", "kcp-glbc"), "The identifier of the GLBC instance, set in the ownership records and tags of the DNS records and health checks it creates")
+	flag.DurationVar(&options.DNSOrphanSweepInterval, "dns-orphan-sweep-interval", env.GetEnvDuration("GLBC_DNS_ORPHAN_SWEEP_INTERVAL", 0), "The interval the DNS records and health checks that outlive their DNSRecord are deleted at (disabled by default, or if set to \"0\")")
+	flag.DurationVar(&options.DNSOrphanGracePeriod, "dns-orphan-grace-period", env.GetEnvDuration("GLBC_DNS_ORPHAN_GRACE_PERIOD", time.Hour), "The time a DNS record or health check must be orphaned for before being deleted")
+	flag.BoolVar(&options.DNSOrphanSweepDryRun, "dns-orphan-sweep-dry-run", env.GetEnvBool("GLBC_DNS_ORPHAN_SWEEP_DRY_RUN", false), "Whether the orphaned DNS records and health checks are only logged, rather than deleted")
+	flag.DurationVar(&options.DNSHealthProbeInterval, "dns-health-probe-interval", env.GetEnvDuration("GLBC_DNS_HEALTH_PROBE_INTERVAL", 0), "The interval the endpoints are probed at by the GLBC itself, instead of being health checked by the DNS provider (can be set to \"0\" to use the health checks of the DNS provider)")
 	// // AWS Route53 options
 	flag.StringVar(&options.Region, "region", env.GetEnvString("AWS_REGION", "eu-central-1"), "the region we should target with AWS clients")
 	//  Observability options
 	flagSet.IntVar(&options.MonitoringPort, "monitoring-port", 8080, "The port of the metrics endpoint (can be set to \"0\" to disable the metrics serving)")
+	// Admission webhook options
+	flagSet.IntVar(&options.WebhookPort, "webhook-port", env.GetEnvInt("GLBC_WEBHOOK_PORT", 0), "The port of the DNSRecord validating and defaulting webhooks (can be set to \"0\" to disable the webhooks serving)")
+	flagSet.StringVar(&options.WebhookCertDir, "webhook-cert-dir", env.GetEnvString("GLBC_WEBHOOK_CERT_DIR", "/etc/kcp-glbc/webhook"), "The directory of the tls.crt and tls.key files of the webhooks serving certificate")
 
 	opts := log.Options{
 		EncoderConfigOptions: []log.EncoderConfigOption{
@@ -124,6 +173,19 @@ func main() {
 
 	g.Go(metricsServer.Start)
 
+	// start listening on the webhook endpoints
+	webhookDomains, err := managedDomains()
+	exitOnError(err, "Failed to load the managed domains")
+	aliasLoadBalancers, err := aliasLoadBalancersFunc()
+	exitOnError(err, "Failed to load DNS zones configuration")
+	webhookServer, err := webhook.NewServer(options.WebhookPort, options.WebhookCertDir, &webhook.DNSRecordWebhook{
+		Domains:            webhookDomains,
+		AliasLoadBalancers: aliasLoadBalancers,
+	})
+	exitOnError(err, "Failed to create webhook server")
+
+	g.Go(webhookServer.Start)
+
 	defaultClientConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
 		&clientcmd.ConfigOverrides{}).ClientConfig()
@@ -170,6 +232,11 @@ func main() {
 	kcpKuadrantClient, err = kuadrantv1.NewClusterForConfig(kcpClientConfig)
 	exitOnError(err, "Failed to create KCP kuadrant client")
 
+	// kcp client for the workload clusters of the user compute workspace, whose labels drive the DNS routing policies
+	kcpClient, err := kcp.NewClusterForConfig(kcpClientConfig)
+	exitOnError(err, "Failed to create KCP client")
+	kcpWorkloadInformerFactory := kcpinformer.NewSharedInformerFactory(kcpClient.Cluster(logicalcluster.New(options.ComputeWorkspace)), resyncPeriod)
+
 	// certificate client targeting the glbc workspace
 	certClient := certmanclient.NewForConfigOrDie(defaultClientConfig)
 
@@ -210,6 +277,27 @@ func main() {
 
 	exitOnError(err, "Failed to create TLS certificate controller")
 
+	domainVerificationSecret := []byte(options.DomainVerificationSecret)
+	if len(domainVerificationSecret) == 0 {
+		if options.EnableCustomHosts {
+			exitOnError(fmt.Errorf("domain verification secret not specified"), "Failed to create DomainVerification controller")
+		}
+		// The domains are only verified for the custom hosts, so the tokens
+		// don't need to be the same across restarts
+		domainVerificationSecret = make([]byte, 32)
+		_, err := rand.Read(domainVerificationSecret)
+		exitOnError(err, "Failed to generate domain verification secret")
+	}
+	domainVerificationController, err := domainverification.NewController(&domainverification.ControllerConfig{
+		KuadrantClient:        kcpKuadrantClient,
+		SharedInformerFactory: kcpKuadrantInformerFactory,
+		HostResolver:          net.NewDefaultHostResolver(),
+		CheckInterval:         options.DomainVerificationInterval,
+		VerifiedCheckInterval: options.DomainVerificationVerifiedInterval,
+		TokenSecret:           domainVerificationSecret,
+	})
+	exitOnError(err, "Failed to create DomainVerification controller")
+
 	ingressController := ingress.NewController(&ingress.ControllerConfig{
 		KubeClient:               kcpKubeClient,
 		DnsRecordClient:          kcpKuadrantClient,
@@ -225,13 +313,28 @@ func main() {
 		// 	Name:      "hosts",
 		// 	Namespace: "default",
 		// },
-		CustomHostsEnabled: options.EnableCustomHosts,
+		CustomHostsEnabled:      options.EnableCustomHosts,
+		IsDomainVerified:        domainVerificationController.IsDomainVerified,
+		AliasLoadBalancers:      aliasLoadBalancers,
+		WorkloadClusterInformer: kcpWorkloadInformerFactory,
 	})
 
 	dnsRecordController, err := dns.NewController(&dns.ControllerConfig{
-		DnsRecordClient:       kcpKuadrantClient,
-		SharedInformerFactory: kcpKuadrantInformerFactory,
-		DNSProvider:           options.DNSProvider,
+		DnsRecordClient:           kcpKuadrantClient,
+		SharedInformerFactory:     kcpKuadrantInformerFactory,
+		DNSProvider:               options.DNSProvider,
+		ZonesConfig:               options.DNSZonesConfig,
+		Domain:                    options.Domain,
+		RequireZone:               options.DNSRequireZone,
+		DriftCheckInterval:        options.DNSDriftCheckInterval,
+		HealthCheckStatusInterval: options.DNSHealthCheckStatusInterval,
+		OwnerID:                   options.DNSOwnerID,
+		OrphanSweeper: dns.OrphanSweeperConfig{
+			Interval:    options.DNSOrphanSweepInterval,
+			GracePeriod: options.DNSOrphanGracePeriod,
+			DryRun:      options.DNSOrphanSweepDryRun,
+		},
+		HealthProbeInterval: options.DNSHealthProbeInterval,
 	})
 	exitOnError(err, "Failed to create DNSRecord controller")
 
@@ -253,6 +356,9 @@ func main() {
 	kcpKuadrantInformerFactory.Start(ctx.Done())
 	kcpKuadrantInformerFactory.WaitForCacheSync(ctx.Done())
 
+	kcpWorkloadInformerFactory.Start(ctx.Done())
+	kcpWorkloadInformerFactory.WaitForCacheSync(ctx.Done())
+
 	if options.TLSProviderEnabled {
 		certificateInformerFactory.Start(ctx.Done())
 		certificateInformerFactory.WaitForCacheSync(ctx.Done())
@@ -262,6 +368,7 @@ func main() {
 
 	start(gCtx, ingressController)
 	start(gCtx, dnsRecordController)
+	start(gCtx, domainVerificationController)
 
 	start(gCtx, serviceController)
 	start(gCtx, deploymentController)
@@ -269,12 +376,63 @@ func main() {
 	g.Go(func() error {
 		// wait until the controllers have return before stopping serving metrics
 		controllersGroup.Wait()
+		if err := webhookServer.Shutdown(); err != nil {
+			return err
+		}
 		return metricsServer.Shutdown()
 	})
 
 	exitOnError(g.Wait(), "Exiting due to error")
 }
 
+// managedDomains returns the domains the DNS names of the DNS records must be
+// within, i.e., the GLBC domain, and the domains of the configured DNS zones.
+// The DNS names are not restricted if a zone matches all the DNS names.
+func managedDomains() ([]string, error) {
+	domains := []string{options.Domain}
+	if options.DNSZonesConfig == "" {
+		return domains, nil
+	}
+	registry, err := dnsprovider.LoadZoneRegistry(options.DNSZonesConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range registry.Zones() {
+		if zone.Domain == "" {
+			return nil, nil
+		}
+		domains = append(domains, zone.Domain)
+	}
+	return domains, nil
+}
+
+// aliasLoadBalancersFunc returns a function that returns whether the AWS
+// load-balancer hostnames of a host can be published as Route53 ALIAS records,
+// i.e., whether all the DNS zones of the host are Route53 hosted zones.
+func aliasLoadBalancersFunc() (func(host string) bool, error) {
+	if options.DNSZonesConfig == "" {
+		aws := options.DNSProvider == "aws"
+		return func(string) bool { return aws }, nil
+	}
+	registry, err := dnsprovider.LoadZoneRegistry(options.DNSZonesConfig)
+	if err != nil {
+		return nil, err
+	}
+	return func(host string) bool {
+		zones := registry.ZonesForName(host)
+		for _, zone := range zones {
+			provider := zone.Provider
+			if provider == "" {
+				provider = options.DNSProvider
+			}
+			if provider != "aws" {
+				return false
+			}
+		}
+		return len(zones) > 0
+	}, nil
+}
+
 type Controller interface {
 	Start(context.Context, int)
 }
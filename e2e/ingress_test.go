@@ -124,6 +124,27 @@ func TestIngress(t *testing.T) {
 			})),
 	))
 
+	// Wait until the DNSRecord change is propagated, so that the host is resolvable
+	test.Eventually(DNSRecord(test, namespace, name)).WithTimeout(TestTimeoutMedium).Should(
+		WithTransform(DNSRecordCondition(zoneID, kuadrantv1.DNSRecordPropagatedConditionType), MatchFieldsP(IgnoreExtras,
+			Fields{
+				"Status": Equal("True"),
+				"Reason": Equal("Propagated"),
+			})),
+	)
+
+	// The DNSRecord is then ready, and its readiness is mirrored on the Ingress
+	test.Eventually(DNSRecord(test, namespace, name)).WithTimeout(TestTimeoutMedium).Should(
+		WithTransform(DNSRecordStatusCondition(kuadrantv1.DNSRecordReadyConditionType), MatchFieldsP(IgnoreExtras,
+			Fields{
+				"Status": Equal(metav1.ConditionTrue),
+				"Reason": Equal("Ready"),
+			})),
+	)
+	test.Eventually(Ingress(test, namespace, name)).WithTimeout(TestTimeoutMedium).Should(
+		WithTransform(Annotations, HaveKeyWithValue("kuadrant.dev/dns-record-status", "ready")),
+	)
+
 	// Finally, delete the resources
 	test.Expect(test.Client().Core().Cluster(logicalcluster.From(namespace)).NetworkingV1().Ingresses(namespace.Name).
 		Delete(test.Ctx(), name, metav1.DeleteOptions{})).
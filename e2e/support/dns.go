@@ -20,6 +20,7 @@ import (
 	"github.com/onsi/gomega"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/kcp-dev/logicalcluster"
@@ -60,3 +61,9 @@ func DNSRecordCondition(zoneID, condition string) func(record *kuadrantv1.DNSRec
 		return nil
 	}
 }
+
+func DNSRecordStatusCondition(condition string) func(record *kuadrantv1.DNSRecord) *metav1.Condition {
+	return func(record *kuadrantv1.DNSRecord) *metav1.Condition {
+		return meta.FindStatusCondition(record.Status.Conditions, condition)
+	}
+}
@@ -1,12 +1,18 @@
 package v1
 
 import (
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // +genclient
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Host",type="string",JSONPath=".spec.endpoints[0].dnsName",description="The host name of the record"
+// +kubebuilder:printcolumn:name="Endpoints",type="integer",JSONPath=".status.endpointCount",description="The number of endpoints of the record"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether the record is published and resolvable"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // DNSRecord is a DNS record managed by the HCG.
 type DNSRecord struct {
@@ -79,8 +85,105 @@ type Endpoint struct {
 // DNSRecordSpec contains the details of a DNS record.
 type DNSRecordSpec struct {
 	Endpoints []*Endpoint `json:"endpoints,omitempty"`
+
+	// healthCheck configures the health checks of the endpoints of the record.
+	// The endpoints are not health checked if unset, unless configured with
+	// the deprecated "kuadrant.experimental/health-*" annotations.
+	// +optional
+	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
 }
 
+// HealthCheckSpec configures the health checks of the endpoints of a record.
+// A health check is created for each endpoint with a set identifier, that
+// requests its target with the DNS name of the endpoint as host.
+type HealthCheckSpec struct {
+	// endpoint is the path of the health check requests, e.g., /healthz. It's
+	// ignored by the TCP health checks.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^/`
+	// +kubebuilder:validation:MaxLength=255
+	// +required
+	Endpoint string `json:"endpoint"`
+
+	// port is the port of the health check requests. It defaults to 80, or
+	// 443 for the HTTPS protocol, and is required for the TCP protocol.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int64 `json:"port,omitempty"`
+
+	// protocol is the protocol of the health check requests, HTTP if unset.
+	// The TCP health checks only check that a connection can be established.
+	// +optional
+	Protocol *HealthCheckProtocol `json:"protocol,omitempty"`
+
+	// failureThreshold is the number of consecutive health checks an endpoint
+	// must fail for to be considered unhealthy, 3 if unset.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	FailureThreshold *int64 `json:"failureThreshold,omitempty"`
+
+	// interval is the interval between the health checks of an endpoint. The
+	// DNS providers round it to the intervals they support.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// expectedStatus is the status code of the responses of healthy
+	// endpoints. Any 2xx or 3xx status code is expected if unset. It's
+	// ignored by the Route53 and Azure health checks, and rejected by the
+	// Google health checks.
+	// +kubebuilder:validation:Minimum=100
+	// +kubebuilder:validation:Maximum=599
+	// +optional
+	ExpectedStatus *int64 `json:"expectedStatus,omitempty"`
+
+	// expectedBody is a string the body of the responses of healthy endpoints
+	// must contain.
+	// +kubebuilder:validation:MaxLength=255
+	// +optional
+	ExpectedBody string `json:"expectedBody,omitempty"`
+
+	// inverted is whether the health of the endpoints is inverted, i.e., they
+	// are considered healthy when failing the health checks, and unhealthy
+	// otherwise.
+	// +optional
+	Inverted bool `json:"inverted,omitempty"`
+
+	// enableSNI is whether the HTTPS health checks send the DNS name of the
+	// endpoints in the TLS handshake, so that the endpoints serving several
+	// certificates present the right one. It defaults to true.
+	// +optional
+	EnableSNI *bool `json:"enableSNI,omitempty"`
+
+	// regions are the regions the DNS provider health checks the endpoints
+	// from, all of its regions if unset. It's ignored by the DNS providers
+	// that don't support choosing the regions.
+	// +kubebuilder:validation:MinItems=3
+	// +kubebuilder:validation:MaxItems=64
+	// +optional
+	Regions []string `json:"regions,omitempty"`
+
+	// healthThreshold is the number of endpoints of a DNS name that must be
+	// healthy for the DNS name to be considered healthy. When set, the DNS
+	// providers that support it create a calculated health check for each DNS
+	// name, that aggregates the health checks of its endpoints.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=256
+	// +optional
+	HealthThreshold *int64 `json:"healthThreshold,omitempty"`
+}
+
+// HealthCheckProtocol is the protocol of the health check requests.
+// +kubebuilder:validation:Enum=HTTP;HTTPS;TCP
+type HealthCheckProtocol string
+
+const (
+	HealthCheckProtocolHTTP  HealthCheckProtocol = "HTTP"
+	HealthCheckProtocolHTTPS HealthCheckProtocol = "HTTPS"
+	HealthCheckProtocolTCP   HealthCheckProtocol = "TCP"
+)
+
 // DNSRecordStatus is the most recently observed status of each record.
 type DNSRecordStatus struct {
 	// zones are the status of the record in each zone.
@@ -94,6 +197,20 @@ type DNSRecordStatus struct {
 	// needs to retry the update for that specific zone.
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// conditions are the conditions of the record, aggregated from the status
+	// of the record in each zone.
+	//
+	// The "Published" condition is true once the record is published to all
+	// its zones, the "HealthChecksReady" condition once the health checks of
+	// its endpoints are reconciled, and the "Ready" condition once both are
+	// true, and the record is propagated to all its zones.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// endpointCount is the number of endpoints of the record.
+	// +optional
+	EndpointCount int32 `json:"endpointCount,omitempty"`
 }
 
 // DNSZone is used to define a DNS hosted zone.
@@ -137,11 +254,63 @@ type DNSZoneStatus struct {
 	// Note: This will not be required if/when we switch to using external-dns since when
 	// running with a "sync" policy it will clean up unused records automatically.
 	Endpoints []*Endpoint `json:"endpoints,omitempty"`
+	// changeID is the identifier of the last change of the record in the zone,
+	// while it is being propagated by the provider.
+	// +optional
+	ChangeID string `json:"changeID,omitempty"`
+	// healthChecks are the status of the health checks of the endpoints
+	// published to the zone, as last reported by the DNS provider.
+	// +optional
+	HealthChecks []EndpointHealthCheckStatus `json:"healthChecks,omitempty"`
 }
 
+// EndpointHealthCheckStatus is the status of the health check of an endpoint.
+type EndpointHealthCheckStatus struct {
+	// dnsName is the DNS name of the endpoint.
+	DNSName string `json:"dnsName"`
+	// setIdentifier is the set identifier of the endpoint.
+	// +optional
+	SetIdentifier string `json:"setIdentifier,omitempty"`
+	// state is the health of the endpoint.
+	State HealthCheckState `json:"state"`
+	// message describes why the endpoint is unhealthy, or its health unknown.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// HealthCheckState is the health of an endpoint, as reported by its health
+// check.
+// +kubebuilder:validation:Enum=Healthy;Unhealthy;Unknown
+type HealthCheckState string
+
+const (
+	HealthCheckStateHealthy   HealthCheckState = "Healthy"
+	HealthCheckStateUnhealthy HealthCheckState = "Unhealthy"
+	HealthCheckStateUnknown   HealthCheckState = "Unknown"
+)
+
 var (
 	// Failed means the record is not available within a zone.
 	DNSRecordFailedConditionType = "Failed"
+
+	// Propagated means the last change of the record is propagated to all the
+	// authoritative DNS servers of the zone, and the record is resolvable.
+	DNSRecordPropagatedConditionType = "Propagated"
+
+	// Drifted means the records of the provider were changed outside of the
+	// controller, and differ from the endpoints published to the zone.
+	DNSRecordDriftedConditionType = "Drifted"
+
+	// Ready means the record is published and propagated to all its zones,
+	// and the health checks of its endpoints are reconciled.
+	DNSRecordReadyConditionType = "Ready"
+
+	// Published means the record is published to all its zones.
+	DNSRecordPublishedConditionType = "Published"
+
+	// HealthChecksReady means the health checks of the endpoints of the record
+	// are reconciled with the DNS provider.
+	DNSRecordHealthChecksReadyConditionType = "HealthChecksReady"
 )
 
 // DNSZoneCondition is just the standard condition fields.
@@ -160,7 +329,7 @@ type DNSZoneCondition struct {
 }
 
 // DNSRecordType is a DNS resource record type.
-// +kubebuilder:validation:Enum=CNAME;A
+// +kubebuilder:validation:Enum=CNAME;A;AAAA
 type DNSRecordType string
 
 const (
@@ -169,6 +338,9 @@ const (
 
 	// ARecordType is an RFC 1035 A record.
 	ARecordType DNSRecordType = "A"
+
+	// AAAARecordType is an RFC 3596 AAAA record.
+	AAAARecordType DNSRecordType = "AAAA"
 )
 
 // +kubebuilder:object:root=true
@@ -187,9 +359,9 @@ func (endpoint *Endpoint) SetProviderSpecific(name, value string) {
 		endpoint.ProviderSpecific = ProviderSpecific{}
 	}
 
-	for _, pair := range endpoint.ProviderSpecific {
-		if pair.Name == name {
-			property = &pair
+	for i := range endpoint.ProviderSpecific {
+		if endpoint.ProviderSpecific[i].Name == name {
+			property = &endpoint.ProviderSpecific[i]
 		}
 	}
 
@@ -233,6 +405,9 @@ func (endpoint *Endpoint) DeleteProviderSpecific(name string) bool {
 	return deleted
 }
 
+// GetAddress returns the first target of the endpoint, and whether the endpoint
+// can be health checked, i.e., it has a set identifier and targets. Note the
+// health checks probe all the targets of the endpoint, not only this one.
 func (endpoint *Endpoint) GetAddress() (string, bool) {
 	if endpoint.SetIdentifier == "" || len(endpoint.Targets) == 0 {
 		return "", false
@@ -240,3 +415,100 @@ func (endpoint *Endpoint) GetAddress() (string, bool) {
 
 	return string(endpoint.Targets[0]), true
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Domain",type="string",JSONPath=".spec.domain",description="The domain to verify"
+// +kubebuilder:printcolumn:name="Verified",type="boolean",JSONPath=".status.verified",description="Whether the ownership of the domain is verified"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DomainVerification verifies the ownership of a custom domain, so that the
+// hosts of the domain and its subdomains can be used by the ingresses of the
+// workspace it's created in.
+//
+// The ownership is verified once a TXT record, named after the domain with the
+// DomainVerificationRecordPrefix prefix, resolves to the token of its status.
+type DomainVerification struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// spec is the specification of the domain to verify.
+	Spec DomainVerificationSpec `json:"spec"`
+	// status is the most recently observed status of the verification.
+	Status DomainVerificationStatus `json:"status,omitempty"`
+}
+
+// DomainVerificationRecordPrefix is the prefix of the name of the TXT record
+// the ownership of a domain is verified with.
+const DomainVerificationRecordPrefix = "_kuadrant-verification."
+
+// DomainVerificationSpec contains the details of the domain to verify.
+type DomainVerificationSpec struct {
+	// domain is the custom domain to verify the ownership of. It can't be
+	// changed, another DomainVerification must be created for another domain.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="domain is immutable"
+	Domain string `json:"domain"`
+}
+
+// DomainVerificationStatus is the most recently observed status of the
+// verification of a domain.
+type DomainVerificationStatus struct {
+	// domain is the domain the token is issued for, and the ownership of is
+	// verified. The ownership is verified again if it differs from the domain
+	// of the spec.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// token is the value the TXT record of the domain must resolve to for its
+	// ownership to be verified. It's computed by the controller from the
+	// logical cluster, name and domain of the DomainVerification.
+	// +optional
+	Token string `json:"token,omitempty"`
+
+	// verified is whether the ownership of the domain is verified. Once
+	// verified, the domain is checked periodically, and not verified anymore
+	// if its TXT record is removed.
+	// +optional
+	Verified bool `json:"verified,omitempty"`
+
+	// message describes why the domain is not verified yet.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// lastChecked is the time the TXT record of the domain was last checked.
+	// +optional
+	LastChecked *metav1.Time `json:"lastChecked,omitempty"`
+
+	// nextCheck is the time the TXT record of the domain is checked again.
+	// +optional
+	NextCheck *metav1.Time `json:"nextCheck,omitempty"`
+}
+
+// TXTRecordName returns the name of the TXT record the ownership of the
+// domain is verified with.
+func (v *DomainVerification) TXTRecordName() string {
+	return DomainVerificationRecordPrefix + v.Spec.Domain
+}
+
+// CoversHost returns whether the host is the domain, or one of its
+// subdomains.
+func (v *DomainVerification) CoversHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain := strings.TrimSuffix(strings.ToLower(v.Spec.Domain), ".")
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// +kubebuilder:object:root=true
+
+// DomainVerificationList contains a list of domainverifications.
+type DomainVerificationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DomainVerification `json:"items"`
+}
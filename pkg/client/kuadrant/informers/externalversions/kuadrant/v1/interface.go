@@ -10,6 +10,8 @@ import (
 type Interface interface {
 	// DNSRecords returns a DNSRecordInformer.
 	DNSRecords() DNSRecordInformer
+	// DomainVerifications returns a DomainVerificationInformer.
+	DomainVerifications() DomainVerificationInformer
 }
 
 type version struct {
@@ -27,3 +29,8 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) DNSRecords() DNSRecordInformer {
 	return &dNSRecordInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// DomainVerifications returns a DomainVerificationInformer.
+func (v *version) DomainVerifications() DomainVerificationInformer {
+	return &domainVerificationInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
@@ -0,0 +1,331 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// maxBatchSize is the maximum number of resource records in a change batch,
+	// where UPSERT changes count twice.
+	// https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/DNSLimitations.html#limits-api-requests-changeresourcerecordsets
+	maxBatchSize = 1000
+
+	// defaultRequestsPerSecond is the Route53 API requests quota per account
+	defaultRequestsPerSecond = 5
+	// defaultBatchInterval is the time changes are coalesced for before being sent
+	defaultBatchInterval = 200 * time.Millisecond
+	// changeRequestTTL is the time the result of a change request is kept for,
+	// once applied, if it's not collected
+	changeRequestTTL = time.Hour
+
+	// changeRequestIDPrefix prefixes the IDs of the change requests, that
+	// are pending until they are sent in a change batch
+	changeRequestIDPrefix = "batch/"
+)
+
+// defaultThrottlingBackoff is the backoff used to retry the change batches
+// that are throttled by Route53.
+var defaultThrottlingBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// errUnknownChangeRequest is returned for the change requests that are not
+// known to the batcher, e.g., because they were submitted before a restart.
+var errUnknownChangeRequest = errors.New("unknown change request")
+
+// changeBatcher coalesces the changes of many records into change batches
+// per hosted zone, and sends them to Route53 asynchronously, retrying the
+// throttled batches with backoff. The results of the change requests are
+// kept until they are collected.
+type changeBatcher struct {
+	route53  *InstrumentedRoute53
+	interval time.Duration
+	backoff  wait.Backoff
+	logger   logr.Logger
+
+	mu       sync.Mutex
+	pending  map[string][]*changeRequest
+	running  map[string]bool
+	requests map[string]*changeRequest
+	// idPrefix distinguishes the IDs of the change requests from the IDs
+	// generated before a restart
+	idPrefix string
+	nextID   int
+}
+
+// changeRequest are the changes of a record, that are applied atomically, in
+// the same change batch.
+type changeRequest struct {
+	id      string
+	changes []*route53.Change
+	// done is closed once the result is set
+	done      chan struct{}
+	result    changeResult
+	completed time.Time
+}
+
+type changeResult struct {
+	info *route53.ChangeInfo
+	err  error
+}
+
+func newChangeBatcher(route53 *InstrumentedRoute53, interval time.Duration, logger logr.Logger) *changeBatcher {
+	return &changeBatcher{
+		route53:  route53,
+		interval: interval,
+		backoff:  defaultThrottlingBackoff,
+		logger:   logger.WithName("batch"),
+		pending:  map[string][]*changeRequest{},
+		running:  map[string]bool{},
+		requests: map[string]*changeRequest{},
+		idPrefix: fmt.Sprintf("%s%d-", changeRequestIDPrefix, time.Now().UnixNano()),
+	}
+}
+
+// isChangeRequestID returns whether the ID is the ID of a change request,
+// rather than of a Route53 change.
+func isChangeRequestID(id string) bool {
+	return strings.HasPrefix(id, changeRequestIDPrefix)
+}
+
+// submit queues the changes to the hosted zone, and returns the ID of the
+// change request, without waiting for the batch they are part of to be sent.
+// It returns an empty ID if there are no changes.
+func (b *changeBatcher) submit(zoneID string, changes []*route53.Change) string {
+	if len(changes) == 0 {
+		return ""
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pruneLocked()
+	b.nextID++
+	request := &changeRequest{
+		id:      fmt.Sprintf("%s%d", b.idPrefix, b.nextID),
+		changes: changes,
+		done:    make(chan struct{}),
+	}
+	b.requests[request.id] = request
+	b.pending[zoneID] = append(b.pending[zoneID], request)
+	if !b.running[zoneID] {
+		b.running[zoneID] = true
+		go b.run(zoneID)
+	}
+	return request.id
+}
+
+// wait blocks until the change request is sent, and returns its result.
+func (b *changeBatcher) wait(id string) (*route53.ChangeInfo, error) {
+	b.mu.Lock()
+	request, ok := b.requests[id]
+	b.mu.Unlock()
+	if !ok {
+		return nil, errUnknownChangeRequest
+	}
+	<-request.done
+	b.forget(id)
+	return request.result.info, request.result.err
+}
+
+// result returns whether the change request has been sent, and its result
+// if so. The result is kept until the request is forgotten.
+func (b *changeBatcher) result(id string) (bool, *route53.ChangeInfo, error) {
+	b.mu.Lock()
+	request, ok := b.requests[id]
+	b.mu.Unlock()
+	if !ok {
+		return false, nil, errUnknownChangeRequest
+	}
+	select {
+	case <-request.done:
+		return true, request.result.info, request.result.err
+	default:
+		return false, nil, nil
+	}
+}
+
+// forget discards the result of the change request.
+func (b *changeBatcher) forget(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.requests, id)
+}
+
+// pruneLocked discards the results of the change requests that were sent
+// more than changeRequestTTL ago, e.g., because their record was deleted
+// before they were collected.
+func (b *changeBatcher) pruneLocked() {
+	for id, request := range b.requests {
+		if !request.completed.IsZero() && time.Since(request.completed) > changeRequestTTL {
+			delete(b.requests, id)
+		}
+	}
+}
+
+// run sends the pending changes to the hosted zone, until there are none left.
+func (b *changeBatcher) run(zoneID string) {
+	for {
+		time.Sleep(b.interval)
+
+		b.mu.Lock()
+		requests := b.pending[zoneID]
+		delete(b.pending, zoneID)
+		if len(requests) == 0 {
+			b.running[zoneID] = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+
+		for _, batch := range batchRequests(requests) {
+			b.flush(zoneID, batch)
+		}
+	}
+}
+
+// flush sends the batch of requests, and reports the result to each request.
+// If the batch is rejected, e.g., because one of the records is invalid, the
+// requests are sent individually, so that the error is reported to the
+// requests of the invalid records only.
+func (b *changeBatcher) flush(zoneID string, batch []*changeRequest) {
+	var changes []*route53.Change
+	for _, request := range batch {
+		changes = append(changes, request.changes...)
+	}
+
+	info, err := b.send(zoneID, changes)
+	if err != nil && len(batch) > 1 && !isThrottlingError(err) {
+		b.logger.Info("Change batch rejected, sending changes individually", "zone", zoneID, "records", len(batch), "error", err.Error())
+		for _, request := range batch {
+			info, err := b.send(zoneID, request.changes)
+			b.complete(request, changeResult{info: info, err: err})
+		}
+		return
+	}
+
+	for _, request := range batch {
+		b.complete(request, changeResult{info: info, err: err})
+	}
+}
+
+// complete sets the result of the change request.
+func (b *changeBatcher) complete(request *changeRequest, result changeResult) {
+	b.mu.Lock()
+	request.result = result
+	request.completed = time.Now()
+	b.mu.Unlock()
+	close(request.done)
+}
+
+// send applies the changes to the hosted zone, and retries with backoff when
+// throttled.
+func (b *changeBatcher) send(zoneID string, changes []*route53.Change) (*route53.ChangeInfo, error) {
+	var info *route53.ChangeInfo
+	var err error
+	backoffErr := wait.ExponentialBackoff(b.backoff, func() (bool, error) {
+		var output *route53.ChangeResourceRecordSetsOutput
+		output, err = b.route53.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+		})
+		if err == nil {
+			info = output.ChangeInfo
+			return true, nil
+		}
+		if isThrottlingError(err) {
+			b.logger.V(3).Info("Change batch throttled, retrying", "zone", zoneID, "error", err.Error())
+			return false, nil
+		}
+		return false, err
+	})
+	if backoffErr == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("change batch throttled: %v", err)
+	}
+	if backoffErr != nil {
+		return nil, backoffErr
+	}
+	return info, nil
+}
+
+// batchRequests packs the requests into batches that don't exceed the size
+// limit, and where each resource record set is only changed once.
+func batchRequests(requests []*changeRequest) [][]*changeRequest {
+	var batches [][]*changeRequest
+	var batch []*changeRequest
+	size := 0
+	recordSets := map[string]bool{}
+
+	for _, request := range requests {
+		requestSize := 0
+		conflict := false
+		for _, change := range request.changes {
+			requestSize += changeSize(change)
+			if recordSets[recordSetKey(change.ResourceRecordSet)] {
+				conflict = true
+			}
+		}
+
+		if len(batch) > 0 && (conflict || size+requestSize > maxBatchSize) {
+			batches = append(batches, batch)
+			batch = nil
+			size = 0
+			recordSets = map[string]bool{}
+		}
+
+		batch = append(batch, request)
+		size += requestSize
+		for _, change := range request.changes {
+			recordSets[recordSetKey(change.ResourceRecordSet)] = true
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// changeSize returns the number of resource records of the change, counting
+// twice for UPSERT changes, as Route53 does for the change batch limits.
+func changeSize(change *route53.Change) int {
+	size := len(change.ResourceRecordSet.ResourceRecords)
+	if size == 0 {
+		// ALIAS records
+		size = 1
+	}
+	if aws.StringValue(change.Action) == route53.ChangeActionUpsert {
+		size *= 2
+	}
+	return size
+}
+
+func recordSetKey(recordSet *route53.ResourceRecordSet) string {
+	return aws.StringValue(recordSet.Name) + "/" + aws.StringValue(recordSet.Type) + "/" + aws.StringValue(recordSet.SetIdentifier)
+}
+
+func isThrottlingError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch awsErr.Code() {
+	case "Throttling", "ThrottlingException", route53.ErrCodePriorRequestNotComplete:
+		return true
+	}
+	return false
+}
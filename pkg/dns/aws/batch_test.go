@@ -0,0 +1,201 @@
+package aws
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+)
+
+func testChange(action, name string, records int) *route53.Change {
+	recordSet := &route53.ResourceRecordSet{
+		Name: aws.String(name),
+		Type: aws.String(route53.RRTypeA),
+		TTL:  aws.Int64(60),
+	}
+	for i := 0; i < records; i++ {
+		recordSet.ResourceRecords = append(recordSet.ResourceRecords, &route53.ResourceRecord{Value: aws.String(fmt.Sprintf("10.0.%d.%d", i/256, i%256))})
+	}
+	return &route53.Change{Action: aws.String(action), ResourceRecordSet: recordSet}
+}
+
+func testRequest(changes ...*route53.Change) *changeRequest {
+	return &changeRequest{changes: changes}
+}
+
+func TestBatchRequests(t *testing.T) {
+	r1 := testRequest(testChange(route53.ChangeActionCreate, "a.example.com", 400))
+	r2 := testRequest(testChange(route53.ChangeActionCreate, "b.example.com", 400))
+	r3 := testRequest(testChange(route53.ChangeActionCreate, "c.example.com", 400))
+	r4 := testRequest(testChange(route53.ChangeActionUpsert, "d.example.com", 300), testChange(route53.ChangeActionDelete, "e.example.com", 1))
+	r5 := testRequest(testChange(route53.ChangeActionUpsert, "a.example.com", 1))
+	r6 := testRequest(testChange(route53.ChangeActionUpsert, "f.example.com", 600))
+
+	cases := []struct {
+		name     string
+		requests []*changeRequest
+		expected [][]*changeRequest
+	}{
+		{
+			name:     "within the size limit",
+			requests: []*changeRequest{r1, r2},
+			expected: [][]*changeRequest{{r1, r2}},
+		},
+		{
+			name:     "exceeding the size limit",
+			requests: []*changeRequest{r1, r2, r3},
+			expected: [][]*changeRequest{{r1, r2}, {r3}},
+		},
+		{
+			name:     "upsert changes count twice",
+			requests: []*changeRequest{r4, r1},
+			expected: [][]*changeRequest{{r4}, {r1}},
+		},
+		{
+			name:     "record set changed by several requests",
+			requests: []*changeRequest{r1, r5, r2},
+			expected: [][]*changeRequest{{r1}, {r5, r2}},
+		},
+		{
+			name:     "request exceeding the size limit",
+			requests: []*changeRequest{r6},
+			expected: [][]*changeRequest{{r6}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			g.Expect(batchRequests(tc.requests)).To(gomega.Equal(tc.expected))
+		})
+	}
+}
+
+// submitAll submits the changes of the records, and waits for their results.
+func submitAll(p *Provider, names ...string) []error {
+	var ids []string
+	for _, name := range names {
+		ids = append(ids, p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, name, 1)}))
+	}
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		_, errs[i] = p.batcher.wait(id)
+	}
+	return errs
+}
+
+func TestChangeBatcherSubmit(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{writable: true}
+	p := newTestProvider(t, fake)
+	p.batcher.interval = 100 * time.Millisecond
+
+	var names []string
+	for i := 0; i < 20; i++ {
+		names = append(names, fmt.Sprintf("app%d.example.com", i))
+	}
+	for _, err := range submitAll(p, names...) {
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+	g.Expect(fake.batches).To(gomega.HaveLen(1))
+	g.Expect(fake.batches[0]).To(gomega.ConsistOf(names))
+	g.Expect(p.batcher.requests).To(gomega.BeEmpty())
+
+	g.Expect(p.batcher.submit("ZEXAMPLE", nil)).To(gomega.BeEmpty())
+	g.Expect(fake.batches).To(gomega.HaveLen(1))
+}
+
+func TestChangeBatcherResult(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{writable: true}
+	p := newTestProvider(t, fake)
+	p.batcher.interval = 100 * time.Millisecond
+
+	id := p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, "app.example.com", 1)})
+	sent, _, err := p.batcher.result(id)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(sent).To(gomega.BeFalse())
+
+	g.Eventually(func() bool {
+		sent, _, _ := p.batcher.result(id)
+		return sent
+	}).Should(gomega.BeTrue())
+	_, info, err := p.batcher.result(id)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(aws.StringValue(info.Id)).To(gomega.Equal("/change/C1"))
+
+	p.batcher.forget(id)
+	_, _, err = p.batcher.result(id)
+	g.Expect(err).To(gomega.Equal(errUnknownChangeRequest))
+
+	// The results that are not collected are pruned
+	id = p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, "app.example.com", 1)})
+	_, err = p.batcher.wait(id)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	id = p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, "app.example.com", 1)})
+	g.Eventually(func() bool {
+		sent, _, _ := p.batcher.result(id)
+		return sent
+	}).Should(gomega.BeTrue())
+	p.batcher.mu.Lock()
+	p.batcher.requests[id].completed = time.Now().Add(-2 * changeRequestTTL)
+	p.batcher.mu.Unlock()
+	p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, "app.example.com", 1)})
+	_, _, err = p.batcher.result(id)
+	g.Expect(err).To(gomega.Equal(errUnknownChangeRequest))
+}
+
+func TestChangeBatcherRejectedBatch(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{writable: true}
+	p := newTestProvider(t, fake)
+	p.batcher.interval = 100 * time.Millisecond
+
+	errs := submitAll(p, "app1.example.com", "invalid.example.com", "app2.example.com")
+	g.Expect(errs[0]).NotTo(gomega.HaveOccurred())
+	g.Expect(errs[1]).To(gomega.HaveOccurred())
+	g.Expect(errs[2]).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.batches).To(gomega.ConsistOf([]string{"app1.example.com"}, []string{"app2.example.com"}))
+}
+
+func TestChangeBatcherThrottling(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{writable: true, throttle: 2}
+	p := newTestProvider(t, fake)
+
+	info, err := p.batcher.wait(p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, "app.example.com", 1)}))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(aws.StringValue(info.Id)).To(gomega.Equal("/change/C1"))
+	g.Expect(fake.batches).To(gomega.HaveLen(1))
+
+	fake.throttle = 10
+	_, err = p.batcher.wait(p.batcher.submit("ZEXAMPLE", []*route53.Change{testChange(route53.ChangeActionUpsert, "app.example.com", 1)}))
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(fake.batches).To(gomega.HaveLen(1))
+}
+
+func TestInstrumentedRoute53Limiter(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{writable: true}
+	p := newTestProvider(t, fake)
+	p.route53.limiter = rate.NewLimiter(rate.Limit(20), 1)
+
+	// All the requests share the limiter
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := p.listRecordSets("app.example.com", "ZEXAMPLE")
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = p.route53.ListHostedZones(&route53.ListHostedZonesInput{})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+	g.Expect(time.Since(start)).To(gomega.BeNumerically(">=", 250*time.Millisecond))
+}
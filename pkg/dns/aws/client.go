@@ -15,17 +15,40 @@ limitations under the License.
 package aws
 
 import (
+	"context"
 	"strconv"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/route53"
 )
 
+// InstrumentedRoute53 records the metrics of the Route53 API requests, and
+// sends them at the rate allowed by the limiter, shared by all the requests
+// of the provider, so that they don't exceed the Route53 API quota.
 type InstrumentedRoute53 struct {
 	route53 *route53.Route53
+	limiter *rate.Limiter
+}
+
+func newInstrumentedRoute53(client *route53.Route53, requestsPerSecond float64) *InstrumentedRoute53 {
+	return &InstrumentedRoute53{
+		route53: client,
+		limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), 1),
+	}
+}
+
+// wait blocks until the limiter allows a request to be sent, or the context
+// is done. Requests are not limited if there is no limiter.
+func (c *InstrumentedRoute53) wait(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	return c.limiter.Wait(ctx)
 }
 
 func observe(operation string, f func() error) {
@@ -52,6 +75,9 @@ func observe(operation string, f func() error) {
 }
 
 func (c *InstrumentedRoute53) ListHostedZones(input *route53.ListHostedZonesInput) (output *route53.ListHostedZonesOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
 	observe("ListHostedZones", func() error {
 		output, err = c.route53.ListHostedZones(input)
 		return err
@@ -59,7 +85,54 @@ func (c *InstrumentedRoute53) ListHostedZones(input *route53.ListHostedZonesInpu
 	return
 }
 
+func (c *InstrumentedRoute53) ListHostedZonesByName(input *route53.ListHostedZonesByNameInput) (output *route53.ListHostedZonesByNameOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
+	observe("ListHostedZonesByName", func() error {
+		output, err = c.route53.ListHostedZonesByName(input)
+		return err
+	})
+	return
+}
+
+func (c *InstrumentedRoute53) GetHostedZone(input *route53.GetHostedZoneInput) (output *route53.GetHostedZoneOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
+	observe("GetHostedZone", func() error {
+		output, err = c.route53.GetHostedZone(input)
+		return err
+	})
+	return
+}
+
+func (c *InstrumentedRoute53) GetChange(input *route53.GetChangeInput) (output *route53.GetChangeOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
+	observe("GetChange", func() error {
+		output, err = c.route53.GetChange(input)
+		return err
+	})
+	return
+}
+
+func (c *InstrumentedRoute53) ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (output *route53.ListResourceRecordSetsOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
+	observe("ListResourceRecordSets", func() error {
+		output, err = c.route53.ListResourceRecordSets(input)
+		return err
+	})
+	return
+}
+
 func (c *InstrumentedRoute53) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (output *route53.ChangeResourceRecordSetsOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
 	observe("ChangeResourceRecordSets", func() error {
 		output, err = c.route53.ChangeResourceRecordSets(input)
 		return err
@@ -68,6 +141,9 @@ func (c *InstrumentedRoute53) ChangeResourceRecordSets(input *route53.ChangeReso
 }
 
 func (c *InstrumentedRoute53) CreateHealthCheck(input *route53.CreateHealthCheckInput) (output *route53.CreateHealthCheckOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
 	observe("CreateHealthCheck", func() error {
 		output, err = c.route53.CreateHealthCheck(input)
 		return err
@@ -76,6 +152,9 @@ func (c *InstrumentedRoute53) CreateHealthCheck(input *route53.CreateHealthCheck
 }
 
 func (c *InstrumentedRoute53) GetHealthCheckWithContext(ctx aws.Context, input *route53.GetHealthCheckInput, opts ...request.Option) (output *route53.GetHealthCheckOutput, err error) {
+	if err = c.wait(ctx); err != nil {
+		return
+	}
 	observe("GetHealthCheckWithContext", func() error {
 		output, err = c.route53.GetHealthCheckWithContext(ctx, input, opts...)
 		return err
@@ -83,7 +162,21 @@ func (c *InstrumentedRoute53) GetHealthCheckWithContext(ctx aws.Context, input *
 	return
 }
 
+func (c *InstrumentedRoute53) GetHealthCheckStatusWithContext(ctx aws.Context, input *route53.GetHealthCheckStatusInput, opts ...request.Option) (output *route53.GetHealthCheckStatusOutput, err error) {
+	if err = c.wait(ctx); err != nil {
+		return
+	}
+	observe("GetHealthCheckStatusWithContext", func() error {
+		output, err = c.route53.GetHealthCheckStatusWithContext(ctx, input, opts...)
+		return err
+	})
+	return
+}
+
 func (c *InstrumentedRoute53) UpdateHealthCheckWithContext(ctx aws.Context, input *route53.UpdateHealthCheckInput, opts ...request.Option) (output *route53.UpdateHealthCheckOutput, err error) {
+	if err = c.wait(ctx); err != nil {
+		return
+	}
 	observe("UpdateHealthCheckWithContext", func() error {
 		output, err = c.route53.UpdateHealthCheckWithContext(ctx, input, opts...)
 		return err
@@ -92,6 +185,9 @@ func (c *InstrumentedRoute53) UpdateHealthCheckWithContext(ctx aws.Context, inpu
 }
 
 func (c *InstrumentedRoute53) DeleteHealthCheckWithContext(ctx aws.Context, input *route53.DeleteHealthCheckInput, opts ...request.Option) (output *route53.DeleteHealthCheckOutput, err error) {
+	if err = c.wait(ctx); err != nil {
+		return
+	}
 	observe("DeleteHealthCheckWithContext", func() error {
 		output, err = c.route53.DeleteHealthCheckWithContext(ctx, input, opts...)
 		return err
@@ -100,9 +196,34 @@ func (c *InstrumentedRoute53) DeleteHealthCheckWithContext(ctx aws.Context, inpu
 }
 
 func (c *InstrumentedRoute53) ChangeTagsForResourceWithContext(ctx aws.Context, input *route53.ChangeTagsForResourceInput, opts ...request.Option) (output *route53.ChangeTagsForResourceOutput, err error) {
+	if err = c.wait(ctx); err != nil {
+		return
+	}
 	observe("ChangeTagsForResourceWithContext", func() error {
 		output, err = c.route53.ChangeTagsForResourceWithContext(ctx, input, opts...)
 		return err
 	})
 	return
 }
+
+func (c *InstrumentedRoute53) ListHealthChecks(input *route53.ListHealthChecksInput) (output *route53.ListHealthChecksOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
+	observe("ListHealthChecks", func() error {
+		output, err = c.route53.ListHealthChecks(input)
+		return err
+	})
+	return
+}
+
+func (c *InstrumentedRoute53) ListTagsForResources(input *route53.ListTagsForResourcesInput) (output *route53.ListTagsForResourcesOutput, err error) {
+	if err = c.wait(context.Background()); err != nil {
+		return
+	}
+	observe("ListTagsForResources", func() error {
+		output, err = c.route53.ListTagsForResources(input)
+		return err
+	})
+	return
+}
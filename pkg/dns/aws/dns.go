@@ -2,11 +2,14 @@ package aws
 
 import (
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
@@ -28,6 +31,21 @@ const (
 	ProviderSpecificFailover             = "aws/failover"
 	ProviderSpecificMultiValueAnswer     = "aws/multi-value-answer"
 	ProviderSpecificHealthCheckID        = "aws/health-check-id"
+	// ProviderSpecificCalculatedHealthCheckID is the ID of the calculated health
+	// check aggregating the health checks of the endpoints of a DNS name
+	ProviderSpecificCalculatedHealthCheckID = "aws/calculated-health-check-id"
+	// ProviderSpecificTargetHealthCheckIDs are the comma-separated <target>=<ID>
+	// pairs of the health checks of the addresses of an endpoint with several
+	// addresses, aggregated by the health check of the endpoint
+	ProviderSpecificTargetHealthCheckIDs = "aws/target-health-check-ids"
+	// ProviderSpecificReplacedHealthCheckIDs are the comma-separated IDs of
+	// the health checks replaced by the health check of an endpoint, that are
+	// deleted once the records don't use them anymore
+	ProviderSpecificReplacedHealthCheckIDs = "aws/replaced-health-check-ids"
+
+	ProviderSpecificGeolocationContinentCode   = "aws/geolocation-continent-code"
+	ProviderSpecificGeolocationCountryCode     = "aws/geolocation-country-code"
+	ProviderSpecificGeolocationSubdivisionCode = "aws/geolocation-subdivision-code"
 )
 
 var _ dns.Provider = &Provider{}
@@ -38,12 +56,27 @@ type Provider struct {
 	healthCheckReconciler *Route53HealthCheckReconciler
 	config                Config
 	logger                logr.Logger
+	// hostedZoneID is the ID of the configured, or discovered, hosted zone
+	hostedZoneID string
+	// batcher coalesces the changes of the records into change batches
+	batcher *changeBatcher
 }
 
 // Config is the necessary input to configure the manager.
 type Config struct {
 	// Region is the AWS region ELBs are created in.
 	Region string
+	// ZoneID is the ID of the hosted zone the records are published to.
+	ZoneID string
+	// Domain is the domain whose authoritative public hosted zone is discovered,
+	// when ZoneID is empty.
+	Domain string
+	// RequireZone is whether the provider fails to be created if the hosted zone
+	// can't be discovered, or doesn't exist, rather than publishing no records.
+	RequireZone bool
+	// OwnerID identifies the GLBC instance in the ownership records and tags of
+	// the resources it creates. No ownership records are published if empty.
+	OwnerID string
 }
 
 func NewProvider(config Config) (*Provider, error) {
@@ -80,16 +113,79 @@ func NewProvider(config Config) (*Provider, error) {
 	}
 
 	p := &Provider{
-		route53: &InstrumentedRoute53{route53.New(sess, r53Config)},
+		route53: newInstrumentedRoute53(route53.New(sess, r53Config), defaultRequestsPerSecond),
 		config:  config,
 		logger:  log.Logger.WithName("aws-route53").WithValues("region", r53Config.Region),
 	}
+	p.batcher = newChangeBatcher(p.route53, defaultBatchInterval, p.logger)
+	p.hostedZoneID = config.ZoneID
+	if p.hostedZoneID == "" && config.Domain != "" {
+		p.hostedZoneID, err = p.discoverHostedZone(config.Domain)
+		switch {
+		case err != nil && config.RequireZone:
+			return nil, fmt.Errorf("failed to discover AWS hosted zone of domain %s: %v", config.Domain, err)
+		case err != nil:
+			p.logger.Error(err, "Failed to discover hosted zone, no DNS records will be created!", "domain", config.Domain)
+		default:
+			p.logger.Info("Discovered hosted zone", "domain", config.Domain, "zone", p.hostedZoneID)
+		}
+	}
 	if err := validateServiceEndpoints(p); err != nil {
 		return nil, fmt.Errorf("failed to validate AWS provider service endpoints: %v", err)
 	}
+	if p.hostedZoneID != "" {
+		if err := validateHostedZone(p, p.hostedZoneID); err != nil {
+			if config.RequireZone {
+				return nil, fmt.Errorf("failed to validate AWS hosted zone: %v", err)
+			}
+			p.logger.Error(err, "Invalid hosted zone, DNS records may fail to be created!", "zone", p.hostedZoneID)
+		}
+	}
 	return p, nil
 }
 
+// HostedZoneID returns the ID of the configured hosted zone, or of the hosted
+// zone discovered for the domain, or an empty string otherwise.
+func (p *Provider) HostedZoneID() string {
+	return p.hostedZoneID
+}
+
+// discoverHostedZone returns the ID of the public hosted zone that is
+// authoritative for the domain, i.e., the hosted zone of the domain, or of its
+// closest parent domain.
+func (p *Provider) discoverHostedZone(domain string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(domain, "."))
+	for strings.Contains(name, ".") {
+		output, err := p.route53.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
+			DNSName:  aws.String(name),
+			MaxItems: aws.String("100"),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list route53 hosted zones by name: %v", err)
+		}
+
+		var ids []string
+		for _, zone := range output.HostedZones {
+			if strings.ToLower(strings.TrimSuffix(aws.StringValue(zone.Name), ".")) != name {
+				continue
+			}
+			if zone.Config != nil && aws.BoolValue(zone.Config.PrivateZone) {
+				continue
+			}
+			ids = append(ids, strings.TrimPrefix(aws.StringValue(zone.Id), "/hostedzone/"))
+		}
+		switch {
+		case len(ids) == 1:
+			return ids[0], nil
+		case len(ids) > 1:
+			return "", fmt.Errorf("multiple public hosted zones %s found for %s, the hosted zone must be set explicitly", strings.Join(ids, ", "), name)
+		}
+
+		name = name[strings.Index(name, ".")+1:]
+	}
+	return "", fmt.Errorf("no public hosted zone found")
+}
+
 // validateServiceEndpoints validates that provider clients can communicate with
 // associated API endpoints by having each client make a list/describe/get call.
 func validateServiceEndpoints(provider *Provider) error {
@@ -101,6 +197,37 @@ func validateServiceEndpoints(provider *Provider) error {
 	return kerrors.NewAggregate(errs)
 }
 
+// validateHostedZone validates that the hosted zone exists, and that records
+// can be changed in it. The latter is checked by deleting a record that doesn't
+// exist, which fails with an InvalidChangeBatch error when permitted, without
+// changing the zone.
+func validateHostedZone(provider *Provider, zoneID string) error {
+	output, err := provider.route53.GetHostedZone(&route53.GetHostedZoneInput{Id: aws.String(zoneID)})
+	if err != nil {
+		return fmt.Errorf("failed to get route53 hosted zone %s: %v", zoneID, err)
+	}
+
+	_, err = provider.route53.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String("GLBC hosted zone permissions check"),
+			Changes: []*route53.Change{{
+				Action: aws.String(string(deleteAction)),
+				ResourceRecordSet: &route53.ResourceRecordSet{
+					Name:            aws.String("_glbc-permissions-check." + aws.StringValue(output.HostedZone.Name)),
+					Type:            aws.String(route53.RRTypeTxt),
+					TTL:             aws.Int64(60),
+					ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"glbc"`)}},
+				},
+			}},
+		},
+	})
+	if awsErr, ok := err.(awserr.Error); err != nil && (!ok || awsErr.Code() != route53.ErrCodeInvalidChangeBatch) {
+		return fmt.Errorf("route53 hosted zone %s is not writable: %v", zoneID, err)
+	}
+	return nil
+}
+
 type action string
 
 const (
@@ -109,27 +236,163 @@ const (
 )
 
 func (p *Provider) Ensure(record *v1.DNSRecord, zone v1.DNSZone) error {
+	return p.changeAndWait(record, zone, upsertAction)
+}
+
+// EnsureChange will create or update record, and return the ID of the change,
+// that is pending until it is sent in a change batch, and then propagated to
+// all the Route53 DNS servers.
+func (p *Provider) EnsureChange(record *v1.DNSRecord, zone v1.DNSZone) (string, error) {
 	return p.change(record, zone, upsertAction)
 }
 
+// Delete will delete record, and wait until the change is applied, so that
+// the record isn't finalized before its records are deleted.
 func (p *Provider) Delete(record *v1.DNSRecord, zone v1.DNSZone) error {
-	return p.change(record, zone, deleteAction)
+	return p.changeAndWait(record, zone, deleteAction)
+}
+
+// ChangePropagated returns whether the change has been sent in a change batch,
+// and the status of the Route53 change is INSYNC. It returns a
+// dns.ChangeFailedError if the change batch was rejected, or the change is
+// unknown, e.g., because it was submitted before a restart.
+func (p *Provider) ChangePropagated(changeID string) (bool, error) {
+	if !isChangeRequestID(changeID) {
+		return p.changeInSync(changeID)
+	}
+
+	sent, info, err := p.batcher.result(changeID)
+	switch {
+	case err != nil:
+		p.batcher.forget(changeID)
+		return false, &dns.ChangeFailedError{ChangeID: changeID, Err: err}
+	case !sent:
+		return false, nil
+	case info == nil:
+		p.batcher.forget(changeID)
+		return true, nil
+	}
+
+	propagated, err := p.changeInSync(aws.StringValue(info.Id))
+	if propagated {
+		p.batcher.forget(changeID)
+	}
+	return propagated, err
+}
+
+// changeInSync returns whether the status of the Route53 change is INSYNC.
+func (p *Provider) changeInSync(changeID string) (bool, error) {
+	output, err := p.route53.GetChange(&route53.GetChangeInput{Id: aws.String(changeID)})
+	if err != nil {
+		return false, fmt.Errorf("failed to get change %s: %v", changeID, err)
+	}
+	return aws.StringValue(output.ChangeInfo.Status) == route53.ChangeStatusInsync, nil
+}
+
+// Records returns the endpoints of the resource record sets with the DNS name
+// in the hosted zone.
+func (p *Provider) Records(dnsName string, zone v1.DNSZone) ([]*v1.Endpoint, error) {
+	recordSets, err := p.listRecordSets(dnsName, zone.ID)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []*v1.Endpoint
+	for _, recordSet := range recordSets {
+		endpoints = append(endpoints, endpointForRecordSet(recordSet))
+	}
+	return endpoints, nil
+}
+
+// listRecordSets returns the resource record sets with the DNS name in the
+// hosted zone.
+func (p *Provider) listRecordSets(dnsName, zoneID string) ([]*route53.ResourceRecordSet, error) {
+	name := normalizeRecordName(dnsName)
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(name),
+	}
+	var recordSets []*route53.ResourceRecordSet
+	for {
+		output, err := p.route53.ListResourceRecordSets(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list records %s in zone %s: %v", dnsName, zoneID, err)
+		}
+		for _, recordSet := range output.ResourceRecordSets {
+			// The record sets are listed in the order of their name
+			if normalizeRecordName(aws.StringValue(recordSet.Name)) != name {
+				return recordSets, nil
+			}
+			recordSets = append(recordSets, recordSet)
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return recordSets, nil
+		}
+		input.StartRecordName = output.NextRecordName
+		input.StartRecordType = output.NextRecordType
+		input.StartRecordIdentifier = output.NextRecordIdentifier
+	}
+}
+
+// endpointForRecordSet returns the endpoint of the resource record set, with
+// the ALIAS target as single target.
+func endpointForRecordSet(recordSet *route53.ResourceRecordSet) *v1.Endpoint {
+	endpoint := &v1.Endpoint{
+		DNSName:       strings.TrimSuffix(unescapeRecordName(aws.StringValue(recordSet.Name)), "."),
+		RecordType:    aws.StringValue(recordSet.Type),
+		SetIdentifier: aws.StringValue(recordSet.SetIdentifier),
+		RecordTTL:     v1.TTL(aws.Int64Value(recordSet.TTL)),
+	}
+	if recordSet.AliasTarget != nil {
+		// Route53 prefixes the ALIAS targets of load balancers with dualstack
+		target := strings.TrimSuffix(aws.StringValue(recordSet.AliasTarget.DNSName), ".")
+		endpoint.Targets = v1.Targets{strings.TrimPrefix(target, "dualstack.")}
+		return endpoint
+	}
+	for _, record := range recordSet.ResourceRecords {
+		endpoint.Targets = append(endpoint.Targets, aws.StringValue(record.Value))
+	}
+	return endpoint
+}
+
+func normalizeRecordName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(unescapeRecordName(name), ".")) + "."
+}
+
+// unescapeRecordName replaces the octal code of the wildcard character, that
+// Route53 returns in the names of the wildcard records.
+func unescapeRecordName(name string) string {
+	return strings.Replace(name, `\052`, "*", 1)
 }
 
 func (p *Provider) HealthCheckReconciler() dns.HealthCheckReconciler {
 	if p.healthCheckReconciler == nil {
-		p.healthCheckReconciler = newRoute53HealthCheckReconciler(p.route53, p.logger)
+		p.healthCheckReconciler = newRoute53HealthCheckReconciler(p.route53, p.config.OwnerID, p.logger)
 	}
 
 	return p.healthCheckReconciler
 }
 
-// change will perform an action on a record.
-func (p *Provider) change(record *v1.DNSRecord, zone v1.DNSZone, action action) error {
+// change will submit an action on a record, and return the ID of the change
+// request.
+func (p *Provider) change(record *v1.DNSRecord, zone v1.DNSZone, action action) (string, error) {
 	// Configure records.
-	err := p.updateRecord(record, zone.ID, string(action))
+	changeID, err := p.updateRecord(record, zone.ID, string(action))
 	if err != nil {
-		return fmt.Errorf("failed to update record in zone %s: %v", zone.ID, err)
+		return "", fmt.Errorf("failed to update record in zone %s: %w", zone.ID, err)
+	}
+	p.logger.Info("Submitted DNS record change", "record", record.Spec, "zone", zone, "action", action, "change", changeID)
+	return changeID, nil
+}
+
+// changeAndWait will perform an action on a record, and wait until the change
+// batch it is part of is applied.
+func (p *Provider) changeAndWait(record *v1.DNSRecord, zone v1.DNSZone, action action) error {
+	changeID, err := p.change(record, zone, action)
+	if err != nil || changeID == "" {
+		return err
+	}
+	if _, err := p.batcher.wait(changeID); err != nil {
+		return fmt.Errorf("couldn't update DNS record %s in zone %s: %v", record.Name, zone.ID, err)
 	}
 	switch action {
 	case upsertAction:
@@ -140,16 +403,14 @@ func (p *Provider) change(record *v1.DNSRecord, zone v1.DNSZone, action action)
 	return nil
 }
 
-func (p *Provider) updateRecord(record *v1.DNSRecord, zoneID, action string) error {
-	input := route53.ChangeResourceRecordSetsInput{HostedZoneId: aws.String(zoneID)}
-
+func (p *Provider) updateRecord(record *v1.DNSRecord, zoneID, action string) (string, error) {
 	expectedEndpointsMap := make(map[string]struct{})
 	var changes []*route53.Change
 	for _, endpoint := range record.Spec.Endpoints {
 		expectedEndpointsMap[endpoint.SetID()] = struct{}{}
-		change, err := p.changeForEndpoint(endpoint, action)
+		change, err := p.changeForEndpoint(endpoint, zoneID, action)
 		if err != nil {
-			return err
+			return "", err
 		}
 		changes = append(changes, change)
 	}
@@ -158,32 +419,58 @@ func (p *Provider) updateRecord(record *v1.DNSRecord, zoneID, action string) err
 	if action != string(deleteAction) {
 		lastPublishedEndpoints, err := p.endpointsFromZoneStatus(record, zoneID)
 		if err != nil {
-			return err
+			return "", err
 		}
 		for _, endpoint := range lastPublishedEndpoints {
 			if _, found := expectedEndpointsMap[endpoint.SetID()]; !found {
-				change, err := p.changeForEndpoint(endpoint, string(deleteAction))
+				change, err := p.changeForEndpoint(endpoint, zoneID, string(deleteAction))
 				if err != nil {
-					return err
+					return "", err
 				}
 				changes = append(changes, change)
 			}
 		}
 	}
 
-	input.ChangeBatch = &route53.ChangeBatch{
-		Changes: changes,
-	}
-	resp, err := p.route53.ChangeResourceRecordSets(&input)
-	if err != nil {
-		return fmt.Errorf("couldn't update DNS record %s in zone %s: %v", record.Name, zoneID, err)
+	if p.config.OwnerID != "" {
+		// The records of the names that are not owned by the record are never changed
+		// The record sets of each name are only listed once
+		recordSets := p.newRecordSetsCache(zoneID)
+		foreignNames, err := p.foreignNames(record, recordSets)
+		if err != nil {
+			return "", err
+		}
+		if action != string(deleteAction) {
+			var conflicts []string
+			for _, name := range dnsNames(record.Spec.Endpoints) {
+				if containsDNSName(foreignNames, name) {
+					conflicts = append(conflicts, name)
+				}
+			}
+			if len(conflicts) > 0 {
+				return "", &dns.OwnershipConflictError{Names: conflicts}
+			}
+		}
+		changes = withoutNames(changes, foreignNames)
+
+		// The ownership records are changed atomically with the records they own
+		ownershipChanges, err := p.ownershipChanges(record, recordSets, action)
+		if err != nil {
+			return "", err
+		}
+		changes = append(changes, ownershipChanges...)
 	}
-	p.logger.Info("Updated DNS record", "record", record, "zone", zoneID, "response", resp)
-	return nil
+
+	// The changes are batched with the changes of the other records
+	return p.batcher.submit(zoneID, changes), nil
 }
 
-func (p *Provider) changeForEndpoint(endpoint *v1.Endpoint, action string) (*route53.Change, error) {
-	if endpoint.RecordType != string(v1.ARecordType) {
+// changeForEndpoint returns the change of the record set of the endpoint in
+// the hosted zone.
+func (p *Provider) changeForEndpoint(endpoint *v1.Endpoint, zoneID, action string) (*route53.Change, error) {
+	switch v1.DNSRecordType(endpoint.RecordType) {
+	case v1.ARecordType, v1.AAAARecordType, v1.CNAMERecordType:
+	default:
 		return nil, fmt.Errorf("unsupported record type %s", endpoint.RecordType)
 	}
 	domain, targets := endpoint.DNSName, endpoint.Targets
@@ -194,16 +481,35 @@ func (p *Provider) changeForEndpoint(endpoint *v1.Endpoint, action string) (*rou
 		return nil, fmt.Errorf("targets is required")
 	}
 
-	var resourceRecords []*route53.ResourceRecord
-	for _, target := range endpoint.Targets {
-		resourceRecords = append(resourceRecords, &route53.ResourceRecord{Value: aws.String(target)})
+	resourceRecordSet := &route53.ResourceRecordSet{
+		Name: aws.String(endpoint.DNSName),
+		Type: aws.String(endpoint.RecordType),
 	}
 
-	resourceRecordSet := &route53.ResourceRecordSet{
-		Name:            aws.String(endpoint.DNSName),
-		Type:            aws.String(route53.RRTypeA),
-		TTL:             aws.Int64(int64(endpoint.RecordTTL)),
-		ResourceRecords: resourceRecords,
+	if isAlias(endpoint) {
+		// ALIAS records point to a single AWS load balancer, or to a record
+		// under their name in the same hosted zone, and have no TTL
+		hostedZoneID := CanonicalHostedZone(targets[0])
+		if hostedZoneID == "" && strings.HasSuffix(strings.TrimSuffix(targets[0], "."), "."+strings.TrimSuffix(domain, ".")) {
+			hostedZoneID = zoneID
+		}
+		if len(targets) > 1 || hostedZoneID == "" {
+			return nil, fmt.Errorf("alias target %s is not an AWS load balancer hostname", strings.Join(targets, ","))
+		}
+		evaluateTargetHealth := false
+		if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificEvaluateTargetHealth); ok {
+			evaluateTargetHealth = prop.Value == "true"
+		}
+		resourceRecordSet.AliasTarget = &route53.AliasTarget{
+			DNSName:              aws.String(targets[0]),
+			HostedZoneId:         aws.String(hostedZoneID),
+			EvaluateTargetHealth: aws.Bool(evaluateTargetHealth),
+		}
+	} else {
+		for _, target := range targets {
+			resourceRecordSet.ResourceRecords = append(resourceRecordSet.ResourceRecords, &route53.ResourceRecord{Value: aws.String(target)})
+		}
+		resourceRecordSet.TTL = aws.Int64(int64(endpoint.RecordTTL))
 	}
 
 	if endpoint.SetIdentifier != "" {
@@ -223,10 +529,15 @@ func (p *Provider) changeForEndpoint(endpoint *v1.Endpoint, action string) (*rou
 	if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificFailover); ok {
 		resourceRecordSet.Failover = aws.String(prop.Value)
 	}
+	resourceRecordSet.GeoLocation = geolocationForEndpoint(endpoint)
 	if _, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificMultiValueAnswer); ok {
 		resourceRecordSet.MultiValueAnswer = aws.Bool(true)
 	}
-	if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificHealthCheckID); ok {
+	// The calculated health check of the DNS name, if any, aggregates the
+	// health check of the endpoint
+	if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificCalculatedHealthCheckID); ok {
+		resourceRecordSet.HealthCheckId = aws.String(prop.Value)
+	} else if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificHealthCheckID); ok {
 		resourceRecordSet.HealthCheckId = aws.String(prop.Value)
 	}
 
@@ -237,11 +548,38 @@ func (p *Provider) changeForEndpoint(endpoint *v1.Endpoint, action string) (*rou
 	return change, nil
 }
 
-func (p *Provider) endpointsFromZoneStatus(record *v1.DNSRecord, zoneID string) ([]*v1.Endpoint, error) {
-	for _, zoneStatus := range record.Status.Zones {
-		if zoneStatus.DNSZone.ID == zoneID {
-			return zoneStatus.Endpoints, nil
-		}
+// geolocationForEndpoint returns the Route53 geolocation of the endpoint, or
+// nil if the endpoint has no geolocation routing policy.
+func geolocationForEndpoint(endpoint *v1.Endpoint) *route53.GeoLocation {
+	geolocation := &route53.GeoLocation{}
+	found := false
+	if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificGeolocationContinentCode); ok {
+		geolocation.ContinentCode = aws.String(prop.Value)
+		found = true
+	}
+	if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificGeolocationCountryCode); ok {
+		geolocation.CountryCode = aws.String(prop.Value)
+		found = true
+	}
+	if prop, ok := endpoint.GetProviderSpecificProperty(ProviderSpecificGeolocationSubdivisionCode); ok {
+		geolocation.SubdivisionCode = aws.String(prop.Value)
+		found = true
+	}
+	if !found {
+		return nil
 	}
-	return []*v1.Endpoint{}, nil
+	return geolocation
+}
+
+// isAlias returns whether the endpoint is published as an ALIAS record, i.e.,
+// an A or AAAA endpoint that targets a hostname rather than an IP address.
+func isAlias(endpoint *v1.Endpoint) bool {
+	if endpoint.RecordType != string(v1.ARecordType) && endpoint.RecordType != string(v1.AAAARecordType) {
+		return false
+	}
+	return len(endpoint.Targets) > 0 && net.ParseIP(endpoint.Targets[0]) == nil
+}
+
+func (p *Provider) endpointsFromZoneStatus(record *v1.DNSRecord, zoneID string) ([]*v1.Endpoint, error) {
+	return dns.EndpointsFromZoneStatus(record, zoneID), nil
 }
@@ -0,0 +1,760 @@
+package aws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+func TestChangeForEndpoint(t *testing.T) {
+	p := &Provider{logger: log.Logger}
+
+	endpoint := func(recordType string, target string, providerSpecific ...v1.ProviderSpecificProperty) *v1.Endpoint {
+		return &v1.Endpoint{
+			DNSName:          "app.example.com",
+			RecordType:       recordType,
+			SetIdentifier:    target,
+			Targets:          v1.Targets{target},
+			RecordTTL:        60,
+			ProviderSpecific: providerSpecific,
+		}
+	}
+
+	cases := []struct {
+		name     string
+		endpoint *v1.Endpoint
+		expected *route53.ResourceRecordSet
+		err      bool
+	}{
+		{
+			name:     "A record",
+			endpoint: endpoint("A", "10.0.0.1", v1.ProviderSpecificProperty{Name: ProviderSpecificWeight, Value: "120"}),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("A"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("10.0.0.1"),
+				Weight:          aws.Int64(120),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			},
+		},
+		{
+			name:     "AAAA record",
+			endpoint: endpoint("AAAA", "2001:db8::1"),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("AAAA"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("2001:db8::1"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("2001:db8::1")}},
+			},
+		},
+		{
+			name:     "CNAME record",
+			endpoint: endpoint("CNAME", "lb.example.org"),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("CNAME"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("lb.example.org"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("lb.example.org")}},
+			},
+		},
+		{
+			name: "ALIAS record to a network load balancer",
+			endpoint: endpoint("A", "nlb-123.elb.eu-west-1.amazonaws.com",
+				v1.ProviderSpecificProperty{Name: ProviderSpecificEvaluateTargetHealth, Value: "true"}),
+			expected: &route53.ResourceRecordSet{
+				Name:          aws.String("app.example.com"),
+				Type:          aws.String("A"),
+				SetIdentifier: aws.String("nlb-123.elb.eu-west-1.amazonaws.com"),
+				AliasTarget: &route53.AliasTarget{
+					DNSName:              aws.String("nlb-123.elb.eu-west-1.amazonaws.com"),
+					HostedZoneId:         aws.String("Z2IFOLAFXWLO4F"),
+					EvaluateTargetHealth: aws.Bool(true),
+				},
+			},
+		},
+		{
+			name:     "ALIAS record to a classic load balancer",
+			endpoint: endpoint("A", "elb-123.us-east-1.elb.amazonaws.com"),
+			expected: &route53.ResourceRecordSet{
+				Name:          aws.String("app.example.com"),
+				Type:          aws.String("A"),
+				SetIdentifier: aws.String("elb-123.us-east-1.elb.amazonaws.com"),
+				AliasTarget: &route53.AliasTarget{
+					DNSName:              aws.String("elb-123.us-east-1.elb.amazonaws.com"),
+					HostedZoneId:         aws.String("Z35SXDOTRQ7X7K"),
+					EvaluateTargetHealth: aws.Bool(false),
+				},
+			},
+		},
+		{
+			name:     "latency record",
+			endpoint: endpoint("A", "10.0.0.1", v1.ProviderSpecificProperty{Name: ProviderSpecificRegion, Value: "eu-west-1"}),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("A"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("10.0.0.1"),
+				Region:          aws.String("eu-west-1"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			},
+		},
+		{
+			name: "geolocation record",
+			endpoint: endpoint("A", "10.0.0.1",
+				v1.ProviderSpecificProperty{Name: ProviderSpecificGeolocationCountryCode, Value: "US"},
+				v1.ProviderSpecificProperty{Name: ProviderSpecificGeolocationSubdivisionCode, Value: "CA"}),
+			expected: &route53.ResourceRecordSet{
+				Name:          aws.String("app.example.com"),
+				Type:          aws.String("A"),
+				TTL:           aws.Int64(60),
+				SetIdentifier: aws.String("10.0.0.1"),
+				GeoLocation: &route53.GeoLocation{
+					CountryCode:     aws.String("US"),
+					SubdivisionCode: aws.String("CA"),
+				},
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			},
+		},
+		{
+			name:     "failover record",
+			endpoint: endpoint("A", "10.0.0.1", v1.ProviderSpecificProperty{Name: ProviderSpecificFailover, Value: "PRIMARY"}),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("A"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("10.0.0.1"),
+				Failover:        aws.String("PRIMARY"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			},
+		},
+		{
+			name:     "health checked record",
+			endpoint: endpoint("A", "10.0.0.1", v1.ProviderSpecificProperty{Name: ProviderSpecificHealthCheckID, Value: "hc-1"}),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("A"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("10.0.0.1"),
+				HealthCheckId:   aws.String("hc-1"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			},
+		},
+		{
+			name: "record with a calculated health check",
+			endpoint: endpoint("A", "10.0.0.1",
+				v1.ProviderSpecificProperty{Name: ProviderSpecificHealthCheckID, Value: "hc-1"},
+				v1.ProviderSpecificProperty{Name: ProviderSpecificCalculatedHealthCheckID, Value: "hc-2"}),
+			expected: &route53.ResourceRecordSet{
+				Name:            aws.String("app.example.com"),
+				Type:            aws.String("A"),
+				TTL:             aws.Int64(60),
+				SetIdentifier:   aws.String("10.0.0.1"),
+				HealthCheckId:   aws.String("hc-2"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			},
+		},
+		{
+			name: "ALIAS record to a record of the same hosted zone",
+			endpoint: endpoint("A", "geo-continent-eu.app.example.com",
+				v1.ProviderSpecificProperty{Name: ProviderSpecificEvaluateTargetHealth, Value: "true"}),
+			expected: &route53.ResourceRecordSet{
+				Name:          aws.String("app.example.com"),
+				Type:          aws.String("A"),
+				SetIdentifier: aws.String("geo-continent-eu.app.example.com"),
+				AliasTarget: &route53.AliasTarget{
+					DNSName:              aws.String("geo-continent-eu.app.example.com"),
+					HostedZoneId:         aws.String("Z123"),
+					EvaluateTargetHealth: aws.Bool(true),
+				},
+			},
+		},
+		{
+			name:     "ALIAS record to an unknown hostname",
+			endpoint: endpoint("A", "lb.example.org"),
+			err:      true,
+		},
+		{
+			name:     "unsupported record type",
+			endpoint: endpoint("TXT", "text"),
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			change, err := p.changeForEndpoint(tc.endpoint, "Z123", string(upsertAction))
+			if tc.err {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(change.ResourceRecordSet).To(gomega.Equal(tc.expected))
+		})
+	}
+}
+
+func TestCanonicalHostedZone(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(CanonicalHostedZone("a1b2c3-123.us-east-1.elb.amazonaws.com")).To(gomega.Equal("Z35SXDOTRQ7X7K"))
+	g.Expect(CanonicalHostedZone("nlb-123.elb.us-east-1.amazonaws.com.")).To(gomega.Equal("Z26RNL4JYFTOTI"))
+	g.Expect(CanonicalHostedZone("lb.example.com")).To(gomega.BeEmpty())
+	g.Expect(CanonicalHostedZone("us-east-1.elb.amazonaws.com")).To(gomega.BeEmpty())
+}
+
+// fakeRoute53 is a Route53 API server with a set of hosted zones.
+type fakeRoute53 struct {
+	zones    []*route53.HostedZone
+	writable bool
+
+	mu sync.Mutex
+	// throttle is the number of change batches to throttle
+	throttle int
+	// batches are the names of the records of the applied change batches
+	batches [][]string
+	// insync is whether the applied changes are propagated
+	insync bool
+	// recordSets are the resource record sets of the hosted zones, in order
+	recordSets []*route53.ResourceRecordSet
+	// listedNames are the names the resource record sets were listed from
+	listedNames []string
+	// healthChecks are the tags of the health checks, by ID
+	healthChecks map[string]map[string]string
+	// callerReferences are the caller references of the health checks, by ID
+	callerReferences map[string]string
+	// taggedHealthChecks are the IDs of the health checks whose tags were listed
+	taggedHealthChecks []string
+	// deletedHealthChecks are the IDs of the deleted health checks
+	deletedHealthChecks []string
+	// healthCheckObservations are the statuses reported by the health checkers, by health check ID
+	healthCheckObservations map[string][]string
+	// healthCheckConfigs are the configurations of the created health checks, by ID
+	healthCheckConfigs map[string]*fakeHealthCheckConfig
+}
+
+// fakeHealthCheckConfig is the XML representation of a health check configuration.
+type fakeHealthCheckConfig struct {
+	IPAddress                *string  `xml:",omitempty"`
+	Port                     *int64   `xml:",omitempty"`
+	Type                     *string  `xml:",omitempty"`
+	ResourcePath             *string  `xml:",omitempty"`
+	FullyQualifiedDomainName *string  `xml:",omitempty"`
+	SearchString             *string  `xml:",omitempty"`
+	RequestInterval          *int64   `xml:",omitempty"`
+	FailureThreshold         *int64   `xml:",omitempty"`
+	Inverted                 *bool    `xml:",omitempty"`
+	HealthThreshold          *int64   `xml:",omitempty"`
+	ChildHealthChecks        []string `xml:"ChildHealthChecks>ChildHealthCheck,omitempty"`
+	EnableSNI                *bool    `xml:",omitempty"`
+	Regions                  []string `xml:"Regions>Region,omitempty"`
+	ResetElements            []string `xml:"ResetElements>ResettableElementName,omitempty"`
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeError := func(status int, code string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>1</RequestId></ErrorResponse>`, code, code)
+	}
+	writeZone := func(zone *route53.HostedZone) {
+		fmt.Fprintf(w, `<HostedZone><Id>%s</Id><Name>%s</Name><CallerReference>glbc</CallerReference><Config><PrivateZone>%t</PrivateZone></Config></HostedZone>`,
+			aws.StringValue(zone.Id), aws.StringValue(zone.Name), aws.BoolValue(zone.Config.PrivateZone))
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/2013-04-01/")
+	switch {
+	case path == "hostedzone" && r.Method == http.MethodGet:
+		fmt.Fprint(w, `<ListHostedZonesResponse><HostedZones></HostedZones><IsTruncated>false</IsTruncated><MaxItems>1</MaxItems></ListHostedZonesResponse>`)
+
+	case path == "hostedzonesbyname":
+		// Hosted zones are listed from the DNS name, in the order of their reversed labels
+		fmt.Fprint(w, `<ListHostedZonesByNameResponse><HostedZones>`)
+		for _, zone := range f.zones {
+			if strings.TrimSuffix(aws.StringValue(zone.Name), ".") >= r.URL.Query().Get("dnsname") {
+				writeZone(zone)
+			}
+		}
+		fmt.Fprint(w, `</HostedZones><IsTruncated>false</IsTruncated><MaxItems>100</MaxItems></ListHostedZonesByNameResponse>`)
+
+	case strings.HasSuffix(path, "/rrset") && r.Method == http.MethodGet:
+		f.mu.Lock()
+		f.listedNames = append(f.listedNames, r.URL.Query().Get("name"))
+		f.mu.Unlock()
+		fmt.Fprint(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>`)
+		for _, recordSet := range f.recordSets {
+			if aws.StringValue(recordSet.Name) < r.URL.Query().Get("name") {
+				continue
+			}
+			fmt.Fprintf(w, `<ResourceRecordSet><Name>%s</Name><Type>%s</Type>`, aws.StringValue(recordSet.Name), aws.StringValue(recordSet.Type))
+			if recordSet.SetIdentifier != nil {
+				fmt.Fprintf(w, `<SetIdentifier>%s</SetIdentifier>`, aws.StringValue(recordSet.SetIdentifier))
+			}
+			if recordSet.AliasTarget != nil {
+				fmt.Fprintf(w, `<AliasTarget><HostedZoneId>%s</HostedZoneId><DNSName>%s</DNSName><EvaluateTargetHealth>false</EvaluateTargetHealth></AliasTarget>`,
+					aws.StringValue(recordSet.AliasTarget.HostedZoneId), aws.StringValue(recordSet.AliasTarget.DNSName))
+			} else {
+				fmt.Fprintf(w, `<TTL>%d</TTL><ResourceRecords>`, aws.Int64Value(recordSet.TTL))
+				for _, record := range recordSet.ResourceRecords {
+					fmt.Fprintf(w, `<ResourceRecord><Value>%s</Value></ResourceRecord>`, aws.StringValue(record.Value))
+				}
+				fmt.Fprint(w, `</ResourceRecords>`)
+			}
+			fmt.Fprint(w, `</ResourceRecordSet>`)
+		}
+		fmt.Fprint(w, `</ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>300</MaxItems></ListResourceRecordSetsResponse>`)
+
+	case strings.HasSuffix(path, "/rrset/") && r.Method == http.MethodPost:
+		if !f.writable {
+			writeError(http.StatusForbidden, "AccessDenied")
+			return
+		}
+		input := struct {
+			Names []string `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Name"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		for _, name := range input.Names {
+			// The permissions check deletes a record that doesn't exist
+			if strings.HasPrefix(name, "_glbc-permissions-check.") || strings.HasPrefix(name, "invalid.") {
+				writeError(http.StatusBadRequest, route53.ErrCodeInvalidChangeBatch)
+				return
+			}
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.throttle > 0 {
+			f.throttle--
+			writeError(http.StatusBadRequest, "Throttling")
+			return
+		}
+		f.batches = append(f.batches, input.Names)
+		fmt.Fprintf(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C%d</Id><Status>PENDING</Status><SubmittedAt>2022-01-01T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>`, len(f.batches))
+
+	case strings.HasPrefix(path, "change/") && r.Method == http.MethodGet:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var id int
+		if _, err := fmt.Sscanf(path, "change/C%d", &id); err != nil || id < 1 || id > len(f.batches) {
+			writeError(http.StatusNotFound, route53.ErrCodeNoSuchChange)
+			return
+		}
+		status := route53.ChangeStatusPending
+		if f.insync {
+			status = route53.ChangeStatusInsync
+		}
+		fmt.Fprintf(w, `<GetChangeResponse><ChangeInfo><Id>/%s</Id><Status>%s</Status><SubmittedAt>2022-01-01T00:00:00Z</SubmittedAt></ChangeInfo></GetChangeResponse>`, path, status)
+
+	case path == "healthcheck" && r.Method == http.MethodGet:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		fmt.Fprint(w, `<ListHealthChecksResponse><HealthChecks>`)
+		for _, id := range f.healthCheckIDs() {
+			fmt.Fprintf(w, `<HealthCheck><Id>%s</Id><CallerReference>%s</CallerReference><HealthCheckVersion>1</HealthCheckVersion></HealthCheck>`, id, f.callerReference(id))
+		}
+		fmt.Fprint(w, `</HealthChecks><Marker></Marker><IsTruncated>false</IsTruncated><MaxItems>100</MaxItems></ListHealthChecksResponse>`)
+
+	case path == "tags/healthcheck" && r.Method == http.MethodPost:
+		input := struct {
+			IDs []string `xml:"ResourceIds>ResourceId"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&input); err != nil || len(input.IDs) > maxTaggedResources {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.taggedHealthChecks = append(f.taggedHealthChecks, input.IDs...)
+		fmt.Fprint(w, `<ListTagsForResourcesResponse><ResourceTagSets>`)
+		for _, id := range input.IDs {
+			fmt.Fprintf(w, `<ResourceTagSet><ResourceType>healthcheck</ResourceType><ResourceId>%s</ResourceId><Tags>`, id)
+			for key, value := range f.healthChecks[id] {
+				fmt.Fprintf(w, `<Tag><Key>%s</Key><Value>%s</Value></Tag>`, key, value)
+			}
+			fmt.Fprint(w, `</Tags></ResourceTagSet>`)
+		}
+		fmt.Fprint(w, `</ResourceTagSets></ListTagsForResourcesResponse>`)
+
+	case strings.HasPrefix(path, "healthcheck/") && strings.HasSuffix(path, "/status") && r.Method == http.MethodGet:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "healthcheck/"), "/status")
+		if _, ok := f.healthChecks[id]; !ok {
+			writeError(http.StatusNotFound, route53.ErrCodeNoSuchHealthCheck)
+			return
+		}
+		fmt.Fprint(w, `<GetHealthCheckStatusResponse><HealthCheckObservations>`)
+		for i, status := range f.healthCheckObservations[id] {
+			fmt.Fprintf(w, `<HealthCheckObservation><Region>region-%d</Region><IPAddress>192.0.2.%d</IPAddress><StatusReport><Status>%s</Status><CheckedTime>2022-01-01T00:00:00Z</CheckedTime></StatusReport></HealthCheckObservation>`, i, i, status)
+		}
+		fmt.Fprint(w, `</HealthCheckObservations></GetHealthCheckStatusResponse>`)
+
+	case path == "healthcheck" && r.Method == http.MethodPost:
+		input := struct {
+			CallerReference   string
+			HealthCheckConfig fakeHealthCheckConfig
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.healthChecks == nil {
+			f.healthChecks = map[string]map[string]string{}
+			f.healthCheckConfigs = map[string]*fakeHealthCheckConfig{}
+		}
+		id := fmt.Sprintf("hc-%d", len(f.healthChecks)+len(f.deletedHealthChecks)+1)
+		// Route53 health checks have a request interval, unless calculated
+		if input.HealthCheckConfig.RequestInterval == nil && aws.StringValue(input.HealthCheckConfig.Type) != route53.HealthCheckTypeCalculated {
+			input.HealthCheckConfig.RequestInterval = aws.Int64(defaultRequestInterval)
+		}
+		if f.callerReferences == nil {
+			f.callerReferences = map[string]string{}
+		}
+		f.healthChecks[id] = map[string]string{}
+		f.healthCheckConfigs[id] = &input.HealthCheckConfig
+		f.callerReferences[id] = input.CallerReference
+		w.Header().Set("Location", "/2013-04-01/healthcheck/"+id)
+		w.WriteHeader(http.StatusCreated)
+		f.writeHealthCheck(w, "CreateHealthCheckResponse", id)
+
+	case strings.HasPrefix(path, "healthcheck/") && r.Method == http.MethodGet:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(path, "healthcheck/")
+		if _, ok := f.healthCheckConfigs[id]; !ok {
+			writeError(http.StatusNotFound, route53.ErrCodeNoSuchHealthCheck)
+			return
+		}
+		f.writeHealthCheck(w, "GetHealthCheckResponse", id)
+
+	case strings.HasPrefix(path, "healthcheck/") && r.Method == http.MethodPost:
+		input := fakeHealthCheckConfig{}
+		if err := xml.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(path, "healthcheck/")
+		config, ok := f.healthCheckConfigs[id]
+		if !ok {
+			writeError(http.StatusNotFound, route53.ErrCodeNoSuchHealthCheck)
+			return
+		}
+		if input.Type != nil || input.RequestInterval != nil {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		if input.IPAddress != nil {
+			config.IPAddress = input.IPAddress
+		}
+		if input.Port != nil {
+			config.Port = input.Port
+		}
+		if input.ResourcePath != nil {
+			config.ResourcePath = input.ResourcePath
+		}
+		if input.FullyQualifiedDomainName != nil {
+			config.FullyQualifiedDomainName = input.FullyQualifiedDomainName
+		}
+		if input.SearchString != nil {
+			config.SearchString = input.SearchString
+		}
+		if input.FailureThreshold != nil {
+			config.FailureThreshold = input.FailureThreshold
+		}
+		if input.Inverted != nil {
+			config.Inverted = input.Inverted
+		}
+		if input.HealthThreshold != nil {
+			config.HealthThreshold = input.HealthThreshold
+		}
+		if input.ChildHealthChecks != nil {
+			config.ChildHealthChecks = input.ChildHealthChecks
+		}
+		if input.EnableSNI != nil {
+			config.EnableSNI = input.EnableSNI
+		}
+		if input.Regions != nil {
+			config.Regions = input.Regions
+		}
+		for _, element := range input.ResetElements {
+			if element == route53.ResettableElementNameRegions {
+				config.Regions = nil
+			}
+		}
+		f.writeHealthCheck(w, "UpdateHealthCheckResponse", id)
+
+	case strings.HasPrefix(path, "tags/healthcheck/") && r.Method == http.MethodPost:
+		input := struct {
+			Tags []*route53.Tag `xml:"AddTags>Tag"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(path, "tags/healthcheck/")
+		for _, tag := range input.Tags {
+			f.healthChecks[id][aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		fmt.Fprint(w, `<ChangeTagsForResourceResponse></ChangeTagsForResourceResponse>`)
+
+	case strings.HasPrefix(path, "healthcheck/") && r.Method == http.MethodDelete:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.TrimPrefix(path, "healthcheck/")
+		if _, ok := f.healthChecks[id]; !ok {
+			writeError(http.StatusNotFound, route53.ErrCodeNoSuchHealthCheck)
+			return
+		}
+		delete(f.healthChecks, id)
+		delete(f.healthCheckConfigs, id)
+		f.deletedHealthChecks = append(f.deletedHealthChecks, id)
+		fmt.Fprint(w, `<DeleteHealthCheckResponse></DeleteHealthCheckResponse>`)
+
+	case strings.HasPrefix(path, "hostedzone/") && r.Method == http.MethodGet:
+		for _, zone := range f.zones {
+			if aws.StringValue(zone.Id) == "/"+path {
+				fmt.Fprint(w, `<GetHostedZoneResponse>`)
+				writeZone(zone)
+				fmt.Fprint(w, `<DelegationSet><NameServers><NameServer>ns.example.com</NameServer></NameServers></DelegationSet></GetHostedZoneResponse>`)
+				return
+			}
+		}
+		writeError(http.StatusNotFound, route53.ErrCodeNoSuchHostedZone)
+
+	default:
+		writeError(http.StatusNotFound, "NotFound")
+	}
+}
+
+// writeHealthCheck writes the response of a health check request.
+func (f *fakeRoute53) writeHealthCheck(w http.ResponseWriter, response, id string) {
+	config, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"HealthCheckConfig"`
+		*fakeHealthCheckConfig
+	}{fakeHealthCheckConfig: f.healthCheckConfigs[id]})
+	fmt.Fprintf(w, `<%s><HealthCheck><Id>%s</Id><CallerReference>%s</CallerReference>%s<HealthCheckVersion>1</HealthCheckVersion></HealthCheck></%s>`, response, id, id, config, response)
+}
+
+// callerReference returns the caller reference of the health check, that
+// defaults to its ID.
+func (f *fakeRoute53) callerReference(id string) string {
+	if callerReference, ok := f.callerReferences[id]; ok {
+		return callerReference
+	}
+	return id
+}
+
+// healthCheckIDs returns the IDs of the health checks, in order.
+func (f *fakeRoute53) healthCheckIDs() []string {
+	var ids []string
+	for id := range f.healthChecks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func newTestProvider(t *testing.T, fake *fakeRoute53) *Provider {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+	p := &Provider{
+		route53: &InstrumentedRoute53{route53: route53.New(sess)},
+		logger:  log.Logger,
+	}
+	p.batcher = newChangeBatcher(p.route53, 10*time.Millisecond, p.logger)
+	p.batcher.backoff.Duration = time.Millisecond
+	return p
+}
+
+func hostedZone(id, name string, private bool) *route53.HostedZone {
+	return &route53.HostedZone{
+		Id:     aws.String("/hostedzone/" + id),
+		Name:   aws.String(name),
+		Config: &route53.HostedZoneConfig{PrivateZone: aws.Bool(private)},
+	}
+}
+
+func TestDiscoverHostedZone(t *testing.T) {
+	fake := &fakeRoute53{
+		zones: []*route53.HostedZone{
+			hostedZone("ZPRIVATE", "apps.example.com.", true),
+			hostedZone("ZAPPS", "apps.example.com.", false),
+			hostedZone("ZEXAMPLE", "example.com.", false),
+			hostedZone("ZDUPLICATE1", "example.org.", false),
+			hostedZone("ZDUPLICATE2", "example.org.", false),
+		},
+	}
+
+	cases := []struct {
+		domain   string
+		expected string
+		err      bool
+	}{
+		{domain: "apps.example.com", expected: "ZAPPS"},
+		{domain: "dev.apps.example.com.", expected: "ZAPPS"},
+		{domain: "dev.example.com", expected: "ZEXAMPLE"},
+		{domain: "Example.com", expected: "ZEXAMPLE"},
+		{domain: "example.org", err: true},
+		{domain: "example.net", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.domain, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			zoneID, err := newTestProvider(t, fake).discoverHostedZone(tc.domain)
+			if tc.err {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(zoneID).To(gomega.Equal(tc.expected))
+		})
+	}
+}
+
+func TestValidateServiceEndpoints(t *testing.T) {
+	zones := []*route53.HostedZone{hostedZone("ZEXAMPLE", "example.com.", false)}
+
+	cases := []struct {
+		name     string
+		zoneID   string
+		writable bool
+		err      bool
+	}{
+		{name: "writable zone", zoneID: "ZEXAMPLE", writable: true},
+		{name: "read-only zone", zoneID: "ZEXAMPLE", err: true},
+		{name: "unknown zone", zoneID: "ZUNKNOWN", writable: true, err: true},
+		{name: "no zone", writable: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			provider := newTestProvider(t, &fakeRoute53{zones: zones, writable: tc.writable})
+			err := validateServiceEndpoints(provider)
+			if err == nil && tc.zoneID != "" {
+				err = validateHostedZone(provider, tc.zoneID)
+			}
+			if tc.err {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	}
+}
+
+func TestEnsureChange(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{writable: true}
+	p := newTestProvider(t, fake)
+
+	record := &v1.DNSRecord{}
+	record.Name = "app"
+	record.Spec.Endpoints = []*v1.Endpoint{{
+		DNSName:    "app.example.com",
+		RecordType: "A",
+		Targets:    v1.Targets{"10.0.0.1"},
+		RecordTTL:  60,
+	}}
+
+	changeID, err := p.EnsureChange(record, v1.DNSZone{ID: "ZEXAMPLE"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(isChangeRequestID(changeID)).To(gomega.BeTrue())
+
+	// The change is pending until the change batch is sent and propagated
+	g.Eventually(func() bool {
+		sent, _, _ := p.batcher.result(changeID)
+		return sent
+	}).Should(gomega.BeTrue())
+	propagated, err := p.ChangePropagated(changeID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(propagated).To(gomega.BeFalse())
+
+	fake.mu.Lock()
+	fake.insync = true
+	fake.mu.Unlock()
+	propagated, err = p.ChangePropagated(changeID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(propagated).To(gomega.BeTrue())
+
+	// The changes submitted before a restart are unknown
+	_, err = p.ChangePropagated(changeID)
+	g.Expect(dns.IsChangeFailed(err)).To(gomega.BeTrue())
+
+	_, err = p.ChangePropagated("/change/C2")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(dns.IsChangeFailed(err)).To(gomega.BeFalse())
+
+	// The rejected changes fail
+	record.Spec.Endpoints[0].DNSName = "invalid.example.com"
+	changeID, err = p.EnsureChange(record, v1.DNSZone{ID: "ZEXAMPLE"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Eventually(func() bool {
+		_, err := p.ChangePropagated(changeID)
+		return dns.IsChangeFailed(err)
+	}).Should(gomega.BeTrue())
+}
+
+func TestRecords(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{
+		recordSets: []*route53.ResourceRecordSet{
+			{Name: aws.String("api.example.com."), Type: aws.String("A"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.9")}}},
+			{Name: aws.String("app.example.com."), Type: aws.String("A"), SetIdentifier: aws.String("10.0.0.1"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}}},
+			{Name: aws.String("app.example.com."), Type: aws.String("A"), SetIdentifier: aws.String("lb"), AliasTarget: &route53.AliasTarget{
+				HostedZoneId: aws.String("Z35SXDOTRQ7X7K"),
+				DNSName:      aws.String("dualstack.a1b2c3-123.us-east-1.elb.amazonaws.com."),
+			}},
+			{Name: aws.String("www.example.com."), Type: aws.String("CNAME"), TTL: aws.Int64(300), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("app.example.com")}}},
+		},
+	}
+	p := newTestProvider(t, fake)
+
+	endpoints, err := p.Records("App.example.com", v1.DNSZone{ID: "ZEXAMPLE"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(endpoints).To(gomega.Equal([]*v1.Endpoint{
+		{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "10.0.0.1", RecordTTL: 60, Targets: v1.Targets{"10.0.0.1"}},
+		{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "lb", Targets: v1.Targets{"a1b2c3-123.us-east-1.elb.amazonaws.com"}},
+	}))
+
+	endpoints, err = p.Records("missing.example.com", v1.DNSZone{ID: "ZEXAMPLE"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(endpoints).To(gomega.BeEmpty())
+}
@@ -2,41 +2,95 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/rs/xid"
 
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/route53"
 
 	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
 	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/util/slice"
 )
 
 const (
 	idTag = "kuadrant.dev/healthcheck"
+	// ownerTag identifies the GLBC instance that created the health check
+	ownerTag = "kuadrant.dev/owner"
+	// dnsRecordTag identifies the DNSRecord the health check was created for
+	dnsRecordTag = "kuadrant.dev/dnsrecord"
+
+	// healthCheckerSuccessPrefix is the prefix of the status reported by the
+	// health checkers that consider the endpoint healthy
+	healthCheckerSuccessPrefix = "Success"
+	// healthyCheckersRatio is the ratio of the health checkers that must report
+	// an endpoint healthy for Route53 to consider it healthy
+	healthyCheckersRatio = 0.18
+
+	// defaultRequestInterval and fastRequestInterval are the intervals, in
+	// seconds, between the requests of each Route53 health checker
+	defaultRequestInterval = 30
+	fastRequestInterval    = 10
 )
 
+// callerReferencePrefix prefixes the caller references of the health checks
+// created by the GLBC, so that the health checks of other tools are ignored
+// without fetching their tags. It is kept short, as the caller references,
+// of at most 64 characters, end with the 32 characters ID of the health check,
+// the hash of its immutable configuration, and a 20 characters xid.
+const callerReferencePrefix = "g."
+
 var (
 	callerReference func(id string) *string
+
+	// errNestedCalculatedHealthCheck is returned when a calculated health check
+	// would aggregate the health check of an endpoint with several addresses,
+	// that's itself a calculated health check, which Route53 doesn't support
+	errNestedCalculatedHealthCheck = errors.New("the healthThreshold can't be set for endpoints with several addresses, as Route53 doesn't support calculated health checks of calculated health checks")
 )
 
 type Route53HealthCheckReconciler struct {
-	client *InstrumentedRoute53
-	logger logr.Logger
+	client  *InstrumentedRoute53
+	ownerID string
+	logger  logr.Logger
 }
 
 var _ dns.HealthCheckReconciler = &Route53HealthCheckReconciler{}
+var _ dns.CalculatedHealthCheckReconciler = &Route53HealthCheckReconciler{}
+var _ dns.ReplacedHealthCheckReconciler = &Route53HealthCheckReconciler{}
 
-func newRoute53HealthCheckReconciler(c *InstrumentedRoute53, l logr.Logger) *Route53HealthCheckReconciler {
+func newRoute53HealthCheckReconciler(c *InstrumentedRoute53, ownerID string, l logr.Logger) *Route53HealthCheckReconciler {
 	return &Route53HealthCheckReconciler{
-		client: c,
-		logger: l.WithName("health"),
+		client:  c,
+		ownerID: ownerID,
+		logger:  l.WithName("health"),
 	}
 }
 
 func (r *Route53HealthCheckReconciler) Reconcile(ctx context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
+	if len(endpoint.Targets) > 1 {
+		return r.reconcileTargets(ctx, spec, endpoint)
+	}
+
+	if err := r.reconcileEndpoint(ctx, spec, endpoint); err != nil {
+		return err
+	}
+	// The endpoint may have had several addresses
+	return r.deleteTargetHealthChecks(ctx, endpoint)
+}
+
+// reconcileEndpoint reconciles the health check of the address of the endpoint.
+func (r *Route53HealthCheckReconciler) reconcileEndpoint(ctx context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
 	healthCheck, exists, err := r.findHealthCheck(ctx, endpoint)
 	if err != nil {
 		return err
@@ -48,11 +102,15 @@ func (r *Route53HealthCheckReconciler) Reconcile(ctx context.Context, spec dns.H
 		}
 	}()
 
+	if exists && healthCheckReplaced(healthCheck, spec) {
+		healthCheck, err = r.replaceHealthCheck(ctx, spec, endpoint, healthCheck, healthCheckConfig(spec, endpoint))
+		return err
+	}
 	if exists {
 		return r.updateHealthCheck(ctx, spec, endpoint, healthCheck)
 	}
 
-	healthCheck, err = r.createHealthCheck(ctx, spec, endpoint)
+	healthCheck, err = r.createHealthCheck(ctx, spec, healthCheckConfig(spec, endpoint))
 	return err
 }
 
@@ -62,7 +120,7 @@ func (r *Route53HealthCheckReconciler) Delete(ctx context.Context, endpoint *v1.
 		return err
 	}
 	if !found {
-		return nil
+		return r.deleteTargetHealthChecks(ctx, endpoint)
 	}
 
 	_, err = r.client.DeleteHealthCheckWithContext(ctx, &route53.DeleteHealthCheckInput{
@@ -74,9 +132,153 @@ func (r *Route53HealthCheckReconciler) Delete(ctx context.Context, endpoint *v1.
 	}
 
 	endpoint.DeleteProviderSpecific(ProviderSpecificHealthCheckID)
+	if err := r.DeleteReplaced(ctx, endpoint, nil); err != nil {
+		return err
+	}
+	return r.deleteTargetHealthChecks(ctx, endpoint)
+}
+
+// DeleteReplaced deletes the health checks replaced by the health check of
+// the endpoint, that none of the published endpoints use anymore.
+func (r *Route53HealthCheckReconciler) DeleteReplaced(ctx context.Context, endpoint *v1.Endpoint, published []*v1.Endpoint) error {
+	replaced := getReplacedHealthCheckIds(endpoint)
+	defer func() {
+		setReplacedHealthCheckIds(endpoint, replaced)
+	}()
+
+	inUse := sets.NewString()
+	for _, endpoint := range published {
+		if id, ok := getHealthCheckId(endpoint); ok {
+			inUse.Insert(id)
+		}
+	}
+	for _, id := range sets.NewString(replaced...).Difference(inUse).List() {
+		r.logger.Info("Deleting replaced health check", "id", id)
+		_, err := r.client.DeleteHealthCheckWithContext(ctx, &route53.DeleteHealthCheckInput{
+			HealthCheckId: aws.String(id),
+		})
+		if awsErr, ok := err.(awserr.Error); err != nil && (!ok || awsErr.Code() != route53.ErrCodeNoSuchHealthCheck) {
+			return err
+		}
+		replaced = slice.RemoveString(replaced, id)
+	}
+	return nil
+}
+
+// ReconcileCalculated reconciles the calculated health check of the DNS name
+// of the endpoints, whose children are the health checks of the endpoints.
+func (r *Route53HealthCheckReconciler) ReconcileCalculated(ctx context.Context, spec dns.HealthCheckSpec, endpoints []*v1.Endpoint) error {
+	var children []*string
+	for _, endpoint := range endpoints {
+		if len(endpoint.Targets) > 1 {
+			return fmt.Errorf("%s: %w", endpoint.DNSName, errNestedCalculatedHealthCheck)
+		}
+		if id, ok := getHealthCheckId(endpoint); ok {
+			children = append(children, aws.String(id))
+		}
+	}
+
+	healthCheck, exists, err := r.findCalculatedHealthCheck(ctx, endpoints)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if healthCheck != nil {
+			for _, endpoint := range endpoints {
+				endpoint.SetProviderSpecific(ProviderSpecificCalculatedHealthCheckID, *healthCheck.Id)
+			}
+		}
+	}()
+
+	if exists {
+		diff := calculatedHealthCheckDiff(healthCheck, spec.HealthThreshold, children)
+		if diff == nil {
+			return nil
+		}
+		r.logger.Info("Updating calculated health check", "id", *healthCheck.Id, "change", diff)
+		_, err = r.client.UpdateHealthCheckWithContext(ctx, diff)
+		return err
+	}
+
+	healthCheck, err = r.createHealthCheck(ctx, spec, &route53.HealthCheckConfig{
+		Type:              aws.String(route53.HealthCheckTypeCalculated),
+		ChildHealthChecks: children,
+		HealthThreshold:   spec.HealthThreshold,
+	})
 	return err
 }
 
+// DeleteCalculated deletes the calculated health check of the DNS name of the
+// endpoints. It must be deleted before its children can be.
+func (r *Route53HealthCheckReconciler) DeleteCalculated(ctx context.Context, endpoints []*v1.Endpoint) error {
+	id, ok := getCalculatedHealthCheckId(endpoints)
+	if !ok {
+		return nil
+	}
+
+	_, err := r.client.DeleteHealthCheckWithContext(ctx, &route53.DeleteHealthCheckInput{
+		HealthCheckId: &id,
+	})
+	// The endpoints of the DNS name may be published to several zones, and
+	// share the calculated health check
+	if awsErr, ok := err.(awserr.Error); err != nil && (!ok || awsErr.Code() != route53.ErrCodeNoSuchHealthCheck) {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		endpoint.DeleteProviderSpecific(ProviderSpecificCalculatedHealthCheckID)
+	}
+	return nil
+}
+
+// Status returns the health of the endpoint, as last reported by the Route53
+// health checkers, that consider it healthy if more than 18% of them report it
+// healthy. The message of an unhealthy endpoint is a failure reported by one
+// of the health checkers. An endpoint with several addresses is healthy as
+// long as any of its addresses is.
+func (r *Route53HealthCheckReconciler) Status(ctx context.Context, endpoint *v1.Endpoint) (dns.HealthCheckStatus, error) {
+	id, hasId := getHealthCheckId(endpoint)
+	if !hasId {
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "The endpoint has no health check"}, nil
+	}
+	if len(endpoint.Targets) > 1 {
+		return r.targetsStatus(ctx, endpoint)
+	}
+	return r.status(ctx, id)
+}
+
+func (r *Route53HealthCheckReconciler) status(ctx context.Context, id string) (dns.HealthCheckStatus, error) {
+	output, err := r.client.GetHealthCheckStatusWithContext(ctx, &route53.GetHealthCheckStatusInput{
+		HealthCheckId: &id,
+	})
+	if err != nil {
+		return dns.HealthCheckStatus{}, err
+	}
+	if len(output.HealthCheckObservations) == 0 {
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "No health checker has reported the health of the endpoint yet"}, nil
+	}
+
+	healthy := 0
+	failure := ""
+	for _, observation := range output.HealthCheckObservations {
+		if observation.StatusReport == nil {
+			continue
+		}
+		status := aws.StringValue(observation.StatusReport.Status)
+		if strings.HasPrefix(status, healthCheckerSuccessPrefix) {
+			healthy++
+		} else if failure == "" || status < failure {
+			// The same failure is reported across reconciliations
+			failure = status
+		}
+	}
+	if float64(healthy) > healthyCheckersRatio*float64(len(output.HealthCheckObservations)) {
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateHealthy}, nil
+	}
+	return dns.HealthCheckStatus{State: v1.HealthCheckStateUnhealthy, Message: failure}, nil
+}
+
 func (r *Route53HealthCheckReconciler) findHealthCheck(ctx context.Context, endpoint *v1.Endpoint) (*route53.HealthCheck, bool, error) {
 	id, hasId := getHealthCheckId(endpoint)
 	if !hasId {
@@ -86,6 +288,13 @@ func (r *Route53HealthCheckReconciler) findHealthCheck(ctx context.Context, endp
 	response, err := r.client.GetHealthCheckWithContext(ctx, &route53.GetHealthCheckInput{
 		HealthCheckId: &id,
 	})
+	// The health check may have been deleted along with another endpoint
+	// sharing it, and is created again
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == route53.ErrCodeNoSuchHealthCheck {
+		r.logger.Info("Health check not found", "id", id)
+		endpoint.DeleteProviderSpecific(ProviderSpecificHealthCheckID)
+		return nil, false, nil
+	}
 	if err != nil {
 		return nil, false, err
 	}
@@ -94,38 +303,58 @@ func (r *Route53HealthCheckReconciler) findHealthCheck(ctx context.Context, endp
 
 }
 
-func (r *Route53HealthCheckReconciler) createHealthCheck(ctx context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) (*route53.HealthCheck, error) {
-	address, _ := endpoint.GetAddress()
-	host := endpoint.DNSName
+func (r *Route53HealthCheckReconciler) findCalculatedHealthCheck(ctx context.Context, endpoints []*v1.Endpoint) (*route53.HealthCheck, bool, error) {
+	id, hasId := getCalculatedHealthCheckId(endpoints)
+	if !hasId {
+		return nil, false, nil
+	}
+
+	response, err := r.client.GetHealthCheckWithContext(ctx, &route53.GetHealthCheckInput{
+		HealthCheckId: &id,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return response.HealthCheck, true, nil
+}
 
+func (r *Route53HealthCheckReconciler) createHealthCheck(ctx context.Context, spec dns.HealthCheckSpec, config *route53.HealthCheckConfig) (*route53.HealthCheck, error) {
 	// Create the health check
 	output, err := r.client.CreateHealthCheck(&route53.CreateHealthCheckInput{
-		CallerReference: callerReference(spec.Id),
-		HealthCheckConfig: &route53.HealthCheckConfig{
-			IPAddress:                &address,
-			FullyQualifiedDomainName: &host,
-			Port:                     spec.Port,
-			ResourcePath:             &spec.Path,
-			Type:                     healthCheckType(spec.Protocol),
-			FailureThreshold:         spec.FailureThreshold,
-		},
+		CallerReference:   callerReference(fmt.Sprintf("%s-%s", spec.Id, immutableConfigHash(config))),
+		HealthCheckConfig: config,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Add the tag to identify it
-	_, err = r.client.ChangeTagsForResourceWithContext(ctx, &route53.ChangeTagsForResourceInput{
-		AddTags: []*route53.Tag{
-			{
-				Key:   aws.String(idTag),
-				Value: aws.String(spec.Id),
+	tags := []*route53.Tag{
+		{
+			Key:   aws.String(idTag),
+			Value: aws.String(spec.Id),
+		},
+		{
+			Key:   aws.String("Name"),
+			Value: &spec.Name,
+		},
+	}
+	// Add the tags to identify its owner, so that it's deleted if it outlives its DNSRecord
+	if r.ownerID != "" && spec.DNSRecord != "" {
+		tags = append(tags,
+			&route53.Tag{
+				Key:   aws.String(ownerTag),
+				Value: aws.String(r.ownerID),
 			},
-			{
-				Key:   aws.String("Name"),
-				Value: &spec.Name,
+			&route53.Tag{
+				Key:   aws.String(dnsRecordTag),
+				Value: aws.String(spec.DNSRecord),
 			},
-		},
+		)
+	}
+	_, err = r.client.ChangeTagsForResourceWithContext(ctx, &route53.ChangeTagsForResourceInput{
+		AddTags:      tags,
 		ResourceId:   output.HealthCheck.Id,
 		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
 	})
@@ -152,6 +381,96 @@ func (r *Route53HealthCheckReconciler) updateHealthCheck(ctx context.Context, sp
 	return nil
 }
 
+// replaceHealthCheck replaces the health check with a new one with the given
+// configuration, as the type and the request interval of the health checks
+// can't be updated, and returns the new health check. The health check of an
+// endpoint aggregated by a calculated health check is deleted right away, as
+// the record set uses the calculated health check. Otherwise it's deleted by
+// DeleteReplaced, once the record set using the new health check is published.
+func (r *Route53HealthCheckReconciler) replaceHealthCheck(ctx context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint, healthCheck *route53.HealthCheck, config *route53.HealthCheckConfig) (*route53.HealthCheck, error) {
+	r.logger.Info("Replacing health check", "id", *healthCheck.Id,
+		"type", aws.StringValue(healthCheck.HealthCheckConfig.Type),
+		"interval", aws.Int64Value(healthCheck.HealthCheckConfig.RequestInterval))
+
+	replacement, err := r.createHealthCheck(ctx, spec, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The health check can't be deleted while it's a child of a calculated health check
+	if id, ok := endpoint.GetProviderSpecific(ProviderSpecificCalculatedHealthCheckID); ok {
+		parent, err := r.client.GetHealthCheckWithContext(ctx, &route53.GetHealthCheckInput{
+			HealthCheckId: &id,
+		})
+		if err != nil {
+			return replacement, err
+		}
+		var children []*string
+		for _, child := range parent.HealthCheck.HealthCheckConfig.ChildHealthChecks {
+			if aws.StringValue(child) == *healthCheck.Id {
+				child = replacement.Id
+			}
+			children = append(children, child)
+		}
+		_, err = r.client.UpdateHealthCheckWithContext(ctx, &route53.UpdateHealthCheckInput{
+			HealthCheckId:     &id,
+			ChildHealthChecks: children,
+		})
+		if err != nil {
+			return replacement, err
+		}
+
+		_, err = r.client.DeleteHealthCheckWithContext(ctx, &route53.DeleteHealthCheckInput{
+			HealthCheckId: healthCheck.Id,
+		})
+		return replacement, err
+	}
+
+	setReplacedHealthCheckIds(endpoint, append(getReplacedHealthCheckIds(endpoint), *healthCheck.Id))
+	return replacement, nil
+}
+
+// healthCheckConfig returns the configuration of the health check of the
+// endpoint for the given spec.
+func healthCheckConfig(spec dns.HealthCheckSpec, endpoint *v1.Endpoint) *route53.HealthCheckConfig {
+	address, host := healthCheckTarget(endpoint)
+	config := &route53.HealthCheckConfig{
+		IPAddress:                address,
+		FullyQualifiedDomainName: host,
+		Port:                     spec.Port,
+		Type:                     healthCheckType(spec),
+		FailureThreshold:         spec.FailureThreshold,
+		RequestInterval:          requestInterval(spec.Interval),
+		Inverted:                 aws.Bool(spec.Inverted),
+	}
+	if len(spec.Regions) > 0 {
+		config.Regions = aws.StringSlice(spec.Regions)
+	}
+
+	switch aws.StringValue(config.Type) {
+	case route53.HealthCheckTypeTcp:
+		return config
+	case route53.HealthCheckTypeHttpStrMatch, route53.HealthCheckTypeHttpsStrMatch:
+		config.SearchString = &spec.ExpectedBody
+	}
+	config.ResourcePath = &spec.Path
+	if isHTTPS(config) {
+		config.EnableSNI = aws.Bool(spec.EnableSNI == nil || *spec.EnableSNI)
+	}
+	return config
+}
+
+// healthCheckReplaced returns whether the health check must be replaced to
+// match the spec, as its type or request interval changed.
+func healthCheckReplaced(healthCheck *route53.HealthCheck, spec dns.HealthCheckSpec) bool {
+	interval := requestInterval(spec.Interval)
+	if interval == nil {
+		interval = aws.Int64(defaultRequestInterval)
+	}
+	return !strValuesEqual(healthCheckType(spec), healthCheck.HealthCheckConfig.Type) ||
+		!intValuesEqual(interval, healthCheck.HealthCheckConfig.RequestInterval)
+}
+
 // healthCheckDiff creates a `UpdateHealthCheckInput` object with the fields to
 // update on healthCheck based on the given spec.
 // If the health check matches the spec, returns `nil`
@@ -168,48 +487,138 @@ func healthCheckDiff(healthCheck *route53.HealthCheck, spec dns.HealthCheckSpec,
 		return result
 	}
 
-	if !strValuesEqual(&endpoint.DNSName, healthCheck.HealthCheckConfig.FullyQualifiedDomainName) {
-		diff().FullyQualifiedDomainName = &endpoint.DNSName
+	config := healthCheckConfig(spec, endpoint)
+	if !strValuesEqual(config.FullyQualifiedDomainName, healthCheck.HealthCheckConfig.FullyQualifiedDomainName) {
+		diff().FullyQualifiedDomainName = config.FullyQualifiedDomainName
 	}
-
-	address, _ := endpoint.GetAddress()
-	if !strValuesEqual(&address, healthCheck.HealthCheckConfig.IPAddress) {
-		diff().IPAddress = &address
+	if !strValuesEqual(config.IPAddress, healthCheck.HealthCheckConfig.IPAddress) {
+		diff().IPAddress = config.IPAddress
+	}
+	if !strValuesEqual(config.ResourcePath, healthCheck.HealthCheckConfig.ResourcePath) {
+		diff().ResourcePath = config.ResourcePath
+	}
+	if !intValuesEqual(config.Port, healthCheck.HealthCheckConfig.Port) {
+		diff().Port = config.Port
 	}
-	if !strValuesEqual(&spec.Path, healthCheck.HealthCheckConfig.ResourcePath) {
-		diff().ResourcePath = &spec.Path
+	if !intValuesEqual(config.FailureThreshold, healthCheck.HealthCheckConfig.FailureThreshold) {
+		diff().FailureThreshold = config.FailureThreshold
+	}
+	if config.SearchString != nil && !strValuesEqual(config.SearchString, healthCheck.HealthCheckConfig.SearchString) {
+		diff().SearchString = config.SearchString
+	}
+	if config.EnableSNI != nil && *config.EnableSNI != aws.BoolValue(healthCheck.HealthCheckConfig.EnableSNI) {
+		diff().EnableSNI = config.EnableSNI
+	}
+	if *config.Inverted != aws.BoolValue(healthCheck.HealthCheckConfig.Inverted) {
+		diff().Inverted = config.Inverted
+	}
+	if !regionsEqual(config.Regions, healthCheck.HealthCheckConfig.Regions) {
+		if len(config.Regions) > 0 {
+			diff().Regions = config.Regions
+		} else {
+			diff().ResetElements = aws.StringSlice([]string{route53.ResettableElementNameRegions})
+		}
+	}
+
+	return result
+}
+
+// calculatedHealthCheckDiff creates a `UpdateHealthCheckInput` object with the
+// fields to update on the calculated healthCheck based on the given health
+// threshold and child health checks. If the health check matches them, returns `nil`
+func calculatedHealthCheckDiff(healthCheck *route53.HealthCheck, healthThreshold *int64, children []*string) *route53.UpdateHealthCheckInput {
+	var result *route53.UpdateHealthCheckInput
+
+	diff := func() *route53.UpdateHealthCheckInput {
+		if result == nil {
+			result = &route53.UpdateHealthCheckInput{
+				HealthCheckId: healthCheck.Id,
+			}
+		}
+
+		return result
 	}
-	if !intValuesEqual(spec.Port, healthCheck.HealthCheckConfig.Port) {
-		diff().Port = spec.Port
+
+	if !stringSetsEqual(children, healthCheck.HealthCheckConfig.ChildHealthChecks) {
+		diff().ChildHealthChecks = children
 	}
-	if !intValuesEqual(spec.FailureThreshold, healthCheck.HealthCheckConfig.FailureThreshold) {
-		diff().FailureThreshold = spec.FailureThreshold
+	if !intValuesEqual(healthThreshold, healthCheck.HealthCheckConfig.HealthThreshold) {
+		diff().HealthThreshold = healthThreshold
 	}
 
 	return result
 }
 
+// healthCheckTarget returns the IP address and the host name the health check
+// of the endpoint probes. CNAME and ALIAS endpoints point to a host name, that's
+// resolved by Route53, rather than to an IP address.
+func healthCheckTarget(endpoint *v1.Endpoint) (*string, *string) {
+	address, _ := endpoint.GetAddress()
+	if endpoint.RecordType == string(v1.CNAMERecordType) || isAlias(endpoint) {
+		return nil, &address
+	}
+	return &address, &endpoint.DNSName
+}
+
 func init() {
 	sid := xid.New()
 	callerReference = func(s string) *string {
-		return aws.String(fmt.Sprintf("%s.%s", s, sid))
+		return aws.String(fmt.Sprintf("%s%s.%s", callerReferencePrefix, s, sid))
 	}
 }
 
-func healthCheckType(protocol *dns.HealthCheckProtocol) *string {
-	if protocol == nil {
-		return nil
+// healthCheckType returns the type of the health check for the spec, that
+// searches the body of the responses for the expected string if any.
+func healthCheckType(spec dns.HealthCheckSpec) *string {
+	protocol := dns.HealthCheckProtocolHTTP
+	if spec.Protocol != nil {
+		protocol = *spec.Protocol
 	}
 
-	switch *protocol {
-	case dns.HealthCheckProtocolHTTP:
-		return aws.String(route53.HealthCheckTypeHttp)
+	switch protocol {
+	case dns.HealthCheckProtocolTCP:
+		return aws.String(route53.HealthCheckTypeTcp)
 
 	case dns.HealthCheckProtocolHTTPS:
+		if spec.ExpectedBody != "" {
+			return aws.String(route53.HealthCheckTypeHttpsStrMatch)
+		}
 		return aws.String(route53.HealthCheckTypeHttps)
 	}
 
-	return nil
+	if spec.ExpectedBody != "" {
+		return aws.String(route53.HealthCheckTypeHttpStrMatch)
+	}
+	return aws.String(route53.HealthCheckTypeHttp)
+}
+
+func isHTTPS(config *route53.HealthCheckConfig) bool {
+	switch aws.StringValue(config.Type) {
+	case route53.HealthCheckTypeHttps, route53.HealthCheckTypeHttpsStrMatch:
+		return true
+	}
+	return false
+}
+
+// requestInterval returns the Route53 request interval closest to the
+// interval, either 10 or 30 seconds, or nil for the default interval.
+func requestInterval(interval *time.Duration) *int64 {
+	if interval == nil {
+		return nil
+	}
+	if *interval <= fastRequestInterval*time.Second {
+		return aws.Int64(fastRequestInterval)
+	}
+	return aws.Int64(defaultRequestInterval)
+}
+
+// immutableConfigHash returns a hash of the fields of the health check
+// configuration that can't be updated, so that a health check replacing
+// another one gets a different caller reference.
+func immutableConfigHash(config *route53.HealthCheckConfig) string {
+	hash := fnv.New32a()
+	_, _ = io.WriteString(hash, fmt.Sprintf("%s/%d", aws.StringValue(config.Type), aws.Int64Value(config.RequestInterval)))
+	return fmt.Sprintf("%x", hash.Sum32())
 }
 
 func strValuesEqual(str1, str2 *string) bool {
@@ -238,6 +647,51 @@ func intValuesEqual(int1, int2 *int64) bool {
 	return *int1 == *int2
 }
 
+// regionsEqual returns whether the regions are the same, the regions being
+// all the regions if empty.
+func regionsEqual(regions1, regions2 []*string) bool {
+	if len(regions1) == 0 {
+		regions1 = aws.StringSlice(route53.HealthCheckRegion_Values())
+	}
+	if len(regions2) == 0 {
+		regions2 = aws.StringSlice(route53.HealthCheckRegion_Values())
+	}
+	return stringSetsEqual(regions1, regions2)
+}
+
+func stringSetsEqual(values1, values2 []*string) bool {
+	return sets.NewString(aws.StringValueSlice(values1)...).Equal(sets.NewString(aws.StringValueSlice(values2)...))
+}
+
 func getHealthCheckId(endpoint *v1.Endpoint) (string, bool) {
 	return endpoint.GetProviderSpecific(ProviderSpecificHealthCheckID)
 }
+
+// getReplacedHealthCheckIds returns the IDs of the health checks replaced by
+// the health check of the endpoint, that are not deleted yet.
+func getReplacedHealthCheckIds(endpoint *v1.Endpoint) []string {
+	value, ok := endpoint.GetProviderSpecific(ProviderSpecificReplacedHealthCheckIDs)
+	if !ok || value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func setReplacedHealthCheckIds(endpoint *v1.Endpoint, ids []string) {
+	if len(ids) == 0 {
+		endpoint.DeleteProviderSpecific(ProviderSpecificReplacedHealthCheckIDs)
+		return
+	}
+	endpoint.SetProviderSpecific(ProviderSpecificReplacedHealthCheckIDs, strings.Join(ids, ","))
+}
+
+// getCalculatedHealthCheckId returns the ID of the calculated health check of
+// the endpoints of a DNS name.
+func getCalculatedHealthCheckId(endpoints []*v1.Endpoint) (string, bool) {
+	for _, endpoint := range endpoints {
+		if id, ok := endpoint.GetProviderSpecific(ProviderSpecificCalculatedHealthCheckID); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
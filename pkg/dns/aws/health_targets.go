@@ -0,0 +1,196 @@
+package aws
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/util/slice"
+)
+
+// reconcileTargets reconciles a health check for each address of the
+// endpoint, as the Route53 health checks probe a single address, and the
+// health check of the endpoint, that's a calculated health check healthy as
+// long as any of the addresses is healthy. This is the case of the endpoints
+// that group the load balancers of several workload clusters, e.g., the
+// primary endpoint of the failover routing policy, that only fails over once
+// all of them are unhealthy.
+func (r *Route53HealthCheckReconciler) reconcileTargets(ctx context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
+	// The calculated health check of the DNS name must be deleted first
+	if _, ok := endpoint.GetProviderSpecific(ProviderSpecificCalculatedHealthCheckID); ok {
+		return fmt.Errorf("%s: %w", endpoint.DNSName, errNestedCalculatedHealthCheck)
+	}
+
+	ids := getTargetHealthCheckIds(endpoint)
+	defer setTargetHealthCheckIds(endpoint, ids)
+
+	parentId, hasParent := getHealthCheckId(endpoint)
+	var children []*string
+	for _, target := range endpoint.Targets {
+		child := &v1.Endpoint{
+			DNSName:       endpoint.DNSName,
+			RecordType:    endpoint.RecordType,
+			SetIdentifier: target,
+			Targets:       v1.Targets{target},
+		}
+		if id, ok := ids[target]; ok {
+			child.SetProviderSpecific(ProviderSpecificHealthCheckID, id)
+		}
+		if hasParent {
+			child.SetProviderSpecific(ProviderSpecificCalculatedHealthCheckID, parentId)
+		}
+
+		childSpec := spec
+		childSpec.Id = fmt.Sprintf("%x", md5.Sum([]byte(spec.Id+"/"+target)))
+		childSpec.Name = fmt.Sprintf("%s-%s", spec.Name, target)
+		err := r.reconcileEndpoint(ctx, childSpec, child)
+		if id, ok := getHealthCheckId(child); ok {
+			ids[target] = id
+			children = append(children, aws.String(id))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	healthCheck, exists, err := r.findHealthCheck(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	config := &route53.HealthCheckConfig{
+		Type:              aws.String(route53.HealthCheckTypeCalculated),
+		ChildHealthChecks: children,
+		HealthThreshold:   aws.Int64(1),
+	}
+	switch {
+	case exists && aws.StringValue(healthCheck.HealthCheckConfig.Type) != route53.HealthCheckTypeCalculated:
+		// The endpoint had a single address
+		healthCheck, err = r.replaceHealthCheck(ctx, spec, endpoint, healthCheck, config)
+	case exists:
+		if diff := calculatedHealthCheckDiff(healthCheck, config.HealthThreshold, children); diff != nil {
+			r.logger.Info("Updating health check", "id", *healthCheck.Id, "change", diff)
+			_, err = r.client.UpdateHealthCheckWithContext(ctx, diff)
+		}
+	default:
+		healthCheck, err = r.createHealthCheck(ctx, spec, config)
+	}
+	if healthCheck != nil {
+		endpoint.SetProviderSpecific(ProviderSpecificHealthCheckID, *healthCheck.Id)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The health checks of the removed addresses can only be deleted once
+	// they are not children of the health check of the endpoint anymore
+	return r.deleteStaleTargetHealthChecks(ctx, endpoint, ids)
+}
+
+// deleteTargetHealthChecks deletes the health checks of the addresses of the
+// endpoint that are stale.
+func (r *Route53HealthCheckReconciler) deleteTargetHealthChecks(ctx context.Context, endpoint *v1.Endpoint) error {
+	ids := getTargetHealthCheckIds(endpoint)
+	defer setTargetHealthCheckIds(endpoint, ids)
+
+	return r.deleteStaleTargetHealthChecks(ctx, endpoint, ids)
+}
+
+// deleteStaleTargetHealthChecks deletes the health checks of the addresses
+// that are not targets of the endpoint anymore, or of all its addresses if it
+// has a single address, or no health check, and removes them from ids.
+func (r *Route53HealthCheckReconciler) deleteStaleTargetHealthChecks(ctx context.Context, endpoint *v1.Endpoint, ids map[string]string) error {
+	_, hasHealthCheck := getHealthCheckId(endpoint)
+	targets := make([]string, 0, len(ids))
+	for target := range ids {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		if hasHealthCheck && len(endpoint.Targets) > 1 && slice.ContainsString(endpoint.Targets, target) {
+			continue
+		}
+		_, err := r.client.DeleteHealthCheckWithContext(ctx, &route53.DeleteHealthCheckInput{
+			HealthCheckId: aws.String(ids[target]),
+		})
+		if awsErr, ok := err.(awserr.Error); err != nil && (!ok || awsErr.Code() != route53.ErrCodeNoSuchHealthCheck) {
+			return err
+		}
+		delete(ids, target)
+	}
+	return nil
+}
+
+// targetsStatus returns the health of the endpoint with several addresses,
+// that's healthy as long as any of its addresses is healthy.
+func (r *Route53HealthCheckReconciler) targetsStatus(ctx context.Context, endpoint *v1.Endpoint) (dns.HealthCheckStatus, error) {
+	ids := getTargetHealthCheckIds(endpoint)
+	var unhealthy, unknown *dns.HealthCheckStatus
+	for _, target := range endpoint.Targets {
+		id, ok := ids[target]
+		if !ok {
+			continue
+		}
+		status, err := r.status(ctx, id)
+		if err != nil {
+			return dns.HealthCheckStatus{}, err
+		}
+		status.Message = fmt.Sprintf("%s: %s", target, status.Message)
+		switch {
+		case status.State == v1.HealthCheckStateHealthy:
+			return dns.HealthCheckStatus{State: v1.HealthCheckStateHealthy}, nil
+		case status.State == v1.HealthCheckStateUnhealthy && unhealthy == nil:
+			unhealthy = &status
+		case status.State == v1.HealthCheckStateUnknown && unknown == nil:
+			unknown = &status
+		}
+	}
+
+	switch {
+	case unhealthy != nil:
+		return *unhealthy, nil
+	case unknown != nil:
+		return *unknown, nil
+	default:
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "The addresses of the endpoint have no health check"}, nil
+	}
+}
+
+// getTargetHealthCheckIds returns the IDs of the health checks of the
+// addresses of the endpoint, by address.
+func getTargetHealthCheckIds(endpoint *v1.Endpoint) map[string]string {
+	ids := map[string]string{}
+	value, ok := endpoint.GetProviderSpecific(ProviderSpecificTargetHealthCheckIDs)
+	if !ok || value == "" {
+		return ids
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			ids[parts[0]] = parts[1]
+		}
+	}
+	return ids
+}
+
+func setTargetHealthCheckIds(endpoint *v1.Endpoint, ids map[string]string) {
+	if len(ids) == 0 {
+		endpoint.DeleteProviderSpecific(ProviderSpecificTargetHealthCheckIDs)
+		return
+	}
+	pairs := make([]string, 0, len(ids))
+	for target, id := range ids {
+		pairs = append(pairs, target+"="+id)
+	}
+	sort.Strings(pairs)
+	endpoint.SetProviderSpecific(ProviderSpecificTargetHealthCheckIDs, strings.Join(pairs, ","))
+}
@@ -0,0 +1,290 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+func TestHealthCheckStatus(t *testing.T) {
+	fake := &fakeRoute53{
+		healthChecks: map[string]map[string]string{
+			"healthy":   {},
+			"unhealthy": {},
+			"pending":   {},
+		},
+		healthCheckObservations: map[string][]string{
+			"healthy": {
+				"Success: HTTP Status Code 200, OK",
+				"Failure: Connection timed out.",
+				"Success: HTTP Status Code 200, OK",
+			},
+			// Route53 considers the endpoint unhealthy, as less than 18% of the health checkers report it healthy
+			"unhealthy": {
+				"Success: HTTP Status Code 200, OK",
+				"Failure: HTTP Status Code 503, Service Unavailable",
+				"Failure: Connection timed out.",
+				"Failure: HTTP Status Code 503, Service Unavailable",
+				"Failure: HTTP Status Code 503, Service Unavailable",
+				"Failure: HTTP Status Code 503, Service Unavailable",
+			},
+		},
+	}
+	p := newTestProvider(t, fake)
+	r := newRoute53HealthCheckReconciler(p.route53, "", log.Logger)
+
+	endpoint := func(id string) *v1.Endpoint {
+		endpoint := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}}
+		if id != "" {
+			endpoint.SetProviderSpecific(ProviderSpecificHealthCheckID, id)
+		}
+		return endpoint
+	}
+
+	tests := []struct {
+		name     string
+		endpoint *v1.Endpoint
+		expected dns.HealthCheckStatus
+		err      bool
+	}{
+		{
+			name:     "healthy",
+			endpoint: endpoint("healthy"),
+			expected: dns.HealthCheckStatus{State: v1.HealthCheckStateHealthy},
+		},
+		{
+			name:     "unhealthy",
+			endpoint: endpoint("unhealthy"),
+			expected: dns.HealthCheckStatus{State: v1.HealthCheckStateUnhealthy, Message: "Failure: Connection timed out."},
+		},
+		{
+			name:     "not checked yet",
+			endpoint: endpoint("pending"),
+			expected: dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "No health checker has reported the health of the endpoint yet"},
+		},
+		{
+			name:     "no health check",
+			endpoint: endpoint(""),
+			expected: dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "The endpoint has no health check"},
+		},
+		{
+			name:     "deleted health check",
+			endpoint: endpoint("deleted"),
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			status, err := r.Status(context.Background(), tt.endpoint)
+			if tt.err {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(status).To(gomega.Equal(tt.expected))
+		})
+	}
+}
+
+func TestHealthCheckReconcile(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	fake := &fakeRoute53{}
+	p := newTestProvider(t, fake)
+	r := newRoute53HealthCheckReconciler(p.route53, "glbc", log.Logger)
+
+	port, https := int64(443), dns.HealthCheckProtocolHTTPS
+	interval := 10 * time.Second
+	spec := dns.HealthCheckSpec{
+		Id:           "abc",
+		Name:         "app.example.com-10.0.0.1",
+		Port:         &port,
+		Protocol:     &https,
+		Path:         "/healthz",
+		Interval:     &interval,
+		ExpectedBody: "ok",
+		Regions:      []string{"us-east-1", "eu-west-1", "ap-southeast-1"},
+		DNSRecord:    "default/app",
+	}
+	endpoint := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}}
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+
+	id, _ := getHealthCheckId(endpoint)
+	g.Expect(fake.healthChecks[id]).To(gomega.HaveKeyWithValue(dnsRecordTag, "default/app"))
+	g.Expect(fake.healthCheckConfigs[id]).To(gomega.Equal(&fakeHealthCheckConfig{
+		IPAddress:                aws.String("10.0.0.1"),
+		Port:                     aws.Int64(443),
+		Type:                     aws.String(route53.HealthCheckTypeHttpsStrMatch),
+		ResourcePath:             aws.String("/healthz"),
+		FullyQualifiedDomainName: aws.String("app.example.com"),
+		SearchString:             aws.String("ok"),
+		RequestInterval:          aws.Int64(10),
+		Inverted:                 aws.Bool(false),
+		EnableSNI:                aws.Bool(true),
+		Regions:                  []string{"us-east-1", "eu-west-1", "ap-southeast-1"},
+	}))
+
+	// The health check of the DNS name aggregates the health checks of its endpoints
+	threshold := int64(1)
+	parentSpec := dns.HealthCheckSpec{Id: "app", Name: "app.example.com", HealthThreshold: &threshold, DNSRecord: "default/app"}
+	g.Expect(r.ReconcileCalculated(ctx, parentSpec, []*v1.Endpoint{endpoint})).To(gomega.Succeed())
+	parentId, _ := endpoint.GetProviderSpecific(ProviderSpecificCalculatedHealthCheckID)
+	g.Expect(fake.healthCheckConfigs[parentId].Type).To(gomega.Equal(aws.String(route53.HealthCheckTypeCalculated)))
+	g.Expect(fake.healthCheckConfigs[parentId].ChildHealthChecks).To(gomega.Equal([]string{id}))
+	g.Expect(fake.healthCheckConfigs[parentId].HealthThreshold).To(gomega.Equal(aws.Int64(1)))
+
+	// The health check is updated
+	spec.Inverted = true
+	spec.Regions = nil
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	updated, _ := getHealthCheckId(endpoint)
+	g.Expect(updated).To(gomega.Equal(id))
+	g.Expect(fake.healthCheckConfigs[id].Inverted).To(gomega.Equal(aws.Bool(true)))
+	g.Expect(fake.healthCheckConfigs[id].Regions).To(gomega.BeEmpty())
+	g.Expect(healthCheckDiff(&route53.HealthCheck{Id: &id, HealthCheckConfig: &route53.HealthCheckConfig{
+		IPAddress:                aws.String("10.0.0.1"),
+		Port:                     aws.Int64(443),
+		ResourcePath:             aws.String("/healthz"),
+		FullyQualifiedDomainName: aws.String("app.example.com"),
+		SearchString:             aws.String("ok"),
+		Inverted:                 aws.Bool(true),
+		EnableSNI:                aws.Bool(true),
+		Regions:                  aws.StringSlice(route53.HealthCheckRegion_Values()),
+	}}, spec, endpoint)).To(gomega.BeNil())
+
+	// And replaced once its type or request interval changes, as they can't be updated
+	spec.Protocol = nil
+	spec.Port = nil
+	spec.Interval = nil
+	spec.ExpectedBody = ""
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	replacement, _ := getHealthCheckId(endpoint)
+	g.Expect(replacement).NotTo(gomega.Equal(id))
+	g.Expect(fake.deletedHealthChecks).To(gomega.Equal([]string{id}))
+	g.Expect(fake.healthCheckConfigs[replacement].Type).To(gomega.Equal(aws.String(route53.HealthCheckTypeHttp)))
+	g.Expect(fake.healthCheckConfigs[replacement].RequestInterval).To(gomega.Equal(aws.Int64(30)))
+	g.Expect(fake.healthCheckConfigs[replacement].EnableSNI).To(gomega.BeNil())
+	g.Expect(fake.healthCheckConfigs[parentId].ChildHealthChecks).To(gomega.Equal([]string{replacement}))
+
+	// The calculated health check is deleted before its children
+	g.Expect(r.DeleteCalculated(ctx, []*v1.Endpoint{endpoint})).To(gomega.Succeed())
+	g.Expect(r.Delete(ctx, endpoint)).To(gomega.Succeed())
+	g.Expect(fake.deletedHealthChecks).To(gomega.Equal([]string{id, parentId, replacement}))
+	g.Expect(endpoint.ProviderSpecific).To(gomega.BeEmpty())
+
+	// The health check deleted along with another endpoint sharing it is created again
+	endpoint.SetProviderSpecific(ProviderSpecificHealthCheckID, replacement)
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	recreated, _ := getHealthCheckId(endpoint)
+	g.Expect(recreated).NotTo(gomega.Equal(replacement))
+	g.Expect(fake.healthCheckConfigs).To(gomega.HaveKey(recreated))
+}
+
+func TestHealthCheckType(t *testing.T) {
+	http, https, tcp := dns.HealthCheckProtocolHTTP, dns.HealthCheckProtocolHTTPS, dns.HealthCheckProtocolTCP
+	tests := []struct {
+		name string
+		spec dns.HealthCheckSpec
+		want string
+	}{
+		{name: "default", want: route53.HealthCheckTypeHttp},
+		{name: "HTTP", spec: dns.HealthCheckSpec{Protocol: &http}, want: route53.HealthCheckTypeHttp},
+		{name: "HTTPS", spec: dns.HealthCheckSpec{Protocol: &https}, want: route53.HealthCheckTypeHttps},
+		{name: "HTTP string match", spec: dns.HealthCheckSpec{Protocol: &http, ExpectedBody: "ok"}, want: route53.HealthCheckTypeHttpStrMatch},
+		{name: "HTTPS string match", spec: dns.HealthCheckSpec{Protocol: &https, ExpectedBody: "ok"}, want: route53.HealthCheckTypeHttpsStrMatch},
+		{name: "TCP", spec: dns.HealthCheckSpec{Protocol: &tcp, ExpectedBody: "ok"}, want: route53.HealthCheckTypeTcp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aws.StringValue(healthCheckType(tt.spec)); got != tt.want {
+				t.Errorf("healthCheckType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthCheckReconcileTargets(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	fake := &fakeRoute53{}
+	p := newTestProvider(t, fake)
+	r := newRoute53HealthCheckReconciler(p.route53, "glbc", log.Logger)
+
+	port := int64(80)
+	spec := dns.HealthCheckSpec{Id: "abc", Name: "app.example.com-failover-primary", Port: &port, Path: "/healthz"}
+	endpoint := &v1.Endpoint{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "failover-primary", Targets: v1.Targets{"10.0.0.1"}}
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	single, _ := getHealthCheckId(endpoint)
+
+	// Each address of the primary workload clusters is health checked, and the
+	// endpoint is healthy as long as any of them is
+	published := endpoint.DeepCopy()
+	endpoint.Targets = v1.Targets{"10.0.0.1", "10.0.0.2"}
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	parent, _ := getHealthCheckId(endpoint)
+	ids := getTargetHealthCheckIds(endpoint)
+	g.Expect(ids).To(gomega.HaveLen(2))
+
+	// The replaced health check is only deleted once the record set uses the new one
+	g.Expect(fake.deletedHealthChecks).To(gomega.BeEmpty())
+	g.Expect(getReplacedHealthCheckIds(endpoint)).To(gomega.Equal([]string{single}))
+	g.Expect(r.DeleteReplaced(ctx, endpoint, []*v1.Endpoint{published})).To(gomega.Succeed())
+	g.Expect(fake.deletedHealthChecks).To(gomega.BeEmpty())
+	g.Expect(r.DeleteReplaced(ctx, endpoint, []*v1.Endpoint{endpoint.DeepCopy()})).To(gomega.Succeed())
+	g.Expect(fake.deletedHealthChecks).To(gomega.Equal([]string{single}))
+	_, ok := endpoint.GetProviderSpecific(ProviderSpecificReplacedHealthCheckIDs)
+	g.Expect(ok).To(gomega.BeFalse())
+
+	g.Expect(fake.healthCheckConfigs[parent].Type).To(gomega.Equal(aws.String(route53.HealthCheckTypeCalculated)))
+	g.Expect(fake.healthCheckConfigs[parent].HealthThreshold).To(gomega.Equal(aws.Int64(1)))
+	g.Expect(fake.healthCheckConfigs[parent].ChildHealthChecks).To(gomega.Equal([]string{ids["10.0.0.1"], ids["10.0.0.2"]}))
+	g.Expect(fake.healthCheckConfigs[ids["10.0.0.2"]].IPAddress).To(gomega.Equal(aws.String("10.0.0.2")))
+
+	fake.healthCheckObservations = map[string][]string{
+		ids["10.0.0.1"]: {"Failure: Connection timed out."},
+		ids["10.0.0.2"]: {"Success: HTTP Status Code 200, OK"},
+	}
+	g.Expect(r.Status(ctx, endpoint)).To(gomega.Equal(dns.HealthCheckStatus{State: v1.HealthCheckStateHealthy}))
+	fake.healthCheckObservations[ids["10.0.0.2"]] = []string{"Failure: HTTP Status Code 503, Service Unavailable"}
+	g.Expect(r.Status(ctx, endpoint)).To(gomega.Equal(dns.HealthCheckStatus{State: v1.HealthCheckStateUnhealthy, Message: "10.0.0.1: Failure: Connection timed out."}))
+
+	// The health checks of the removed addresses are deleted once the calculated health check is updated
+	endpoint.Targets = v1.Targets{"10.0.0.2", "10.0.0.3"}
+	g.Expect(r.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	removed := ids["10.0.0.1"]
+	ids = getTargetHealthCheckIds(endpoint)
+	g.Expect(ids).To(gomega.HaveLen(2))
+	g.Expect(ids).NotTo(gomega.HaveKey("10.0.0.1"))
+	g.Expect(fake.deletedHealthChecks).To(gomega.Equal([]string{single, removed}))
+	g.Expect(fake.healthCheckConfigs[parent].ChildHealthChecks).To(gomega.ConsistOf(ids["10.0.0.2"], ids["10.0.0.3"]))
+
+	// The calculated health checks of the DNS names can't aggregate the
+	// calculated health checks of the endpoints with several addresses
+	threshold := int64(1)
+	parentSpec := dns.HealthCheckSpec{Id: "app", Name: "app.example.com", HealthThreshold: &threshold}
+	err := r.ReconcileCalculated(ctx, parentSpec, []*v1.Endpoint{endpoint})
+	g.Expect(errors.Is(err, errNestedCalculatedHealthCheck)).To(gomega.BeTrue())
+	_, ok = endpoint.GetProviderSpecific(ProviderSpecificCalculatedHealthCheckID)
+	g.Expect(ok).To(gomega.BeFalse())
+	calculated := endpoint.DeepCopy()
+	calculated.SetProviderSpecific(ProviderSpecificCalculatedHealthCheckID, "hc-calculated")
+	err = r.Reconcile(ctx, spec, calculated)
+	g.Expect(errors.Is(err, errNestedCalculatedHealthCheck)).To(gomega.BeTrue())
+
+	g.Expect(r.Delete(ctx, endpoint)).To(gomega.Succeed())
+	g.Expect(fake.deletedHealthChecks).To(gomega.Equal([]string{single, removed, parent, ids["10.0.0.2"], ids["10.0.0.3"]}))
+	g.Expect(endpoint.ProviderSpecific).To(gomega.BeEmpty())
+}
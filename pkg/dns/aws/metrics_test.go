@@ -24,11 +24,18 @@ func TestRegister(t *testing.T) {
 	g := gomega.NewWithT(t)
 	g.Expect(operationLabelValues).To(gomega.ConsistOf(
 		"ListHostedZones",
+		"ListHostedZonesByName",
+		"GetHostedZone",
+		"GetChange",
+		"ListResourceRecordSets",
 		"ChangeResourceRecordSets",
 		"CreateHealthCheck",
 		"GetHealthCheckWithContext",
+		"GetHealthCheckStatusWithContext",
 		"UpdateHealthCheckWithContext",
 		"DeleteHealthCheckWithContext",
 		"ChangeTagsForResourceWithContext",
+		"ListHealthChecks",
+		"ListTagsForResources",
 	))
 }
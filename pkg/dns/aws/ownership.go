@@ -0,0 +1,396 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+const (
+	// ownershipRecordTTL is the TTL of the ownership TXT records
+	ownershipRecordTTL = 300
+	// maxTaggedResources is the maximum number of resources whose tags can be
+	// listed at once
+	maxTaggedResources = 10
+)
+
+var _ dns.ResourceOwner = &Provider{}
+
+// ownershipChanges returns the changes of the ownership records of the DNS
+// names of the record in the hosted zone, i.e., the ownership records of the
+// names of the record, and the deletion of the ownership records of the names
+// that are not published anymore.
+func (p *Provider) ownershipChanges(record *v1.DNSRecord, recordSets *recordSetsCache, action string) ([]*route53.Change, error) {
+	ownership := dns.Ownership{Owner: p.config.OwnerID, DNSRecord: dns.DNSRecordKey(record)}
+
+	names := dnsNames(record.Spec.Endpoints)
+	lastPublishedEndpoints, err := p.endpointsFromZoneStatus(record, recordSets.zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*route53.Change
+	var removedNames []string
+	if action == string(deleteAction) {
+		removedNames = dnsNames(append(append([]*v1.Endpoint{}, record.Spec.Endpoints...), lastPublishedEndpoints...))
+	} else {
+		for _, name := range names {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String(action),
+				ResourceRecordSet: ownershipRecordSet(name, ownership),
+			})
+		}
+		for _, name := range dnsNames(lastPublishedEndpoints) {
+			if !containsDNSName(names, name) {
+				removedNames = append(removedNames, name)
+			}
+		}
+	}
+
+	// The ownership records are only deleted if they exist, as the records
+	// published before ownership records existed don't have any
+	for _, name := range removedNames {
+		recordSet, current, err := recordSets.ownershipRecord(name)
+		if err != nil {
+			return nil, err
+		}
+		if recordSet != nil && current == ownership {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String(string(deleteAction)),
+				ResourceRecordSet: recordSet,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// foreignNames returns the DNS names of the record, and of the endpoints last
+// published for it, that are not owned by the record in the hosted zone, i.e.,
+// whose ownership record is owned by another GLBC instance or DNSRecord, or
+// that have records, but neither an ownership record nor a published endpoint
+// of the record, e.g., the records created by another tool.
+func (p *Provider) foreignNames(record *v1.DNSRecord, recordSets *recordSetsCache) ([]string, error) {
+	ownership := dns.Ownership{Owner: p.config.OwnerID, DNSRecord: dns.DNSRecordKey(record)}
+	zoneID := recordSets.zoneID
+
+	lastPublishedEndpoints, err := p.endpointsFromZoneStatus(record, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	publishedNames := dnsNames(lastPublishedEndpoints)
+
+	var names []string
+	for _, name := range dnsNames(append(append([]*v1.Endpoint{}, record.Spec.Endpoints...), lastPublishedEndpoints...)) {
+		recordSet, current, err := recordSets.ownershipRecord(name)
+		if err != nil {
+			return nil, err
+		}
+		if recordSet != nil {
+			if current != ownership {
+				p.logger.Info("DNS name is owned by another owner", "name", name, "zone", zoneID, "owner", current.Owner, "dnsRecord", current.DNSRecord)
+				names = append(names, name)
+			}
+			continue
+		}
+		// The names published before ownership records existed are adopted
+		if containsDNSName(publishedNames, name) {
+			continue
+		}
+		nameRecordSets, err := recordSets.list(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(ownedRecordSets(nameRecordSets)) > 0 {
+			p.logger.Info("DNS name has records without ownership record", "name", name, "zone", zoneID)
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ownedRecordSets returns the record sets of the types that are published for
+// the DNSRecords, and owned by the ownership records.
+func ownedRecordSets(recordSets []*route53.ResourceRecordSet) []*route53.ResourceRecordSet {
+	var owned []*route53.ResourceRecordSet
+	for _, recordSet := range recordSets {
+		switch aws.StringValue(recordSet.Type) {
+		case route53.RRTypeA, route53.RRTypeAaaa, route53.RRTypeCname:
+			owned = append(owned, recordSet)
+		}
+	}
+	return owned
+}
+
+// withoutNames returns the changes of the records whose name is not one of
+// the DNS names.
+func withoutNames(changes []*route53.Change, names []string) []*route53.Change {
+	var filtered []*route53.Change
+	for _, change := range changes {
+		if !containsDNSName(names, aws.StringValue(change.ResourceRecordSet.Name)) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// recordSetsCache lists the record sets of the DNS names in a hosted zone,
+// once per DNS name, so that the ownership of the names of a record is only
+// looked up once while its changes are computed.
+type recordSetsCache struct {
+	provider   *Provider
+	zoneID     string
+	recordSets map[string][]*route53.ResourceRecordSet
+}
+
+func (p *Provider) newRecordSetsCache(zoneID string) *recordSetsCache {
+	return &recordSetsCache{
+		provider:   p,
+		zoneID:     zoneID,
+		recordSets: map[string][]*route53.ResourceRecordSet{},
+	}
+}
+
+// list returns the record sets with the DNS name in the hosted zone.
+func (c *recordSetsCache) list(dnsName string) ([]*route53.ResourceRecordSet, error) {
+	name := normalizeRecordName(dnsName)
+	if recordSets, ok := c.recordSets[name]; ok {
+		return recordSets, nil
+	}
+	recordSets, err := c.provider.listRecordSets(dnsName, c.zoneID)
+	if err != nil {
+		return nil, err
+	}
+	c.recordSets[name] = recordSets
+	return recordSets, nil
+}
+
+// ownershipRecord returns the ownership TXT record of the DNS name in the
+// hosted zone, and its ownership, or nil if it doesn't exist.
+func (c *recordSetsCache) ownershipRecord(dnsName string) (*route53.ResourceRecordSet, dns.Ownership, error) {
+	recordSets, err := c.list(dns.OwnershipRecordName(dnsName))
+	if err != nil {
+		return nil, dns.Ownership{}, err
+	}
+	for _, recordSet := range recordSets {
+		if aws.StringValue(recordSet.Type) != route53.RRTypeTxt {
+			continue
+		}
+		for _, resourceRecord := range recordSet.ResourceRecords {
+			if ownership, ok := dns.ParseOwnership(aws.StringValue(resourceRecord.Value)); ok {
+				return recordSet, ownership, nil
+			}
+		}
+	}
+	return nil, dns.Ownership{}, nil
+}
+
+// OwnedResources returns the DNS names whose ownership records, in the hosted
+// zones, are owned by the GLBC instance, and the health checks tagged with the
+// GLBC instance as owner.
+func (p *Provider) OwnedResources(zones []v1.DNSZone) ([]dns.OwnedResource, error) {
+	if p.config.OwnerID == "" {
+		return nil, nil
+	}
+
+	var resources []dns.OwnedResource
+	for _, zone := range zones {
+		input := &route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(zone.ID)}
+		for {
+			output, err := p.route53.ListResourceRecordSets(input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list records in zone %s: %v", zone.ID, err)
+			}
+			for _, recordSet := range output.ResourceRecordSets {
+				if aws.StringValue(recordSet.Type) != route53.RRTypeTxt {
+					continue
+				}
+				name, ok := dns.OwnedDNSName(strings.TrimSuffix(unescapeRecordName(aws.StringValue(recordSet.Name)), "."))
+				if !ok {
+					continue
+				}
+				for _, resourceRecord := range recordSet.ResourceRecords {
+					if ownership, ok := dns.ParseOwnership(aws.StringValue(resourceRecord.Value)); ok && ownership.Owner == p.config.OwnerID {
+						resources = append(resources, dns.OwnedResource{
+							Kind:      dns.OwnedResourceKindRecords,
+							ID:        name,
+							Zone:      zone,
+							DNSRecord: ownership.DNSRecord,
+						})
+					}
+				}
+			}
+			if !aws.BoolValue(output.IsTruncated) {
+				break
+			}
+			input.StartRecordName = output.NextRecordName
+			input.StartRecordType = output.NextRecordType
+			input.StartRecordIdentifier = output.NextRecordIdentifier
+		}
+	}
+
+	healthChecks, err := p.ownedHealthChecks()
+	if err != nil {
+		return nil, err
+	}
+	return append(resources, healthChecks...), nil
+}
+
+// ownedHealthChecks returns the health checks tagged with the GLBC instance
+// as owner. Only the tags of the health checks created by the GLBC, i.e.,
+// whose caller reference has the GLBC prefix, are fetched.
+func (p *Provider) ownedHealthChecks() ([]dns.OwnedResource, error) {
+	var ids []*string
+	input := &route53.ListHealthChecksInput{}
+	for {
+		output, err := p.route53.ListHealthChecks(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list health checks: %v", err)
+		}
+		for _, healthCheck := range output.HealthChecks {
+			if strings.HasPrefix(aws.StringValue(healthCheck.CallerReference), callerReferencePrefix) {
+				ids = append(ids, healthCheck.Id)
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		input.Marker = output.NextMarker
+	}
+
+	var resources []dns.OwnedResource
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxTaggedResources {
+			n = maxTaggedResources
+		}
+		output, err := p.route53.ListTagsForResources(&route53.ListTagsForResourcesInput{
+			ResourceIds:  ids[:n],
+			ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the tags of health checks: %v", err)
+		}
+		ids = ids[n:]
+
+		for _, tagSet := range output.ResourceTagSets {
+			tags := map[string]string{}
+			for _, tag := range tagSet.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			if tags[ownerTag] != p.config.OwnerID || tags[dnsRecordTag] == "" {
+				continue
+			}
+			resources = append(resources, dns.OwnedResource{
+				Kind:      dns.OwnedResourceKindHealthCheck,
+				ID:        aws.StringValue(tagSet.ResourceId),
+				DNSRecord: tags[dnsRecordTag],
+			})
+		}
+	}
+	return resources, nil
+}
+
+// ResourceInUse returns whether the DNS name is the DNS name of an endpoint
+// of the DNSRecord, or whether the health check, calculated health check, or
+// health check of an address, is set on an endpoint of the DNSRecord.
+func (p *Provider) ResourceInUse(resource dns.OwnedResource, record *v1.DNSRecord) bool {
+	endpoints := append([]*v1.Endpoint{}, record.Spec.Endpoints...)
+	for _, status := range record.Status.Zones {
+		endpoints = append(endpoints, status.Endpoints...)
+	}
+	for _, endpoint := range endpoints {
+		switch resource.Kind {
+		case dns.OwnedResourceKindRecords:
+			if normalizeRecordName(endpoint.DNSName) == normalizeRecordName(resource.ID) {
+				return true
+			}
+		case dns.OwnedResourceKindHealthCheck:
+			if id, ok := getHealthCheckId(endpoint); ok && id == resource.ID {
+				return true
+			}
+			if id, ok := endpoint.GetProviderSpecific(ProviderSpecificCalculatedHealthCheckID); ok && id == resource.ID {
+				return true
+			}
+			for _, id := range getTargetHealthCheckIds(endpoint) {
+				if id == resource.ID {
+					return true
+				}
+			}
+			for _, id := range getReplacedHealthCheckIds(endpoint) {
+				if id == resource.ID {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// DeleteOwnedResource deletes the records of the DNS name, along with its
+// ownership record, or the health check.
+func (p *Provider) DeleteOwnedResource(resource dns.OwnedResource) error {
+	switch resource.Kind {
+	case dns.OwnedResourceKindRecords:
+		cache := p.newRecordSetsCache(resource.Zone.ID)
+		recordSets, err := cache.list(resource.ID)
+		if err != nil {
+			return err
+		}
+		var changes []*route53.Change
+		for _, recordSet := range ownedRecordSets(recordSets) {
+			changes = append(changes, &route53.Change{Action: aws.String(string(deleteAction)), ResourceRecordSet: recordSet})
+		}
+		ownershipRecordSet, ownership, err := cache.ownershipRecord(resource.ID)
+		if err != nil {
+			return err
+		}
+		if ownershipRecordSet == nil || ownership.Owner != p.config.OwnerID || ownership.DNSRecord != resource.DNSRecord {
+			return fmt.Errorf("records %s are not owned by %s anymore", resource.ID, resource.DNSRecord)
+		}
+		changes = append(changes, &route53.Change{Action: aws.String(string(deleteAction)), ResourceRecordSet: ownershipRecordSet})
+		_, err = p.batcher.wait(p.batcher.submit(resource.Zone.ID, changes))
+		return err
+
+	case dns.OwnedResourceKindHealthCheck:
+		_, err := p.route53.DeleteHealthCheckWithContext(aws.BackgroundContext(), &route53.DeleteHealthCheckInput{HealthCheckId: aws.String(resource.ID)})
+		return err
+	}
+	return fmt.Errorf("unsupported resource kind %s", resource.Kind)
+}
+
+// ownershipRecordSet returns the ownership TXT record of the DNS name.
+func ownershipRecordSet(dnsName string, ownership dns.Ownership) *route53.ResourceRecordSet {
+	return &route53.ResourceRecordSet{
+		Name: aws.String(dns.OwnershipRecordName(dnsName)),
+		Type: aws.String(route53.RRTypeTxt),
+		TTL:  aws.Int64(ownershipRecordTTL),
+		ResourceRecords: []*route53.ResourceRecord{
+			{Value: aws.String(`"` + ownership.String() + `"`)},
+		},
+	}
+}
+
+// dnsNames returns the distinct DNS names of the endpoints.
+func dnsNames(endpoints []*v1.Endpoint) []string {
+	var names []string
+	for _, endpoint := range endpoints {
+		if !containsDNSName(names, endpoint.DNSName) {
+			names = append(names, endpoint.DNSName)
+		}
+	}
+	return names
+}
+
+func containsDNSName(names []string, name string) bool {
+	for _, n := range names {
+		if normalizeRecordName(n) == normalizeRecordName(name) {
+			return true
+		}
+	}
+	return false
+}
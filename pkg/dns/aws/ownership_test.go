@@ -0,0 +1,250 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+func txtRecordSet(name, value string) *route53.ResourceRecordSet {
+	return &route53.ResourceRecordSet{
+		Name:            aws.String(name),
+		Type:            aws.String(route53.RRTypeTxt),
+		TTL:             aws.Int64(ownershipRecordTTL),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"` + value + `"`)}},
+	}
+}
+
+func TestOwnershipChanges(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ours := dns.Ownership{Owner: "glbc", DNSRecord: "default/app"}
+	fake := &fakeRoute53{
+		recordSets: []*route53.ResourceRecordSet{
+			txtRecordSet("_glbc-owner.app.example.com.", ours.String()),
+			txtRecordSet("_glbc-owner.old.example.com.", ours.String()),
+			txtRecordSet("_glbc-owner.other.example.com.", dns.Ownership{Owner: "other", DNSRecord: "default/app"}.String()),
+		},
+	}
+	p := newTestProvider(t, fake)
+	p.config.OwnerID = "glbc"
+
+	record := &v1.DNSRecord{}
+	record.Namespace = "default"
+	record.Name = "app"
+	record.Spec.Endpoints = []*v1.Endpoint{
+		{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}},
+		{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "10.0.0.2", Targets: v1.Targets{"10.0.0.2"}},
+	}
+	record.Status.Zones = []v1.DNSZoneStatus{{
+		DNSZone: v1.DNSZone{ID: "ZEXAMPLE"},
+		Endpoints: []*v1.Endpoint{
+			{DNSName: "app.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}},
+			{DNSName: "old.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}},
+			{DNSName: "other.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}},
+		},
+	}}
+
+	changes, err := p.ownershipChanges(record, p.newRecordSetsCache("ZEXAMPLE"), string(upsertAction))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(changes).To(gomega.HaveLen(2))
+	g.Expect(aws.StringValue(changes[0].Action)).To(gomega.Equal(string(upsertAction)))
+	g.Expect(changes[0].ResourceRecordSet).To(gomega.Equal(txtRecordSet("_glbc-owner.app.example.com", ours.String())))
+	// The ownership record of the names owned by another instance is kept
+	g.Expect(aws.StringValue(changes[1].Action)).To(gomega.Equal(string(deleteAction)))
+	g.Expect(aws.StringValue(changes[1].ResourceRecordSet.Name)).To(gomega.Equal("_glbc-owner.old.example.com."))
+
+	changes, err = p.ownershipChanges(record, p.newRecordSetsCache("ZEXAMPLE"), string(deleteAction))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(changes).To(gomega.HaveLen(2))
+	g.Expect(aws.StringValue(changes[0].ResourceRecordSet.Name)).To(gomega.Equal("_glbc-owner.app.example.com."))
+	g.Expect(aws.StringValue(changes[1].ResourceRecordSet.Name)).To(gomega.Equal("_glbc-owner.old.example.com."))
+}
+
+func TestEnsureListsRecordSetsOnce(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ours := dns.Ownership{Owner: "glbc", DNSRecord: "default/app"}
+	fake := &fakeRoute53{
+		writable: true,
+		recordSets: []*route53.ResourceRecordSet{
+			txtRecordSet("_glbc-owner.app.example.com.", ours.String()),
+			txtRecordSet("_glbc-owner.old.example.com.", ours.String()),
+		},
+	}
+	p := newTestProvider(t, fake)
+	p.config.OwnerID = "glbc"
+
+	record := &v1.DNSRecord{}
+	record.Namespace = "default"
+	record.Name = "app"
+	record.Spec.Endpoints = []*v1.Endpoint{
+		{DNSName: "app.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60},
+		{DNSName: "new.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60},
+	}
+	record.Status.Zones = []v1.DNSZoneStatus{{
+		DNSZone:   v1.DNSZone{ID: "ZEXAMPLE"},
+		Endpoints: []*v1.Endpoint{{DNSName: "old.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60}},
+	}}
+
+	g.Expect(p.Ensure(record, v1.DNSZone{ID: "ZEXAMPLE"})).To(gomega.Succeed())
+	// The ownership of the removed name is looked up once, for both the
+	// foreign names and the ownership changes
+	g.Expect(fake.listedNames).To(gomega.ConsistOf(
+		"_glbc-owner.app.example.com.",
+		"_glbc-owner.new.example.com.",
+		"new.example.com.",
+		"_glbc-owner.old.example.com.",
+	))
+}
+
+func TestOwnedResources(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{
+		recordSets: []*route53.ResourceRecordSet{
+			txtRecordSet("_glbc-owner.app.example.com.", dns.Ownership{Owner: "glbc", DNSRecord: "default/app"}.String()),
+			txtRecordSet("_glbc-owner.other.example.com.", dns.Ownership{Owner: "other", DNSRecord: "default/other"}.String()),
+			{Name: aws.String("app.example.com."), Type: aws.String("A"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}}},
+			txtRecordSet("app.example.com.", "v=spf1 -all"),
+		},
+		healthChecks: map[string]map[string]string{
+			"hc-1": {ownerTag: "glbc", dnsRecordTag: "default/app"},
+			"hc-2": {ownerTag: "other", dnsRecordTag: "default/other"},
+			"hc-3": {},
+			"hc-4": {ownerTag: "glbc", dnsRecordTag: "default/app"},
+		},
+		// The health checks without the GLBC caller reference prefix are ignored
+		callerReferences: map[string]string{
+			"hc-1": callerReferencePrefix + "hc-1",
+			"hc-2": callerReferencePrefix + "hc-2",
+			"hc-3": callerReferencePrefix + "hc-3",
+			"hc-4": "hc-4",
+		},
+	}
+	p := newTestProvider(t, fake)
+
+	resources, err := p.OwnedResources([]v1.DNSZone{{ID: "ZEXAMPLE"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resources).To(gomega.BeEmpty())
+
+	p.config.OwnerID = "glbc"
+	resources, err = p.OwnedResources([]v1.DNSZone{{ID: "ZEXAMPLE"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resources).To(gomega.Equal([]dns.OwnedResource{
+		{Kind: dns.OwnedResourceKindRecords, ID: "app.example.com", Zone: v1.DNSZone{ID: "ZEXAMPLE"}, DNSRecord: "default/app"},
+		{Kind: dns.OwnedResourceKindHealthCheck, ID: "hc-1", DNSRecord: "default/app"},
+	}))
+	g.Expect(fake.taggedHealthChecks).NotTo(gomega.ContainElement("hc-4"))
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{{DNSName: "app.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}}}
+	g.Expect(p.ResourceInUse(resources[0], record)).To(gomega.BeTrue())
+	g.Expect(p.ResourceInUse(resources[1], record)).To(gomega.BeFalse())
+
+	record.Spec.Endpoints[0].SetProviderSpecific(ProviderSpecificHealthCheckID, "hc-1")
+	g.Expect(p.ResourceInUse(resources[1], record)).To(gomega.BeTrue())
+}
+
+func TestDeleteOwnedResource(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	fake := &fakeRoute53{
+		writable: true,
+		recordSets: []*route53.ResourceRecordSet{
+			txtRecordSet("_glbc-owner.app.example.com.", dns.Ownership{Owner: "glbc", DNSRecord: "default/app"}.String()),
+			{Name: aws.String("app.example.com."), Type: aws.String("A"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}}},
+			txtRecordSet("app.example.com.", "v=spf1 -all"),
+		},
+		healthChecks: map[string]map[string]string{
+			"hc-1": {ownerTag: "glbc", dnsRecordTag: "default/app"},
+		},
+	}
+	p := newTestProvider(t, fake)
+	p.config.OwnerID = "glbc"
+
+	// The records are not deleted once owned by another DNSRecord
+	err := p.DeleteOwnedResource(dns.OwnedResource{Kind: dns.OwnedResourceKindRecords, ID: "app.example.com", Zone: v1.DNSZone{ID: "ZEXAMPLE"}, DNSRecord: "default/other"})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(fake.batches).To(gomega.BeEmpty())
+
+	err = p.DeleteOwnedResource(dns.OwnedResource{Kind: dns.OwnedResourceKindRecords, ID: "app.example.com", Zone: v1.DNSZone{ID: "ZEXAMPLE"}, DNSRecord: "default/app"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.batches).To(gomega.Equal([][]string{{"app.example.com.", "_glbc-owner.app.example.com."}}))
+
+	err = p.DeleteOwnedResource(dns.OwnedResource{Kind: dns.OwnedResourceKindHealthCheck, ID: "hc-1", DNSRecord: "default/app"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.deletedHealthChecks).To(gomega.Equal([]string{"hc-1"}))
+}
+
+func TestEnsureOwnershipConflict(t *testing.T) {
+	fake := &fakeRoute53{
+		writable: true,
+		recordSets: []*route53.ResourceRecordSet{
+			txtRecordSet("_glbc-owner.other.example.com.", dns.Ownership{Owner: "other", DNSRecord: "default/app"}.String()),
+			{Name: aws.String("foreign.example.com."), Type: aws.String("A"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.9")}}},
+			{Name: aws.String("legacy.example.com."), Type: aws.String("A"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}}},
+		},
+	}
+	p := newTestProvider(t, fake)
+	p.config.OwnerID = "glbc"
+
+	zone := v1.DNSZone{ID: "ZEXAMPLE"}
+	recordFor := func(name string, published ...string) *v1.DNSRecord {
+		record := &v1.DNSRecord{}
+		record.Namespace = "default"
+		record.Name = "app"
+		record.Spec.Endpoints = []*v1.Endpoint{{DNSName: name, RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60}}
+		status := v1.DNSZoneStatus{DNSZone: zone}
+		for _, name := range published {
+			status.Endpoints = append(status.Endpoints, &v1.Endpoint{DNSName: name, RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60})
+		}
+		record.Status.Zones = []v1.DNSZoneStatus{status}
+		return record
+	}
+
+	cases := []struct {
+		name     string
+		record   *v1.DNSRecord
+		conflict bool
+		batch    []string
+	}{
+		{name: "unowned name", record: recordFor("app.example.com"), batch: []string{"app.example.com", "_glbc-owner.app.example.com"}},
+		{name: "name owned by another instance", record: recordFor("other.example.com"), conflict: true},
+		{name: "name with foreign records", record: recordFor("foreign.example.com"), conflict: true},
+		{name: "name published before ownership records", record: recordFor("legacy.example.com", "legacy.example.com"), batch: []string{"legacy.example.com", "_glbc-owner.legacy.example.com"}},
+		{name: "previously published name owned by another instance", record: recordFor("app.example.com", "other.example.com"), batch: []string{"app.example.com", "_glbc-owner.app.example.com"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			fake.mu.Lock()
+			fake.batches = nil
+			fake.mu.Unlock()
+
+			err := p.Ensure(tc.record, zone)
+			if tc.conflict {
+				g.Expect(dns.IsOwnershipConflict(err)).To(gomega.BeTrue())
+				g.Expect(fake.batches).To(gomega.BeEmpty())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(fake.batches).To(gomega.Equal([][]string{tc.batch}))
+		})
+	}
+
+	// The records of the names owned by another instance are not deleted
+	g := gomega.NewWithT(t)
+	fake.batches = nil
+	record := recordFor("legacy.example.com", "legacy.example.com", "other.example.com")
+	record.Spec.Endpoints = record.Status.Zones[0].Endpoints
+	err := p.Delete(record, zone)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.batches).To(gomega.Equal([][]string{{"legacy.example.com"}}))
+}
@@ -0,0 +1,226 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultResourceManagerEndpoint is the base URL of the Azure Resource Manager API.
+	DefaultResourceManagerEndpoint = "https://management.azure.com"
+
+	dnsAPIVersion            = "2018-05-01"
+	trafficManagerAPIVersion = "2022-04-01"
+)
+
+// TrafficManagerProfile is an Azure Traffic Manager profile.
+// See https://docs.microsoft.com/en-us/rest/api/trafficmanager/profiles
+type TrafficManagerProfile struct {
+	Name       string                          `json:"name,omitempty"`
+	Location   string                          `json:"location"`
+	Tags       map[string]string               `json:"tags,omitempty"`
+	Properties TrafficManagerProfileProperties `json:"properties"`
+}
+
+// TrafficManagerProfileProperties are the properties of a Traffic Manager profile.
+type TrafficManagerProfileProperties struct {
+	ProfileStatus        string                    `json:"profileStatus,omitempty"`
+	TrafficRoutingMethod string                    `json:"trafficRoutingMethod"`
+	DNSConfig            DNSConfig                 `json:"dnsConfig"`
+	MonitorConfig        MonitorConfig             `json:"monitorConfig"`
+	Endpoints            []*TrafficManagerEndpoint `json:"endpoints,omitempty"`
+}
+
+// DNSConfig is the DNS configuration of a Traffic Manager profile.
+type DNSConfig struct {
+	RelativeName string `json:"relativeName"`
+	FQDN         string `json:"fqdn,omitempty"`
+	TTL          int64  `json:"ttl"`
+}
+
+// MonitorConfig is the endpoint monitoring configuration of a Traffic Manager profile.
+type MonitorConfig struct {
+	Protocol                  string `json:"protocol"`
+	Port                      int64  `json:"port"`
+	Path                      string `json:"path,omitempty"`
+	IntervalInSeconds         int64  `json:"intervalInSeconds,omitempty"`
+	TimeoutInSeconds          int64  `json:"timeoutInSeconds,omitempty"`
+	ToleratedNumberOfFailures *int64 `json:"toleratedNumberOfFailures,omitempty"`
+}
+
+// TrafficManagerEndpoint is an endpoint of a Traffic Manager profile.
+type TrafficManagerEndpoint struct {
+	Name       string                           `json:"name"`
+	Type       string                           `json:"type"`
+	Properties TrafficManagerEndpointProperties `json:"properties"`
+}
+
+// TrafficManagerEndpointProperties are the properties of a Traffic Manager endpoint.
+type TrafficManagerEndpointProperties struct {
+	Target         string `json:"target"`
+	EndpointStatus string `json:"endpointStatus,omitempty"`
+	Weight         int64  `json:"weight,omitempty"`
+	AlwaysServe    string `json:"alwaysServe,omitempty"`
+}
+
+// RecordSet is an Azure DNS record set.
+// See https://docs.microsoft.com/en-us/rest/api/dns/record-sets
+type RecordSet struct {
+	Name       string              `json:"name,omitempty"`
+	Properties RecordSetProperties `json:"properties"`
+}
+
+// RecordSetProperties are the properties of an Azure DNS record set.
+type RecordSetProperties struct {
+	TTL         int64             `json:"TTL"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CNAMERecord *CNAMERecord      `json:"CNAMERecord,omitempty"`
+}
+
+// CNAMERecord is the value of a CNAME record set.
+type CNAMERecord struct {
+	CNAME string `json:"cname"`
+}
+
+type zonesListResponse struct {
+	Value []struct {
+		Name string `json:"name"`
+	} `json:"value"`
+}
+
+// apiError is the error payload returned by Azure Resource Manager.
+type apiError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("azure: error %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+func isNotFound(err error) bool {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// resourceManagerClient is a minimal client for the Azure DNS and Traffic
+// Manager REST APIs, covering only the operations required by the provider.
+type resourceManagerClient struct {
+	httpClient     *http.Client
+	endpoint       string
+	subscriptionID string
+	resourceGroup  string
+}
+
+func (c *resourceManagerClient) listDNSZones(ctx context.Context) (*zonesListResponse, error) {
+	result := &zonesListResponse{}
+	path := fmt.Sprintf("%s/dnszones?api-version=%s&$top=1", c.resourceGroupURL(), dnsAPIVersion)
+	if err := c.do(ctx, http.MethodGet, path, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *resourceManagerClient) createOrUpdateCNAMERecordSet(ctx context.Context, zone, name string, recordSet *RecordSet) error {
+	return c.do(ctx, http.MethodPut, c.recordSetURL(zone, name), recordSet, nil)
+}
+
+func (c *resourceManagerClient) deleteCNAMERecordSet(ctx context.Context, zone, name string) error {
+	return c.do(ctx, http.MethodDelete, c.recordSetURL(zone, name), nil, nil)
+}
+
+func (c *resourceManagerClient) getProfile(ctx context.Context, name string) (*TrafficManagerProfile, error) {
+	result := &TrafficManagerProfile{}
+	if err := c.do(ctx, http.MethodGet, c.profileURL(name), nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *resourceManagerClient) createOrUpdateProfile(ctx context.Context, profile *TrafficManagerProfile) error {
+	return c.do(ctx, http.MethodPut, c.profileURL(profile.Name), profile, nil)
+}
+
+func (c *resourceManagerClient) deleteProfile(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, c.profileURL(name), nil, nil)
+}
+
+func (c *resourceManagerClient) resourceGroupURL() string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network", c.endpoint, c.subscriptionID, c.resourceGroup)
+}
+
+func (c *resourceManagerClient) recordSetURL(zone, name string) string {
+	return fmt.Sprintf("%s/dnsZones/%s/CNAME/%s?api-version=%s", c.resourceGroupURL(), zone, name, dnsAPIVersion)
+}
+
+func (c *resourceManagerClient) profileURL(name string) string {
+	return fmt.Sprintf("%s/trafficmanagerprofiles/%s?api-version=%s", c.resourceGroupURL(), name, trafficManagerAPIVersion)
+}
+
+func (c *resourceManagerClient) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		payload := struct {
+			Error *apiError `json:"error"`
+		}{}
+		if err := json.Unmarshal(data, &payload); err != nil || payload.Error == nil {
+			return &apiError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		}
+		payload.Error.StatusCode = resp.StatusCode
+		return payload.Error
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,366 @@
+package azure
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/oauth2/clientcredentials"
+
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+const (
+	ProviderSpecificMonitorProtocol          = "azure/monitor-protocol"
+	ProviderSpecificMonitorPort              = "azure/monitor-port"
+	ProviderSpecificMonitorPath              = "azure/monitor-path"
+	ProviderSpecificMonitorToleratedFailures = "azure/monitor-tolerated-failures"
+
+	trafficManagerDomain    = "trafficmanager.net"
+	trafficManagerLocation  = "global"
+	routingMethodWeighted   = "Weighted"
+	externalEndpointType    = "Microsoft.Network/trafficManagerProfiles/externalEndpoints"
+	endpointStatusEnabled   = "Enabled"
+	endpointStatusDisabled  = "Disabled"
+	alwaysServeEnabled      = "Enabled"
+	alwaysServeDisabled     = "Disabled"
+	maxTrafficManagerWeight = 1000
+	maxRelativeNameLength   = 63
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]`)
+
+var _ dns.Provider = &Provider{}
+
+// Provider publishes DNS records to Azure DNS zones.
+//
+// As Azure DNS has no weighted record sets, each DNS name is backed by a
+// weighted Traffic Manager profile holding one external endpoint per DNS
+// endpoint, and the DNS name is published as a CNAME to the profile.
+type Provider struct {
+	client                *resourceManagerClient
+	healthCheckReconciler *TrafficManagerHealthCheckReconciler
+	config                Config
+	logger                logr.Logger
+}
+
+// Config is the necessary input to configure the provider.
+type Config struct {
+	// SubscriptionID is the Azure subscription the DNS zones belong to.
+	SubscriptionID string
+	// ResourceGroup is the resource group of the DNS zones, where the
+	// Traffic Manager profiles are created as well.
+	ResourceGroup string
+	// TenantID, ClientID and ClientSecret are the service principal
+	// credentials used when no HTTPClient is provided.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// Endpoint overrides the Azure Resource Manager base URL.
+	Endpoint string
+	// HTTPClient is the authenticated client used to call the APIs.
+	HTTPClient *http.Client
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.SubscriptionID == "" || config.ResourceGroup == "" {
+		return nil, fmt.Errorf("an Azure subscription and resource group are required")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultResourceManagerEndpoint
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		credentials := clientcredentials.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			TokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", config.TenantID),
+			Scopes:       []string{DefaultResourceManagerEndpoint + "/.default"},
+		}
+		httpClient = credentials.Client(context.Background())
+	}
+
+	p := &Provider{
+		client: &resourceManagerClient{
+			httpClient:     httpClient,
+			endpoint:       strings.TrimSuffix(endpoint, "/"),
+			subscriptionID: config.SubscriptionID,
+			resourceGroup:  config.ResourceGroup,
+		},
+		config: config,
+		logger: log.Logger.WithName("azure-dns").WithValues("resourceGroup", config.ResourceGroup),
+	}
+	if err := validateServiceEndpoints(p); err != nil {
+		return nil, fmt.Errorf("failed to validate Azure provider service endpoints: %v", err)
+	}
+	return p, nil
+}
+
+// validateServiceEndpoints validates that the provider client can communicate
+// with Azure Resource Manager by listing the DNS zones of the resource group.
+func validateServiceEndpoints(provider *Provider) error {
+	var errs []error
+	if _, err := provider.client.listDNSZones(context.Background()); err != nil {
+		errs = append(errs, fmt.Errorf("failed to list Azure DNS zones: %v", err))
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+func (p *Provider) Ensure(record *v1.DNSRecord, zone v1.DNSZone) error {
+	ctx := context.Background()
+
+	desired, err := endpointsByName(record.Spec.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	for name, endpoints := range desired {
+		profile := profileForEndpoints(name, endpoints)
+		if err := p.client.createOrUpdateProfile(ctx, profile); err != nil {
+			return fmt.Errorf("couldn't update Traffic Manager profile %s: %v", profile.Name, err)
+		}
+
+		recordSet := &RecordSet{
+			Properties: RecordSetProperties{
+				TTL:         int64(endpoints[0].RecordTTL),
+				CNAMERecord: &CNAMERecord{CNAME: fmt.Sprintf("%s.%s", profile.Properties.DNSConfig.RelativeName, trafficManagerDomain)},
+			},
+		}
+		if err := p.client.createOrUpdateCNAMERecordSet(ctx, zone.ID, relativeRecordName(name, zone.ID), recordSet); err != nil {
+			return fmt.Errorf("couldn't update DNS record %s in zone %s: %v", record.Name, zone.ID, err)
+		}
+	}
+
+	// Delete any previously published names that are no longer present in record.Spec.Endpoints
+	published, err := endpointsByName(dns.EndpointsFromZoneStatus(record, zone.ID))
+	if err != nil {
+		return err
+	}
+	for name := range published {
+		if _, found := desired[name]; found {
+			continue
+		}
+		if err := p.deleteName(ctx, name, zone); err != nil {
+			return err
+		}
+	}
+
+	p.logger.Info("Upserted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+func (p *Provider) Delete(record *v1.DNSRecord, zone v1.DNSZone) error {
+	ctx := context.Background()
+
+	desired, err := endpointsByName(record.Spec.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	// Names that were previously published but are no longer present in
+	// record.Spec.Endpoints have to be removed as well
+	published, err := endpointsByName(dns.EndpointsFromZoneStatus(record, zone.ID))
+	if err != nil {
+		return err
+	}
+	for name, endpoints := range published {
+		if _, found := desired[name]; !found {
+			desired[name] = endpoints
+		}
+	}
+
+	for name := range desired {
+		if err := p.deleteName(ctx, name, zone); err != nil {
+			return err
+		}
+	}
+
+	p.logger.Info("Deleted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+func (p *Provider) HealthCheckReconciler() dns.HealthCheckReconciler {
+	if p.healthCheckReconciler == nil {
+		p.healthCheckReconciler = newTrafficManagerHealthCheckReconciler(p.logger)
+	}
+
+	return p.healthCheckReconciler
+}
+
+func (p *Provider) deleteName(ctx context.Context, name string, zone v1.DNSZone) error {
+	if err := p.client.deleteCNAMERecordSet(ctx, zone.ID, relativeRecordName(name, zone.ID)); err != nil && !isNotFound(err) {
+		return fmt.Errorf("couldn't delete DNS record %s in zone %s: %v", name, zone.ID, err)
+	}
+	if err := p.client.deleteProfile(ctx, profileName(name)); err != nil && !isNotFound(err) {
+		return fmt.Errorf("couldn't delete Traffic Manager profile for %s: %v", name, err)
+	}
+	return nil
+}
+
+// endpointsByName groups the endpoints by DNS name, as each DNS name is
+// backed by a single Traffic Manager profile.
+func endpointsByName(endpoints []*v1.Endpoint) (map[string][]*v1.Endpoint, error) {
+	result := map[string][]*v1.Endpoint{}
+	for _, endpoint := range endpoints {
+		// The external endpoints of Traffic Manager profiles are either IPv4
+		// addresses, IPv6 addresses or host names
+		switch v1.DNSRecordType(endpoint.RecordType) {
+		case v1.ARecordType, v1.AAAARecordType, v1.CNAMERecordType:
+		default:
+			return nil, fmt.Errorf("unsupported record type %s", endpoint.RecordType)
+		}
+		if len(endpoint.DNSName) == 0 {
+			return nil, fmt.Errorf("domain is required")
+		}
+		if len(endpoint.Targets) == 0 {
+			return nil, fmt.Errorf("targets is required")
+		}
+		name := strings.TrimSuffix(endpoint.DNSName, ".")
+		result[name] = append(result[name], endpoint)
+	}
+	return result, nil
+}
+
+func profileForEndpoints(name string, endpoints []*v1.Endpoint) *TrafficManagerProfile {
+	profile := &TrafficManagerProfile{
+		Name:     profileName(name),
+		Location: trafficManagerLocation,
+		Tags:     map[string]string{"kuadrant.dev/dns-name": name},
+		Properties: TrafficManagerProfileProperties{
+			ProfileStatus:        endpointStatusEnabled,
+			TrafficRoutingMethod: routingMethodWeighted,
+			DNSConfig: DNSConfig{
+				RelativeName: profileName(name),
+				TTL:          int64(endpoints[0].RecordTTL),
+			},
+			MonitorConfig: MonitorConfig{
+				Protocol: string(dns.HealthCheckProtocolHTTP),
+				Port:     80,
+				Path:     "/",
+			},
+		},
+	}
+
+	monitored := false
+	for _, endpoint := range endpoints {
+		if monitorConfig, ok := monitorConfigFromEndpoint(endpoint); ok {
+			// Traffic Manager monitors all the endpoints of a profile the same way
+			if !monitored {
+				profile.Properties.MonitorConfig = monitorConfig
+			}
+			monitored = true
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		for _, target := range endpoint.Targets {
+			weight, enabled := trafficManagerWeight(endpoint)
+
+			tmEndpoint := &TrafficManagerEndpoint{
+				Name: endpointName(endpoint, target),
+				Type: externalEndpointType,
+				Properties: TrafficManagerEndpointProperties{
+					Target:         target,
+					Weight:         weight,
+					EndpointStatus: endpointStatusEnabled,
+					AlwaysServe:    alwaysServeEnabled,
+				},
+			}
+			if !enabled {
+				tmEndpoint.Properties.EndpointStatus = endpointStatusDisabled
+			}
+			if _, ok := monitorConfigFromEndpoint(endpoint); ok {
+				tmEndpoint.Properties.AlwaysServe = alwaysServeDisabled
+			}
+			profile.Properties.Endpoints = append(profile.Properties.Endpoints, tmEndpoint)
+		}
+	}
+
+	return profile
+}
+
+// trafficManagerWeight maps the Route53 style weight (0-255) set on the
+// endpoint to a Traffic Manager weight (1-1000). As Traffic Manager has no
+// zero weight, endpoints with a weight of 0 are disabled instead.
+func trafficManagerWeight(endpoint *v1.Endpoint) (int64, bool) {
+	value, ok := endpoint.GetProviderSpecific(aws.ProviderSpecificWeight)
+	if !ok {
+		return 1, true
+	}
+	weight, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || weight < 0 {
+		return 1, true
+	}
+	if weight == 0 {
+		return 1, false
+	}
+	if weight > maxTrafficManagerWeight {
+		weight = maxTrafficManagerWeight
+	}
+	return weight, true
+}
+
+func monitorConfigFromEndpoint(endpoint *v1.Endpoint) (MonitorConfig, bool) {
+	protocol, ok := endpoint.GetProviderSpecific(ProviderSpecificMonitorProtocol)
+	if !ok {
+		return MonitorConfig{}, false
+	}
+
+	config := MonitorConfig{Protocol: protocol, Port: 80}
+	if value, ok := endpoint.GetProviderSpecific(ProviderSpecificMonitorPort); ok {
+		if port, err := strconv.ParseInt(value, 10, 64); err == nil {
+			config.Port = port
+		}
+	}
+	if value, ok := endpoint.GetProviderSpecific(ProviderSpecificMonitorPath); ok {
+		config.Path = value
+	}
+	if value, ok := endpoint.GetProviderSpecific(ProviderSpecificMonitorToleratedFailures); ok {
+		if failures, err := strconv.ParseInt(value, 10, 64); err == nil {
+			config.ToleratedNumberOfFailures = &failures
+		}
+	}
+	return config, true
+}
+
+// profileName returns the name of the Traffic Manager profile for a DNS name,
+// which is used as the profile relative DNS name as well, so it must be a
+// valid DNS label.
+func profileName(name string) string {
+	result := invalidNameChars.ReplaceAllString(strings.ToLower(strings.TrimSuffix(name, ".")), "-")
+	if len(result) <= maxRelativeNameLength {
+		return result
+	}
+	return fmt.Sprintf("glbc-%x", sha1.Sum([]byte(name)))
+}
+
+func endpointName(endpoint *v1.Endpoint, target string) string {
+	name := endpoint.SetID()
+	if len(endpoint.Targets) > 1 {
+		name = fmt.Sprintf("%s-%s", name, target)
+	}
+	return invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// relativeRecordName returns the name of the record relative to the zone.
+func relativeRecordName(name, zone string) string {
+	name = strings.TrimSuffix(name, ".")
+	zone = strings.TrimSuffix(zone, ".")
+	if name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
@@ -0,0 +1,280 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+)
+
+const (
+	testSubscription  = "sub"
+	testResourceGroup = "rg"
+	testZone          = "example.com"
+)
+
+// fakeResourceManager is an HTTP stand-in for the subset of the Azure DNS and
+// Traffic Manager APIs used by the provider.
+type fakeResourceManager struct {
+	mu         sync.Mutex
+	profiles   map[string]*TrafficManagerProfile
+	recordSets map[string]*RecordSet
+}
+
+func newFakeResourceManager() *fakeResourceManager {
+	return &fakeResourceManager{
+		profiles:   map[string]*TrafficManagerProfile{},
+		recordSets: map[string]*RecordSet{},
+	}
+}
+
+func (f *fakeResourceManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	base := "/subscriptions/" + testSubscription + "/resourceGroups/" + testResourceGroup + "/providers/Microsoft.Network"
+	profilesPath := base + "/trafficmanagerprofiles/"
+	recordSetsPath := base + "/dnsZones/" + testZone + "/CNAME/"
+
+	switch {
+	case r.URL.Path == base+"/dnszones" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{"value": []map[string]string{{"name": testZone}}})
+
+	case strings.HasPrefix(r.URL.Path, profilesPath):
+		name := strings.TrimPrefix(r.URL.Path, profilesPath)
+		switch r.Method {
+		case http.MethodPut:
+			profile := &TrafficManagerProfile{}
+			if err := json.NewDecoder(r.Body).Decode(profile); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			f.profiles[name] = profile
+			writeJSON(w, profile)
+		case http.MethodDelete:
+			if _, ok := f.profiles[name]; !ok {
+				writeError(w, http.StatusNotFound, "profile not found")
+				return
+			}
+			delete(f.profiles, name)
+		}
+
+	case strings.HasPrefix(r.URL.Path, recordSetsPath):
+		name := strings.TrimPrefix(r.URL.Path, recordSetsPath)
+		switch r.Method {
+		case http.MethodPut:
+			recordSet := &RecordSet{}
+			if err := json.NewDecoder(r.Body).Decode(recordSet); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			f.recordSets[name] = recordSet
+			writeJSON(w, recordSet)
+		case http.MethodDelete:
+			delete(f.recordSets, name)
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "unexpected request "+r.Method+" "+r.URL.String())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": apiError{Code: http.StatusText(code), Message: message}})
+}
+
+func newTestProvider(t *testing.T) (*Provider, *fakeResourceManager) {
+	fake := newFakeResourceManager()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	provider, err := NewProvider(Config{
+		SubscriptionID: testSubscription,
+		ResourceGroup:  testResourceGroup,
+		Endpoint:       server.URL,
+		HTTPClient:     server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating provider: %v", err)
+	}
+	return provider, fake
+}
+
+func weightedEndpoint(host, target, weight string) *v1.Endpoint {
+	endpoint := &v1.Endpoint{
+		DNSName:       host,
+		RecordType:    string(v1.ARecordType),
+		SetIdentifier: target,
+		Targets:       v1.Targets{target},
+		RecordTTL:     60,
+	}
+	endpoint.SetProviderSpecific(aws.ProviderSpecificWeight, weight)
+	return endpoint
+}
+
+func TestProviderEnsureAndDelete(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+	zone := v1.DNSZone{ID: testZone}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "120"),
+		weightedEndpoint("app.example.com", "10.0.0.2", "0"),
+	}
+
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+
+	g.Expect(fake.profiles).To(gomega.HaveKey("app-example-com"))
+	profile := fake.profiles["app-example-com"]
+	g.Expect(profile.Properties.TrafficRoutingMethod).To(gomega.Equal(routingMethodWeighted))
+	g.Expect(profile.Properties.DNSConfig.RelativeName).To(gomega.Equal("app-example-com"))
+	g.Expect(profile.Properties.Endpoints).To(gomega.ConsistOf(
+		&TrafficManagerEndpoint{
+			Name: "10-0-0-1",
+			Type: externalEndpointType,
+			Properties: TrafficManagerEndpointProperties{
+				Target: "10.0.0.1", Weight: 120, EndpointStatus: endpointStatusEnabled, AlwaysServe: alwaysServeEnabled,
+			},
+		},
+		&TrafficManagerEndpoint{
+			Name: "10-0-0-2",
+			Type: externalEndpointType,
+			Properties: TrafficManagerEndpointProperties{
+				Target: "10.0.0.2", Weight: 1, EndpointStatus: endpointStatusDisabled, AlwaysServe: alwaysServeEnabled,
+			},
+		},
+	))
+
+	g.Expect(fake.recordSets).To(gomega.HaveKey("app"))
+	g.Expect(fake.recordSets["app"].Properties.CNAMERecord.CNAME).To(gomega.Equal("app-example-com.trafficmanager.net"))
+
+	// Moving the record to another host removes the previously published name
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: zone, Endpoints: record.Spec.Endpoints}}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("other.example.com", "10.0.0.3", "120"),
+	}
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.profiles).To(gomega.HaveLen(1))
+	g.Expect(fake.profiles).To(gomega.HaveKey("other-example-com"))
+	g.Expect(fake.recordSets).To(gomega.HaveLen(1))
+	g.Expect(fake.recordSets).To(gomega.HaveKey("other"))
+
+	g.Expect(provider.Delete(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.profiles).To(gomega.BeEmpty())
+	g.Expect(fake.recordSets).To(gomega.BeEmpty())
+}
+
+func TestProviderDeletePublishedNames(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+	zone := v1.DNSZone{ID: testZone}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "120"),
+	}
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+
+	// A name removed from the spec before it's unpublished is still deleted
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: zone, Endpoints: record.Spec.Endpoints}}
+	record.Spec.Endpoints = []*v1.Endpoint{}
+	g.Expect(provider.Delete(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.profiles).To(gomega.BeEmpty())
+	g.Expect(fake.recordSets).To(gomega.BeEmpty())
+}
+
+func TestProviderAAAAAndCNAMERecords(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+
+	v6 := weightedEndpoint("app.example.com", "2001:db8::1", "120")
+	v6.RecordType = string(v1.AAAARecordType)
+	lb := weightedEndpoint("lb.example.com", "lb.example.net", "120")
+	lb.RecordType = string(v1.CNAMERecordType)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{v6, lb}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+
+	// The targets are external endpoints of the profiles of the DNS names
+	g.Expect(fake.profiles["app-example-com"].Properties.Endpoints[0].Properties.Target).To(gomega.Equal("2001:db8::1"))
+	g.Expect(fake.profiles["lb-example-com"].Properties.Endpoints[0].Properties.Target).To(gomega.Equal("lb.example.net"))
+}
+
+func TestHealthCheckMonitoring(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+	reconciler := provider.HealthCheckReconciler()
+	ctx := context.Background()
+
+	endpoint := weightedEndpoint("app.example.com", "10.0.0.1", "120")
+	protocol := dns.HealthCheckProtocolHTTPS
+	port := int64(443)
+	threshold := int64(5)
+	spec := dns.HealthCheckSpec{
+		Id:               "abc",
+		Path:             "/healthz",
+		Port:             &port,
+		Protocol:         &protocol,
+		FailureThreshold: &threshold,
+	}
+	g.Expect(reconciler.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{endpoint}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+
+	// The endpoint is degraded after failing the threshold of checks in a row
+	tolerated := int64(4)
+	profile := fake.profiles["app-example-com"]
+	g.Expect(profile.Properties.MonitorConfig).To(gomega.Equal(MonitorConfig{
+		Protocol:                  "HTTPS",
+		Port:                      443,
+		Path:                      "/healthz",
+		ToleratedNumberOfFailures: &tolerated,
+	}))
+	g.Expect(profile.Properties.Endpoints[0].Properties.AlwaysServe).To(gomega.Equal(alwaysServeDisabled))
+
+	// Updating the spec updates the monitoring configuration
+	spec.Path = "/ready"
+	g.Expect(reconciler.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	path, _ := endpoint.GetProviderSpecific(ProviderSpecificMonitorPath)
+	g.Expect(path).To(gomega.Equal("/ready"))
+
+	g.Expect(reconciler.Delete(ctx, endpoint)).To(gomega.Succeed())
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+	profile = fake.profiles["app-example-com"]
+	g.Expect(profile.Properties.Endpoints[0].Properties.AlwaysServe).To(gomega.Equal(alwaysServeEnabled))
+}
+
+func TestToleratedFailures(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(toleratedFailures(1)).To(gomega.Equal(int64(0)))
+	g.Expect(toleratedFailures(3)).To(gomega.Equal(int64(2)))
+	g.Expect(toleratedFailures(10)).To(gomega.Equal(int64(9)))
+	g.Expect(toleratedFailures(20)).To(gomega.Equal(int64(9)))
+}
+
+func TestRelativeRecordName(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(relativeRecordName("app.example.com", "example.com")).To(gomega.Equal("app"))
+	g.Expect(relativeRecordName("a.b.example.com.", "example.com")).To(gomega.Equal("a.b"))
+	g.Expect(relativeRecordName("example.com", "example.com")).To(gomega.Equal("@"))
+}
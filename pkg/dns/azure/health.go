@@ -0,0 +1,78 @@
+package azure
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-logr/logr"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+// TrafficManagerHealthCheckReconciler maps health checks onto Traffic Manager
+// endpoint monitoring. Traffic Manager monitors the endpoints of a profile
+// itself, so the reconciler only records the monitoring configuration on the
+// endpoint, which is applied to the profile when the record is ensured.
+type TrafficManagerHealthCheckReconciler struct {
+	logger logr.Logger
+}
+
+var _ dns.HealthCheckReconciler = &TrafficManagerHealthCheckReconciler{}
+
+func newTrafficManagerHealthCheckReconciler(l logr.Logger) *TrafficManagerHealthCheckReconciler {
+	return &TrafficManagerHealthCheckReconciler{
+		logger: l.WithName("health"),
+	}
+}
+
+func (r *TrafficManagerHealthCheckReconciler) Reconcile(_ context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
+	protocol := dns.HealthCheckProtocolHTTP
+	if spec.Protocol != nil {
+		protocol = *spec.Protocol
+	}
+	endpoint.SetProviderSpecific(ProviderSpecificMonitorProtocol, string(protocol))
+	endpoint.SetProviderSpecific(ProviderSpecificMonitorPath, spec.Path)
+
+	if spec.Port != nil {
+		endpoint.SetProviderSpecific(ProviderSpecificMonitorPort, strconv.FormatInt(*spec.Port, 10))
+	} else {
+		endpoint.DeleteProviderSpecific(ProviderSpecificMonitorPort)
+	}
+	if spec.FailureThreshold != nil {
+		endpoint.SetProviderSpecific(ProviderSpecificMonitorToleratedFailures, strconv.FormatInt(toleratedFailures(*spec.FailureThreshold), 10))
+	} else {
+		endpoint.DeleteProviderSpecific(ProviderSpecificMonitorToleratedFailures)
+	}
+
+	return nil
+}
+
+func (r *TrafficManagerHealthCheckReconciler) Delete(_ context.Context, endpoint *v1.Endpoint) error {
+	endpoint.DeleteProviderSpecific(ProviderSpecificMonitorProtocol)
+	endpoint.DeleteProviderSpecific(ProviderSpecificMonitorPort)
+	endpoint.DeleteProviderSpecific(ProviderSpecificMonitorPath)
+	endpoint.DeleteProviderSpecific(ProviderSpecificMonitorToleratedFailures)
+	return nil
+}
+
+// toleratedFailures returns the number of failures Traffic Manager tolerates
+// before marking an endpoint degraded, for the endpoint to be unhealthy after
+// failureThreshold consecutive failures. Traffic Manager tolerates between 0
+// and 9 failures.
+func toleratedFailures(failureThreshold int64) int64 {
+	tolerated := failureThreshold - 1
+	if tolerated < 0 {
+		return 0
+	}
+	if tolerated > 9 {
+		return 9
+	}
+	return tolerated
+}
+
+// Status returns an unknown state, as the monitor status of the endpoints is
+// not retrieved from the Traffic Manager profiles.
+func (r *TrafficManagerHealthCheckReconciler) Status(_ context.Context, _ *v1.Endpoint) (dns.HealthCheckStatus, error) {
+	return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "Traffic Manager endpoint monitor status is not supported"}, nil
+}
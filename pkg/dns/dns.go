@@ -1,6 +1,9 @@
 package dns
 
 import (
+	"errors"
+	"fmt"
+
 	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
 )
 
@@ -16,6 +19,50 @@ type Provider interface {
 	HealthCheckReconciler() HealthCheckReconciler
 }
 
+// ChangeTracker is implemented by the providers that propagate the changes
+// of the records asynchronously.
+type ChangeTracker interface {
+	// EnsureChange will create or update record, and return the identifier
+	// of the change.
+	EnsureChange(record *v1.DNSRecord, zone v1.DNSZone) (string, error)
+
+	// ChangePropagated returns whether the change has been propagated to
+	// all the authoritative DNS servers of the zone. It returns a
+	// ChangeFailedError if the change failed to be applied.
+	ChangePropagated(changeID string) (bool, error)
+}
+
+// ChangeFailedError is returned by the providers that track the propagation
+// of the changes, when the change failed to be applied, so that the record is
+// published again.
+type ChangeFailedError struct {
+	ChangeID string
+	Err      error
+}
+
+func (e *ChangeFailedError) Error() string {
+	return fmt.Sprintf("the change %s failed: %v", e.ChangeID, e.Err)
+}
+
+func (e *ChangeFailedError) Unwrap() error {
+	return e.Err
+}
+
+// IsChangeFailed returns whether the error, or an error it wraps, is a
+// ChangeFailedError.
+func IsChangeFailed(err error) bool {
+	var failed *ChangeFailedError
+	return errors.As(err, &failed)
+}
+
+// RecordLister is implemented by the providers that can list the records
+// published to a zone, to detect the changes made outside of the GLBC.
+type RecordLister interface {
+	// Records returns the endpoints of the records with the DNS name
+	// published to the zone.
+	Records(dnsName string, zone v1.DNSZone) ([]*v1.Endpoint, error)
+}
+
 var _ Provider = &FakeProvider{}
 
 type FakeProvider struct{}
@@ -25,3 +72,14 @@ func (_ *FakeProvider) Delete(record *v1.DNSRecord, zone v1.DNSZone) error { ret
 func (*FakeProvider) HealthCheckReconciler() HealthCheckReconciler {
 	return &fakeHealthCheckReconciler{}
 }
+
+// EndpointsFromZoneStatus returns the endpoints of the record last published
+// to the zone, as recorded in the record status.
+func EndpointsFromZoneStatus(record *v1.DNSRecord, zoneID string) []*v1.Endpoint {
+	for _, zoneStatus := range record.Status.Zones {
+		if zoneStatus.DNSZone.ID == zoneID {
+			return zoneStatus.Endpoints
+		}
+	}
+	return []*v1.Endpoint{}
+}
@@ -0,0 +1,426 @@
+package embedded
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+
+	"k8s.io/client-go/tools/cache"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	glbcdns "github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/prober"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+const (
+	defaultAddress             = ":53"
+	defaultTTL                 = 60
+	defaultHealthCheckInterval = 30 * time.Second
+
+	// ProviderSpecificHealthCheck is the ID of the in-process health check of an endpoint.
+	ProviderSpecificHealthCheck = "embedded/health-check"
+)
+
+var _ glbcdns.Provider = &Provider{}
+var _ glbcdns.RecordLister = &Provider{}
+
+// Provider is an authoritative DNS server, embedded in the GLBC, that answers
+// from an in-memory copy of the DNS records.
+//
+// For each query, one of the healthy endpoints of the queried name is picked
+// with a probability proportional to its weight, so that the traffic is
+// spread across the endpoints the same way weighted record sets would.
+type Provider struct {
+	config Config
+	logger logr.Logger
+
+	mu sync.RWMutex
+	// zones maps a zone origin to the endpoints of each record, by record key
+	zones map[string]map[string][]*v1.Endpoint
+
+	// rand is guarded by its own lock, as queries are answered concurrently
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	// prober probes the endpoints in-process, so that unhealthy endpoints are
+	// filtered out of the answers
+	prober *prober.Prober
+}
+
+// Config is the necessary input to configure the provider.
+type Config struct {
+	// Address is the address the DNS server listens on, for both UDP and TCP.
+	Address string
+	// Nameserver is the host name of the server, used in the SOA and NS
+	// records of the zones. Defaults to "ns." followed by the zone origin.
+	Nameserver string
+	// HealthCheckInterval is the interval between two health check probes.
+	HealthCheckInterval time.Duration
+	// Zones are the IDs of the zones the server is authoritative for, that
+	// are answered for even before any record is published to them.
+	Zones []string
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Address == "" {
+		config.Address = defaultAddress
+	}
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", config.Address, err)
+	}
+	if config.HealthCheckInterval == 0 {
+		config.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	zones := map[string]map[string][]*v1.Endpoint{}
+	for _, zone := range config.Zones {
+		if _, ok := dns.IsDomainName(zone); !ok {
+			return nil, fmt.Errorf("invalid zone %s", zone)
+		}
+		zones[dns.Fqdn(strings.ToLower(zone))] = map[string][]*v1.Endpoint{}
+	}
+
+	logger := log.Logger.WithName("embedded")
+	return &Provider{
+		config: config,
+		logger: logger,
+		zones:  zones,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		prober: prober.New(prober.Config{
+			Interval:         config.HealthCheckInterval,
+			ProviderSpecific: ProviderSpecificHealthCheck,
+		}, logger),
+	}, nil
+}
+
+func (p *Provider) Ensure(record *v1.DNSRecord, zone v1.DNSZone) error {
+	if err := p.store(record, zone, record.Spec.Endpoints); err != nil {
+		return err
+	}
+	p.logger.Info("Upserted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+// Restore serves the endpoints of the record last published to the zone, as
+// recorded in the record status, so that the records published before the
+// GLBC restarted are served before the record is reconciled again.
+func (p *Provider) Restore(record *v1.DNSRecord, zone v1.DNSZone) error {
+	return p.store(record, zone, glbcdns.EndpointsFromZoneStatus(record, zone.ID))
+}
+
+func (p *Provider) store(record *v1.DNSRecord, zone v1.DNSZone, endpoints []*v1.Endpoint) error {
+	for _, endpoint := range endpoints {
+		if err := validateEndpoint(endpoint); err != nil {
+			return err
+		}
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(record)
+	if err != nil {
+		return err
+	}
+
+	copies := make([]*v1.Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		copies = append(copies, endpoint.DeepCopy())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	origin := dns.Fqdn(strings.ToLower(zone.ID))
+	if _, ok := p.zones[origin]; !ok {
+		p.zones[origin] = map[string][]*v1.Endpoint{}
+	}
+	p.zones[origin][key] = copies
+	return nil
+}
+
+func validateEndpoint(endpoint *v1.Endpoint) error {
+	var valid func(target string) bool
+	switch v1.DNSRecordType(endpoint.RecordType) {
+	case v1.ARecordType:
+		valid = func(target string) bool { return net.ParseIP(target).To4() != nil }
+	case v1.AAAARecordType:
+		valid = func(target string) bool { ip := net.ParseIP(target); return ip != nil && ip.To4() == nil }
+	case v1.CNAMERecordType:
+		valid = func(target string) bool { _, ok := dns.IsDomainName(target); return ok }
+	default:
+		return fmt.Errorf("unsupported record type %s", endpoint.RecordType)
+	}
+	for _, target := range endpoint.Targets {
+		if !valid(target) {
+			return fmt.Errorf("invalid %s record target %s", endpoint.RecordType, target)
+		}
+	}
+	return nil
+}
+
+func (p *Provider) Delete(record *v1.DNSRecord, zone v1.DNSZone) error {
+	key, err := cache.MetaNamespaceKeyFunc(record)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if records, ok := p.zones[dns.Fqdn(strings.ToLower(zone.ID))]; ok {
+		delete(records, key)
+	}
+
+	p.logger.Info("Deleted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+// Records returns the endpoints with the DNS name served for the zone.
+func (p *Provider) Records(dnsName string, zone v1.DNSZone) ([]*v1.Endpoint, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var endpoints []*v1.Endpoint
+	for _, endpoint := range p.endpointsFor(dns.Fqdn(strings.ToLower(zone.ID)), dns.Fqdn(strings.ToLower(dnsName))) {
+		endpoints = append(endpoints, endpoint.DeepCopy())
+	}
+	return endpoints, nil
+}
+
+func (p *Provider) HealthCheckReconciler() glbcdns.HealthCheckReconciler {
+	return p.prober
+}
+
+// Start serves DNS queries, and probes the endpoints health, until the
+// context is done.
+func (p *Provider) Start(ctx context.Context) error {
+	servers := []*dns.Server{
+		{Addr: p.config.Address, Net: "udp", Handler: p},
+		{Addr: p.config.Address, Net: "tcp", Handler: p},
+	}
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+	p.logger.Info("Started serving DNS", "address", p.config.Address)
+
+	go p.prober.Run(ctx)
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	for _, server := range servers {
+		_ = server.Shutdown()
+	}
+	return err
+}
+
+// ServeDNS answers the queries for the names of the zones the provider is
+// authoritative for.
+func (p *Provider) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+
+	if len(req.Question) != 1 {
+		resp.SetRcode(req, dns.RcodeFormatError)
+		_ = w.WriteMsg(resp)
+		return
+	}
+	question := req.Question[0]
+	name := strings.ToLower(question.Name)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	origin, ok := p.zoneFor(name)
+	if !ok {
+		resp.Authoritative = false
+		resp.SetRcode(req, dns.RcodeRefused)
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	endpoints := p.endpointsFor(origin, name)
+	switch {
+	case name == origin && question.Qtype == dns.TypeSOA:
+		resp.Answer = append(resp.Answer, p.soa(origin))
+	case name == origin && question.Qtype == dns.TypeNS:
+		resp.Answer = append(resp.Answer, p.ns(origin))
+	case len(endpoints) == 0 && name != origin:
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.Ns = append(resp.Ns, p.soa(origin))
+	default:
+		resp.Answer = append(resp.Answer, p.answer(name, question.Qtype, endpoints)...)
+	}
+	if len(resp.Answer) == 0 && resp.Rcode == dns.RcodeSuccess {
+		resp.Ns = append(resp.Ns, p.soa(origin))
+	}
+
+	_ = w.WriteMsg(resp)
+}
+
+// zoneFor returns the origin of the most specific zone name belongs to.
+func (p *Provider) zoneFor(name string) (string, bool) {
+	for i, end := 0, false; !end; i, end = dns.NextLabel(name, i) {
+		if _, ok := p.zones[name[i:]]; ok {
+			return name[i:], true
+		}
+	}
+	return "", false
+}
+
+func (p *Provider) endpointsFor(origin, name string) []*v1.Endpoint {
+	var endpoints []*v1.Endpoint
+	for _, records := range p.zones[origin] {
+		for _, endpoint := range records {
+			if dns.Fqdn(strings.ToLower(endpoint.DNSName)) == name {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	return endpoints
+}
+
+// answer returns the records of the query type for the endpoints of name, or
+// its CNAME record, as a CNAME record can't coexist with other records.
+// Unhealthy endpoints are left out, unless they are all unhealthy, in which
+// case they are all considered healthy, so that the name still resolves. Then,
+// if the endpoints are weighted, a single endpoint is picked at random based
+// on the weights.
+func (p *Provider) answer(name string, qtype uint16, endpoints []*v1.Endpoint) []dns.RR {
+	var matching []*v1.Endpoint
+	for _, endpoint := range endpoints {
+		if endpoint.RecordType == string(v1.CNAMERecordType) {
+			matching = append(matching, endpoint)
+		}
+	}
+	if len(matching) == 0 {
+		for _, endpoint := range endpoints {
+			recordType := dns.StringToType[endpoint.RecordType]
+			if qtype == recordType || qtype == dns.TypeANY {
+				matching = append(matching, endpoint)
+			}
+		}
+	}
+
+	var healthy []*v1.Endpoint
+	for _, endpoint := range matching {
+		if p.prober.Healthy(endpoint) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = matching
+	}
+
+	selected := healthy
+	if endpoint := p.pickWeighted(healthy); endpoint != nil {
+		selected = []*v1.Endpoint{endpoint}
+	}
+
+	var rrs []dns.RR
+	seen := map[string]struct{}{}
+	for _, endpoint := range selected {
+		ttl := uint32(endpoint.RecordTTL)
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		for _, target := range endpoint.Targets {
+			if _, ok := seen[target]; ok {
+				continue
+			}
+			seen[target] = struct{}{}
+			rrs = append(rrs, resourceRecord(name, endpoint.RecordType, ttl, target))
+			// A CNAME record has a single target
+			if endpoint.RecordType == string(v1.CNAMERecordType) {
+				return rrs
+			}
+		}
+	}
+	return rrs
+}
+
+func resourceRecord(name, recordType string, ttl uint32, target string) dns.RR {
+	hdr := dns.RR_Header{Name: name, Rrtype: dns.StringToType[recordType], Class: dns.ClassINET, Ttl: ttl}
+	switch v1.DNSRecordType(recordType) {
+	case v1.AAAARecordType:
+		return &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(target)}
+	case v1.CNAMERecordType:
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(target)}
+	default:
+		return &dns.A{Hdr: hdr, A: net.ParseIP(target).To4()}
+	}
+}
+
+// pickWeighted returns an endpoint picked at random, with a probability
+// proportional to its weight, or nil if none of the endpoints has a weight.
+func (p *Provider) pickWeighted(endpoints []*v1.Endpoint) *v1.Endpoint {
+	total := int64(0)
+	weights := make([]int64, len(endpoints))
+	for i, endpoint := range endpoints {
+		value, ok := endpoint.GetProviderSpecific(aws.ProviderSpecificWeight)
+		if !ok {
+			continue
+		}
+		weight, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || weight < 0 {
+			p.logger.Error(err, "Invalid weight, using weight of 0", "weight", aws.ProviderSpecificWeight, "value", value)
+			continue
+		}
+		weights[i] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	p.randMu.Lock()
+	n := p.rand.Int63n(total)
+	p.randMu.Unlock()
+	for i, weight := range weights {
+		if n < weight {
+			return endpoints[i]
+		}
+		n -= weight
+	}
+	return nil
+}
+
+func (p *Provider) nameserver(origin string) string {
+	if p.config.Nameserver != "" {
+		return dns.Fqdn(p.config.Nameserver)
+	}
+	return "ns." + origin
+}
+
+func (p *Provider) soa(origin string) dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: defaultTTL},
+		Ns:      p.nameserver(origin),
+		Mbox:    "hostmaster." + origin,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  defaultTTL,
+	}
+}
+
+func (p *Provider) ns(origin string) dns.RR {
+	return &dns.NS{
+		Hdr: dns.RR_Header{Name: origin, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: defaultTTL},
+		Ns:  p.nameserver(origin),
+	}
+}
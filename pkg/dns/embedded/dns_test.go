@@ -0,0 +1,357 @@
+package embedded
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	glbcdns "github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+)
+
+var testZone = v1.DNSZone{ID: "example.com"}
+
+func newTestProvider(t *testing.T) (*Provider, func(name string, qtype uint16) *dns.Msg) {
+	provider, err := NewProvider(Config{Address: "127.0.0.1:0", Zones: []string{testZone.ID}})
+	if err != nil {
+		t.Fatalf("unexpected error creating provider: %v", err)
+	}
+	provider.rand = rand.New(rand.NewSource(1))
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: conn, Handler: provider, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, qtype)
+		resp, _, err := new(dns.Client).Exchange(msg, conn.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("unexpected error querying %s: %v", name, err)
+		}
+		return resp
+	}
+	return provider, query
+}
+
+func newRecord(name string, endpoints ...*v1.Endpoint) *v1.DNSRecord {
+	record := &v1.DNSRecord{}
+	record.Name = name
+	record.Namespace = "default"
+	record.Spec.Endpoints = endpoints
+	return record
+}
+
+func weightedEndpoint(host, target, weight string) *v1.Endpoint {
+	endpoint := &v1.Endpoint{
+		DNSName:       host,
+		RecordType:    string(v1.ARecordType),
+		SetIdentifier: target,
+		Targets:       v1.Targets{target},
+		RecordTTL:     60,
+	}
+	endpoint.SetProviderSpecific(aws.ProviderSpecificWeight, weight)
+	return endpoint
+}
+
+func targets(resp *dns.Msg) []string {
+	var targets []string
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			targets = append(targets, rr.A.String())
+		case *dns.AAAA:
+			targets = append(targets, rr.AAAA.String())
+		case *dns.CNAME:
+			targets = append(targets, rr.Target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func TestProviderEnsureAndDelete(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, query := newTestProvider(t)
+
+	record := newRecord("app", &v1.Endpoint{
+		DNSName:    "app.example.com",
+		RecordType: string(v1.ARecordType),
+		Targets:    v1.Targets{"10.0.0.1", "10.0.0.2"},
+		RecordTTL:  300,
+	})
+	g.Expect(provider.Ensure(record, testZone)).To(gomega.Succeed())
+
+	resp := query("app.example.com.", dns.TypeA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeSuccess))
+	g.Expect(resp.Authoritative).To(gomega.BeTrue())
+	g.Expect(targets(resp)).To(gomega.Equal([]string{"10.0.0.1", "10.0.0.2"}))
+	g.Expect(resp.Answer[0].Header().Ttl).To(gomega.Equal(uint32(300)))
+
+	// Names are case insensitive
+	g.Expect(targets(query("APP.example.com.", dns.TypeA))).To(gomega.HaveLen(2))
+
+	// Other types are answered with no data
+	resp = query("app.example.com.", dns.TypeAAAA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeSuccess))
+	g.Expect(resp.Answer).To(gomega.BeEmpty())
+	g.Expect(resp.Ns).To(gomega.HaveLen(1))
+
+	// Unknown names in the zone don't exist
+	resp = query("other.example.com.", dns.TypeA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeNameError))
+
+	// Names out of the zone are refused
+	resp = query("app.example.org.", dns.TypeA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeRefused))
+
+	// The zone apex is served
+	resp = query("example.com.", dns.TypeSOA)
+	g.Expect(resp.Answer).To(gomega.HaveLen(1))
+	g.Expect(resp.Answer[0].(*dns.SOA).Ns).To(gomega.Equal("ns.example.com."))
+
+	g.Expect(provider.Delete(record, testZone)).To(gomega.Succeed())
+	resp = query("app.example.com.", dns.TypeA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeNameError))
+}
+
+func TestProviderEmptyZone(t *testing.T) {
+	g := gomega.NewWithT(t)
+	_, query := newTestProvider(t)
+
+	// The configured zones are served before any record is published
+	resp := query("example.com.", dns.TypeSOA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeSuccess))
+	g.Expect(resp.Authoritative).To(gomega.BeTrue())
+	g.Expect(resp.Answer).To(gomega.HaveLen(1))
+	g.Expect(resp.Answer[0].(*dns.SOA).Ns).To(gomega.Equal("ns.example.com."))
+
+	resp = query("example.com.", dns.TypeNS)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeSuccess))
+	g.Expect(resp.Answer).To(gomega.HaveLen(1))
+
+	resp = query("app.example.com.", dns.TypeA)
+	g.Expect(resp.Rcode).To(gomega.Equal(dns.RcodeNameError))
+}
+
+func TestProviderInvalidZone(t *testing.T) {
+	_, err := NewProvider(Config{Zones: []string{"example..com"}})
+	gomega.NewWithT(t).Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestProviderRestore(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, query := newTestProvider(t)
+
+	// The endpoints last published to the zone are served, rather than the
+	// ones of the spec that are not published yet
+	record := newRecord("app", &v1.Endpoint{
+		DNSName:    "app.example.com",
+		RecordType: string(v1.ARecordType),
+		Targets:    v1.Targets{"10.0.0.2"},
+	})
+	record.Status.Zones = []v1.DNSZoneStatus{{
+		DNSZone: testZone,
+		Endpoints: []*v1.Endpoint{{
+			DNSName:    "app.example.com",
+			RecordType: string(v1.ARecordType),
+			Targets:    v1.Targets{"10.0.0.1"},
+		}},
+	}}
+	g.Expect(provider.Restore(record, testZone)).To(gomega.Succeed())
+	g.Expect(targets(query("app.example.com.", dns.TypeA))).To(gomega.Equal([]string{"10.0.0.1"}))
+
+	g.Expect(provider.Ensure(record, testZone)).To(gomega.Succeed())
+	g.Expect(targets(query("app.example.com.", dns.TypeA))).To(gomega.Equal([]string{"10.0.0.2"}))
+
+	// The served endpoints are listed for the drift checks
+	records, err := provider.Records("APP.example.com", testZone)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(records).To(gomega.HaveLen(1))
+	g.Expect(records[0].Targets).To(gomega.Equal(v1.Targets{"10.0.0.2"}))
+}
+
+func TestProviderWeightedAnswers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, query := newTestProvider(t)
+
+	record := newRecord("app",
+		weightedEndpoint("app.example.com", "10.0.0.1", "90"),
+		weightedEndpoint("app.example.com", "10.0.0.2", "10"),
+		weightedEndpoint("app.example.com", "10.0.0.3", "0"),
+	)
+	g.Expect(provider.Ensure(record, testZone)).To(gomega.Succeed())
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		resp := query("app.example.com.", dns.TypeA)
+		g.Expect(resp.Answer).To(gomega.HaveLen(1))
+		counts[targets(resp)[0]]++
+	}
+	g.Expect(counts["10.0.0.1"]).To(gomega.BeNumerically("~", 900, 50))
+	g.Expect(counts["10.0.0.2"]).To(gomega.BeNumerically("~", 100, 50))
+	g.Expect(counts).NotTo(gomega.HaveKey("10.0.0.3"))
+}
+
+func TestProviderHealthFiltering(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, query := newTestProvider(t)
+	reconciler := provider.HealthCheckReconciler()
+	ctx := context.Background()
+
+	healthy := true
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Host).To(gomega.Equal("app.example.com"))
+		g.Expect(r.URL.Path).To(gomega.Equal("/healthz"))
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+	port, _ := strconv.ParseInt(targetURL.Port(), 10, 64)
+
+	// Both endpoints probe the same local server, so only the first one is health checked
+	checked := weightedEndpoint("app.example.com", "127.0.0.1", "50")
+	unchecked := weightedEndpoint("app.example.com", "10.0.0.2", "50")
+	threshold := int64(2)
+	spec := glbcdns.HealthCheckSpec{
+		Id:               "abc",
+		Path:             "/healthz",
+		Port:             &port,
+		FailureThreshold: &threshold,
+	}
+	g.Expect(reconciler.Reconcile(ctx, spec, checked)).To(gomega.Succeed())
+	id, _ := checked.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(id).To(gomega.Equal("abc"))
+
+	g.Expect(provider.Ensure(newRecord("app", checked, unchecked), testZone)).To(gomega.Succeed())
+
+	answered := func() map[string]bool {
+		answered := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			answered[targets(query("app.example.com.", dns.TypeA))[0]] = true
+		}
+		return answered
+	}
+
+	state := func() v1.HealthCheckState {
+		status, err := reconciler.Status(ctx, checked)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return status.State
+	}
+	g.Expect(state()).To(gomega.Equal(v1.HealthCheckStateUnknown))
+
+	provider.prober.ProbeAll(ctx)
+	g.Expect(answered()).To(gomega.HaveLen(2))
+	g.Expect(state()).To(gomega.Equal(v1.HealthCheckStateHealthy))
+
+	// The endpoint is filtered out once the failure threshold is reached
+	healthy = false
+	provider.prober.ProbeAll(ctx)
+	g.Expect(answered()).To(gomega.HaveLen(2))
+	g.Expect(state()).To(gomega.Equal(v1.HealthCheckStateHealthy))
+	provider.prober.ProbeAll(ctx)
+	g.Expect(answered()).To(gomega.Equal(map[string]bool{"10.0.0.2": true}))
+	status, err := reconciler.Status(ctx, checked)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(status.State).To(gomega.Equal(v1.HealthCheckStateUnhealthy))
+	g.Expect(status.Message).To(gomega.ContainSubstring("returned status code 503"))
+
+	// And recovers as soon as it succeeds again
+	healthy = true
+	provider.prober.ProbeAll(ctx)
+	g.Expect(answered()).To(gomega.HaveLen(2))
+	g.Expect(state()).To(gomega.Equal(v1.HealthCheckStateHealthy))
+
+	g.Expect(reconciler.Delete(ctx, checked)).To(gomega.Succeed())
+	_, ok := checked.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(ok).To(gomega.BeFalse())
+}
+
+func TestProviderAllEndpointsUnhealthy(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, query := newTestProvider(t)
+
+	// A port nothing listens to
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	port := int64(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	ctx := context.Background()
+	endpoint := weightedEndpoint("app.example.com", "127.0.0.1", "100")
+	tcp, threshold := glbcdns.HealthCheckProtocolTCP, int64(1)
+	spec := glbcdns.HealthCheckSpec{Id: "abc", Port: &port, Protocol: &tcp, FailureThreshold: &threshold}
+	g.Expect(provider.HealthCheckReconciler().Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	provider.prober.ProbeAll(ctx)
+	g.Expect(provider.prober.Healthy(endpoint)).To(gomega.BeFalse())
+
+	// The name still resolves when all its endpoints are unhealthy
+	g.Expect(provider.Ensure(newRecord("app", endpoint), testZone)).To(gomega.Succeed())
+	g.Expect(targets(query("app.example.com.", dns.TypeA))).To(gomega.Equal([]string{"127.0.0.1"}))
+}
+
+func TestProviderAAAAAndCNAMERecords(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, query := newTestProvider(t)
+
+	record := newRecord("app",
+		&v1.Endpoint{
+			DNSName:    "app.example.com",
+			RecordType: string(v1.ARecordType),
+			Targets:    v1.Targets{"10.0.0.1"},
+		},
+		&v1.Endpoint{
+			DNSName:    "app.example.com",
+			RecordType: string(v1.AAAARecordType),
+			Targets:    v1.Targets{"2001:db8::1"},
+		},
+		&v1.Endpoint{
+			DNSName:    "lb.example.com",
+			RecordType: string(v1.CNAMERecordType),
+			Targets:    v1.Targets{"lb.example.net"},
+		},
+	)
+	g.Expect(provider.Ensure(record, testZone)).To(gomega.Succeed())
+
+	// The addresses are answered by query type
+	g.Expect(targets(query("app.example.com.", dns.TypeA))).To(gomega.Equal([]string{"10.0.0.1"}))
+	g.Expect(targets(query("app.example.com.", dns.TypeAAAA))).To(gomega.Equal([]string{"2001:db8::1"}))
+
+	// The CNAME record is answered for any query type
+	g.Expect(targets(query("lb.example.com.", dns.TypeA))).To(gomega.Equal([]string{"lb.example.net."}))
+	g.Expect(targets(query("lb.example.com.", dns.TypeCNAME))).To(gomega.Equal([]string{"lb.example.net."}))
+
+	// An AAAA record must point to an IPv6 address
+	record.Spec.Endpoints[1].Targets = v1.Targets{"10.0.0.2"}
+	g.Expect(provider.Ensure(record, testZone)).NotTo(gomega.Succeed())
+}
+
+func TestProviderUnsupportedRecordType(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, _ := newTestProvider(t)
+
+	record := newRecord("txt", &v1.Endpoint{
+		DNSName:    "txt.example.com",
+		RecordType: "TXT",
+		Targets:    v1.Targets{"text"},
+	})
+	g.Expect(provider.Ensure(record, testZone)).NotTo(gomega.Succeed())
+}
@@ -0,0 +1,260 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultCloudDNSEndpoint is the base URL of the Cloud DNS v1 API.
+	DefaultCloudDNSEndpoint = "https://dns.googleapis.com/dns/v1"
+	// DefaultComputeEndpoint is the base URL of the Compute Engine v1 API,
+	// used to manage the health checks attached to routing policies.
+	DefaultComputeEndpoint = "https://compute.googleapis.com/compute/v1"
+)
+
+// ResourceRecordSet is a Cloud DNS resource record set.
+// See https://cloud.google.com/dns/docs/reference/v1/resourceRecordSets
+type ResourceRecordSet struct {
+	Kind          string              `json:"kind,omitempty"`
+	Name          string              `json:"name"`
+	Type          string              `json:"type"`
+	TTL           int64               `json:"ttl,omitempty"`
+	Rrdatas       []string            `json:"rrdatas,omitempty"`
+	RoutingPolicy *RRSetRoutingPolicy `json:"routingPolicy,omitempty"`
+}
+
+// RRSetRoutingPolicy configures a routing policy on a resource record set.
+type RRSetRoutingPolicy struct {
+	Wrr         *WrrPolicy `json:"wrr,omitempty"`
+	HealthCheck string     `json:"healthCheck,omitempty"`
+}
+
+// WrrPolicy is a weighted round robin routing policy.
+type WrrPolicy struct {
+	Items []*WrrPolicyItem `json:"items"`
+}
+
+// WrrPolicyItem is a single weighted item of a weighted round robin policy.
+type WrrPolicyItem struct {
+	Weight               float64               `json:"weight"`
+	Rrdatas              []string              `json:"rrdatas,omitempty"`
+	HealthCheckedTargets *HealthCheckedTargets `json:"healthCheckedTargets,omitempty"`
+}
+
+// HealthCheckedTargets are the targets whose health is checked before being
+// returned in a DNS response.
+type HealthCheckedTargets struct {
+	ExternalEndpoints []string `json:"externalEndpoints,omitempty"`
+}
+
+// Change is an atomic update to a collection of resource record sets.
+type Change struct {
+	Kind      string               `json:"kind,omitempty"`
+	ID        string               `json:"id,omitempty"`
+	Status    string               `json:"status,omitempty"`
+	Additions []*ResourceRecordSet `json:"additions,omitempty"`
+	Deletions []*ResourceRecordSet `json:"deletions,omitempty"`
+}
+
+type managedZonesListResponse struct {
+	ManagedZones []struct {
+		Name    string `json:"name"`
+		DNSName string `json:"dnsName"`
+	} `json:"managedZones"`
+}
+
+type resourceRecordSetsListResponse struct {
+	Rrsets        []*ResourceRecordSet `json:"rrsets"`
+	NextPageToken string               `json:"nextPageToken,omitempty"`
+}
+
+// HealthCheck is a Compute Engine health check.
+// See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks
+type HealthCheck struct {
+	Name               string           `json:"name"`
+	Description        string           `json:"description,omitempty"`
+	SelfLink           string           `json:"selfLink,omitempty"`
+	Type               string           `json:"type"`
+	CheckIntervalSec   int64            `json:"checkIntervalSec,omitempty"`
+	TimeoutSec         int64            `json:"timeoutSec,omitempty"`
+	UnhealthyThreshold int64            `json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int64            `json:"healthyThreshold,omitempty"`
+	HTTPHealthCheck    *HTTPHealthCheck `json:"httpHealthCheck,omitempty"`
+	HTTPSHealthCheck   *HTTPHealthCheck `json:"httpsHealthCheck,omitempty"`
+	TCPHealthCheck     *TCPHealthCheck  `json:"tcpHealthCheck,omitempty"`
+	SourceRegions      []string         `json:"sourceRegions,omitempty"`
+}
+
+// HTTPHealthCheck holds the HTTP(S) specific settings of a health check.
+type HTTPHealthCheck struct {
+	Port        int64  `json:"port,omitempty"`
+	Host        string `json:"host,omitempty"`
+	RequestPath string `json:"requestPath,omitempty"`
+}
+
+// TCPHealthCheck holds the TCP specific settings of a health check.
+type TCPHealthCheck struct {
+	Port int64 `json:"port,omitempty"`
+}
+
+// apiError is the error payload returned by the Google APIs.
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("googleapi: error %d: %s", e.Code, e.Message)
+}
+
+func isNotFound(err error) bool {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr.Code == http.StatusNotFound
+	}
+	return false
+}
+
+// cloudDNSClient is a minimal client for the Cloud DNS and Compute Engine
+// REST APIs, covering only the operations required by the provider.
+type cloudDNSClient struct {
+	httpClient      *http.Client
+	project         string
+	dnsEndpoint     string
+	computeEndpoint string
+}
+
+func (c *cloudDNSClient) listManagedZones(ctx context.Context, maxResults int) (*managedZonesListResponse, error) {
+	result := &managedZonesListResponse{}
+	path := fmt.Sprintf("%s/projects/%s/managedZones?maxResults=%d", c.dnsEndpoint, c.project, maxResults)
+	if err := c.do(ctx, http.MethodGet, path, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *cloudDNSClient) createChange(ctx context.Context, managedZone string, change *Change) (*Change, error) {
+	result := &Change{}
+	path := fmt.Sprintf("%s/projects/%s/managedZones/%s/changes", c.dnsEndpoint, c.project, managedZone)
+	if err := c.do(ctx, http.MethodPost, path, change, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *cloudDNSClient) listResourceRecordSets(ctx context.Context, managedZone, name, recordType string) ([]*ResourceRecordSet, error) {
+	var rrsets []*ResourceRecordSet
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("name", name)
+		if recordType != "" {
+			query.Set("type", recordType)
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		path := fmt.Sprintf("%s/projects/%s/managedZones/%s/rrsets?%s", c.dnsEndpoint, c.project, managedZone, query.Encode())
+
+		response := &resourceRecordSetsListResponse{}
+		if err := c.do(ctx, http.MethodGet, path, nil, response); err != nil {
+			return nil, err
+		}
+		rrsets = append(rrsets, response.Rrsets...)
+		if response.NextPageToken == "" {
+			return rrsets, nil
+		}
+		pageToken = response.NextPageToken
+	}
+}
+
+func (c *cloudDNSClient) getHealthCheck(ctx context.Context, name string) (*HealthCheck, error) {
+	result := &HealthCheck{}
+	if err := c.do(ctx, http.MethodGet, c.healthCheckURL(name), nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *cloudDNSClient) insertHealthCheck(ctx context.Context, healthCheck *HealthCheck) error {
+	path := fmt.Sprintf("%s/projects/%s/global/healthChecks", c.computeEndpoint, c.project)
+	return c.do(ctx, http.MethodPost, path, healthCheck, nil)
+}
+
+func (c *cloudDNSClient) updateHealthCheck(ctx context.Context, healthCheck *HealthCheck) error {
+	return c.do(ctx, http.MethodPut, c.healthCheckURL(healthCheck.Name), healthCheck, nil)
+}
+
+func (c *cloudDNSClient) deleteHealthCheck(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, c.healthCheckURL(name), nil, nil)
+}
+
+func (c *cloudDNSClient) healthCheckURL(name string) string {
+	return fmt.Sprintf("%s/projects/%s/global/healthChecks/%s", c.computeEndpoint, c.project, name)
+}
+
+func (c *cloudDNSClient) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		payload := struct {
+			Error *apiError `json:"error"`
+		}{}
+		if err := json.Unmarshal(data, &payload); err != nil || payload.Error == nil {
+			return &apiError{Code: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		}
+		payload.Error.Code = resp.StatusCode
+		return payload.Error
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,353 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/oauth2/google"
+
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+const (
+	ProviderSpecificHealthCheck = "google/health-check"
+
+	cloudDNSScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+	computeScope  = "https://www.googleapis.com/auth/compute"
+)
+
+var _ dns.Provider = &Provider{}
+
+// Provider publishes DNS records to Google Cloud DNS managed zones.
+//
+// Weighted endpoints are published as a single record set per name and type,
+// using a weighted round robin (WRR) routing policy. Endpoints with a health
+// check attached are published as health checked external endpoints.
+type Provider struct {
+	client                *cloudDNSClient
+	healthCheckReconciler *CloudDNSHealthCheckReconciler
+	config                Config
+	logger                logr.Logger
+}
+
+// Config is the necessary input to configure the provider.
+type Config struct {
+	// Project is the GCP project the managed zones belong to.
+	Project string
+	// DNSEndpoint overrides the Cloud DNS API base URL.
+	DNSEndpoint string
+	// ComputeEndpoint overrides the Compute Engine API base URL.
+	ComputeEndpoint string
+	// HTTPClient is the authenticated client used to call the APIs. When nil,
+	// the Google application default credentials are used.
+	HTTPClient *http.Client
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Project == "" {
+		return nil, fmt.Errorf("a GCP project is required")
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		var err error
+		httpClient, err = google.DefaultClient(context.Background(), cloudDNSScope, computeScope)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create Google client: %v", err)
+		}
+	}
+
+	dnsEndpoint := config.DNSEndpoint
+	if dnsEndpoint == "" {
+		dnsEndpoint = DefaultCloudDNSEndpoint
+	}
+	computeEndpoint := config.ComputeEndpoint
+	if computeEndpoint == "" {
+		computeEndpoint = DefaultComputeEndpoint
+	}
+
+	p := &Provider{
+		client: &cloudDNSClient{
+			httpClient:      httpClient,
+			project:         config.Project,
+			dnsEndpoint:     strings.TrimSuffix(dnsEndpoint, "/"),
+			computeEndpoint: strings.TrimSuffix(computeEndpoint, "/"),
+		},
+		config: config,
+		logger: log.Logger.WithName("google-clouddns").WithValues("project", config.Project),
+	}
+	if err := validateServiceEndpoints(p); err != nil {
+		return nil, fmt.Errorf("failed to validate Google provider service endpoints: %v", err)
+	}
+	return p, nil
+}
+
+// validateServiceEndpoints validates that the provider client can communicate
+// with the Cloud DNS API by listing the managed zones of the project.
+func validateServiceEndpoints(provider *Provider) error {
+	var errs []error
+	if _, err := provider.client.listManagedZones(context.Background(), 1); err != nil {
+		errs = append(errs, fmt.Errorf("failed to list Cloud DNS managed zones: %v", err))
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+func (p *Provider) Ensure(record *v1.DNSRecord, zone v1.DNSZone) error {
+	ctx := context.Background()
+
+	desired, err := recordSetsForEndpoints(record.Spec.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	// Record sets that were previously published but are no longer present
+	// in record.Spec.Endpoints have to be removed as well
+	published, err := recordSetsForEndpoints(dns.EndpointsFromZoneStatus(record, zone.ID))
+	if err != nil {
+		return err
+	}
+
+	change := &Change{}
+	for key := range published {
+		if _, found := desired[key]; found {
+			continue
+		}
+		existing, err := p.client.listResourceRecordSets(ctx, zone.ID, key.name, key.recordType)
+		if err != nil {
+			return fmt.Errorf("couldn't list record sets for %s in zone %s: %v", key.name, zone.ID, err)
+		}
+		change.Deletions = append(change.Deletions, existing...)
+	}
+
+	for key, recordSet := range desired {
+		existing, err := p.client.listResourceRecordSets(ctx, zone.ID, key.name, key.recordType)
+		if err != nil {
+			return fmt.Errorf("couldn't list record sets for %s in zone %s: %v", key.name, zone.ID, err)
+		}
+		if len(existing) == 1 && recordSetsEqual(existing[0], recordSet) {
+			continue
+		}
+		change.Deletions = append(change.Deletions, existing...)
+		change.Additions = append(change.Additions, recordSet)
+	}
+
+	if err := p.apply(ctx, record, zone, change); err != nil {
+		return err
+	}
+	p.logger.Info("Upserted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+func (p *Provider) Delete(record *v1.DNSRecord, zone v1.DNSZone) error {
+	ctx := context.Background()
+
+	desired, err := recordSetsForEndpoints(record.Spec.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	// Record sets that were previously published but are no longer present
+	// in record.Spec.Endpoints have to be removed as well
+	published, err := recordSetsForEndpoints(dns.EndpointsFromZoneStatus(record, zone.ID))
+	if err != nil {
+		return err
+	}
+	for key, recordSet := range published {
+		if _, found := desired[key]; !found {
+			desired[key] = recordSet
+		}
+	}
+
+	change := &Change{}
+	for key := range desired {
+		existing, err := p.client.listResourceRecordSets(ctx, zone.ID, key.name, key.recordType)
+		if err != nil {
+			return fmt.Errorf("couldn't list record sets for %s in zone %s: %v", key.name, zone.ID, err)
+		}
+		change.Deletions = append(change.Deletions, existing...)
+	}
+
+	if err := p.apply(ctx, record, zone, change); err != nil {
+		return err
+	}
+	p.logger.Info("Deleted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+func (p *Provider) HealthCheckReconciler() dns.HealthCheckReconciler {
+	if p.healthCheckReconciler == nil {
+		p.healthCheckReconciler = newCloudDNSHealthCheckReconciler(p.client, p.logger)
+	}
+
+	return p.healthCheckReconciler
+}
+
+func (p *Provider) apply(ctx context.Context, record *v1.DNSRecord, zone v1.DNSZone, change *Change) error {
+	if len(change.Additions) == 0 && len(change.Deletions) == 0 {
+		return nil
+	}
+	resp, err := p.client.createChange(ctx, zone.ID, change)
+	if err != nil {
+		return fmt.Errorf("couldn't update DNS record %s in zone %s: %v", record.Name, zone.ID, err)
+	}
+	p.logger.Info("Updated DNS record", "record", record, "zone", zone.ID, "change", resp.ID, "status", resp.Status)
+	return nil
+}
+
+type recordSetKey struct {
+	name       string
+	recordType string
+}
+
+// recordSetsForEndpoints groups the endpoints by name and type, as Cloud DNS
+// holds a single record set per name and type, and converts each group into
+// a record set.
+func recordSetsForEndpoints(endpoints []*v1.Endpoint) (map[recordSetKey]*ResourceRecordSet, error) {
+	groups := map[recordSetKey][]*v1.Endpoint{}
+	for _, endpoint := range endpoints {
+		switch v1.DNSRecordType(endpoint.RecordType) {
+		case v1.ARecordType, v1.AAAARecordType, v1.CNAMERecordType:
+		default:
+			return nil, fmt.Errorf("unsupported record type %s", endpoint.RecordType)
+		}
+		if len(endpoint.DNSName) == 0 {
+			return nil, fmt.Errorf("domain is required")
+		}
+		if len(endpoint.Targets) == 0 {
+			return nil, fmt.Errorf("targets is required")
+		}
+		key := recordSetKey{name: fqdn(endpoint.DNSName), recordType: endpoint.RecordType}
+		groups[key] = append(groups[key], endpoint)
+	}
+
+	recordSets := make(map[recordSetKey]*ResourceRecordSet, len(groups))
+	for key, group := range groups {
+		recordSet, err := recordSetForEndpoints(key, group)
+		if err != nil {
+			return nil, err
+		}
+		recordSets[key] = recordSet
+	}
+	return recordSets, nil
+}
+
+func recordSetForEndpoints(key recordSetKey, endpoints []*v1.Endpoint) (*ResourceRecordSet, error) {
+	recordSet := &ResourceRecordSet{
+		Kind: "dns#resourceRecordSet",
+		Name: key.name,
+		Type: key.recordType,
+		TTL:  int64(endpoints[0].RecordTTL),
+	}
+
+	weighted := false
+	for _, endpoint := range endpoints {
+		if _, ok := endpoint.GetProviderSpecific(aws.ProviderSpecificWeight); ok {
+			weighted = true
+		}
+		if _, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck); ok {
+			weighted = true
+		}
+	}
+
+	// Without any routing information, a simple record set with all the
+	// targets is published
+	if !weighted {
+		for _, endpoint := range endpoints {
+			recordSet.Rrdatas = append(recordSet.Rrdatas, rrdatas(key, endpoint)...)
+		}
+		if key.recordType == string(v1.CNAMERecordType) && len(recordSet.Rrdatas) > 1 {
+			return nil, fmt.Errorf("CNAME record %s can only have a single target", key.name)
+		}
+		return recordSet, nil
+	}
+
+	policy := &RRSetRoutingPolicy{Wrr: &WrrPolicy{}}
+	for _, endpoint := range endpoints {
+		item := &WrrPolicyItem{Weight: endpointWeight(endpoint)}
+		// The health checked targets must be IP addresses
+		if healthCheck, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck); ok && key.recordType != string(v1.CNAMERecordType) {
+			// Cloud DNS probes each of the health checked targets with the
+			// single health check of the routing policy, which the endpoints
+			// of a DNS name share
+			if policy.HealthCheck != "" && policy.HealthCheck != healthCheck {
+				return nil, fmt.Errorf("endpoints of %s have different health checks, Cloud DNS supports a single health check per routing policy", key.name)
+			}
+			policy.HealthCheck = healthCheck
+			item.HealthCheckedTargets = &HealthCheckedTargets{ExternalEndpoints: endpoint.Targets}
+		} else {
+			item.Rrdatas = rrdatas(key, endpoint)
+		}
+		policy.Wrr.Items = append(policy.Wrr.Items, item)
+	}
+	recordSet.RoutingPolicy = policy
+
+	return recordSet, nil
+}
+
+// rrdatas returns the record data of the endpoint targets, i.e., the
+// addresses, or the fully qualified host names of the CNAME records.
+func rrdatas(key recordSetKey, endpoint *v1.Endpoint) []string {
+	if key.recordType != string(v1.CNAMERecordType) {
+		return endpoint.Targets
+	}
+	data := make([]string, 0, len(endpoint.Targets))
+	for _, target := range endpoint.Targets {
+		data = append(data, fqdn(target))
+	}
+	return data
+}
+
+// endpointWeight returns the weight of the endpoint, as set by the ingress
+// reconciler, defaulting to 1 when no valid weight is set.
+func endpointWeight(endpoint *v1.Endpoint) float64 {
+	value, ok := endpoint.GetProviderSpecific(aws.ProviderSpecificWeight)
+	if !ok {
+		return 1
+	}
+	weight, err := strconv.ParseFloat(value, 64)
+	if err != nil || weight < 0 {
+		return 1
+	}
+	return weight
+}
+
+func recordSetsEqual(a, b *ResourceRecordSet) bool {
+	normalize := func(r *ResourceRecordSet) string {
+		c := *r
+		c.Kind = ""
+		data, _ := json.Marshal(c)
+		return string(data)
+	}
+	return normalize(a) == normalize(b)
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,387 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+)
+
+const (
+	testProject = "test-project"
+	testZone    = "test-zone"
+)
+
+// fakeCloudDNS is an HTTP stand-in for the subset of the Cloud DNS and
+// Compute Engine APIs used by the provider.
+type fakeCloudDNS struct {
+	mu           sync.Mutex
+	rrsets       map[string]*ResourceRecordSet
+	healthChecks map[string]*HealthCheck
+	changes      []*Change
+}
+
+func newFakeCloudDNS() *fakeCloudDNS {
+	return &fakeCloudDNS{
+		rrsets:       map[string]*ResourceRecordSet{},
+		healthChecks: map[string]*HealthCheck{},
+	}
+}
+
+func (f *fakeCloudDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	zonePath := "/dns/v1/projects/" + testProject + "/managedZones"
+	healthCheckPath := "/compute/v1/projects/" + testProject + "/global/healthChecks"
+
+	switch {
+	case r.URL.Path == zonePath && r.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{"managedZones": []map[string]string{{"name": testZone, "dnsName": "example.com."}}})
+
+	case r.URL.Path == zonePath+"/"+testZone+"/rrsets" && r.Method == http.MethodGet:
+		var rrsets []*ResourceRecordSet
+		for _, rrset := range f.rrsets {
+			if rrset.Name == r.URL.Query().Get("name") && (r.URL.Query().Get("type") == "" || rrset.Type == r.URL.Query().Get("type")) {
+				rrsets = append(rrsets, rrset)
+			}
+		}
+		writeJSON(w, resourceRecordSetsListResponse{Rrsets: rrsets})
+
+	case r.URL.Path == zonePath+"/"+testZone+"/changes" && r.Method == http.MethodPost:
+		change := &Change{}
+		if err := json.NewDecoder(r.Body).Decode(change); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, deletion := range change.Deletions {
+			if _, ok := f.rrsets[deletion.Name+deletion.Type]; !ok {
+				writeError(w, http.StatusNotFound, "record set not found")
+				return
+			}
+			delete(f.rrsets, deletion.Name+deletion.Type)
+		}
+		for _, addition := range change.Additions {
+			if _, ok := f.rrsets[addition.Name+addition.Type]; ok {
+				writeError(w, http.StatusConflict, "record set already exists")
+				return
+			}
+			f.rrsets[addition.Name+addition.Type] = addition
+		}
+		change.ID = "1"
+		change.Status = "pending"
+		f.changes = append(f.changes, change)
+		writeJSON(w, change)
+
+	case r.URL.Path == healthCheckPath && r.Method == http.MethodPost:
+		healthCheck := &HealthCheck{}
+		if err := json.NewDecoder(r.Body).Decode(healthCheck); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.healthChecks[healthCheck.Name] = healthCheck
+		writeJSON(w, map[string]string{"status": "DONE"})
+
+	case strings.HasPrefix(r.URL.Path, healthCheckPath+"/"):
+		name := strings.TrimPrefix(r.URL.Path, healthCheckPath+"/")
+		healthCheck, ok := f.healthChecks[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "health check not found")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, healthCheck)
+		case http.MethodPut:
+			updated := &HealthCheck{}
+			if err := json.NewDecoder(r.Body).Decode(updated); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			f.healthChecks[name] = updated
+			writeJSON(w, map[string]string{"status": "DONE"})
+		case http.MethodDelete:
+			delete(f.healthChecks, name)
+			writeJSON(w, map[string]string{"status": "DONE"})
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "unexpected request "+r.Method+" "+r.URL.String())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": apiError{Code: code, Message: message}})
+}
+
+func newTestProvider(t *testing.T) (*Provider, *fakeCloudDNS) {
+	fake := newFakeCloudDNS()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	provider, err := NewProvider(Config{
+		Project:         testProject,
+		DNSEndpoint:     server.URL + "/dns/v1",
+		ComputeEndpoint: server.URL + "/compute/v1",
+		HTTPClient:      server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating provider: %v", err)
+	}
+	return provider, fake
+}
+
+func weightedEndpoint(host, target, weight string) *v1.Endpoint {
+	endpoint := &v1.Endpoint{
+		DNSName:       host,
+		RecordType:    string(v1.ARecordType),
+		SetIdentifier: target,
+		Targets:       v1.Targets{target},
+		RecordTTL:     60,
+	}
+	endpoint.SetProviderSpecific(aws.ProviderSpecificWeight, weight)
+	return endpoint
+}
+
+func TestProviderEnsureAndDelete(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+	zone := v1.DNSZone{ID: testZone}
+
+	record := &v1.DNSRecord{}
+	record.Name = "test"
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "120"),
+		weightedEndpoint("app.example.com", "10.0.0.2", "60"),
+	}
+
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.rrsets).To(gomega.HaveKey("app.example.com.A"))
+
+	rrset := fake.rrsets["app.example.com.A"]
+	g.Expect(rrset.TTL).To(gomega.Equal(int64(60)))
+	g.Expect(rrset.RoutingPolicy).NotTo(gomega.BeNil())
+	g.Expect(rrset.RoutingPolicy.Wrr.Items).To(gomega.ConsistOf(
+		&WrrPolicyItem{Weight: 120, Rrdatas: []string{"10.0.0.1"}},
+		&WrrPolicyItem{Weight: 60, Rrdatas: []string{"10.0.0.2"}},
+	))
+
+	// Ensuring the same record again is a no-op
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.changes).To(gomega.HaveLen(1))
+
+	// Moving the record to another host removes the previously published set
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: zone, Endpoints: record.Spec.Endpoints}}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("other.example.com", "10.0.0.3", "120"),
+	}
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.rrsets).NotTo(gomega.HaveKey("app.example.com.A"))
+	g.Expect(fake.rrsets).To(gomega.HaveKey("other.example.com.A"))
+
+	// Deleting the record removes the sets only published in the zone status
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: zone, Endpoints: record.Spec.Endpoints}}
+	record.Spec.Endpoints = []*v1.Endpoint{}
+	g.Expect(provider.Delete(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.rrsets).To(gomega.BeEmpty())
+}
+
+func TestProviderUnweightedRecord(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{{
+		DNSName:    "simple.example.com",
+		RecordType: string(v1.ARecordType),
+		Targets:    v1.Targets{"10.0.0.1", "10.0.0.2"},
+		RecordTTL:  300,
+	}}
+
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+	g.Expect(fake.rrsets).To(gomega.HaveKey("simple.example.com.A"))
+	g.Expect(fake.rrsets["simple.example.com.A"].RoutingPolicy).To(gomega.BeNil())
+	g.Expect(fake.rrsets["simple.example.com.A"].Rrdatas).To(gomega.Equal([]string{"10.0.0.1", "10.0.0.2"}))
+}
+
+func TestProviderAAAAAndCNAMERecords(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		{
+			DNSName:    "v6.example.com",
+			RecordType: string(v1.AAAARecordType),
+			Targets:    v1.Targets{"2001:db8::1"},
+			RecordTTL:  60,
+		},
+		{
+			DNSName:    "alias.example.com",
+			RecordType: string(v1.CNAMERecordType),
+			Targets:    v1.Targets{"lb.example.net"},
+			RecordTTL:  60,
+		},
+	}
+
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+	g.Expect(fake.rrsets["v6.example.com.AAAA"].Rrdatas).To(gomega.Equal([]string{"2001:db8::1"}))
+	g.Expect(fake.rrsets["alias.example.com.CNAME"].Rrdatas).To(gomega.Equal([]string{"lb.example.net."}))
+
+	// A CNAME record can only point to a single host name
+	record.Spec.Endpoints[1].Targets = v1.Targets{"lb.example.net", "lb.example.org"}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).NotTo(gomega.Succeed())
+}
+
+func TestProviderUnsupportedRecordType(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, _ := newTestProvider(t)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{{
+		DNSName:    "txt.example.com",
+		RecordType: "TXT",
+		Targets:    v1.Targets{"text"},
+	}}
+
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).NotTo(gomega.Succeed())
+}
+
+func TestHealthCheckReconciler(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t)
+	reconciler := provider.HealthCheckReconciler()
+	ctx := context.Background()
+
+	endpoint := weightedEndpoint("app.example.com", "10.0.0.1", "120")
+	protocol := dns.HealthCheckProtocolHTTPS
+	threshold := int64(3)
+	port := int64(443)
+	spec := dns.HealthCheckSpec{
+		Id:               "abc",
+		Name:             "app.example.com-10.0.0.1",
+		Path:             "/healthz",
+		Port:             &port,
+		Protocol:         &protocol,
+		FailureThreshold: &threshold,
+	}
+
+	name := healthCheckName(endpoint)
+	g.Expect(reconciler.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	g.Expect(fake.healthChecks).To(gomega.HaveKey(name))
+	g.Expect(fake.healthChecks[name].Type).To(gomega.Equal(healthCheckTypeHTTPS))
+	g.Expect(fake.healthChecks[name].HTTPSHealthCheck.RequestPath).To(gomega.Equal("/healthz"))
+
+	selfLink, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(selfLink).To(gomega.HaveSuffix("/global/healthChecks/" + name))
+
+	// The health check is attached to the routing policy of the record set
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{endpoint}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+	rrset := fake.rrsets["app.example.com.A"]
+	g.Expect(rrset.RoutingPolicy.HealthCheck).To(gomega.Equal(selfLink))
+	g.Expect(rrset.RoutingPolicy.Wrr.Items[0].HealthCheckedTargets.ExternalEndpoints).To(gomega.Equal([]string{"10.0.0.1"}))
+
+	// Updating the spec updates the health check
+	spec.Path = "/ready"
+	g.Expect(reconciler.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	g.Expect(fake.healthChecks[name].HTTPSHealthCheck.RequestPath).To(gomega.Equal("/ready"))
+
+	// The TCP health checks only connect to the port
+	protocol = dns.HealthCheckProtocolTCP
+	g.Expect(reconciler.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	g.Expect(fake.healthChecks[name].Type).To(gomega.Equal(healthCheckTypeTCP))
+	g.Expect(fake.healthChecks[name].TCPHealthCheck).To(gomega.Equal(&TCPHealthCheck{Port: 443}))
+	g.Expect(fake.healthChecks[name].HTTPSHealthCheck).To(gomega.BeNil())
+
+	// The endpoints of a DNS name share the health check of the routing policy
+	other := weightedEndpoint("app.example.com", "10.0.0.2", "60")
+	g.Expect(reconciler.Reconcile(ctx, spec, other)).To(gomega.Succeed())
+	g.Expect(fake.healthChecks).To(gomega.HaveLen(1))
+	record.Spec.Endpoints = []*v1.Endpoint{endpoint, other}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).To(gomega.Succeed())
+	g.Expect(fake.rrsets["app.example.com.A"].RoutingPolicy.Wrr.Items).To(gomega.HaveLen(2))
+
+	// Endpoints of a DNS name with different health checks can't be published
+	other.SetProviderSpecific(ProviderSpecificHealthCheck, "other")
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: testZone})).NotTo(gomega.Succeed())
+	other.SetProviderSpecific(ProviderSpecificHealthCheck, selfLink)
+
+	// The users of the shared health check are registered again on restart
+	reconciler = newCloudDNSHealthCheckReconciler(provider.client, provider.logger)
+	reconciler.(dns.RegisteringHealthCheckReconciler).Register(endpoint)
+	reconciler.(dns.RegisteringHealthCheckReconciler).Register(other)
+
+	// The shared health check is deleted once unused by all the endpoints
+	g.Expect(reconciler.Delete(ctx, other)).To(gomega.Succeed())
+	g.Expect(fake.healthChecks).To(gomega.HaveLen(1))
+	g.Expect(reconciler.Delete(ctx, endpoint)).To(gomega.Succeed())
+	g.Expect(fake.healthChecks).To(gomega.BeEmpty())
+	_, ok = endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(ok).To(gomega.BeFalse())
+}
+
+func TestHealthCheckReconcilerUnsupportedFields(t *testing.T) {
+	provider, fake := newTestProvider(t)
+	reconciler := provider.HealthCheckReconciler()
+	ctx := context.Background()
+
+	protocol := dns.HealthCheckProtocolHTTP
+	port := int64(80)
+	expectedStatus := int64(200)
+	disabled := false
+	testCases := []struct {
+		name   string
+		modify func(spec *dns.HealthCheckSpec)
+	}{
+		{name: "expectedStatus", modify: func(spec *dns.HealthCheckSpec) { spec.ExpectedStatus = &expectedStatus }},
+		{name: "expectedBody", modify: func(spec *dns.HealthCheckSpec) { spec.ExpectedBody = "ok" }},
+		{name: "inverted", modify: func(spec *dns.HealthCheckSpec) { spec.Inverted = true }},
+		{name: "enableSNI", modify: func(spec *dns.HealthCheckSpec) { spec.EnableSNI = &disabled }},
+		{name: "regions", modify: func(spec *dns.HealthCheckSpec) { spec.Regions = []string{"us-east-1"} }},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			spec := dns.HealthCheckSpec{Path: "/healthz", Port: &port, Protocol: &protocol}
+			testCase.modify(&spec)
+
+			err := reconciler.Reconcile(ctx, spec, weightedEndpoint("app.example.com", "10.0.0.1", "120"))
+			g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring(testCase.name)))
+			g.Expect(fake.healthChecks).To(gomega.BeEmpty())
+		})
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+const (
+	healthCheckTypeHTTP  = "HTTP"
+	healthCheckTypeHTTPS = "HTTPS"
+	healthCheckTypeTCP   = "TCP"
+
+	healthCheckNamePrefix = "glbc-"
+)
+
+// healthCheckSourceRegions are the regions the health checks probe the
+// external endpoints from. Cloud DNS requires exactly three source regions
+// for health checks attached to public routing policies.
+var healthCheckSourceRegions = []string{"us-east4", "europe-west2", "asia-southeast1"}
+
+// CloudDNSHealthCheckReconciler manages Compute Engine health checks that are
+// attached to the Cloud DNS routing policies of the endpoints.
+//
+// Cloud DNS attaches a single health check to a routing policy, so the
+// endpoints of a DNS name share a single health check, that's deleted once
+// it's not used by any endpoint anymore.
+type CloudDNSHealthCheckReconciler struct {
+	client *cloudDNSClient
+	logger logr.Logger
+
+	mu sync.Mutex
+	// users are the endpoints using each health check, by health check name
+	users map[string]map[string]bool
+}
+
+var _ dns.HealthCheckReconciler = &CloudDNSHealthCheckReconciler{}
+var _ dns.RegisteringHealthCheckReconciler = &CloudDNSHealthCheckReconciler{}
+
+func newCloudDNSHealthCheckReconciler(c *cloudDNSClient, l logr.Logger) *CloudDNSHealthCheckReconciler {
+	return &CloudDNSHealthCheckReconciler{
+		client: c,
+		logger: l.WithName("health"),
+		users:  map[string]map[string]bool{},
+	}
+}
+
+func (r *CloudDNSHealthCheckReconciler) Reconcile(ctx context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
+	if unsupported := unsupportedHealthCheckFields(spec); len(unsupported) > 0 {
+		return fmt.Errorf("Cloud DNS health checks don't support %s", strings.Join(unsupported, ", "))
+	}
+	desired := healthCheckForSpec(spec, endpoint)
+
+	existing, err := r.client.getHealthCheck(ctx, desired.Name)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		r.logger.Info("Creating health check", "name", desired.Name)
+		if err := r.client.insertHealthCheck(ctx, desired); err != nil {
+			return err
+		}
+	} else if healthCheckChanged(existing, desired) {
+		r.logger.Info("Updating health check", "name", desired.Name)
+		if err := r.client.updateHealthCheck(ctx, desired); err != nil {
+			return err
+		}
+	}
+
+	r.addUser(desired.Name, endpoint)
+	endpoint.SetProviderSpecific(ProviderSpecificHealthCheck, r.client.healthCheckURL(desired.Name))
+	return nil
+}
+
+func (r *CloudDNSHealthCheckReconciler) Delete(ctx context.Context, endpoint *v1.Endpoint) error {
+	selfLink, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	if !ok {
+		return nil
+	}
+
+	name := strings.TrimPrefix(selfLink, r.client.healthCheckURL(""))
+	if r.removeUser(name, endpoint) {
+		r.logger.Info("Deleting health check", "name", name)
+		if err := r.client.deleteHealthCheck(ctx, name); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	endpoint.DeleteProviderSpecific(ProviderSpecificHealthCheck)
+	return nil
+}
+
+// Register records the endpoint as a user of its health check, so that the
+// users of the health checks are restored when the controller starts.
+func (r *CloudDNSHealthCheckReconciler) Register(endpoint *v1.Endpoint) {
+	selfLink, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	if !ok {
+		return
+	}
+	r.addUser(strings.TrimPrefix(selfLink, r.client.healthCheckURL("")), endpoint)
+}
+
+func (r *CloudDNSHealthCheckReconciler) addUser(name string, endpoint *v1.Endpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.users[name] == nil {
+		r.users[name] = map[string]bool{}
+	}
+	r.users[name][healthCheckUser(endpoint)] = true
+}
+
+// removeUser removes the endpoint from the users of the health check, and
+// returns whether the health check isn't used by any endpoint anymore.
+func (r *CloudDNSHealthCheckReconciler) removeUser(name string, endpoint *v1.Endpoint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users[name], healthCheckUser(endpoint))
+	if len(r.users[name]) > 0 {
+		return false
+	}
+	delete(r.users, name)
+	return true
+}
+
+func healthCheckUser(endpoint *v1.Endpoint) string {
+	return endpoint.DNSName + "/" + endpoint.SetIdentifier
+}
+
+// Status returns an unknown state, as the health of the endpoints is only
+// available through the backend services the health checks are attached to.
+func (r *CloudDNSHealthCheckReconciler) Status(_ context.Context, _ *v1.Endpoint) (dns.HealthCheckStatus, error) {
+	return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "Cloud DNS doesn't report the health of the endpoints"}, nil
+}
+
+// unsupportedHealthCheckFields returns the fields of the spec the Compute
+// Engine health checks can't be configured with.
+func unsupportedHealthCheckFields(spec dns.HealthCheckSpec) []string {
+	var unsupported []string
+	if spec.ExpectedStatus != nil {
+		unsupported = append(unsupported, "expectedStatus")
+	}
+	if spec.ExpectedBody != "" {
+		unsupported = append(unsupported, "expectedBody")
+	}
+	if spec.Inverted {
+		unsupported = append(unsupported, "inverted")
+	}
+	if spec.EnableSNI != nil && !*spec.EnableSNI {
+		unsupported = append(unsupported, "enableSNI")
+	}
+	// The source regions are fixed by Cloud DNS
+	if len(spec.Regions) > 0 {
+		unsupported = append(unsupported, "regions")
+	}
+	return unsupported
+}
+
+func healthCheckForSpec(spec dns.HealthCheckSpec, endpoint *v1.Endpoint) *HealthCheck {
+	healthCheck := &HealthCheck{
+		Name:          healthCheckName(endpoint),
+		Description:   endpoint.DNSName,
+		Type:          healthCheckTypeHTTP,
+		SourceRegions: healthCheckSourceRegions,
+	}
+	if spec.FailureThreshold != nil {
+		healthCheck.UnhealthyThreshold = *spec.FailureThreshold
+	}
+	if spec.Interval != nil {
+		healthCheck.CheckIntervalSec = int64(spec.Interval.Seconds())
+	}
+
+	if spec.Protocol != nil && *spec.Protocol == dns.HealthCheckProtocolTCP {
+		healthCheck.Type = healthCheckTypeTCP
+		healthCheck.TCPHealthCheck = &TCPHealthCheck{}
+		if spec.Port != nil {
+			healthCheck.TCPHealthCheck.Port = *spec.Port
+		}
+		return healthCheck
+	}
+
+	settings := &HTTPHealthCheck{
+		Host:        endpoint.DNSName,
+		RequestPath: spec.Path,
+	}
+	if spec.Port != nil {
+		settings.Port = *spec.Port
+	}
+
+	if spec.Protocol != nil && *spec.Protocol == dns.HealthCheckProtocolHTTPS {
+		healthCheck.Type = healthCheckTypeHTTPS
+		healthCheck.HTTPSHealthCheck = settings
+	} else {
+		healthCheck.HTTPHealthCheck = settings
+	}
+
+	return healthCheck
+}
+
+// healthCheckName returns the name of the health check of the endpoint, that's
+// shared by the endpoints of its DNS name.
+func healthCheckName(endpoint *v1.Endpoint) string {
+	return fmt.Sprintf("%s%x", healthCheckNamePrefix, md5.Sum([]byte(endpoint.DNSName)))
+}
+
+func healthCheckChanged(existing, desired *HealthCheck) bool {
+	if existing.Type != desired.Type {
+		return true
+	}
+	if desired.UnhealthyThreshold != 0 && existing.UnhealthyThreshold != desired.UnhealthyThreshold {
+		return true
+	}
+	if desired.CheckIntervalSec != 0 && existing.CheckIntervalSec != desired.CheckIntervalSec {
+		return true
+	}
+	if !reflect.DeepEqual(existing.HTTPHealthCheck, desired.HTTPHealthCheck) ||
+		!reflect.DeepEqual(existing.HTTPSHealthCheck, desired.HTTPSHealthCheck) ||
+		!reflect.DeepEqual(existing.TCPHealthCheck, desired.TCPHealthCheck) {
+		return true
+	}
+	return false
+}
@@ -2,14 +2,66 @@ package dns
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
 )
 
+// HealthCheckAnnotationPrefix is the prefix of the deprecated annotations that
+// configure the health checks, superseded by the DNSRecord healthCheck field.
+const HealthCheckAnnotationPrefix = "kuadrant.experimental/health-"
+
 type HealthCheckReconciler interface {
 	Reconcile(ctx context.Context, spec HealthCheckSpec, endpoint *v1.Endpoint) error
 
 	Delete(ctx context.Context, endpoint *v1.Endpoint) error
+
+	// Status returns the health of the endpoint, as last reported by its
+	// health check.
+	Status(ctx context.Context, endpoint *v1.Endpoint) (HealthCheckStatus, error)
+}
+
+// CalculatedHealthCheckReconciler is implemented by the health check
+// reconcilers that can aggregate the health checks of the endpoints of a DNS
+// name into a calculated health check.
+type CalculatedHealthCheckReconciler interface {
+	// ReconcileCalculated reconciles the health check of the DNS name of the
+	// endpoints, that's healthy if at least spec.HealthThreshold of their
+	// health checks are healthy.
+	ReconcileCalculated(ctx context.Context, spec HealthCheckSpec, endpoints []*v1.Endpoint) error
+
+	// DeleteCalculated deletes the calculated health check of the endpoints.
+	DeleteCalculated(ctx context.Context, endpoints []*v1.Endpoint) error
+}
+
+// ReplacedHealthCheckReconciler is implemented by the health check
+// reconcilers that replace the health checks they can't update, and can only
+// delete the replaced health checks once the records don't use them anymore.
+type ReplacedHealthCheckReconciler interface {
+	// DeleteReplaced deletes the health checks replaced by the health check
+	// of the endpoint, that none of the published endpoints use anymore.
+	DeleteReplaced(ctx context.Context, endpoint *v1.Endpoint, published []*v1.Endpoint) error
+}
+
+// RegisteringHealthCheckReconciler is implemented by the health check
+// reconcilers that count the users of their health checks, whose users are
+// restored from the endpoints of the existing DNSRecords when the controller
+// starts.
+type RegisteringHealthCheckReconciler interface {
+	// Register records the endpoint as a user of its health check.
+	Register(endpoint *v1.Endpoint)
+}
+
+// HealthCheckStatus is the health of an endpoint, as reported by its health check.
+type HealthCheckStatus struct {
+	State v1.HealthCheckState
+	// Message describes why the endpoint is unhealthy, or its health unknown
+	Message string
 }
 
 type HealthCheckSpec struct {
@@ -20,12 +72,130 @@ type HealthCheckSpec struct {
 	Protocol         *HealthCheckProtocol
 
 	Path string
+
+	// Interval is the interval between the checks, the provider default if nil
+	Interval *time.Duration
+	// ExpectedStatus is the status code of the healthy responses, any 2xx or
+	// 3xx status code if nil
+	ExpectedStatus *int64
+	// ExpectedBody is a string the body of the healthy responses must contain
+	ExpectedBody string
+
+	// Inverted is whether the endpoints are healthy when failing the checks
+	Inverted bool
+	// EnableSNI is whether the HTTPS checks send the host name in the TLS
+	// handshake, true if nil
+	EnableSNI *bool
+	// Regions are the regions the endpoints are checked from, all the
+	// regions of the provider if empty
+	Regions []string
+	// HealthThreshold is the number of health checks of the endpoints of a
+	// DNS name that must be healthy for its calculated health check to be healthy
+	HealthThreshold *int64
+
+	// DNSRecord is the key of the DNSRecord the health check is created for
+	DNSRecord string
+}
+
+type HealthCheckProtocol = v1.HealthCheckProtocol
+
+const HealthCheckProtocolHTTP = v1.HealthCheckProtocolHTTP
+const HealthCheckProtocolHTTPS = v1.HealthCheckProtocolHTTPS
+const HealthCheckProtocolTCP = v1.HealthCheckProtocolTCP
+
+// healthCheckAnnotations are the supported health check annotations, without
+// the HealthCheckAnnotationPrefix.
+var healthCheckAnnotations = []string{
+	"endpoint",
+	"port",
+	"protocol",
+	"failure-threshold",
+	"interval",
+	"expected-status",
+	"expected-body",
+	"inverted",
+	"enable-sni",
+	"regions",
+	"health-threshold",
+}
+
+// HealthCheckFromAnnotations returns the health check configured with the
+// deprecated "kuadrant.experimental/health-*" annotations, or nil if none of
+// them is set.
+func HealthCheckFromAnnotations(annotations map[string]string) (*v1.HealthCheckSpec, error) {
+	var healthCheck *v1.HealthCheckSpec
+
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, HealthCheckAnnotationPrefix) {
+			continue
+		}
+		if healthCheck == nil {
+			healthCheck = &v1.HealthCheckSpec{}
+		}
+
+		var err error
+		switch strings.TrimPrefix(key, HealthCheckAnnotationPrefix) {
+		case "endpoint":
+			healthCheck.Endpoint = value
+		case "port":
+			healthCheck.Port, err = parseInt64(value)
+		case "protocol":
+			switch protocol := HealthCheckProtocol(value); protocol {
+			case HealthCheckProtocolHTTP, HealthCheckProtocolHTTPS, HealthCheckProtocolTCP:
+				healthCheck.Protocol = &protocol
+			default:
+				err = fmt.Errorf("invalid protocol %s. Only supported values are HTTP, HTTPS and TCP", value)
+			}
+		case "failure-threshold":
+			healthCheck.FailureThreshold, err = parseInt64(value)
+		case "interval":
+			var interval time.Duration
+			if interval, err = time.ParseDuration(value); err == nil {
+				healthCheck.Interval = &metav1.Duration{Duration: interval}
+			}
+		case "expected-status":
+			healthCheck.ExpectedStatus, err = parseInt64(value)
+		case "expected-body":
+			healthCheck.ExpectedBody = value
+		case "inverted":
+			healthCheck.Inverted, err = strconv.ParseBool(value)
+		case "enable-sni":
+			var enableSNI bool
+			if enableSNI, err = strconv.ParseBool(value); err == nil {
+				healthCheck.EnableSNI = &enableSNI
+			}
+		case "regions":
+			healthCheck.Regions = strings.Split(value, ",")
+		case "health-threshold":
+			healthCheck.HealthThreshold, err = parseInt64(value)
+		default:
+			supported := make([]string, 0, len(healthCheckAnnotations))
+			for _, annotation := range healthCheckAnnotations {
+				supported = append(supported, HealthCheckAnnotationPrefix+annotation)
+			}
+			return nil, fmt.Errorf("unsupported annotation %s. Only supported annotations are %s", key, strings.Join(supported, ", "))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for annotation %s: %v", key, err)
+		}
+	}
+
+	return healthCheck, nil
 }
 
-type HealthCheckProtocol string
+func parseInt64(s string) (*int64, error) {
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
 
-const HealthCheckProtocolHTTP HealthCheckProtocol = "HTTP"
-const HealthCheckProtocolHTTPS HealthCheckProtocol = "HTTPS"
+// NoopHealthCheckReconciler returns a health check reconciler that does
+// nothing, for providers that don't support health checks.
+func NoopHealthCheckReconciler() HealthCheckReconciler {
+	return &fakeHealthCheckReconciler{}
+}
 
 type fakeHealthCheckReconciler struct{}
 
@@ -37,4 +207,8 @@ func (*fakeHealthCheckReconciler) Delete(ctx context.Context, _ *v1.Endpoint) er
 	return nil
 }
 
+func (*fakeHealthCheckReconciler) Status(ctx context.Context, _ *v1.Endpoint) (HealthCheckStatus, error) {
+	return HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "The DNS provider doesn't support health checks"}, nil
+}
+
 var _ HealthCheckReconciler = &fakeHealthCheckReconciler{}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+func TestHealthCheckFromAnnotations(t *testing.T) {
+	port, threshold, status, tcpPort, healthThreshold, enableSNI := int64(8443), int64(5), int64(204), int64(5432), int64(2), false
+	https, http, tcp := HealthCheckProtocolHTTPS, HealthCheckProtocolHTTP, HealthCheckProtocolTCP
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		healthCheck *v1.HealthCheckSpec
+		valid       bool
+	}{
+		{name: "no annotations", valid: true},
+		{name: "unrelated annotations", annotations: map[string]string{"kuadrant.experimental/dns-record-type": "CNAME"}, valid: true},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				HealthCheckAnnotationPrefix + "endpoint":          "/healthz",
+				HealthCheckAnnotationPrefix + "port":              "8443",
+				HealthCheckAnnotationPrefix + "protocol":          "HTTPS",
+				HealthCheckAnnotationPrefix + "failure-threshold": "5",
+				HealthCheckAnnotationPrefix + "interval":          "30s",
+				HealthCheckAnnotationPrefix + "expected-status":   "204",
+				HealthCheckAnnotationPrefix + "expected-body":     "ok",
+				HealthCheckAnnotationPrefix + "inverted":          "true",
+				HealthCheckAnnotationPrefix + "enable-sni":        "false",
+				HealthCheckAnnotationPrefix + "regions":           "us-east-1,eu-west-1,ap-southeast-1",
+				HealthCheckAnnotationPrefix + "health-threshold":  "2",
+			},
+			healthCheck: &v1.HealthCheckSpec{
+				Endpoint:         "/healthz",
+				Port:             &port,
+				Protocol:         &https,
+				FailureThreshold: &threshold,
+				Interval:         &metav1.Duration{Duration: 30 * time.Second},
+				ExpectedStatus:   &status,
+				ExpectedBody:     "ok",
+				Inverted:         true,
+				EnableSNI:        &enableSNI,
+				Regions:          []string{"us-east-1", "eu-west-1", "ap-southeast-1"},
+				HealthThreshold:  &healthThreshold,
+			},
+			valid: true,
+		},
+		{
+			name:        "HTTP protocol",
+			annotations: map[string]string{HealthCheckAnnotationPrefix + "protocol": "HTTP"},
+			healthCheck: &v1.HealthCheckSpec{Protocol: &http},
+			valid:       true,
+		},
+		{
+			name:        "TCP protocol",
+			annotations: map[string]string{HealthCheckAnnotationPrefix + "protocol": "TCP", HealthCheckAnnotationPrefix + "port": "5432"},
+			healthCheck: &v1.HealthCheckSpec{Protocol: &tcp, Port: &tcpPort},
+			valid:       true,
+		},
+		{name: "invalid protocol", annotations: map[string]string{HealthCheckAnnotationPrefix + "protocol": "UDP"}},
+		{name: "invalid port", annotations: map[string]string{HealthCheckAnnotationPrefix + "port": "http"}},
+		{name: "invalid inverted", annotations: map[string]string{HealthCheckAnnotationPrefix + "inverted": "yes please"}},
+		{name: "invalid interval", annotations: map[string]string{HealthCheckAnnotationPrefix + "interval": "30"}},
+		{name: "unknown annotation", annotations: map[string]string{HealthCheckAnnotationPrefix + "timeout": "5s"}},
+	}
+
+	// The supported annotations are listed in the error of an unknown annotation
+	_, err := HealthCheckFromAnnotations(map[string]string{HealthCheckAnnotationPrefix + "timeout": "5s"})
+	gomega.NewWithT(t).Expect(err).To(gomega.MatchError(
+		"unsupported annotation kuadrant.experimental/health-timeout. Only supported annotations are " +
+			"kuadrant.experimental/health-endpoint, kuadrant.experimental/health-port, kuadrant.experimental/health-protocol, " +
+			"kuadrant.experimental/health-failure-threshold, kuadrant.experimental/health-interval, " +
+			"kuadrant.experimental/health-expected-status, kuadrant.experimental/health-expected-body, " +
+			"kuadrant.experimental/health-inverted, kuadrant.experimental/health-enable-sni, " +
+			"kuadrant.experimental/health-regions, kuadrant.experimental/health-health-threshold"))
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			healthCheck, err := HealthCheckFromAnnotations(tc.annotations)
+			if !tc.valid {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(healthCheck).To(gomega.Equal(tc.healthCheck))
+		})
+	}
+}
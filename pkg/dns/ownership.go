@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/tools/cache"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+const (
+	// ownershipHeritage identifies the ownership records created by the GLBC
+	ownershipHeritage = "kcp-glbc"
+	// ownershipRecordPrefix is the prefix of the name of the ownership TXT record
+	// of a DNS name. The ownership record doesn't have the same name as the
+	// records it owns, as CNAME records can't coexist with other records.
+	ownershipRecordPrefix = "_glbc-owner."
+)
+
+// Ownership is the content of the ownership TXT record of a DNS name, that
+// identifies the GLBC instance, and the DNSRecord, the records of the name
+// are published for.
+type Ownership struct {
+	// Owner is the identifier of the GLBC instance
+	Owner string
+	// DNSRecord is the key of the DNSRecord
+	DNSRecord string
+}
+
+// String returns the value of the ownership TXT record.
+func (o Ownership) String() string {
+	return fmt.Sprintf("heritage=%s,%s/owner=%s,%s/resource=dnsrecord/%s", ownershipHeritage, ownershipHeritage, o.Owner, ownershipHeritage, o.DNSRecord)
+}
+
+// ParseOwnership returns the ownership from the value of an ownership TXT
+// record, with or without quotes, and whether the value is a valid ownership.
+func ParseOwnership(value string) (Ownership, bool) {
+	ownership := Ownership{}
+	heritage := false
+	for _, field := range strings.Split(strings.Trim(value, `"`), ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return Ownership{}, false
+		}
+		switch kv[0] {
+		case "heritage":
+			heritage = kv[1] == ownershipHeritage
+		case ownershipHeritage + "/owner":
+			ownership.Owner = kv[1]
+		case ownershipHeritage + "/resource":
+			ownership.DNSRecord = strings.TrimPrefix(kv[1], "dnsrecord/")
+		}
+	}
+	if !heritage || ownership.Owner == "" || ownership.DNSRecord == "" {
+		return Ownership{}, false
+	}
+	return ownership, true
+}
+
+// OwnershipConflictError is returned by the providers that refuse to change
+// the records of DNS names that are not owned by the DNSRecord, i.e., that are
+// owned by another GLBC instance or DNSRecord, or that were created by another
+// tool.
+type OwnershipConflictError struct {
+	// Names are the DNS names that are not owned by the DNSRecord
+	Names []string
+}
+
+func (e *OwnershipConflictError) Error() string {
+	return fmt.Sprintf("the records of %s are not owned by the DNS record", strings.Join(e.Names, ", "))
+}
+
+// IsOwnershipConflict returns whether the error, or an error it wraps, is an
+// OwnershipConflictError.
+func IsOwnershipConflict(err error) bool {
+	var conflict *OwnershipConflictError
+	return errors.As(err, &conflict)
+}
+
+// DNSRecordKey returns the key of the DNSRecord, that identifies it across
+// logical clusters.
+func DNSRecordKey(record *v1.DNSRecord) string {
+	key, err := cache.MetaNamespaceKeyFunc(record)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// OwnershipRecordName returns the name of the ownership TXT record of the DNS name.
+func OwnershipRecordName(dnsName string) string {
+	return ownershipRecordPrefix + dnsName
+}
+
+// OwnedDNSName returns the DNS name owned by the ownership TXT record with the
+// name, and whether the name is the name of an ownership record.
+func OwnedDNSName(name string) (string, bool) {
+	if !strings.HasPrefix(name, ownershipRecordPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(name, ownershipRecordPrefix), true
+}
+
+// OwnedResourceKind is the kind of the resources a DNS provider creates for
+// the DNSRecords.
+type OwnedResourceKind string
+
+const (
+	OwnedResourceKindRecords     OwnedResourceKind = "records"
+	OwnedResourceKindHealthCheck OwnedResourceKind = "health-check"
+)
+
+// OwnedResource is a resource of a DNS provider that's owned by the GLBC
+// instance, i.e., the records of a DNS name, or a health check, that were
+// created for a DNSRecord.
+type OwnedResource struct {
+	Kind OwnedResourceKind
+	// ID identifies the resource in the DNS provider, i.e., the DNS name of
+	// the records, or the ID of the health check.
+	ID string
+	// Zone is the zone of the records, empty for health checks.
+	Zone v1.DNSZone
+	// DNSRecord is the key of the DNSRecord the resource was created for.
+	DNSRecord string
+}
+
+func (r OwnedResource) String() string {
+	if r.Zone.ID != "" {
+		return fmt.Sprintf("%s %s in zone %s", r.Kind, r.ID, r.Zone.ID)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.ID)
+}
+
+// ResourceOwner is implemented by the providers that can identify the resources
+// owned by the GLBC instance, so that the resources that outlive the DNSRecord
+// they were created for, e.g., if a finalizer is removed, can be deleted.
+type ResourceOwner interface {
+	// OwnedResources returns the resources owned by the GLBC instance, in the
+	// zones, and the health checks.
+	OwnedResources(zones []v1.DNSZone) ([]OwnedResource, error)
+
+	// ResourceInUse returns whether the resource is still used by the
+	// DNSRecord it was created for.
+	ResourceInUse(resource OwnedResource, record *v1.DNSRecord) bool
+
+	// DeleteOwnedResource deletes the resource from the DNS provider.
+	DeleteOwnedResource(resource OwnedResource) error
+}
@@ -0,0 +1,45 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestParseOwnership(t *testing.T) {
+	ownership := Ownership{Owner: "glbc", DNSRecord: "default/admin#$#app"}
+
+	cases := []struct {
+		name      string
+		value     string
+		ownership Ownership
+		valid     bool
+	}{
+		{name: "unquoted", value: ownership.String(), ownership: ownership, valid: true},
+		{name: "quoted", value: `"` + ownership.String() + `"`, ownership: ownership, valid: true},
+		{name: "other heritage", value: "heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/app"},
+		{name: "no owner", value: "heritage=kcp-glbc,kcp-glbc/resource=dnsrecord/default/app"},
+		{name: "no resource", value: "heritage=kcp-glbc,kcp-glbc/owner=glbc"},
+		{name: "not an ownership", value: "v=spf1 -all"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			parsed, valid := ParseOwnership(tc.value)
+			g.Expect(valid).To(gomega.Equal(tc.valid))
+			g.Expect(parsed).To(gomega.Equal(tc.ownership))
+		})
+	}
+}
+
+func TestOwnedDNSName(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	name, ok := OwnedDNSName(OwnershipRecordName("app.example.com"))
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(name).To(gomega.Equal("app.example.com"))
+
+	_, ok = OwnedDNSName("app.example.com")
+	g.Expect(ok).To(gomega.BeFalse())
+}
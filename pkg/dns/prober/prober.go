@@ -0,0 +1,411 @@
+// Package prober implements health checks that probe the endpoints from the
+// GLBC itself, so that the endpoints can be health checked regardless of the
+// health checks the DNS providers offer.
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+const (
+	// ProviderSpecificHealthCheck is the ID of the health check probing an endpoint.
+	ProviderSpecificHealthCheck = "glbc/health-check"
+
+	DefaultFailureThreshold = 3
+	DefaultInterval         = 30 * time.Second
+	DefaultTimeout          = 5 * time.Second
+	DefaultWorkers          = 10
+
+	// MaxBodySearchLength is the length of the beginning of the response body
+	// searched for the expected string
+	MaxBodySearchLength = 5120
+
+	// tick is the interval the health checks are checked for a due probe at
+	tick = time.Second
+	// expiry is the time after which the health checks that haven't been
+	// reconciled are removed, as their endpoint has been removed
+	expiry = 10 * time.Minute
+)
+
+type Config struct {
+	// Interval is the interval between the probes of the health checks
+	// without interval
+	Interval time.Duration
+	// Timeout is the timeout of each probe
+	Timeout time.Duration
+	// Workers is the maximum number of health checks probed concurrently
+	Workers int
+	// ProviderSpecific is the provider specific property the ID of the
+	// health check is set in, ProviderSpecificHealthCheck if unset
+	ProviderSpecific string
+	// OnChange is called with the key of the DNSRecord of a health check,
+	// when its endpoint turns healthy or unhealthy
+	OnChange func(dnsRecord string)
+}
+
+// Prober is a dns.HealthCheckReconciler that probes the targets of the
+// endpoints with HTTP(S) requests or TCP connections, and tracks their health.
+type Prober struct {
+	config Config
+	client *http.Client
+	dialer *net.Dialer
+	logger logr.Logger
+
+	mu     sync.RWMutex
+	checks map[string]*healthCheck
+}
+
+type healthCheck struct {
+	spec    dns.HealthCheckSpec
+	host    string
+	targets []string
+
+	failures int64
+	// lastError is the error of the last failed probe
+	lastError string
+	probed    bool
+	// probing is whether a probe is in progress
+	probing    bool
+	lastProbe  time.Time
+	reconciled time.Time
+}
+
+var _ dns.HealthCheckReconciler = &Prober{}
+
+func New(config Config, l logr.Logger) *Prober {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.ProviderSpecific == "" {
+		config.ProviderSpecific = ProviderSpecificHealthCheck
+	}
+	return &Prober{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				// Endpoints are probed by IP address, so the certificates can't be verified
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		dialer: &net.Dialer{Timeout: config.Timeout},
+		logger: l.WithName("prober"),
+		checks: map[string]*healthCheck{},
+	}
+}
+
+func (p *Prober) Reconcile(_ context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	check, ok := p.checks[spec.Id]
+	if !ok {
+		p.logger.Info("Creating health check", "id", spec.Id, "name", spec.Name)
+		check = &healthCheck{}
+		p.checks[spec.Id] = check
+	}
+	check.spec = spec
+	check.host = endpoint.DNSName
+	check.targets = append([]string{}, endpoint.Targets...)
+	check.reconciled = time.Now()
+
+	endpoint.SetProviderSpecific(p.config.ProviderSpecific, spec.Id)
+	return nil
+}
+
+func (p *Prober) Delete(_ context.Context, endpoint *v1.Endpoint) error {
+	id, ok := endpoint.GetProviderSpecific(p.config.ProviderSpecific)
+	if !ok {
+		return nil
+	}
+
+	p.mu.Lock()
+	delete(p.checks, id)
+	p.mu.Unlock()
+
+	endpoint.DeleteProviderSpecific(p.config.ProviderSpecific)
+	return nil
+}
+
+func (p *Prober) Status(_ context.Context, endpoint *v1.Endpoint) (dns.HealthCheckStatus, error) {
+	id, ok := endpoint.GetProviderSpecific(p.config.ProviderSpecific)
+	if !ok {
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "The endpoint has no health check"}, nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	check, ok := p.checks[id]
+	switch {
+	case !ok || !check.probed:
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateUnknown, Message: "The endpoint hasn't been probed yet"}, nil
+	case check.healthy():
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateHealthy}, nil
+	default:
+		return dns.HealthCheckStatus{State: v1.HealthCheckStateUnhealthy, Message: check.lastError}, nil
+	}
+}
+
+// Healthy returns whether the failures of the health check of the endpoint
+// have not reached its failure threshold. The endpoints without health check,
+// or not probed yet, are considered healthy.
+func (p *Prober) Healthy(endpoint *v1.Endpoint) bool {
+	id, ok := endpoint.GetProviderSpecific(p.config.ProviderSpecific)
+	if !ok {
+		return true
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	check, ok := p.checks[id]
+	return !ok || check.healthy()
+}
+
+func (c *healthCheck) healthy() bool {
+	threshold := int64(DefaultFailureThreshold)
+	if c.spec.FailureThreshold != nil {
+		threshold = *c.spec.FailureThreshold
+	}
+	return c.failures < threshold
+}
+
+// Run probes the health checks at their interval, with at most
+// Config.Workers probes in progress, until the context is done.
+func (p *Prober) Run(ctx context.Context) {
+	p.logger.Info("Starting health check prober", "interval", p.config.Interval, "timeout", p.config.Timeout, "workers", p.config.Workers)
+	ids := make(chan string)
+	defer close(ids)
+	for i := 0; i < p.config.Workers; i++ {
+		go func() {
+			for id := range ids {
+				p.probe(ctx, id)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// The due health checks wait for a worker to be available, and
+			// stay marked as being probed until then
+			for _, id := range p.due(now) {
+				select {
+				case ids <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// ProbeAll probes all the health checks at once, regardless of their
+// interval, and returns once they are all probed.
+func (p *Prober) ProbeAll(ctx context.Context) {
+	p.mu.RLock()
+	ids := make([]string, 0, len(p.checks))
+	for id := range p.checks {
+		ids = append(ids, id)
+	}
+	p.mu.RUnlock()
+
+	for _, id := range ids {
+		p.probe(ctx, id)
+	}
+}
+
+// due returns the IDs of the health checks whose interval has elapsed since
+// their last probe, and removes the expired health checks.
+func (p *Prober) due(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ids []string
+	for id, check := range p.checks {
+		if now.Sub(check.reconciled) > expiry {
+			p.logger.Info("Deleting expired health check", "id", id, "name", check.spec.Name)
+			delete(p.checks, id)
+			continue
+		}
+		interval := p.config.Interval
+		if check.spec.Interval != nil {
+			interval = *check.spec.Interval
+		}
+		if check.probing || now.Sub(check.lastProbe) < interval {
+			continue
+		}
+		check.probing = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// probe probes the targets of the health check, and records the result.
+func (p *Prober) probe(ctx context.Context, id string) {
+	p.mu.RLock()
+	check, ok := p.checks[id]
+	if !ok {
+		p.mu.RUnlock()
+		return
+	}
+	snapshot := *check
+	p.mu.RUnlock()
+
+	err := p.probeTargets(ctx, snapshot)
+
+	p.mu.Lock()
+	// The health check may have been deleted in the meantime
+	current, ok := p.checks[id]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	wasHealthy := current.healthy()
+	current.probing = false
+	current.probed = true
+	current.lastProbe = time.Now()
+	if err != nil {
+		if current.failures == 0 {
+			p.logger.Info("Health check failed", "id", id, "host", current.host, "error", err.Error())
+		}
+		current.failures++
+		current.lastError = err.Error()
+	} else {
+		current.failures = 0
+	}
+	changed := wasHealthy != current.healthy()
+	dnsRecord := current.spec.DNSRecord
+	p.mu.Unlock()
+
+	if changed {
+		p.logger.Info("Endpoint health changed", "id", id, "host", snapshot.host, "healthy", !wasHealthy)
+		if p.config.OnChange != nil && dnsRecord != "" {
+			p.config.OnChange(dnsRecord)
+		}
+	}
+}
+
+// probeTargets probes each of the targets of the health check, and only
+// fails if all the probes fail, the same way the health checks of the DNS
+// providers consider an endpoint grouping several load balancers healthy as
+// long as any of them is healthy.
+func (p *Prober) probeTargets(ctx context.Context, check healthCheck) error {
+	protocol := dns.HealthCheckProtocolHTTP
+	if check.spec.Protocol != nil {
+		protocol = *check.spec.Protocol
+	}
+	port := int64(80)
+	if protocol == dns.HealthCheckProtocolHTTPS {
+		port = 443
+	}
+	if check.spec.Port != nil {
+		port = *check.spec.Port
+	} else if protocol == dns.HealthCheckProtocolTCP {
+		return errors.New("no port to probe")
+	}
+
+	var errs []string
+	for _, target := range check.targets {
+		address := net.JoinHostPort(target, strconv.FormatInt(port, 10))
+		var err error
+		if protocol == dns.HealthCheckProtocolTCP {
+			err = p.probeTCP(ctx, address)
+		} else {
+			err = p.probeHTTP(ctx, check, strings.ToLower(string(protocol)), address)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return errors.New("no target to probe")
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// probeTCP fails if a connection can't be established with the address.
+func (p *Prober) probeTCP(ctx context.Context, address string) error {
+	conn, err := p.dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeHTTP sends a request to the address, with the host of the health
+// check, and fails if the request fails, or the response is not the expected one.
+func (p *Prober) probeHTTP(ctx context.Context, check healthCheck, scheme, address string) error {
+	url := fmt.Sprintf("%s://%s%s", scheme, address, check.spec.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = check.host
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := CheckResponse(check.spec, resp); err != nil {
+		return fmt.Errorf("%s %v", url, err)
+	}
+	return nil
+}
+
+// CheckResponse returns an error if the status code of the response is not the
+// expected one, or any 2xx or 3xx status code, or if its body doesn't contain
+// the expected string.
+func CheckResponse(spec dns.HealthCheckSpec, resp *http.Response) error {
+	if spec.ExpectedStatus != nil {
+		if int64(resp.StatusCode) != *spec.ExpectedStatus {
+			return fmt.Errorf("returned status code %d, expected %d", resp.StatusCode, *spec.ExpectedStatus)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		return fmt.Errorf("returned status code %d", resp.StatusCode)
+	}
+
+	if spec.ExpectedBody != "" {
+		// Only the beginning of the body is searched, like the DNS providers do
+		body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySearchLength))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(body), spec.ExpectedBody) {
+			return fmt.Errorf("returned a body not containing %q", spec.ExpectedBody)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+func serverPort(t *testing.T, server *httptest.Server) int64 {
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.ParseInt(serverURL.Port(), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestProberFailureThreshold(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Host).To(gomega.Equal("app.example.com"))
+		g.Expect(r.URL.Path).To(gomega.Equal("/healthz"))
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var changes []string
+	p := New(Config{OnChange: func(dnsRecord string) { changes = append(changes, dnsRecord) }}, logr.Discard())
+
+	port, threshold := serverPort(t, server), int64(2)
+	endpoint := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "127.0.0.1", Targets: v1.Targets{"127.0.0.1"}}
+	spec := dns.HealthCheckSpec{
+		Id:               "abc",
+		Path:             "/healthz",
+		Port:             &port,
+		FailureThreshold: &threshold,
+		DNSRecord:        "default/app",
+	}
+	g.Expect(p.Reconcile(ctx, spec, endpoint)).To(gomega.Succeed())
+	id, _ := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(id).To(gomega.Equal("abc"))
+
+	state := func() v1.HealthCheckState {
+		status, err := p.Status(ctx, endpoint)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return status.State
+	}
+	g.Expect(state()).To(gomega.Equal(v1.HealthCheckStateUnknown))
+	g.Expect(p.Healthy(endpoint)).To(gomega.BeTrue())
+
+	p.probe(ctx, "abc")
+	g.Expect(state()).To(gomega.Equal(v1.HealthCheckStateHealthy))
+
+	// The endpoint is unhealthy once the failure threshold is reached
+	healthy = false
+	p.probe(ctx, "abc")
+	g.Expect(p.Healthy(endpoint)).To(gomega.BeTrue())
+	g.Expect(changes).To(gomega.BeEmpty())
+	p.probe(ctx, "abc")
+	g.Expect(p.Healthy(endpoint)).To(gomega.BeFalse())
+	g.Expect(changes).To(gomega.Equal([]string{"default/app"}))
+	status, err := p.Status(ctx, endpoint)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(status.State).To(gomega.Equal(v1.HealthCheckStateUnhealthy))
+	g.Expect(status.Message).To(gomega.ContainSubstring("returned status code 503"))
+
+	// And recovers as soon as it succeeds again
+	healthy = true
+	p.probe(ctx, "abc")
+	g.Expect(p.Healthy(endpoint)).To(gomega.BeTrue())
+	g.Expect(changes).To(gomega.Equal([]string{"default/app", "default/app"}))
+
+	g.Expect(p.Delete(ctx, endpoint)).To(gomega.Succeed())
+	_, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(ok).To(gomega.BeFalse())
+	g.Expect(p.checks).To(gomega.BeEmpty())
+}
+
+func TestProbeProtocols(t *testing.T) {
+	ctx := context.Background()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	httpsServer := httptest.NewTLSServer(handler)
+	defer httpsServer.Close()
+
+	// A port nothing listens to
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := int64(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	httpPort, httpsPort := serverPort(t, httpServer), serverPort(t, httpsServer)
+	httpProtocol, httpsProtocol, tcpProtocol := dns.HealthCheckProtocolHTTP, dns.HealthCheckProtocolHTTPS, dns.HealthCheckProtocolTCP
+	accepted, ok := int64(http.StatusAccepted), int64(http.StatusOK)
+
+	cases := []struct {
+		name    string
+		spec    dns.HealthCheckSpec
+		healthy bool
+	}{
+		{name: "HTTP", spec: dns.HealthCheckSpec{Port: &httpPort, Protocol: &httpProtocol}, healthy: true},
+		{name: "HTTPS", spec: dns.HealthCheckSpec{Port: &httpsPort, Protocol: &httpsProtocol}, healthy: true},
+		{name: "HTTP to HTTPS", spec: dns.HealthCheckSpec{Port: &httpsPort, Protocol: &httpProtocol}},
+		{name: "expected status", spec: dns.HealthCheckSpec{Port: &httpPort, ExpectedStatus: &accepted}, healthy: true},
+		{name: "unexpected status", spec: dns.HealthCheckSpec{Port: &httpPort, ExpectedStatus: &ok}},
+		{name: "expected body", spec: dns.HealthCheckSpec{Port: &httpPort, ExpectedBody: `"status":"ok"`}, healthy: true},
+		{name: "unexpected body", spec: dns.HealthCheckSpec{Port: &httpPort, ExpectedBody: `"status":"degraded"`}},
+		{name: "TCP", spec: dns.HealthCheckSpec{Port: &httpPort, Protocol: &tcpProtocol}, healthy: true},
+		{name: "TCP connection refused", spec: dns.HealthCheckSpec{Port: &closedPort, Protocol: &tcpProtocol}},
+		{name: "TCP without port", spec: dns.HealthCheckSpec{Protocol: &tcpProtocol}},
+	}
+
+	p := New(Config{Timeout: time.Second}, logr.Discard())
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			tc.spec.Path = "/healthz"
+			err := p.probeTargets(ctx, healthCheck{spec: tc.spec, host: "app.example.com", targets: []string{"127.0.0.1"}})
+			if tc.healthy {
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+			} else {
+				g.Expect(err).To(gomega.HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestProbeAllTargets(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := int64(listener.Addr().(*net.TCPAddr).Port)
+	tcp := dns.HealthCheckProtocolTCP
+
+	p := New(Config{Timeout: time.Second}, logr.Discard())
+	check := healthCheck{spec: dns.HealthCheckSpec{Port: &port, Protocol: &tcp}, host: "app.example.com", targets: []string{"127.0.0.1"}}
+	g.Expect(p.probeTargets(ctx, check)).To(gomega.Succeed())
+
+	// The endpoints grouping several load balancers are healthy as long as
+	// any of their addresses is, and not only the first one
+	check.targets = []string{"127.0.0.2", "127.0.0.1"}
+	g.Expect(p.probeTargets(ctx, check)).To(gomega.Succeed())
+
+	check.targets = []string{"127.0.0.2", "127.0.0.3"}
+	err = p.probeTargets(ctx, check)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("127.0.0.2"))
+	g.Expect(err.Error()).To(gomega.ContainSubstring("127.0.0.3"))
+}
+
+func TestProberProviderSpecific(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	p := New(Config{ProviderSpecific: "test/health-check"}, logr.Discard())
+	endpoint := &v1.Endpoint{DNSName: "app.example.com"}
+	g.Expect(p.Reconcile(ctx, dns.HealthCheckSpec{Id: "abc"}, endpoint)).To(gomega.Succeed())
+	id, _ := endpoint.GetProviderSpecific("test/health-check")
+	g.Expect(id).To(gomega.Equal("abc"))
+	_, ok := endpoint.GetProviderSpecific(ProviderSpecificHealthCheck)
+	g.Expect(ok).To(gomega.BeFalse())
+
+	g.Expect(p.Delete(ctx, endpoint)).To(gomega.Succeed())
+	g.Expect(endpoint.ProviderSpecific).To(gomega.BeEmpty())
+}
+
+func TestProberWorkers(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The server blocks the probes until they are released, and records the
+	// maximum number of probes in progress
+	var mu sync.Mutex
+	inProgress, maxInProgress, probes := 0, 0, 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inProgress++
+		probes++
+		if inProgress > maxInProgress {
+			maxInProgress = inProgress
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inProgress--
+		mu.Unlock()
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p := New(Config{Workers: 2}, logr.Discard())
+	port := serverPort(t, server)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		endpoint := &v1.Endpoint{DNSName: "app.example.com", Targets: v1.Targets{"127.0.0.1"}}
+		g.Expect(p.Reconcile(ctx, dns.HealthCheckSpec{Id: id, Port: &port}, endpoint)).To(gomega.Succeed())
+	}
+	go p.Run(ctx)
+
+	probed := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return probes
+	}
+	g.Eventually(probed, 5*time.Second, 10*time.Millisecond).Should(gomega.Equal(2))
+	g.Consistently(probed, 1500*time.Millisecond, 100*time.Millisecond).Should(gomega.Equal(2))
+	mu.Lock()
+	g.Expect(maxInProgress).To(gomega.Equal(2))
+	mu.Unlock()
+}
+
+func TestProberDue(t *testing.T) {
+	g := gomega.NewWithT(t)
+	p := New(Config{Interval: time.Minute}, logr.Discard())
+
+	interval := 10 * time.Second
+	for _, spec := range []dns.HealthCheckSpec{{Id: "default"}, {Id: "fast", Interval: &interval}, {Id: "expired"}} {
+		g.Expect(p.Reconcile(context.Background(), spec, &v1.Endpoint{DNSName: "app.example.com"})).To(gomega.Succeed())
+	}
+	now := time.Now()
+	p.checks["default"].lastProbe = now
+	p.checks["fast"].lastProbe = now
+	p.checks["expired"].reconciled = now.Add(-expiry - time.Second)
+
+	g.Expect(p.due(now.Add(30 * time.Second))).To(gomega.ConsistOf("fast"))
+	g.Expect(p.checks).NotTo(gomega.HaveKey("expired"))
+
+	// The health checks being probed are not due
+	g.Expect(p.due(now.Add(2 * time.Minute))).To(gomega.ConsistOf("default"))
+}
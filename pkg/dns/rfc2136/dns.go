@@ -0,0 +1,259 @@
+package rfc2136
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	glbcdns "github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	defaultTSIGFudge = 300
+)
+
+var _ glbcdns.Provider = &Provider{}
+
+// Provider publishes DNS records to an authoritative name server, e.g., BIND
+// or PowerDNS, using RFC 2136 dynamic updates signed with TSIG (RFC 8945).
+//
+// As there are no weighted records in standard DNS, the endpoints sharing the
+// same name and type are published as a single multi-value record set, from
+// which the targets with a zero weight are left out.
+type Provider struct {
+	client dns.Client
+	config Config
+	logger logr.Logger
+}
+
+// Config is the necessary input to configure the provider.
+type Config struct {
+	// Nameserver is the host:port address of the primary name server.
+	Nameserver string
+	// Net is the transport used to send the updates, "udp" or "tcp".
+	Net string
+	// TSIGKeyName is the name of the TSIG key used to sign the updates.
+	// Updates are not signed when empty.
+	TSIGKeyName string
+	// TSIGSecret is the base64 encoded TSIG key secret.
+	TSIGSecret string
+	// TSIGAlgorithm is the TSIG algorithm, defaults to hmac-sha256.
+	TSIGAlgorithm string
+	// Timeout is the timeout of the update requests.
+	Timeout time.Duration
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Nameserver == "" {
+		return nil, fmt.Errorf("a name server address is required")
+	}
+	if _, _, err := net.SplitHostPort(config.Nameserver); err != nil {
+		config.Nameserver = net.JoinHostPort(config.Nameserver, "53")
+	}
+	if config.TSIGAlgorithm == "" {
+		config.TSIGAlgorithm = dns.HmacSHA256
+	}
+	config.TSIGAlgorithm = dns.Fqdn(config.TSIGAlgorithm)
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	p := &Provider{
+		client: dns.Client{
+			Net:     config.Net,
+			Timeout: config.Timeout,
+		},
+		config: config,
+		logger: log.Logger.WithName("rfc2136").WithValues("nameserver", config.Nameserver),
+	}
+	if config.TSIGKeyName != "" {
+		p.config.TSIGKeyName = dns.Fqdn(strings.ToLower(config.TSIGKeyName))
+		p.client.TsigSecret = map[string]string{p.config.TSIGKeyName: config.TSIGSecret}
+	}
+	return p, nil
+}
+
+func (p *Provider) Ensure(record *v1.DNSRecord, zone v1.DNSZone) error {
+	desired, err := recordSetsForEndpoints(record.Spec.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone.ID))
+
+	// Delete any previously published record sets that are no longer present in record.Spec.Endpoints
+	published, err := recordSetsForEndpoints(glbcdns.EndpointsFromZoneStatus(record, zone.ID))
+	if err != nil {
+		return err
+	}
+	for key, rrs := range published {
+		if _, found := desired[key]; !found {
+			msg.RemoveRRset(rrs[:1])
+		}
+	}
+
+	for _, rrs := range desired {
+		msg.RemoveRRset(rrs[:1])
+		msg.Insert(rrs)
+	}
+
+	if err := p.send(msg, zone); err != nil {
+		return fmt.Errorf("couldn't update DNS record %s in zone %s: %v", record.Name, zone.ID, err)
+	}
+	p.logger.Info("Upserted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+func (p *Provider) Delete(record *v1.DNSRecord, zone v1.DNSZone) error {
+	desired, err := recordSetsForEndpoints(record.Spec.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	// Record sets that were previously published but are no longer present
+	// in record.Spec.Endpoints have to be removed as well
+	published, err := recordSetsForEndpoints(glbcdns.EndpointsFromZoneStatus(record, zone.ID))
+	if err != nil {
+		return err
+	}
+	for key, rrs := range published {
+		if _, found := desired[key]; !found {
+			desired[key] = rrs
+		}
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone.ID))
+	for _, rrs := range desired {
+		msg.RemoveRRset(rrs[:1])
+	}
+
+	if err := p.send(msg, zone); err != nil {
+		return fmt.Errorf("couldn't delete DNS record %s in zone %s: %v", record.Name, zone.ID, err)
+	}
+	p.logger.Info("Deleted DNS record", "record", record.Spec, "zone", zone)
+	return nil
+}
+
+func (*Provider) HealthCheckReconciler() glbcdns.HealthCheckReconciler {
+	return glbcdns.NoopHealthCheckReconciler()
+}
+
+func (p *Provider) send(msg *dns.Msg, zone v1.DNSZone) error {
+	if len(msg.Ns) == 0 {
+		return nil
+	}
+	if p.config.TSIGKeyName != "" {
+		msg.SetTsig(p.config.TSIGKeyName, p.config.TSIGAlgorithm, defaultTSIGFudge, time.Now().Unix())
+	}
+
+	resp, _, err := p.client.Exchange(msg, p.config.Nameserver)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("name server responded with %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+type recordSetKey struct {
+	name       string
+	recordType uint16
+}
+
+// recordSetsForEndpoints groups the endpoints by name and type, and converts
+// each group into a multi-value record set. As a CNAME record set holds a
+// single target, only the first of the targets of a CNAME group is published.
+func recordSetsForEndpoints(endpoints []*v1.Endpoint) (map[recordSetKey][]dns.RR, error) {
+	targets := map[recordSetKey]map[string]struct{}{}
+	ttls := map[recordSetKey]uint32{}
+	fallback := map[recordSetKey][]string{}
+
+	for _, endpoint := range endpoints {
+		recordType, ok := dns.StringToType[endpoint.RecordType]
+		if !ok || (recordType != dns.TypeA && recordType != dns.TypeAAAA && recordType != dns.TypeCNAME) {
+			return nil, fmt.Errorf("unsupported record type %s", endpoint.RecordType)
+		}
+		if len(endpoint.DNSName) == 0 {
+			return nil, fmt.Errorf("domain is required")
+		}
+		if len(endpoint.Targets) == 0 {
+			return nil, fmt.Errorf("targets is required")
+		}
+
+		key := recordSetKey{name: dns.Fqdn(endpoint.DNSName), recordType: recordType}
+		if _, ok := targets[key]; !ok {
+			targets[key] = map[string]struct{}{}
+			ttls[key] = uint32(endpoint.RecordTTL)
+		}
+		fallback[key] = append(fallback[key], endpoint.Targets...)
+		if weight, ok := endpoint.GetProviderSpecific(aws.ProviderSpecificWeight); ok && weight == "0" {
+			continue
+		}
+		for _, target := range endpoint.Targets {
+			targets[key][target] = struct{}{}
+		}
+	}
+
+	result := make(map[recordSetKey][]dns.RR, len(targets))
+	for key, values := range targets {
+		// Publish all the targets rather than none when they all have a zero weight
+		if len(values) == 0 {
+			for _, target := range fallback[key] {
+				values[target] = struct{}{}
+			}
+		}
+
+		sorted := make([]string, 0, len(values))
+		for target := range values {
+			sorted = append(sorted, target)
+		}
+		sort.Strings(sorted)
+		if key.recordType == dns.TypeCNAME {
+			sorted = sorted[:1]
+		}
+
+		for _, target := range sorted {
+			rr, err := resourceRecord(key, ttls[key], target)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = append(result[key], rr)
+		}
+	}
+	return result, nil
+}
+
+func resourceRecord(key recordSetKey, ttl uint32, target string) (dns.RR, error) {
+	hdr := dns.RR_Header{Name: key.name, Rrtype: key.recordType, Class: dns.ClassINET, Ttl: ttl}
+	switch key.recordType {
+	case dns.TypeA:
+		ip := net.ParseIP(target).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %s", target)
+		}
+		return &dns.A{Hdr: hdr, A: ip}, nil
+	case dns.TypeAAAA:
+		ip := net.ParseIP(target)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid IPv6 address %s", target)
+		}
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	default:
+		if _, ok := dns.IsDomainName(target); !ok {
+			return nil, fmt.Errorf("invalid host name %s", target)
+		}
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(target)}, nil
+	}
+}
@@ -0,0 +1,259 @@
+package rfc2136
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+)
+
+const (
+	testZone       = "example.com."
+	testTSIGKey    = "glbc."
+	testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="
+)
+
+// fakeNameServer is an in-process authoritative name server that applies the
+// RFC 2136 updates it receives to an in-memory zone.
+type fakeNameServer struct {
+	mu      sync.Mutex
+	records map[string][]dns.RR
+	updates int
+}
+
+func (f *fakeNameServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		resp.SetRcode(req, dns.RcodeRefused)
+		_ = w.WriteMsg(resp)
+		return
+	}
+	if req.Opcode != dns.OpcodeUpdate || req.Question[0].Name != testZone {
+		resp.SetRcode(req, dns.RcodeNotAuth)
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	for _, rr := range req.Ns {
+		header := rr.Header()
+		switch header.Class {
+		case dns.ClassANY:
+			var kept []dns.RR
+			for _, existing := range f.records[header.Name] {
+				if existing.Header().Rrtype != header.Rrtype {
+					kept = append(kept, existing)
+				}
+			}
+			f.records[header.Name] = kept
+		case dns.ClassNONE:
+			var kept []dns.RR
+			for _, existing := range f.records[header.Name] {
+				if existing.Header().Rrtype != header.Rrtype || rrTarget(existing) != rrTarget(rr) {
+					kept = append(kept, existing)
+				}
+			}
+			f.records[header.Name] = kept
+		default:
+			f.records[header.Name] = append(f.records[header.Name], rr)
+		}
+	}
+	f.updates++
+
+	resp.SetTsig(testTSIGKey, dns.HmacSHA256, defaultTSIGFudge, int64(req.IsTsig().TimeSigned))
+	_ = w.WriteMsg(resp)
+}
+
+func (f *fakeNameServer) targets(name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var targets []string
+	for _, rr := range f.records[name] {
+		targets = append(targets, rrTarget(rr))
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func rrTarget(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	case *dns.CNAME:
+		return rr.Target
+	}
+	return ""
+}
+
+func newTestProvider(t *testing.T, keySecret string) (*Provider, *fakeNameServer) {
+	fake := &fakeNameServer{records: map[string][]dns.RR{}}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		Handler:           fake,
+		TsigSecret:        map[string]string{testTSIGKey: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			return dns.MsgAccept
+		},
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	provider, err := NewProvider(Config{
+		Nameserver:  conn.LocalAddr().String(),
+		TSIGKeyName: testTSIGKey,
+		TSIGSecret:  keySecret,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating provider: %v", err)
+	}
+	return provider, fake
+}
+
+func weightedEndpoint(host, target, weight string) *v1.Endpoint {
+	endpoint := &v1.Endpoint{
+		DNSName:       host,
+		RecordType:    string(v1.ARecordType),
+		SetIdentifier: target,
+		Targets:       v1.Targets{target},
+		RecordTTL:     60,
+	}
+	endpoint.SetProviderSpecific(aws.ProviderSpecificWeight, weight)
+	return endpoint
+}
+
+func TestProviderEnsureAndDelete(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t, testTSIGSecret)
+	zone := v1.DNSZone{ID: "example.com"}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "120"),
+		weightedEndpoint("app.example.com", "10.0.0.2", "120"),
+		weightedEndpoint("app.example.com", "10.0.0.3", "0"),
+	}
+
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.targets("app.example.com.")).To(gomega.Equal([]string{"10.0.0.1", "10.0.0.2"}))
+	g.Expect(fake.records["app.example.com."][0].Header().Ttl).To(gomega.Equal(uint32(60)))
+
+	// Ensuring again replaces the record set rather than appending to it
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.targets("app.example.com.")).To(gomega.Equal([]string{"10.0.0.1", "10.0.0.2"}))
+
+	// Moving the record to another host removes the previously published set
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: zone, Endpoints: record.Spec.Endpoints}}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("other.example.com", "10.0.0.4", "120"),
+	}
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.targets("app.example.com.")).To(gomega.BeEmpty())
+	g.Expect(fake.targets("other.example.com.")).To(gomega.Equal([]string{"10.0.0.4"}))
+
+	g.Expect(provider.Delete(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.targets("other.example.com.")).To(gomega.BeEmpty())
+	g.Expect(fake.updates).To(gomega.Equal(4))
+}
+
+func TestProviderDeletePublishedRecordSets(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t, testTSIGSecret)
+	zone := v1.DNSZone{ID: "example.com"}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "120"),
+	}
+	g.Expect(provider.Ensure(record, zone)).To(gomega.Succeed())
+
+	// A record set removed from the spec before it's unpublished is still deleted
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: zone, Endpoints: record.Spec.Endpoints}}
+	record.Spec.Endpoints = []*v1.Endpoint{}
+	g.Expect(provider.Delete(record, zone)).To(gomega.Succeed())
+	g.Expect(fake.targets("app.example.com.")).To(gomega.BeEmpty())
+}
+
+func TestProviderAllTargetsZeroWeight(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t, testTSIGSecret)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "0"),
+		weightedEndpoint("app.example.com", "10.0.0.2", "0"),
+	}
+
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: "example.com"})).To(gomega.Succeed())
+	g.Expect(fake.targets("app.example.com.")).To(gomega.Equal([]string{"10.0.0.1", "10.0.0.2"}))
+}
+
+func TestProviderAAAAAndCNAMERecords(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t, testTSIGSecret)
+
+	v6 := weightedEndpoint("app.example.com", "2001:db8::1", "120")
+	v6.RecordType = string(v1.AAAARecordType)
+	lb1 := weightedEndpoint("lb.example.com", "lb2.example.net", "120")
+	lb1.RecordType = string(v1.CNAMERecordType)
+	lb2 := weightedEndpoint("lb.example.com", "lb1.example.net", "120")
+	lb2.RecordType = string(v1.CNAMERecordType)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{v6, lb1, lb2}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: "example.com"})).To(gomega.Succeed())
+	g.Expect(fake.targets("app.example.com.")).To(gomega.Equal([]string{"2001:db8::1"}))
+	// A CNAME record set holds a single target
+	g.Expect(fake.targets("lb.example.com.")).To(gomega.Equal([]string{"lb1.example.net."}))
+
+	// An AAAA record must point to an IPv6 address
+	v6.Targets = v1.Targets{"10.0.0.1"}
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: "example.com"})).NotTo(gomega.Succeed())
+}
+
+func TestProviderInvalidTSIGKey(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, fake := newTestProvider(t, "d3Jvbmctc2VjcmV0")
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weightedEndpoint("app.example.com", "10.0.0.1", "120"),
+	}
+
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: "example.com"})).NotTo(gomega.Succeed())
+	g.Expect(fake.updates).To(gomega.BeZero())
+}
+
+func TestProviderUnsupportedRecordType(t *testing.T) {
+	g := gomega.NewWithT(t)
+	provider, _ := newTestProvider(t, testTSIGSecret)
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{{
+		DNSName:    "txt.example.com",
+		RecordType: "TXT",
+		Targets:    v1.Targets{"text"},
+	}}
+
+	g.Expect(provider.Ensure(record, v1.DNSZone{ID: "example.com"})).NotTo(gomega.Succeed())
+}
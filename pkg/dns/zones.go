@@ -0,0 +1,229 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+// ZoneVisibility is the visibility of a DNS zone, i.e., whether it is resolved
+// from the internet, or only from private networks.
+type ZoneVisibility string
+
+const (
+	ZoneVisibilityPublic  ZoneVisibility = "public"
+	ZoneVisibilityPrivate ZoneVisibility = "private"
+)
+
+const (
+	// ZoneVisibilityAnnotation restricts the zones a DNSRecord is published to,
+	// to the public or private zones of its domain. It's published to both by default.
+	ZoneVisibilityAnnotation = "kuadrant.experimental/dns-zone-visibility"
+	// ZoneVisibilityLabel restricts the zones an endpoint of a DNSRecord is
+	// published to, to the public or private zones of its domain.
+	ZoneVisibilityLabel = "kuadrant.dev/zone-visibility"
+)
+
+// Zone is a DNS zone the records of a domain are published to.
+type Zone struct {
+	v1.DNSZone `json:",inline"`
+
+	// Domain is the domain suffix of the DNS names published to the zone.
+	// An empty domain matches all the DNS names.
+	Domain string `json:"domain,omitempty"`
+
+	// Provider is the name of the DNS provider of the zone. The default
+	// DNS provider is used if empty.
+	Provider string `json:"provider,omitempty"`
+
+	// Visibility is the visibility of the zone, public if empty. A public and
+	// a private zone can be registered for the same domain, to publish the
+	// records in split-horizon.
+	Visibility ZoneVisibility `json:"visibility,omitempty"`
+}
+
+// ZoneRegistry maps domain suffixes to the DNS zones the records of the
+// domains are published to.
+type ZoneRegistry struct {
+	zones []Zone
+}
+
+// ZoneRegistryConfig is the configuration file format of the zone registry.
+type ZoneRegistryConfig struct {
+	Zones []Zone `json:"zones"`
+}
+
+// NewZoneRegistry returns a registry of the zones.
+func NewZoneRegistry(zones ...Zone) (*ZoneRegistry, error) {
+	registry := &ZoneRegistry{}
+	for _, zone := range zones {
+		if zone.ID == "" && len(zone.Tags) == 0 {
+			return nil, fmt.Errorf("zone for domain %q has neither an id nor tags", zone.Domain)
+		}
+		zone.Domain = normalizeDomain(zone.Domain)
+		switch zone.Visibility {
+		case "":
+			zone.Visibility = ZoneVisibilityPublic
+		case ZoneVisibilityPublic, ZoneVisibilityPrivate:
+		default:
+			return nil, fmt.Errorf("invalid visibility %q for zone %s, expected %s or %s", zone.Visibility, zone.ID, ZoneVisibilityPublic, ZoneVisibilityPrivate)
+		}
+		registry.zones = append(registry.zones, zone)
+	}
+	return registry, nil
+}
+
+// LoadZoneRegistry returns a registry of the zones from the YAML configuration file.
+func LoadZoneRegistry(path string) (*ZoneRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &ZoneRegistryConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid DNS zones configuration %s: %v", path, err)
+	}
+	return NewZoneRegistry(config.Zones...)
+}
+
+// Zones returns all the zones of the registry.
+func (r *ZoneRegistry) Zones() []Zone {
+	return r.zones
+}
+
+// ZonesForRecord returns the zones with the visibility the DNSRecord should be
+// published to, i.e., the zones whose domain contains the DNS names of all the
+// record endpoints. If visibility is empty, zones of any visibility match.
+//
+// Only the zones with the longest matching domain are returned, so that a
+// record is published to the most specific zones of its domain, e.g., to the
+// public and private zones of a sub-domain, rather than to those of the parent
+// domain.
+func (r *ZoneRegistry) ZonesForRecord(record *v1.DNSRecord, visibility ZoneVisibility) []Zone {
+	return r.longestMatch(func(zone Zone) bool {
+		return (visibility == "" || zone.Visibility == visibility) && zoneContainsRecord(zone, record)
+	})
+}
+
+// ZonesForName returns the zones of any visibility the records with the DNS
+// name are published to, i.e., the zones with the longest domain that
+// contains the DNS name.
+func (r *ZoneRegistry) ZonesForName(name string) []Zone {
+	return r.longestMatch(func(zone Zone) bool {
+		return domainContains(zone.Domain, name)
+	})
+}
+
+// longestMatch returns the matching zones with the longest domain.
+func (r *ZoneRegistry) longestMatch(matches func(zone Zone) bool) []Zone {
+	var zones []Zone
+	longest := -1
+	for _, zone := range r.zones {
+		if !matches(zone) {
+			continue
+		}
+		switch {
+		case len(zone.Domain) > longest:
+			longest = len(zone.Domain)
+			zones = []Zone{zone}
+		case len(zone.Domain) == longest:
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// ZoneFor returns the zone of the registry that is equal to the DNS zone.
+func (r *ZoneRegistry) ZoneFor(dnsZone v1.DNSZone) (Zone, bool) {
+	for _, zone := range r.zones {
+		if zone.ID == dnsZone.ID && tagsEqual(zone.Tags, dnsZone.Tags) {
+			return zone, true
+		}
+	}
+	return Zone{}, false
+}
+
+// EndpointsForZone returns the endpoints published to the zone, according to
+// its visibility. The endpoints labelled with a visibility are only published
+// to the zones with that visibility. In split-horizon, i.e., if the domain of
+// the zone has both a public and a private zone, the endpoints whose targets
+// are all private addresses are only published to the private zone, as they
+// can't be reached from the internet.
+func (r *ZoneRegistry) EndpointsForZone(zone Zone, endpoints []*v1.Endpoint) []*v1.Endpoint {
+	splitHorizon := false
+	for _, other := range r.zones {
+		if other.Domain == zone.Domain && other.Visibility != zone.Visibility {
+			splitHorizon = true
+			break
+		}
+	}
+
+	var published []*v1.Endpoint
+	for _, endpoint := range endpoints {
+		if visibility, ok := endpoint.Labels[ZoneVisibilityLabel]; ok && ZoneVisibility(visibility) != zone.Visibility {
+			continue
+		}
+		if splitHorizon && zone.Visibility == ZoneVisibilityPublic && privateTargets(endpoint) {
+			continue
+		}
+		published = append(published, endpoint)
+	}
+	return published
+}
+
+// privateTargets returns whether all the targets of the endpoint are private
+// IP addresses.
+func privateTargets(endpoint *v1.Endpoint) bool {
+	if len(endpoint.Targets) == 0 {
+		return false
+	}
+	for _, target := range endpoint.Targets {
+		ip := net.ParseIP(target)
+		if ip == nil || !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()) {
+			return false
+		}
+	}
+	return true
+}
+
+func zoneContainsRecord(zone Zone, record *v1.DNSRecord) bool {
+	if len(record.Spec.Endpoints) == 0 {
+		return false
+	}
+	for _, endpoint := range record.Spec.Endpoints {
+		if !domainContains(zone.Domain, endpoint.DNSName) {
+			return false
+		}
+	}
+	return true
+}
+
+// domainContains returns whether the DNS name is the domain, or a sub-domain of it.
+func domainContains(domain, name string) bool {
+	if domain == "" {
+		return true
+	}
+	name = normalizeDomain(name)
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+func tagsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
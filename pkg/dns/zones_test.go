@@ -0,0 +1,187 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+func recordForNames(names ...string) *v1.DNSRecord {
+	record := &v1.DNSRecord{}
+	for _, name := range names {
+		record.Spec.Endpoints = append(record.Spec.Endpoints, &v1.Endpoint{DNSName: name})
+	}
+	return record
+}
+
+func zoneIDs(zones []Zone) []string {
+	var ids []string
+	for _, zone := range zones {
+		ids = append(ids, zone.ID)
+	}
+	return ids
+}
+
+func TestZoneRegistryZonesForRecord(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	registry, err := NewZoneRegistry(
+		Zone{DNSZone: v1.DNSZone{ID: "public"}, Domain: "example.com"},
+		Zone{DNSZone: v1.DNSZone{ID: "private"}, Domain: "example.com.", Visibility: ZoneVisibilityPrivate},
+		Zone{DNSZone: v1.DNSZone{ID: "apps"}, Domain: "Apps.Example.com", Provider: "google"},
+		Zone{DNSZone: v1.DNSZone{ID: "other"}, Domain: "example.org"},
+	)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	cases := []struct {
+		name       string
+		record     *v1.DNSRecord
+		visibility ZoneVisibility
+		expected   []string
+	}{
+		{
+			name:     "split-horizon zones",
+			record:   recordForNames("app.example.com"),
+			expected: []string{"public", "private"},
+		},
+		{
+			name:       "public zone only",
+			record:     recordForNames("app.example.com"),
+			visibility: ZoneVisibilityPublic,
+			expected:   []string{"public"},
+		},
+		{
+			name:       "private zone only",
+			record:     recordForNames("app.example.com"),
+			visibility: ZoneVisibilityPrivate,
+			expected:   []string{"private"},
+		},
+		{
+			name:     "zone apex",
+			record:   recordForNames("example.com."),
+			expected: []string{"public", "private"},
+		},
+		{
+			name:     "most specific zone",
+			record:   recordForNames("app.apps.example.com"),
+			expected: []string{"apps"},
+		},
+		{
+			name:       "no zone with the visibility in the most specific domain",
+			record:     recordForNames("app.APPS.example.com"),
+			visibility: ZoneVisibilityPrivate,
+			expected:   []string{"private"},
+		},
+		{
+			name:     "names in different zones",
+			record:   recordForNames("app.example.com", "app.example.org"),
+			expected: nil,
+		},
+		{
+			name:     "domain suffix that is not a parent domain",
+			record:   recordForNames("app.notexample.com"),
+			expected: nil,
+		},
+		{
+			name:     "no endpoints",
+			record:   recordForNames(),
+			expected: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			g.Expect(zoneIDs(registry.ZonesForRecord(tc.record, tc.visibility))).To(gomega.Equal(tc.expected))
+		})
+	}
+
+	zone, ok := registry.ZoneFor(v1.DNSZone{ID: "apps"})
+	g.Expect(ok).To(gomega.BeTrue())
+	g.Expect(zone.Provider).To(gomega.Equal("google"))
+	_, ok = registry.ZoneFor(v1.DNSZone{ID: "unknown"})
+	g.Expect(ok).To(gomega.BeFalse())
+
+	g.Expect(zoneIDs(registry.ZonesForName("app.example.com"))).To(gomega.Equal([]string{"public", "private"}))
+	g.Expect(zoneIDs(registry.ZonesForName("web.apps.example.com"))).To(gomega.Equal([]string{"apps"}))
+	g.Expect(registry.ZonesForName("app.example.net")).To(gomega.BeEmpty())
+}
+
+func TestZoneRegistryAnyDomain(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	registry, err := NewZoneRegistry(Zone{DNSZone: v1.DNSZone{ID: "zone"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(zoneIDs(registry.ZonesForRecord(recordForNames("app.example.com"), ""))).To(gomega.Equal([]string{"zone"}))
+}
+
+func TestEndpointsForZone(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	registry, err := NewZoneRegistry(
+		Zone{DNSZone: v1.DNSZone{ID: "public"}, Domain: "example.com"},
+		Zone{DNSZone: v1.DNSZone{ID: "private"}, Domain: "example.com", Visibility: ZoneVisibilityPrivate},
+		Zone{DNSZone: v1.DNSZone{ID: "apps"}, Domain: "apps.example.com"},
+	)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	internet := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "a", Targets: v1.Targets{"203.0.113.1"}}
+	internal := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "b", Targets: v1.Targets{"10.0.0.1", "fd00::1"}}
+	hostname := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "c", Targets: v1.Targets{"lb.example.net"}}
+	labelled := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "d", Targets: v1.Targets{"203.0.113.2"}, Labels: v1.Labels{ZoneVisibilityLabel: "private"}}
+	endpoints := []*v1.Endpoint{internet, internal, hostname, labelled}
+
+	zone := func(id string) Zone {
+		zone, ok := registry.ZoneFor(v1.DNSZone{ID: id})
+		g.Expect(ok).To(gomega.BeTrue())
+		return zone
+	}
+
+	// In split-horizon, the private addresses are only published to the private zone
+	g.Expect(registry.EndpointsForZone(zone("public"), endpoints)).To(gomega.Equal([]*v1.Endpoint{internet, hostname}))
+	g.Expect(registry.EndpointsForZone(zone("private"), endpoints)).To(gomega.Equal(endpoints))
+	// Otherwise only the endpoints labelled with another visibility are filtered out
+	g.Expect(registry.EndpointsForZone(zone("apps"), endpoints)).To(gomega.Equal([]*v1.Endpoint{internet, internal, hostname}))
+}
+
+func TestLoadZoneRegistry(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "zones.yaml")
+	g.Expect(os.WriteFile(path, []byte(`
+zones:
+- id: Z123
+  domain: example.com
+  provider: aws
+- id: Z456
+  domain: example.com
+  provider: aws
+  visibility: private
+`), 0600)).To(gomega.Succeed())
+
+	registry, err := LoadZoneRegistry(path)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(registry.Zones()).To(gomega.Equal([]Zone{
+		{DNSZone: v1.DNSZone{ID: "Z123"}, Domain: "example.com", Provider: "aws", Visibility: ZoneVisibilityPublic},
+		{DNSZone: v1.DNSZone{ID: "Z456"}, Domain: "example.com", Provider: "aws", Visibility: ZoneVisibilityPrivate},
+	}))
+
+	g.Expect(os.WriteFile(path, []byte(`
+zones:
+- id: Z123
+  visibility: internal
+`), 0600)).To(gomega.Succeed())
+	_, err = LoadZoneRegistry(path)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	g.Expect(os.WriteFile(path, []byte(`
+zones:
+- domain: example.com
+`), 0600)).To(gomega.Succeed())
+	_, err = LoadZoneRegistry(path)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
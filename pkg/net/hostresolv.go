@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	gonet "net"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,19 @@ import (
 
 type HostResolver interface {
 	LookupIPAddr(ctx context.Context, host string) ([]HostAddress, error)
+	// LookupTXT returns the TXT records of the host, each record being the
+	// concatenation of its strings.
+	LookupTXT(ctx context.Context, host string) ([]string, error)
+	// LookupCNAME returns the canonical name the host is an alias for, without
+	// the trailing dot.
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// IsNotFound returns whether the error of a lookup confirms that the host, or
+// the records looked up, don't exist, rather than the lookup failing.
+func IsNotFound(err error) bool {
+	var dnsErr *gonet.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
 }
 
 type HostAddress struct {
@@ -43,7 +57,7 @@ func (r *ConfigMapHostResolver) LookupIPAddr(ctx context.Context, host string) (
 
 	ipsValue, ok := configMap.Data[host]
 	if !ok {
-		return nil, &gonet.DNSError{Err: fmt.Sprintf("host not found in ConfigMap %s/%s", r.Name, r.Namespace)}
+		return nil, &gonet.DNSError{Err: fmt.Sprintf("host not found in ConfigMap %s/%s", r.Namespace, r.Name)}
 	}
 
 	var ips []struct {
@@ -66,6 +80,42 @@ func (r *ConfigMapHostResolver) LookupIPAddr(ctx context.Context, host string) (
 	return result, nil
 }
 
+// LookupTXT returns the TXT records of the host from the ConfigMap, whose
+// value is the JSON list of the records, prefixed with "TXT:" to distinguish
+// them from the addresses of the host, e.g., TXT:_kuadrant-verification.example.com.
+func (r *ConfigMapHostResolver) LookupTXT(ctx context.Context, host string) ([]string, error) {
+	configMap, err := r.Client.CoreV1().ConfigMaps(r.Namespace).Get(ctx, r.Name, v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	recordsValue, ok := configMap.Data["TXT:"+host]
+	if !ok {
+		return nil, &gonet.DNSError{Err: fmt.Sprintf("TXT record not found in ConfigMap %s/%s", r.Namespace, r.Name), Name: host, IsNotFound: true}
+	}
+
+	var records []string
+	if err := json.Unmarshal([]byte(recordsValue), &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// LookupCNAME returns the canonical name of the host from the ConfigMap, whose
+// value is set with the "CNAME:" prefix, e.g., CNAME:app.example.com.
+func (r *ConfigMapHostResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	configMap, err := r.Client.CoreV1().ConfigMaps(r.Namespace).Get(ctx, r.Name, v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	cname, ok := configMap.Data["CNAME:"+host]
+	if !ok {
+		return "", &gonet.DNSError{Err: fmt.Sprintf("CNAME record not found in ConfigMap %s/%s", r.Namespace, r.Name), Name: host, IsNotFound: true}
+	}
+	return strings.TrimSuffix(cname, "."), nil
+}
+
 type DefaultHostResolver struct {
 	Client dns.Client
 }
@@ -83,27 +133,36 @@ func (hr *DefaultHostResolver) LookupIPAddr(ctx context.Context, host string) ([
 	}
 
 	for _, server := range cfg.Servers {
-		m := dns.Msg{}
-		m.SetQuestion(fmt.Sprintf("%s.", host), dns.TypeA)
+		var results []HostAddress
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			m := dns.Msg{}
+			m.SetQuestion(fmt.Sprintf("%s.", host), qtype)
 
-		r, _, err := hr.Client.ExchangeContext(ctx, &m, fmt.Sprintf("%s:53", server))
-		if err != nil {
-			return nil, err
-		}
+			r, _, err := hr.Client.ExchangeContext(ctx, &m, fmt.Sprintf("%s:53", server))
+			if err != nil {
+				return nil, err
+			}
 
-		if len(r.Answer) == 0 {
-			continue
+			for _, answer := range r.Answer {
+				switch rr := answer.(type) {
+				case *dns.A:
+					results = append(results, HostAddress{
+						Host: host,
+						IP:   rr.A,
+						TTL:  time.Duration(rr.Hdr.Ttl) * time.Second,
+					})
+				case *dns.AAAA:
+					results = append(results, HostAddress{
+						Host: host,
+						IP:   rr.AAAA,
+						TTL:  time.Duration(rr.Hdr.Ttl) * time.Second,
+					})
+				}
+			}
 		}
 
-		results := make([]HostAddress, 0, len(r.Answer))
-		for _, answer := range r.Answer {
-			if a, ok := answer.(*dns.A); ok {
-				results = append(results, HostAddress{
-					Host: host,
-					IP:   a.A,
-					TTL:  time.Duration(a.Hdr.Ttl) * time.Second,
-				})
-			}
+		if len(results) == 0 {
+			continue
 		}
 
 		return results, nil
@@ -112,6 +171,76 @@ func (hr *DefaultHostResolver) LookupIPAddr(ctx context.Context, host string) ([
 	return nil, errors.New("no records found for host")
 }
 
+func (hr *DefaultHostResolver) LookupTXT(ctx context.Context, host string) ([]string, error) {
+	r, err := hr.exchange(ctx, host, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for _, answer := range r.Answer {
+		if rr, ok := answer.(*dns.TXT); ok {
+			// Long records are split into several strings
+			records = append(records, strings.Join(rr.Txt, ""))
+		}
+	}
+	if len(records) == 0 {
+		return nil, &gonet.DNSError{Err: "no TXT records found for host", Name: host, IsNotFound: true}
+	}
+
+	return records, nil
+}
+
+func (hr *DefaultHostResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	r, err := hr.exchange(ctx, host, dns.TypeCNAME)
+	if err != nil {
+		return "", err
+	}
+
+	for _, answer := range r.Answer {
+		if rr, ok := answer.(*dns.CNAME); ok {
+			return strings.TrimSuffix(rr.Target, "."), nil
+		}
+	}
+
+	return "", &gonet.DNSError{Err: "no CNAME record found for host", Name: host, IsNotFound: true}
+}
+
+// exchange queries the nameservers in turn, until one of them answers, and
+// returns its answer. An answer that the host doesn't exist is returned as a
+// not found error, and the error of the last nameserver if none of them
+// answers, e.g., that fails with SERVFAIL.
+func (hr *DefaultHostResolver) exchange(ctx context.Context, host string, qtype uint16) (*dns.Msg, error) {
+	cfg, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+
+	lastErr := &gonet.DNSError{Err: "no nameservers configured", Name: host}
+	for _, server := range cfg.Servers {
+		m := dns.Msg{}
+		m.SetQuestion(fmt.Sprintf("%s.", host), qtype)
+
+		address := gonet.JoinHostPort(server, cfg.Port)
+		r, _, err := hr.Client.ExchangeContext(ctx, &m, address)
+		if err != nil {
+			lastErr = &gonet.DNSError{Err: err.Error(), Name: host, Server: address, IsTemporary: true}
+			continue
+		}
+
+		switch r.Rcode {
+		case dns.RcodeSuccess:
+			return r, nil
+		case dns.RcodeNameError:
+			return nil, &gonet.DNSError{Err: "no such host", Name: host, Server: address, IsNotFound: true}
+		default:
+			lastErr = &gonet.DNSError{Err: fmt.Sprintf("server answered %s", dns.RcodeToString[r.Rcode]), Name: host, Server: address, IsTemporary: true}
+		}
+	}
+
+	return nil, lastErr
+}
+
 type SafeHostResolver struct {
 	HostResolver
 
@@ -129,3 +258,15 @@ func (r *SafeHostResolver) LookupIPAddr(ctx context.Context, host string) ([]Hos
 	defer r.mu.Unlock()
 	return r.HostResolver.LookupIPAddr(ctx, host)
 }
+
+func (r *SafeHostResolver) LookupTXT(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.HostResolver.LookupTXT(ctx, host)
+}
+
+func (r *SafeHostResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.HostResolver.LookupCNAME(ctx, host)
+}
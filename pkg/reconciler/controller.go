@@ -54,6 +54,16 @@ func (c *Controller) Enqueue(obj interface{}) {
 	c.Queue.Add(key)
 }
 
+// EnqueueAfter adds the object to the queue after the duration has passed.
+func (c *Controller) EnqueueAfter(obj interface{}, duration time.Duration) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.Queue.AddAfter(key, duration)
+}
+
 func (c *Controller) Start(ctx context.Context, numThreads int) {
 	defer runtime.HandleCrash()
 	defer c.Queue.ShutDown()
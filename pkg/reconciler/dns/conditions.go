@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+// recordConditions returns the conditions of the record, aggregated from the
+// statuses of the record in its zones, and the result of the reconciliation of
+// its health checks. The transition time of the conditions is only updated if
+// their status changes.
+func recordConditions(record *v1.DNSRecord, statuses []v1.DNSZoneStatus, healthChecksErr error) []metav1.Condition {
+	conditions := make([]metav1.Condition, len(record.Status.Conditions))
+	copy(conditions, record.Status.Conditions)
+
+	published := publishedCondition(statuses)
+	healthChecksReady := healthChecksReadyCondition(healthChecksErr)
+	ready := metav1.Condition{
+		Type:    v1.DNSRecordReadyConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Ready",
+		Message: "The record is published and propagated to all its zones",
+	}
+	switch {
+	case published.Status != metav1.ConditionTrue:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "NotPublished"
+		ready.Message = published.Message
+	case healthChecksReady.Status != metav1.ConditionTrue:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "HealthChecksNotReady"
+		ready.Message = healthChecksReady.Message
+	case !propagated(statuses):
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "PropagationPending"
+		ready.Message = "The record is being propagated to its zones"
+	}
+
+	for _, condition := range []metav1.Condition{published, healthChecksReady, ready} {
+		condition.ObservedGeneration = record.Generation
+		condition.LastTransitionTime = metav1.NewTime(clock.Now())
+		meta.SetStatusCondition(&conditions, condition)
+	}
+	return conditions
+}
+
+// publishedCondition returns the "Published" condition of a record, that is
+// true if the record is published to all its zones.
+func publishedCondition(statuses []v1.DNSZoneStatus) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    v1.DNSRecordPublishedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Published",
+		Message: "The record is published to all its zones",
+	}
+	if len(statuses) == 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NoZones"
+		condition.Message = "The record has no zone to be published to"
+		return condition
+	}
+	for _, status := range statuses {
+		failed := findZoneCondition(status.Conditions, v1.DNSRecordFailedConditionType)
+		if failed == nil {
+			condition.Status = metav1.ConditionUnknown
+			condition.Reason = "Pending"
+			condition.Message = fmt.Sprintf("The record is not published to zone %s yet", status.DNSZone.ID)
+			continue
+		}
+		if failed.Status != string(ConditionFalse) {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = failed.Reason
+			condition.Message = fmt.Sprintf("The record failed to be published to zone %s: %s", status.DNSZone.ID, failed.Message)
+			return condition
+		}
+	}
+	return condition
+}
+
+// healthChecksReadyCondition returns the "HealthChecksReady" condition of a
+// record, that is true if its health checks are reconciled.
+func healthChecksReadyCondition(err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    v1.DNSRecordHealthChecksReadyConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ReconcileFailed",
+			Message: fmt.Sprintf("The health checks of the record failed to be reconciled: %v", err),
+		}
+	}
+	return metav1.Condition{
+		Type:    v1.DNSRecordHealthChecksReadyConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Reconciled",
+		Message: "The health checks of the record are reconciled",
+	}
+}
+
+// propagated returns whether the record is propagated to all its zones.
+func propagated(statuses []v1.DNSZoneStatus) bool {
+	for _, status := range statuses {
+		condition := findZoneCondition(status.Conditions, v1.DNSRecordPropagatedConditionType)
+		if condition == nil || condition.Status != string(ConditionTrue) {
+			return false
+		}
+	}
+	return true
+}
+
+func findZoneCondition(conditions []v1.DNSZoneCondition, conditionType string) *v1.DNSZoneCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
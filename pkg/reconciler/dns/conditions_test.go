@@ -0,0 +1,136 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	utilclock "k8s.io/apimachinery/pkg/util/clock"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+func TestRecordConditions(t *testing.T) {
+	zoneStatus := func(id string, failed, propagated ConditionStatus, reason string) v1.DNSZoneStatus {
+		return v1.DNSZoneStatus{
+			DNSZone: v1.DNSZone{ID: id},
+			Conditions: []v1.DNSZoneCondition{
+				{Type: v1.DNSRecordFailedConditionType, Status: string(failed), Reason: reason},
+				{Type: v1.DNSRecordPropagatedConditionType, Status: string(propagated)},
+			},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		statuses        []v1.DNSZoneStatus
+		healthChecksErr error
+		published       metav1.ConditionStatus
+		ready           metav1.ConditionStatus
+		readyReason     string
+	}{
+		{
+			name:        "no zones",
+			published:   metav1.ConditionFalse,
+			ready:       metav1.ConditionFalse,
+			readyReason: "NotPublished",
+		},
+		{
+			name: "published and propagated",
+			statuses: []v1.DNSZoneStatus{
+				zoneStatus("public", ConditionFalse, ConditionTrue, "ProviderSuccess"),
+				zoneStatus("private", ConditionFalse, ConditionTrue, "ProviderSuccess"),
+			},
+			published:   metav1.ConditionTrue,
+			ready:       metav1.ConditionTrue,
+			readyReason: "Ready",
+		},
+		{
+			name: "failed in a zone",
+			statuses: []v1.DNSZoneStatus{
+				zoneStatus("public", ConditionFalse, ConditionTrue, "ProviderSuccess"),
+				zoneStatus("private", ConditionTrue, ConditionFalse, "OwnershipConflict"),
+			},
+			published:   metav1.ConditionFalse,
+			ready:       metav1.ConditionFalse,
+			readyReason: "NotPublished",
+		},
+		{
+			name: "propagation pending",
+			statuses: []v1.DNSZoneStatus{
+				zoneStatus("public", ConditionFalse, ConditionFalse, "ProviderSuccess"),
+			},
+			published:   metav1.ConditionTrue,
+			ready:       metav1.ConditionFalse,
+			readyReason: "PropagationPending",
+		},
+		{
+			name: "health checks failed",
+			statuses: []v1.DNSZoneStatus{
+				zoneStatus("public", ConditionFalse, ConditionTrue, "ProviderSuccess"),
+			},
+			healthChecksErr: errors.New("invalid health check"),
+			published:       metav1.ConditionTrue,
+			ready:           metav1.ConditionFalse,
+			readyReason:     "HealthChecksNotReady",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &v1.DNSRecord{}
+			record.Generation = 2
+
+			conditions := recordConditions(record, tt.statuses, tt.healthChecksErr)
+			if len(conditions) != 3 {
+				t.Fatalf("expected 3 conditions, got %v", conditions)
+			}
+			if published := meta.FindStatusCondition(conditions, v1.DNSRecordPublishedConditionType); published.Status != tt.published {
+				t.Errorf("expected Published condition %s, got %s", tt.published, published.Status)
+			}
+			ready := meta.FindStatusCondition(conditions, v1.DNSRecordReadyConditionType)
+			if ready.Status != tt.ready || ready.Reason != tt.readyReason {
+				t.Errorf("expected Ready condition %s (%s), got %s (%s)", tt.ready, tt.readyReason, ready.Status, ready.Reason)
+			}
+			if ready.ObservedGeneration != record.Generation {
+				t.Errorf("expected Ready condition for generation %d, got %d", record.Generation, ready.ObservedGeneration)
+			}
+			if healthChecksReady := meta.IsStatusConditionTrue(conditions, v1.DNSRecordHealthChecksReadyConditionType); healthChecksReady != (tt.healthChecksErr == nil) {
+				t.Errorf("unexpected HealthChecksReady condition %t", healthChecksReady)
+			}
+		})
+	}
+}
+
+func TestMergeConditions(t *testing.T) {
+	fakeClock := utilclock.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	clock = fakeClock
+	defer func() { clock = utilclock.RealClock{} }()
+
+	drifted := func(status ConditionStatus, reason, message string) v1.DNSZoneCondition {
+		return v1.DNSZoneCondition{Type: v1.DNSRecordDriftedConditionType, Status: string(status), Reason: reason, Message: message}
+	}
+	start := metav1.NewTime(fakeClock.Now())
+
+	conditions := mergeConditions(nil, []v1.DNSZoneCondition{drifted(ConditionTrue, "RecordsDrifted", "a.example.com missing")})
+	if len(conditions) != 1 || !conditions[0].LastTransitionTime.Equal(&start) {
+		t.Fatalf("unexpected conditions: %v", conditions)
+	}
+
+	// A changed message is updated, without changing the transition time
+	fakeClock.Step(time.Minute)
+	conditions = mergeConditions(conditions, []v1.DNSZoneCondition{drifted(ConditionTrue, "RecordsDrifted", "b.example.com missing")})
+	if conditions[0].Message != "b.example.com missing" || !conditions[0].LastTransitionTime.Equal(&start) {
+		t.Errorf("expected the message to be updated, got %v", conditions[0])
+	}
+
+	// A changed status updates the transition time
+	conditions = mergeConditions(conditions, []v1.DNSZoneCondition{drifted(ConditionFalse, "InSync", "in sync")})
+	now := metav1.NewTime(fakeClock.Now())
+	if conditions[0].Status != string(ConditionFalse) || !conditions[0].LastTransitionTime.Equal(&now) {
+		t.Errorf("expected the status and transition time to be updated, got %v", conditions[0])
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
@@ -18,7 +21,13 @@ import (
 	kuadrantv1lister "github.com/kuadrant/kcp-glbc/pkg/client/kuadrant/listers/kuadrant/v1"
 	"github.com/kuadrant/kcp-glbc/pkg/dns"
 	awsdns "github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	azuredns "github.com/kuadrant/kcp-glbc/pkg/dns/azure"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/embedded"
+	googledns "github.com/kuadrant/kcp-glbc/pkg/dns/google"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/prober"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/rfc2136"
 	"github.com/kuadrant/kcp-glbc/pkg/reconciler"
+	"github.com/kuadrant/kcp-glbc/pkg/util/env"
 )
 
 const controllerName = "kcp-glbc-dns"
@@ -27,30 +36,83 @@ const controllerName = "kcp-glbc-dns"
 func NewController(config *ControllerConfig) (*Controller, error) {
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
 	c := &Controller{
-		Controller:            reconciler.NewController(controllerName, queue),
-		dnsRecordClient:       config.DnsRecordClient,
-		sharedInformerFactory: config.SharedInformerFactory,
+		Controller:                reconciler.NewController(controllerName, queue),
+		dnsRecordClient:           config.DnsRecordClient,
+		sharedInformerFactory:     config.SharedInformerFactory,
+		driftCheckInterval:        config.DriftCheckInterval,
+		driftChecks:               map[types.UID]time.Time{},
+		healthCheckStatusInterval: config.HealthCheckStatusInterval,
+		ownerID:                   config.OwnerID,
+		orphanSweeper:             config.OrphanSweeper,
+		orphans:                   map[string]time.Time{},
+		healthChecks:              newHealthCheckRegistry(),
+		requireZone:               config.RequireZone,
 	}
 	c.Process = c.process
+	if c.healthCheckStatusInterval <= 0 {
+		c.healthCheckStatusInterval = DefaultHealthCheckStatusInterval
+	}
+	if config.HealthProbeInterval > 0 {
+		c.prober = prober.New(prober.Config{
+			Interval: config.HealthProbeInterval,
+			// Publish the records again once the health of one of their endpoints changes
+			OnChange: func(dnsRecord string) {
+				c.Queue.Add(dnsRecord)
+				for _, key := range c.healthChecks.dnsRecordsSharing(dnsRecord) {
+					c.Queue.Add(key)
+				}
+			},
+		}, c.Logger)
+	}
+	if config.ZonesConfig == "" {
+		// The hosted zone of the domain is discovered, unless the zones are configured
+		c.domain = config.Domain
+	}
 
+	// The zones are loaded first, so that the DNS providers serving them are
+	// built with them
+	if config.ZonesConfig != "" {
+		zones, err := dns.LoadZoneRegistry(config.ZonesConfig)
+		if err != nil {
+			return nil, err
+		}
+		c.zones = zones
+	}
+
+	c.dnsProviderName = config.DNSProvider
 	dnsProvider, err := c.createDNSProvider(config.DNSProvider)
 	if err != nil {
 		return nil, err
 	}
 	c.dnsProvider = dnsProvider
+	c.dnsProviders = map[string]dns.Provider{config.DNSProvider: dnsProvider}
 
-	var dnsZones []v1.DNSZone
-	zoneID, zoneIDSet := os.LookupEnv("AWS_DNS_PUBLIC_ZONE_ID")
-	if zoneIDSet {
-		dnsZone := &v1.DNSZone{
-			ID: zoneID,
+	if zones := c.zones; zones != nil {
+		for _, zone := range zones.Zones() {
+			c.Logger.Info("Using DNS zone", "id", zone.ID, "domain", zone.Domain, "provider", zone.Provider, "visibility", zone.Visibility)
+			if _, ok := c.dnsProviders[zone.Provider]; zone.Provider != "" && !ok {
+				provider, err := c.createDNSProvider(zone.Provider)
+				if err != nil {
+					return nil, err
+				}
+				c.dnsProviders[zone.Provider] = provider
+			}
 		}
-		dnsZones = append(dnsZones, *dnsZone)
-		c.Logger.Info("Using AWS DNS zone", "id", zoneID)
 	} else {
-		c.Logger.Info("No AWS DNS zone id set (AWS_DNS_PUBLIC_ZONE_ID), no DNS records will be created!")
+		zones, err := c.zonesFromEnv(config.DNSProvider)
+		if err != nil {
+			return nil, err
+		}
+		c.zones = zones
+	}
+
+	if c.driftCheckInterval > 0 {
+		for name, provider := range c.dnsProviders {
+			if _, ok := provider.(dns.RecordLister); !ok {
+				c.Logger.Info("The DNS provider can't list the records of its zones, their drift won't be detected", "provider", name)
+			}
+		}
 	}
-	c.dnsZones = dnsZones
 
 	c.sharedInformerFactory.Kuadrant().V1().DNSRecords().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) { c.Enqueue(obj) },
@@ -72,6 +134,25 @@ type ControllerConfig struct {
 	DnsRecordClient       kuadrantv1.ClusterInterface
 	SharedInformerFactory externalversions.SharedInformerFactory
 	DNSProvider           string
+	// Optional path of the DNS zones configuration file, that maps domains to zones
+	ZonesConfig string
+	// The managed domain, whose hosted zone is discovered if no zone is set
+	Domain string
+	// Whether the controller fails to start if the zone of the managed domain
+	// can't be found, rather than publishing no records
+	RequireZone bool
+	// The interval the published records are checked for drift at, zero to disable
+	DriftCheckInterval time.Duration
+	// The interval the health of the endpoints is refreshed at, while they
+	// are health checked, DefaultHealthCheckStatusInterval if unset
+	HealthCheckStatusInterval time.Duration
+	// The identifier of the GLBC instance, that owns the records and health checks it creates
+	OwnerID string
+	// The configuration of the deletion of the orphaned records and health checks
+	OrphanSweeper OrphanSweeperConfig
+	// The interval the endpoints are probed at by the GLBC itself, rather than
+	// health checked by the DNS provider, zero to disable
+	HealthProbeInterval time.Duration
 }
 
 type Controller struct {
@@ -81,7 +162,134 @@ type Controller struct {
 	indexer               cache.Indexer
 	lister                kuadrantv1lister.DNSRecordLister
 	dnsProvider           dns.Provider
-	dnsZones              []v1.DNSZone
+	dnsProviderName       string
+	dnsProviders          map[string]dns.Provider
+	zones                 *dns.ZoneRegistry
+	domain                string
+	requireZone           bool
+	driftCheckInterval    time.Duration
+	// driftChecks are the times of the last drift check of the records
+	driftChecks     map[types.UID]time.Time
+	driftChecksLock sync.Mutex
+	// healthCheckStatusInterval is the interval the health of the endpoints
+	// is refreshed at, while they are health checked
+	healthCheckStatusInterval time.Duration
+
+	ownerID       string
+	orphanSweeper OrphanSweeperConfig
+	// orphans are the times the orphaned resources were first found at, only
+	// accessed by the orphan sweeper
+	orphans map[string]time.Time
+	// prober probes the endpoints, if the GLBC health checks them itself
+	prober healthProber
+	// healthChecks are the users of the health checks shared by the endpoints
+	healthChecks *healthCheckRegistry
+}
+
+// healthProber is a health check reconciler that probes the endpoints from
+// the GLBC itself.
+type healthProber interface {
+	dns.HealthCheckReconciler
+	// Healthy returns whether the endpoint passes its health check
+	Healthy(endpoint *v1.Endpoint) bool
+	// Run probes the endpoints until the context is done
+	Run(ctx context.Context)
+}
+
+// Start starts the DNS server of the providers, if it serves DNS queries
+// in-process, the orphan sweeper and the health check prober, along with the
+// controller workers, once the users of the existing health checks are
+// registered.
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	c.registerHealthChecks()
+	for _, provider := range c.dnsProviders {
+		if server, ok := provider.(dnsServer); ok {
+			c.restoreRecords(server)
+			go func() {
+				if err := server.Start(ctx); err != nil {
+					c.Logger.Error(err, "DNS server failed")
+				}
+			}()
+		}
+	}
+	go c.runOrphanSweeper(ctx)
+	if c.prober != nil {
+		go c.prober.Run(ctx)
+	}
+	c.Controller.Start(ctx, numThreads)
+}
+
+// dnsServer is a DNS provider that serves the DNS queries in-process, from
+// the records it's been given since it started.
+type dnsServer interface {
+	dns.Provider
+	Start(ctx context.Context) error
+	// Restore serves the records last published to the zone
+	Restore(record *v1.DNSRecord, zone v1.DNSZone) error
+}
+
+// restoreRecords gives the DNS server the records last published to its
+// zones, as it only keeps them in memory, so that they are served as soon as
+// it starts.
+func (c *Controller) restoreRecords(server dnsServer) {
+	for _, obj := range c.indexer.List() {
+		dnsRecord := obj.(*v1.DNSRecord)
+		for _, zoneStatus := range dnsRecord.Status.Zones {
+			if c.providerForZone(zoneStatus.DNSZone) != server {
+				continue
+			}
+			if err := server.Restore(dnsRecord, zoneStatus.DNSZone); err != nil {
+				c.Logger.Error(err, "Failed to restore DNS record", "record", dnsRecord.Name, "zone", zoneStatus.DNSZone.ID)
+			}
+		}
+	}
+}
+
+// healthCheckReconcilers returns the prober if the GLBC health checks the
+// endpoints itself, or the health check reconcilers of the DNS providers of
+// the zones, or of the default DNS provider if there is no zone.
+func (c *Controller) healthCheckReconcilers(zones []v1.DNSZone) []dns.HealthCheckReconciler {
+	if c.prober != nil {
+		return []dns.HealthCheckReconciler{c.prober}
+	}
+	var providers []dns.Provider
+	for _, zone := range zones {
+		provider := c.providerForZone(zone)
+		if !containsProvider(providers, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	if len(providers) == 0 {
+		providers = append(providers, c.dnsProvider)
+	}
+	reconcilers := make([]dns.HealthCheckReconciler, 0, len(providers))
+	for _, provider := range providers {
+		reconcilers = append(reconcilers, provider.HealthCheckReconciler())
+	}
+	return reconcilers
+}
+
+func containsProvider(providers []dns.Provider, provider dns.Provider) bool {
+	for _, p := range providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// providerForZone returns the DNS provider of the zone, or the default DNS
+// provider if the zone has no provider, or is not registered anymore.
+func (c *Controller) providerForZone(zone v1.DNSZone) dns.Provider {
+	if c.zones == nil {
+		return c.dnsProvider
+	}
+	if registered, ok := c.zones.ZoneFor(zone); ok {
+		if provider, ok := c.dnsProviders[registered.Provider]; ok {
+			return provider
+		}
+	}
+	return c.dnsProvider
 }
 
 func (c *Controller) process(ctx context.Context, key string) error {
@@ -109,21 +317,89 @@ func (c *Controller) process(ctx context.Context, key string) error {
 	return nil
 }
 
+// zonesFromEnv returns a registry of the DNS zone of the provider, set with
+// environment variables, to which all the DNS records are published.
+func (c *Controller) zonesFromEnv(dnsProviderName string) (*dns.ZoneRegistry, error) {
+	var dnsZones []dns.Zone
+	switch dnsProviderName {
+	case "google":
+		zoneID, zoneIDSet := os.LookupEnv("GOOGLE_DNS_MANAGED_ZONE")
+		if zoneIDSet {
+			dnsZones = append(dnsZones, dns.Zone{DNSZone: v1.DNSZone{ID: zoneID}})
+			c.Logger.Info("Using Google Cloud DNS managed zone", "id", zoneID)
+		} else {
+			c.Logger.Info("No Google Cloud DNS managed zone set (GOOGLE_DNS_MANAGED_ZONE), no DNS records will be created!")
+		}
+	case "azure":
+		zoneID, zoneIDSet := os.LookupEnv("AZURE_DNS_ZONE")
+		if zoneIDSet {
+			dnsZones = append(dnsZones, dns.Zone{DNSZone: v1.DNSZone{ID: zoneID}})
+			c.Logger.Info("Using Azure DNS zone", "id", zoneID)
+		} else {
+			c.Logger.Info("No Azure DNS zone set (AZURE_DNS_ZONE), no DNS records will be created!")
+		}
+	case "rfc2136":
+		zoneID, zoneIDSet := os.LookupEnv("RFC2136_ZONE")
+		if zoneIDSet {
+			dnsZones = append(dnsZones, dns.Zone{DNSZone: v1.DNSZone{ID: zoneID}})
+			c.Logger.Info("Using RFC 2136 DNS zone", "id", zoneID)
+		} else {
+			c.Logger.Info("No RFC 2136 DNS zone set (RFC2136_ZONE), no DNS records will be created!")
+		}
+	case "embedded":
+		zoneID, zoneIDSet := os.LookupEnv("EMBEDDED_DNS_ZONE")
+		if zoneIDSet {
+			dnsZones = append(dnsZones, dns.Zone{DNSZone: v1.DNSZone{ID: zoneID}})
+			c.Logger.Info("Using embedded DNS zone", "id", zoneID)
+		} else {
+			c.Logger.Info("No embedded DNS zone set (EMBEDDED_DNS_ZONE), no DNS records will be served!")
+		}
+	default:
+		zoneID, zoneIDSet := os.LookupEnv("AWS_DNS_PUBLIC_ZONE_ID")
+		if zoneIDSet {
+			dnsZone := &v1.DNSZone{
+				ID: zoneID,
+			}
+			dnsZones = append(dnsZones, dns.Zone{DNSZone: *dnsZone})
+			c.Logger.Info("Using AWS DNS zone", "id", zoneID)
+		} else if provider, ok := c.dnsProvider.(*awsdns.Provider); ok && provider.HostedZoneID() != "" {
+			dnsZones = append(dnsZones, dns.Zone{DNSZone: v1.DNSZone{ID: provider.HostedZoneID()}})
+			c.Logger.Info("Using discovered AWS DNS zone", "id", provider.HostedZoneID(), "domain", c.domain)
+		} else {
+			c.Logger.Info("No AWS DNS zone id set (AWS_DNS_PUBLIC_ZONE_ID), no DNS records will be created!")
+		}
+	}
+	return dns.NewZoneRegistry(dnsZones...)
+}
+
 func (c *Controller) createDNSProvider(dnsProviderName string) (dns.Provider, error) {
 	var dnsProvider dns.Provider
 	var dnsError error
 	switch dnsProviderName {
 	case "aws":
-		dnsProvider, dnsError = newAWSDNSProvider()
+		dnsProvider, dnsError = newAWSDNSProvider(c.domain, c.ownerID, c.requireZone)
+	case "google":
+		dnsProvider, dnsError = newGoogleDNSProvider()
+	case "azure":
+		dnsProvider, dnsError = newAzureDNSProvider()
+	case "rfc2136":
+		dnsProvider, dnsError = newRFC2136DNSProvider()
+	case "embedded":
+		dnsProvider, dnsError = newEmbeddedDNSProvider(c.embeddedZones())
 	default:
 		dnsProvider = &dns.FakeProvider{}
 	}
 	return dnsProvider, dnsError
 }
 
-func newAWSDNSProvider() (dns.Provider, error) {
+func newAWSDNSProvider(domain, ownerID string, requireZone bool) (dns.Provider, error) {
 	var dnsProvider dns.Provider
-	provider, err := awsdns.NewProvider(awsdns.Config{})
+	provider, err := awsdns.NewProvider(awsdns.Config{
+		ZoneID:      env.GetEnvString("AWS_DNS_PUBLIC_ZONE_ID", ""),
+		Domain:      domain,
+		RequireZone: requireZone,
+		OwnerID:     ownerID,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS DNS manager: %v", err)
 	}
@@ -131,3 +407,88 @@ func newAWSDNSProvider() (dns.Provider, error) {
 
 	return dnsProvider, nil
 }
+
+func newGoogleDNSProvider() (dns.Provider, error) {
+	var dnsProvider dns.Provider
+	provider, err := googledns.NewProvider(googledns.Config{
+		Project: env.GetEnvString("GOOGLE_PROJECT_ID", ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google DNS manager: %v", err)
+	}
+	dnsProvider = provider
+
+	return dnsProvider, nil
+}
+
+func newAzureDNSProvider() (dns.Provider, error) {
+	var dnsProvider dns.Provider
+	provider, err := azuredns.NewProvider(azuredns.Config{
+		SubscriptionID: env.GetEnvString("AZURE_SUBSCRIPTION_ID", ""),
+		ResourceGroup:  env.GetEnvString("AZURE_RESOURCE_GROUP", ""),
+		TenantID:       env.GetEnvString("AZURE_TENANT_ID", ""),
+		ClientID:       env.GetEnvString("AZURE_CLIENT_ID", ""),
+		ClientSecret:   env.GetEnvString("AZURE_CLIENT_SECRET", ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure DNS manager: %v", err)
+	}
+	dnsProvider = provider
+
+	return dnsProvider, nil
+}
+
+func newRFC2136DNSProvider() (dns.Provider, error) {
+	var dnsProvider dns.Provider
+	provider, err := rfc2136.NewProvider(rfc2136.Config{
+		Nameserver:    env.GetEnvString("RFC2136_NAMESERVER", ""),
+		Net:           env.GetEnvString("RFC2136_NET", "udp"),
+		TSIGKeyName:   env.GetEnvString("RFC2136_TSIG_KEY_NAME", ""),
+		TSIGSecret:    env.GetEnvString("RFC2136_TSIG_SECRET", ""),
+		TSIGAlgorithm: env.GetEnvString("RFC2136_TSIG_ALGORITHM", ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RFC 2136 DNS manager: %v", err)
+	}
+	dnsProvider = provider
+
+	return dnsProvider, nil
+}
+
+// embeddedZones returns the IDs of the zones served by the embedded DNS
+// provider, i.e., the configured zones of the provider, or the zone set with
+// EMBEDDED_DNS_ZONE when the zones aren't configured.
+func (c *Controller) embeddedZones() []string {
+	var zoneIDs []string
+	if c.zones == nil {
+		if zoneID, ok := os.LookupEnv("EMBEDDED_DNS_ZONE"); ok {
+			zoneIDs = append(zoneIDs, zoneID)
+		}
+		return zoneIDs
+	}
+	for _, zone := range c.zones.Zones() {
+		provider := zone.Provider
+		if provider == "" {
+			provider = c.dnsProviderName
+		}
+		if provider == "embedded" {
+			zoneIDs = append(zoneIDs, zone.ID)
+		}
+	}
+	return zoneIDs
+}
+
+func newEmbeddedDNSProvider(zoneIDs []string) (dns.Provider, error) {
+	var dnsProvider dns.Provider
+	provider, err := embedded.NewProvider(embedded.Config{
+		Address:    env.GetEnvString("EMBEDDED_DNS_ADDRESS", ":53"),
+		Nameserver: env.GetEnvString("EMBEDDED_DNS_NAMESERVER", ""),
+		Zones:      zoneIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded DNS server: %v", err)
+	}
+	dnsProvider = provider
+
+	return dnsProvider, nil
+}
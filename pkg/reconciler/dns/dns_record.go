@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilclock "k8s.io/apimachinery/pkg/util/clock"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
@@ -15,6 +17,7 @@ import (
 	"github.com/kcp-dev/logicalcluster"
 
 	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
 	"github.com/kuadrant/kcp-glbc/pkg/util/slice"
 )
 
@@ -23,6 +26,9 @@ type ConditionStatus string
 const (
 	DNSRecordFinalizer = "kuadrant.dev/dns-record"
 
+	// propagationCheckInterval is the interval the propagation of the changes is checked at
+	propagationCheckInterval = 10 * time.Second
+
 	ConditionTrue    ConditionStatus = "True"
 	ConditionFalse   ConditionStatus = "False"
 	ConditionUnknown ConditionStatus = "Unknown"
@@ -42,6 +48,7 @@ func (c *Controller) reconcile(ctx context.Context, dnsRecord *v1.DNSRecord) err
 			c.Logger.Error(err, "Failed to delete DNSRecord", "record", dnsRecord)
 			return err
 		}
+		c.forgetDriftChecks(dnsRecord)
 
 		return nil
 	}
@@ -50,35 +57,89 @@ func (c *Controller) reconcile(ctx context.Context, dnsRecord *v1.DNSRecord) err
 		dnsRecord.Finalizers = append(dnsRecord.Finalizers, DNSRecordFinalizer)
 	}
 
-	statuses := c.publishRecordToZones(c.dnsZones, dnsRecord)
-	if !dnsZoneStatusSlicesEqual(statuses, dnsRecord.Status.Zones) || dnsRecord.Status.ObservedGeneration != dnsRecord.Generation {
+	// The health checks are reconciled first, so that the records are
+	// published with the IDs of the health checks in the same reconciliation
+	healthChecksErr := c.ReconcileHealthChecks(ctx, dnsRecord)
+
+	zones := c.zonesForRecord(dnsRecord)
+	drifts := c.detectDrift(dnsRecord)
+	statuses := c.publishRecordToZones(zones, dnsRecord, drifts)
+	statuses, unpublishErr := c.unpublishRecordFromZones(zones, dnsRecord, statuses)
+	setDriftedConditions(statuses, drifts)
+	propagationPending := c.checkPropagation(statuses)
+
+	if healthChecksErr == nil && !propagationPending {
+		healthChecksErr = c.deleteReplacedHealthChecks(ctx, dnsRecord, statuses)
+	}
+	if healthChecksErr != nil {
+		c.Logger.Error(healthChecksErr, "Failed to reconcile health check for DNSRecord", "record", dnsRecord)
+	}
+	healthChecked := c.setHealthCheckStatuses(ctx, dnsRecord, statuses)
+
+	conditions := recordConditions(dnsRecord, statuses, healthChecksErr)
+	endpointCount := int32(len(dnsRecord.Spec.Endpoints))
+	if !dnsZoneStatusSlicesEqual(statuses, dnsRecord.Status.Zones) || dnsRecord.Status.ObservedGeneration != dnsRecord.Generation ||
+		!equality.Semantic.DeepEqual(conditions, dnsRecord.Status.Conditions) || dnsRecord.Status.EndpointCount != endpointCount {
 		dnsRecord.Status.Zones = statuses
 		dnsRecord.Status.ObservedGeneration = dnsRecord.Generation
+		dnsRecord.Status.Conditions = conditions
+		dnsRecord.Status.EndpointCount = endpointCount
 		_, err := c.dnsRecordClient.Cluster(logicalcluster.From(dnsRecord)).KuadrantV1().DNSRecords(dnsRecord.Namespace).UpdateStatus(ctx, dnsRecord, metav1.UpdateOptions{})
 		if err != nil {
 			return err
 		}
 	}
 
-	if err := c.ReconcileHealthChecks(ctx, dnsRecord); err != nil {
-		c.Logger.Error(err, "Failed to reconcile health check for DNSRecord", "record", dnsRecord)
-		return err
+	if unpublishErr != nil {
+		return unpublishErr
 	}
 
-	return nil
+	// Poll the changes until they are propagated, rather than blocking the worker
+	if propagationPending {
+		c.EnqueueAfter(dnsRecord, propagationCheckInterval)
+	} else if interval := c.requeueInterval(healthChecked); interval > 0 {
+		c.EnqueueAfter(dnsRecord, interval)
+	}
+
+	return healthChecksErr
 }
 
-func (c *Controller) publishRecordToZones(zones []v1.DNSZone, record *v1.DNSRecord) []v1.DNSZoneStatus {
+// requeueInterval returns the interval the record is reconciled again at, to
+// check the published records for drift, and refresh the health of its
+// endpoints if they are health checked. It returns zero if neither is needed.
+func (c *Controller) requeueInterval(healthChecked bool) time.Duration {
+	interval := c.driftCheckInterval
+	if statusInterval := c.healthCheckStatusInterval; healthChecked && statusInterval > 0 && (interval <= 0 || interval > statusInterval) {
+		interval = statusInterval
+	}
+	return interval
+}
+
+func (c *Controller) publishRecordToZones(zones []v1.DNSZone, record *v1.DNSRecord, drifts []zoneDrift) []v1.DNSZoneStatus {
+	// The endpoints are copied, as the health checks of the record update them
+	published := record.DeepCopy()
+	published.Spec.Endpoints = c.endpointsToPublish(record)
+
 	var statuses []v1.DNSZoneStatus
 	for i := range zones {
 		zone := zones[i]
+		published := published.DeepCopy()
+		published.Spec.Endpoints = c.endpointsForZone(zone, published.Spec.Endpoints)
 
 		// Only publish the record if the DNSRecord has been modified
 		// (which would mean the target could have changed) or its
-		// status does not indicate that it has already been published.
+		// status does not indicate that it has already been published,
+		// or the records of the provider have drifted, or the health of
+		// its endpoints has changed.
 		if record.Generation == record.Status.ObservedGeneration && recordIsAlreadyPublishedToZone(record, &zone) {
-			c.Logger.Info("Skipping zone to which the DNS record is already published", "record", record, "zone", zone)
-			continue
+			if isDrifted(drifts, zone) {
+				c.Logger.Info("Publishing drifted DNS record again", "record", record, "zone", zone)
+			} else if !weightsEqual(publishedEndpoints(record, zone), published.Spec.Endpoints) {
+				c.Logger.Info("Publishing DNS record again, as the health of its endpoints has changed", "record", record, "zone", zone)
+			} else {
+				c.Logger.Info("Skipping zone to which the DNS record is already published", "record", record, "zone", zone)
+				continue
+			}
 		}
 
 		condition := v1.DNSZoneCondition{
@@ -87,13 +148,15 @@ func (c *Controller) publishRecordToZones(zones []v1.DNSZone, record *v1.DNSReco
 			LastTransitionTime: metav1.Now(),
 		}
 
+		var changeID string
+		var err error
 		if recordIsAlreadyPublishedToZone(record, &zone) {
 			c.Logger.Info("replacing DNS record", "record", record, "zone", zone)
 
-			if err := c.dnsProvider.Ensure(record, zone); err != nil {
+			if changeID, err = c.ensureRecord(published, zone); err != nil {
 				c.Logger.Error(err, "Failed to replace DNS record in zone", "record", record.Spec, "zone", zone)
 				condition.Status = string(ConditionTrue)
-				condition.Reason = "ProviderError"
+				condition.Reason = failedReason(err)
 				condition.Message = fmt.Sprintf("The DNS provider failed to replace the record: %v", err)
 			} else {
 				c.Logger.Info("Replaced DNS record in zone", "record", record.Spec, "zone", zone)
@@ -102,10 +165,10 @@ func (c *Controller) publishRecordToZones(zones []v1.DNSZone, record *v1.DNSReco
 				condition.Message = "The DNS provider succeeded in replacing the record"
 			}
 		} else {
-			if err := c.dnsProvider.Ensure(record, zone); err != nil {
+			if changeID, err = c.ensureRecord(published, zone); err != nil {
 				c.Logger.Error(err, "Failed to publish DNS record to zone", "record", record.Spec, "zone", zone)
 				condition.Status = string(ConditionTrue)
-				condition.Reason = "ProviderError"
+				condition.Reason = failedReason(err)
 				condition.Message = fmt.Sprintf("The DNS provider failed to ensure the record: %v", err)
 			} else {
 				c.Logger.Info("Published DNS record to zone", "record", record.Spec, "zone", zone)
@@ -114,15 +177,188 @@ func (c *Controller) publishRecordToZones(zones []v1.DNSZone, record *v1.DNSReco
 				condition.Message = "The DNS provider succeeded in ensuring the record"
 			}
 		}
+		endpoints := published.Spec.DeepCopy().Endpoints
+		if dns.IsOwnershipConflict(err) {
+			// None of the endpoints have been published
+			endpoints = publishedEndpoints(record, zone)
+		}
 		statuses = append(statuses, v1.DNSZoneStatus{
 			DNSZone:    zone,
-			Conditions: []v1.DNSZoneCondition{condition},
-			Endpoints:  record.Spec.Endpoints,
+			Conditions: []v1.DNSZoneCondition{condition, propagatedCondition(changeID, err)},
+			Endpoints:  endpoints,
+			ChangeID:   changeID,
 		})
 	}
 	return mergeStatuses(zones, record.Status.DeepCopy().Zones, statuses)
 }
 
+// failedReason returns the reason of the "Failed" condition of a record that
+// the DNS provider failed to publish.
+func failedReason(err error) string {
+	if dns.IsOwnershipConflict(err) {
+		return "OwnershipConflict"
+	}
+	return "ProviderError"
+}
+
+// publishedEndpoints returns the endpoints last published to the zone.
+func publishedEndpoints(record *v1.DNSRecord, zone v1.DNSZone) []*v1.Endpoint {
+	for _, status := range record.Status.Zones {
+		if reflect.DeepEqual(&status.DNSZone, &zone) {
+			return status.Endpoints
+		}
+	}
+	return nil
+}
+
+// ensureRecord creates or updates the record in the zone, and returns the ID
+// of the change if the provider propagates it asynchronously.
+func (c *Controller) ensureRecord(record *v1.DNSRecord, zone v1.DNSZone) (string, error) {
+	provider := c.providerForZone(zone)
+	if tracker, ok := provider.(dns.ChangeTracker); ok {
+		return tracker.EnsureChange(record, zone)
+	}
+	return "", provider.Ensure(record, zone)
+}
+
+// propagatedCondition returns the "Propagated" condition of the record in
+// a zone, once it has been published, either pending until the change is
+// propagated, or true if the provider applies the changes synchronously.
+func propagatedCondition(changeID string, err error) v1.DNSZoneCondition {
+	condition := v1.DNSZoneCondition{
+		Type:               v1.DNSRecordPropagatedConditionType,
+		LastTransitionTime: metav1.Now(),
+	}
+	switch {
+	case err != nil:
+		condition.Status = string(ConditionFalse)
+		condition.Reason = "ProviderError"
+		condition.Message = "The DNS provider failed to publish the record"
+	case changeID != "":
+		condition.Status = string(ConditionFalse)
+		condition.Reason = "Pending"
+		condition.Message = fmt.Sprintf("The DNS provider is propagating the change %s", changeID)
+	default:
+		condition.Status = string(ConditionTrue)
+		condition.Reason = "Propagated"
+		condition.Message = "The DNS provider has propagated the record"
+	}
+	return condition
+}
+
+// checkPropagation updates the "Propagated" condition of the statuses whose
+// change has been propagated by the provider since it was published, or the
+// "Failed" condition of those whose change failed to be applied, and returns
+// whether the propagation of changes is still pending in some zones.
+func (c *Controller) checkPropagation(statuses []v1.DNSZoneStatus) bool {
+	pending := false
+	for i := range statuses {
+		status := &statuses[i]
+		if status.ChangeID == "" {
+			continue
+		}
+		tracker, ok := c.providerForZone(status.DNSZone).(dns.ChangeTracker)
+		if !ok {
+			status.ChangeID = ""
+			continue
+		}
+		propagated, err := tracker.ChangePropagated(status.ChangeID)
+		if dns.IsChangeFailed(err) {
+			// The record is published again on the next reconciliation
+			c.Logger.Error(err, "DNS record change failed", "zone", status.DNSZone, "change", status.ChangeID)
+			status.ChangeID = ""
+			status.Conditions = mergeConditions(status.Conditions, []v1.DNSZoneCondition{
+				{
+					Type:               v1.DNSRecordFailedConditionType,
+					Status:             string(ConditionTrue),
+					Reason:             "ProviderError",
+					Message:            fmt.Sprintf("The DNS provider failed to apply the change: %v", err),
+					LastTransitionTime: metav1.Now(),
+				},
+				propagatedCondition("", err),
+			})
+			pending = true
+			continue
+		}
+		if err != nil {
+			c.Logger.Error(err, "Failed to check the propagation of the DNS record change", "zone", status.DNSZone, "change", status.ChangeID)
+			pending = true
+			continue
+		}
+		if !propagated {
+			pending = true
+			continue
+		}
+		c.Logger.Info("DNS record change propagated", "zone", status.DNSZone, "change", status.ChangeID)
+		status.ChangeID = ""
+		status.Conditions = mergeConditions(status.Conditions, []v1.DNSZoneCondition{propagatedCondition("", nil)})
+	}
+	return pending
+}
+
+// zonesForRecord returns the zones the DNSRecord is published to, i.e., the
+// zones whose domain contains the DNS names of the record, with the visibility
+// set by the record annotation, if any, and that any of its endpoints is
+// published to.
+func (c *Controller) zonesForRecord(record *v1.DNSRecord) []v1.DNSZone {
+	visibility := dns.ZoneVisibility(record.Annotations[dns.ZoneVisibilityAnnotation])
+	var zones []v1.DNSZone
+	for _, zone := range c.zones.ZonesForRecord(record, visibility) {
+		if len(c.zones.EndpointsForZone(zone, record.Spec.Endpoints)) == 0 {
+			continue
+		}
+		zones = append(zones, zone.DNSZone)
+	}
+	return zones
+}
+
+// endpointsForZone returns the endpoints published to the zone, according to
+// its visibility.
+func (c *Controller) endpointsForZone(zone v1.DNSZone, endpoints []*v1.Endpoint) []*v1.Endpoint {
+	if c.zones == nil {
+		return endpoints
+	}
+	registered, ok := c.zones.ZoneFor(zone)
+	if !ok {
+		return endpoints
+	}
+	return c.zones.EndpointsForZone(registered, endpoints)
+}
+
+// unpublishRecordFromZones deletes the DNSRecord from the zones it is not
+// published to anymore, e.g., when its DNS name has changed, and returns the
+// statuses without these zones.
+func (c *Controller) unpublishRecordFromZones(zones []v1.DNSZone, record *v1.DNSRecord, statuses []v1.DNSZoneStatus) ([]v1.DNSZoneStatus, error) {
+	var errs []error
+	var kept []v1.DNSZoneStatus
+	for i := range statuses {
+		zone := statuses[i].DNSZone
+		if containsZone(zones, zone) {
+			kept = append(kept, statuses[i])
+			continue
+		}
+		if recordIsAlreadyPublishedToZone(record, &zone) {
+			if err := c.providerForZone(zone).Delete(record, zone); err != nil {
+				c.Logger.Error(err, "Failed to delete DNS record from zone", "record", record.Spec, "zone", zone)
+				errs = append(errs, err)
+				kept = append(kept, statuses[i])
+				continue
+			}
+			c.Logger.Info("Deleted DNS record from zone", "record", record.Spec, "zone", zone)
+		}
+	}
+	return kept, utilerrors.NewAggregate(errs)
+}
+
+func containsZone(zones []v1.DNSZone, zone v1.DNSZone) bool {
+	for i := range zones {
+		if reflect.DeepEqual(&zones[i], &zone) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Controller) deleteRecord(record *v1.DNSRecord) error {
 	var errs []error
 	for i := range record.Status.Zones {
@@ -132,7 +368,7 @@ func (c *Controller) deleteRecord(record *v1.DNSRecord) error {
 		if !recordIsAlreadyPublishedToZone(record, &zone) {
 			continue
 		}
-		err := c.dnsProvider.Delete(record, zone)
+		err := c.providerForZone(zone).Delete(record, zone)
 		if err != nil {
 			errs = append(errs, err)
 		} else {
@@ -177,6 +413,7 @@ func mergeStatuses(zones []v1.DNSZone, statuses, updates []v1.DNSZoneStatus) []v
 				add = false
 				statuses[j].Conditions = mergeConditions(status.Conditions, update.Conditions)
 				statuses[j].Endpoints = update.Endpoints
+				statuses[j].ChangeID = update.ChangeID
 			}
 		}
 		if add {
@@ -190,8 +427,8 @@ func mergeStatuses(zones []v1.DNSZone, statuses, updates []v1.DNSZoneStatus) []v
 var clock utilclock.Clock = utilclock.RealClock{}
 
 // mergeConditions adds or updates matching conditions, and updates
-// the transition time if details of a condition have changed. Returns
-// the updated condition array.
+// the transition time if the status or reason of a condition have changed.
+// Returns the updated condition array.
 func mergeConditions(conditions, updates []v1.DNSZoneCondition) []v1.DNSZoneCondition {
 	now := metav1.NewTime(clock.Now())
 	var additions []v1.DNSZoneCondition
@@ -201,10 +438,12 @@ func mergeConditions(conditions, updates []v1.DNSZoneCondition) []v1.DNSZoneCond
 			if cond.Type == update.Type {
 				add = false
 				if conditionChanged(cond, update) {
+					if cond.Status != update.Status || cond.Reason != update.Reason {
+						conditions[j].LastTransitionTime = now
+					}
 					conditions[j].Status = update.Status
 					conditions[j].Reason = update.Reason
 					conditions[j].Message = update.Message
-					conditions[j].LastTransitionTime = now
 					break
 				}
 			}
@@ -219,7 +458,7 @@ func mergeConditions(conditions, updates []v1.DNSZoneCondition) []v1.DNSZoneCond
 }
 
 func conditionChanged(a, b v1.DNSZoneCondition) bool {
-	return a.Status != b.Status || a.Reason != b.Reason
+	return a.Status != b.Status || a.Reason != b.Reason || a.Message != b.Message
 }
 
 // dnsZoneStatusSlicesEqual compares two DNSZoneStatus slice values.  Returns
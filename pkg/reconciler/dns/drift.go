@@ -0,0 +1,190 @@
+package dns
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+// zoneDrift is the result of the drift check of a record in a zone, i.e., the
+// differences between the published endpoints and the records of the provider.
+type zoneDrift struct {
+	zone        v1.DNSZone
+	differences []string
+}
+
+// detectDrift compares the endpoints last published to each zone with the
+// records of the provider, for the zones whose provider can list them, and
+// returns the results. The record is only checked once per drift check
+// interval, and only once it's published, so that the changes from the
+// reconciliation of the record itself are not reported as drift.
+func (c *Controller) detectDrift(record *v1.DNSRecord) []zoneDrift {
+	if c.driftCheckInterval <= 0 || record.Generation != record.Status.ObservedGeneration {
+		return nil
+	}
+	if !c.driftCheckDue(record) {
+		return nil
+	}
+
+	var drifts []zoneDrift
+	for i := range record.Status.Zones {
+		status := record.Status.Zones[i]
+		if !recordIsAlreadyPublishedToZone(record, &status.DNSZone) {
+			continue
+		}
+		lister, ok := c.providerForZone(status.DNSZone).(dns.RecordLister)
+		if !ok {
+			continue
+		}
+
+		var names []string
+		for _, endpoint := range status.Endpoints {
+			if !containsName(names, endpoint.DNSName) {
+				names = append(names, endpoint.DNSName)
+			}
+		}
+		var records []*v1.Endpoint
+		var err error
+		for _, name := range names {
+			var endpoints []*v1.Endpoint
+			if endpoints, err = lister.Records(name, status.DNSZone); err != nil {
+				break
+			}
+			records = append(records, endpoints...)
+		}
+		if err != nil {
+			c.Logger.Error(err, "Failed to check the drift of the DNS record", "record", record, "zone", status.DNSZone)
+			continue
+		}
+
+		drift := zoneDrift{zone: status.DNSZone, differences: endpointsDifferences(status.Endpoints, records)}
+		if len(drift.differences) > 0 {
+			c.Logger.Info("DNS record drifted from the published endpoints", "record", record, "zone", status.DNSZone, "differences", drift.differences)
+			dnsRecordDriftTotal.Inc()
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// driftCheckDue returns whether the last drift check of the record is older
+// than the drift check interval, and records the time of the check if so.
+func (c *Controller) driftCheckDue(record *v1.DNSRecord) bool {
+	c.driftChecksLock.Lock()
+	defer c.driftChecksLock.Unlock()
+	now := clock.Now()
+	if last, ok := c.driftChecks[record.UID]; ok && now.Sub(last) < c.driftCheckInterval {
+		return false
+	}
+	c.driftChecks[record.UID] = now
+	return true
+}
+
+// forgetDriftChecks removes the time of the last drift check of the record.
+func (c *Controller) forgetDriftChecks(record *v1.DNSRecord) {
+	c.driftChecksLock.Lock()
+	defer c.driftChecksLock.Unlock()
+	delete(c.driftChecks, record.UID)
+}
+
+// isDrifted returns whether the record drifted in the zone.
+func isDrifted(drifts []zoneDrift, zone v1.DNSZone) bool {
+	for i := range drifts {
+		if reflect.DeepEqual(&drifts[i].zone, &zone) {
+			return len(drifts[i].differences) > 0
+		}
+	}
+	return false
+}
+
+// setDriftedConditions updates the "Drifted" condition of the statuses of the
+// zones the drift was checked for.
+func setDriftedConditions(statuses []v1.DNSZoneStatus, drifts []zoneDrift) {
+	for i := range drifts {
+		condition := v1.DNSZoneCondition{
+			Type:               v1.DNSRecordDriftedConditionType,
+			Status:             string(ConditionFalse),
+			Reason:             "InSync",
+			Message:            "The records of the DNS provider match the published endpoints",
+			LastTransitionTime: metav1.Now(),
+		}
+		if len(drifts[i].differences) > 0 {
+			condition.Status = string(ConditionTrue)
+			condition.Reason = "RecordsDrifted"
+			condition.Message = fmt.Sprintf("The records of the DNS provider differ from the published endpoints: %s", strings.Join(drifts[i].differences, ", "))
+		}
+		for j := range statuses {
+			if reflect.DeepEqual(&statuses[j].DNSZone, &drifts[i].zone) {
+				statuses[j].Conditions = mergeConditions(statuses[j].Conditions, []v1.DNSZoneCondition{condition})
+			}
+		}
+	}
+}
+
+// endpointsDifferences returns the descriptions of the published endpoints
+// that are missing, or that differ, in the records of the provider.
+func endpointsDifferences(published, records []*v1.Endpoint) []string {
+	var differences []string
+	for _, endpoint := range published {
+		id := fmt.Sprintf("%s %s", endpoint.DNSName, endpoint.RecordType)
+		if endpoint.SetIdentifier != "" {
+			id = fmt.Sprintf("%s (%s)", id, endpoint.SetIdentifier)
+		}
+		record := findRecord(records, endpoint)
+		switch {
+		case record == nil:
+			differences = append(differences, fmt.Sprintf("%s is missing", id))
+		case !targetsEqual(endpoint.Targets, record.Targets):
+			differences = append(differences, fmt.Sprintf("%s targets are %s instead of %s", id, strings.Join(record.Targets, ","), strings.Join(endpoint.Targets, ",")))
+		case record.RecordTTL != 0 && record.RecordTTL != endpoint.RecordTTL:
+			// ALIAS records have no TTL
+			differences = append(differences, fmt.Sprintf("%s TTL is %d instead of %d", id, record.RecordTTL, endpoint.RecordTTL))
+		}
+	}
+	return differences
+}
+
+func findRecord(records []*v1.Endpoint, endpoint *v1.Endpoint) *v1.Endpoint {
+	for _, record := range records {
+		if normalizeName(record.DNSName) == normalizeName(endpoint.DNSName) &&
+			record.RecordType == endpoint.RecordType &&
+			record.SetIdentifier == endpoint.SetIdentifier {
+			return record
+		}
+	}
+	return nil
+}
+
+func targetsEqual(a, b v1.Targets) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	normalize := func(targets v1.Targets) []string {
+		var normalized []string
+		for _, target := range targets {
+			normalized = append(normalized, normalizeName(target))
+		}
+		sort.Strings(normalized)
+		return normalized
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if normalizeName(n) == normalizeName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
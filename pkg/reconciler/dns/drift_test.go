@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+)
+
+func TestEndpointsDifferences(t *testing.T) {
+	published := []*v1.Endpoint{
+		{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "10.0.0.1", RecordTTL: 60, Targets: v1.Targets{"10.0.0.1"}},
+		{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "lb", RecordTTL: 60, Targets: v1.Targets{"lb.elb.amazonaws.com"}},
+		{DNSName: "www.example.com", RecordType: "A", RecordTTL: 60, Targets: v1.Targets{"10.0.0.1", "10.0.0.2"}},
+	}
+
+	tests := []struct {
+		name    string
+		records []*v1.Endpoint
+		want    []string
+	}{
+		{
+			name: "records in sync",
+			records: []*v1.Endpoint{
+				{DNSName: "APP.example.com.", RecordType: "A", SetIdentifier: "10.0.0.1", RecordTTL: 60, Targets: v1.Targets{"10.0.0.1"}},
+				{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "lb", Targets: v1.Targets{"LB.elb.amazonaws.com."}},
+				{DNSName: "www.example.com", RecordType: "A", RecordTTL: 60, Targets: v1.Targets{"10.0.0.2", "10.0.0.1"}},
+				{DNSName: "app.example.com", RecordType: "AAAA", SetIdentifier: "::1", RecordTTL: 60, Targets: v1.Targets{"::1"}},
+			},
+		},
+		{
+			name: "records deleted",
+			records: []*v1.Endpoint{
+				{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "lb", Targets: v1.Targets{"lb.elb.amazonaws.com"}},
+			},
+			want: []string{
+				"app.example.com A (10.0.0.1) is missing",
+				"www.example.com A is missing",
+			},
+		},
+		{
+			name: "records changed",
+			records: []*v1.Endpoint{
+				{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "10.0.0.1", RecordTTL: 300, Targets: v1.Targets{"10.0.0.1"}},
+				{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "lb", Targets: v1.Targets{"other.elb.amazonaws.com"}},
+				{DNSName: "www.example.com", RecordType: "A", RecordTTL: 60, Targets: v1.Targets{"10.0.0.1"}},
+			},
+			want: []string{
+				"app.example.com A (10.0.0.1) TTL is 300 instead of 60",
+				"app.example.com A (lb) targets are other.elb.amazonaws.com instead of lb.elb.amazonaws.com",
+				"www.example.com A targets are 10.0.0.1 instead of 10.0.0.1,10.0.0.2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := endpointsDifferences(published, tt.records); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("endpointsDifferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
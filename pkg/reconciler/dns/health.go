@@ -6,75 +6,42 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
-	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
 	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	awsdns "github.com/kuadrant/kcp-glbc/pkg/dns/aws"
 )
 
-const ANNOTATION_HEALTH_CHECK_PREFIX = "kuadrant.experimental/health-"
-
-// healthChecksConfig represents the user configuration for the health checks
-type healthChecksConfig struct {
-	Endpoint         string
-	Port             *int64
-	FailureThreshold *int64
-	Protocol         *dns.HealthCheckProtocol
-}
-
-// annotationsConfigMap contains the logic to map an annotation-based configuration
-// value into a mutation of the healthChecksConfig.
-var annotationsConfigMap = map[string]func(string, *healthChecksConfig) error{
-	"endpoint": notNilConfig(func(endpoint string, s *healthChecksConfig) error {
-		s.Endpoint = endpoint
-		return nil
-	}),
-	"port": notNilConfig(configInt64(func(port int64, c *healthChecksConfig) {
-		c.Port = &port
-	})),
-	"protocol": notNilConfig(func(protocol string, c *healthChecksConfig) error {
-		var value dns.HealthCheckProtocol
-		switch protocol {
-		case string(dns.HealthCheckProtocolHTTP):
-		case string(dns.HealthCheckProtocolHTTPS):
-			value = dns.HealthCheckProtocol(protocol)
-		}
-
-		if value == "" {
-			return fmt.Errorf("invalid protocol %s. Only supported values are HTTP and HTTPS", protocol)
-		}
-
-		c.Protocol = &value
-		return nil
-	}),
-	"failure-threshold": notNilConfig(configInt64(func(v int64, c *healthChecksConfig) {
-		c.FailureThreshold = &v
-	})),
-}
+// DefaultHealthCheckStatusInterval is the default interval the health of the
+// endpoints is refreshed at, while the endpoints of a record are health checked
+const DefaultHealthCheckStatusInterval = time.Minute
 
 func (c *Controller) ReconcileHealthChecks(ctx context.Context, dnsRecord *v1.DNSRecord) error {
-	config, err := configFromAnnotations(dnsRecord.Annotations)
+	healthCheck, err := healthCheckForRecord(dnsRecord)
 	if err != nil {
 		return err
 	}
 
-	if config == nil {
+	if healthCheck == nil {
 		return c.reconcileHealthCheckDeletion(ctx, dnsRecord)
 	}
 
-	if err = validateHealthChecksConfig(config); err != nil {
+	if err = validateHealthCheck(healthCheck); err != nil {
 		return err
 	}
 
-	return c.reconcileHealthCheck(ctx, config, dnsRecord)
+	return c.reconcileHealthCheck(ctx, healthCheck, dnsRecord)
 }
 
-func (c *Controller) reconcileHealthCheck(ctx context.Context, config *healthChecksConfig, dnsRecord *v1.DNSRecord) error {
-	healthCheck := c.dnsProvider.HealthCheckReconciler()
+func (c *Controller) reconcileHealthCheck(ctx context.Context, healthCheckSpec *v1.HealthCheckSpec, dnsRecord *v1.DNSRecord) error {
+	reconcilers := c.healthCheckReconcilers(c.healthCheckZones(dnsRecord))
+	dnsRecordKey := dns.DNSRecordKey(dnsRecord)
 
+	users := map[healthCheckUser]bool{}
+	shared := false
 	for _, dnsEndpoint := range dnsRecord.Spec.Endpoints {
 		ok := false
 		if _, ok = dnsEndpoint.GetAddress(); !ok {
@@ -82,38 +49,230 @@ func (c *Controller) reconcileHealthCheck(ctx context.Context, config *healthChe
 			continue
 		}
 
-		endpointId, err := idForEndpoint(dnsRecord, dnsEndpoint)
-		if err != nil {
+		// The endpoints with the same probes share a health check
+		key := newHealthCheckKey(healthCheckSpec, dnsEndpoint)
+		user := newHealthCheckUser(dnsRecordKey, dnsEndpoint)
+		users[user] = true
+		owner, unused := c.healthChecks.acquire(key, user, dnsEndpoint)
+		if err := c.deleteHealthChecks(ctx, reconcilers, unused); err != nil {
 			return err
 		}
+		if !owner {
+			continue
+		}
 
 		spec := dns.HealthCheckSpec{
-			Id:               endpointId,
+			Id:               key.id(),
 			Name:             fmt.Sprintf("%s-%s", dnsEndpoint.DNSName, dnsEndpoint.SetIdentifier),
-			Path:             config.Endpoint,
-			Port:             config.Port,
-			Protocol:         config.Protocol,
-			FailureThreshold: config.FailureThreshold,
+			Path:             healthCheckSpec.Endpoint,
+			Port:             healthCheckSpec.Port,
+			Protocol:         healthCheckSpec.Protocol,
+			FailureThreshold: healthCheckSpec.FailureThreshold,
+			ExpectedStatus:   healthCheckSpec.ExpectedStatus,
+			ExpectedBody:     healthCheckSpec.ExpectedBody,
+			Inverted:         healthCheckSpec.Inverted,
+			EnableSNI:        healthCheckSpec.EnableSNI,
+			Regions:          healthCheckSpec.Regions,
+			DNSRecord:        dnsRecordKey,
+		}
+		if healthCheckSpec.Interval != nil {
+			spec.Interval = &healthCheckSpec.Interval.Duration
 		}
 
 		c.Logger.Info("Reconciling health check for endpoint", "name", dnsEndpoint.DNSName, "identifier", dnsEndpoint.SetIdentifier)
 
-		err = healthCheck.Reconcile(ctx, spec, dnsEndpoint)
+		var errs []error
+		for _, healthCheck := range reconcilers {
+			if err := healthCheck.Reconcile(ctx, spec, dnsEndpoint); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if c.healthChecks.reconciled(key, user, dnsEndpoint) {
+			shared = true
+		}
+		if len(errs) > 0 {
+			return utilerrors.NewAggregate(errs)
+		}
+	}
+
+	// The other DNSRecords sharing the health checks publish their new
+	// properties, e.g., the ID of a health check created for this one
+	if shared {
+		for _, key := range c.healthChecks.dnsRecordsSharing(dnsRecordKey) {
+			c.Queue.Add(key)
+		}
+	}
+
+	// The endpoints removed from the record don't use their health check anymore
+	if err := c.deleteHealthChecks(ctx, reconcilers, c.healthChecks.release(dnsRecordKey, users)); err != nil {
+		return err
+	}
+
+	for _, reconciler := range reconcilers {
+		if err := c.reconcileCalculatedHealthChecks(ctx, reconciler, healthCheckSpec, dnsRecord); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// healthCheckZones returns the zones the health checks of the record are
+// reconciled for, i.e., the zones it's published to, and the zones it was
+// last published to.
+func (c *Controller) healthCheckZones(dnsRecord *v1.DNSRecord) []v1.DNSZone {
+	var zones []v1.DNSZone
+	if c.zones != nil {
+		zones = c.zonesForRecord(dnsRecord)
+	}
+	for _, status := range dnsRecord.Status.Zones {
+		if !containsZone(zones, status.DNSZone) {
+			zones = append(zones, status.DNSZone)
+		}
+	}
+	return zones
+}
+
+// deleteHealthChecks deletes the health checks of the endpoints from the DNS
+// providers, once they are not used by any endpoint anymore.
+func (c *Controller) deleteHealthChecks(ctx context.Context, reconcilers []dns.HealthCheckReconciler, endpoints []*v1.Endpoint) error {
+	for _, endpoint := range endpoints {
+		c.Logger.Info("Deleting unused health check", "name", endpoint.DNSName, "identifier", endpoint.SetIdentifier)
+		for _, reconciler := range reconcilers {
+			if err := reconciler.Delete(ctx, endpoint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileCalculatedHealthChecks reconciles the calculated health checks
+// aggregating the health checks of the endpoints of each DNS name of the
+// record, if the health check reconciler supports them, and deletes them once
+// the health threshold is unset.
+func (c *Controller) reconcileCalculatedHealthChecks(ctx context.Context, reconciler dns.HealthCheckReconciler, healthCheckSpec *v1.HealthCheckSpec, dnsRecord *v1.DNSRecord) error {
+	calculated, ok := reconciler.(dns.CalculatedHealthCheckReconciler)
+	if !ok {
+		return nil
+	}
+
+	dnsNames, endpoints := healthCheckedEndpointsByDNSName(dnsRecord.Spec.Endpoints)
+	for _, dnsName := range dnsNames {
+		if healthCheckSpec.HealthThreshold == nil {
+			if err := calculated.DeleteCalculated(ctx, endpoints[dnsName]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id, err := idForEndpoint(dnsRecord, &v1.Endpoint{DNSName: dnsName})
 		if err != nil {
 			return err
 		}
+		spec := dns.HealthCheckSpec{
+			Id:              id,
+			Name:            dnsName,
+			HealthThreshold: healthCheckSpec.HealthThreshold,
+			DNSRecord:       dns.DNSRecordKey(dnsRecord),
+		}
+
+		c.Logger.Info("Reconciling calculated health check for DNS name", "name", dnsName)
+
+		if err := calculated.ReconcileCalculated(ctx, spec, endpoints[dnsName]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteReplacedHealthChecks deletes the health checks replaced by the health
+// checks of the endpoints of the record, once the record has been published
+// to all its zones with the new ones, and the changes have propagated.
+func (c *Controller) deleteReplacedHealthChecks(ctx context.Context, dnsRecord *v1.DNSRecord, statuses []v1.DNSZoneStatus) error {
+	var published []*v1.Endpoint
+	for _, status := range statuses {
+		if status.ChangeID != "" || !zoneStatusPublished(status) {
+			return nil
+		}
+		published = append(published, status.Endpoints...)
 	}
 
+	for _, reconciler := range c.healthCheckReconcilers(c.healthCheckZones(dnsRecord)) {
+		replaced, ok := reconciler.(dns.ReplacedHealthCheckReconciler)
+		if !ok {
+			continue
+		}
+		for _, endpoint := range dnsRecord.Spec.Endpoints {
+			if err := replaced.DeleteReplaced(ctx, endpoint, published); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// zoneStatusPublished returns whether the record was successfully published to
+// the zone of the status.
+func zoneStatusPublished(status v1.DNSZoneStatus) bool {
+	for _, condition := range status.Conditions {
+		if condition.Type == v1.DNSRecordFailedConditionType {
+			return condition.Status == string(ConditionFalse)
+		}
+	}
+	return false
+}
+
+// healthCheckedEndpointsByDNSName groups the endpoints with an address by DNS
+// name, and returns the DNS names in order.
+func healthCheckedEndpointsByDNSName(endpoints []*v1.Endpoint) ([]string, map[string][]*v1.Endpoint) {
+	var dnsNames []string
+	byDNSName := map[string][]*v1.Endpoint{}
+	for _, endpoint := range endpoints {
+		if _, ok := endpoint.GetAddress(); !ok {
+			continue
+		}
+		if _, ok := byDNSName[endpoint.DNSName]; !ok {
+			dnsNames = append(dnsNames, endpoint.DNSName)
+		}
+		byDNSName[endpoint.DNSName] = append(byDNSName[endpoint.DNSName], endpoint)
+	}
+	return dnsNames, byDNSName
+}
+
 func (c *Controller) reconcileHealthCheckDeletion(ctx context.Context, dnsRecord *v1.DNSRecord) error {
-	reconciler := c.dnsProvider.HealthCheckReconciler()
+	for _, zone := range dnsRecord.Status.Zones {
+		// The calculated health checks must be deleted before their children
+		for _, reconciler := range c.healthCheckReconcilers([]v1.DNSZone{zone.DNSZone}) {
+			calculated, ok := reconciler.(dns.CalculatedHealthCheckReconciler)
+			if !ok {
+				continue
+			}
+			dnsNames, endpoints := healthCheckedEndpointsByDNSName(zone.Endpoints)
+			for _, dnsName := range dnsNames {
+				if err := calculated.DeleteCalculated(ctx, endpoints[dnsName]); err != nil {
+					return err
+				}
+			}
+		}
+	}
 
+	unused := c.healthChecks.release(dns.DNSRecordKey(dnsRecord), nil)
+	if err := c.deleteHealthChecks(ctx, c.healthCheckReconcilers(c.healthCheckZones(dnsRecord)), unused); err != nil {
+		return err
+	}
 	for _, zone := range dnsRecord.Status.Zones {
+		reconcilers := c.healthCheckReconcilers([]v1.DNSZone{zone.DNSZone})
 		for _, endpoint := range zone.Endpoints {
-			if err := reconciler.Delete(ctx, endpoint); err != nil {
-				return err
+			// The health checks still used by other endpoints are kept
+			if c.healthChecks.registered(endpoint) || containsHealthCheck(unused, endpoint) {
+				clearHealthCheckProperties(endpoint)
+				continue
+			}
+			for _, reconciler := range reconcilers {
+				if err := reconciler.Delete(ctx, endpoint); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -121,90 +280,225 @@ func (c *Controller) reconcileHealthCheckDeletion(ctx context.Context, dnsRecord
 	return nil
 }
 
-// idForEndpoint returns a unique identifier for an endpoint
-func idForEndpoint(dnsRecord *v1.DNSRecord, endpoint *v1.Endpoint) (string, error) {
-	hash := md5.New()
-	if _, err := io.WriteString(hash, fmt.Sprintf("%s/%s@%s", dnsRecord.Name, endpoint.SetIdentifier, endpoint.DNSName)); err != nil {
-		return "", fmt.Errorf("unexpected error creating ID for endpoint %s", endpoint.SetIdentifier)
+// containsHealthCheck returns whether the health check of the endpoint is the
+// health check of any of the endpoints.
+func containsHealthCheck(endpoints []*v1.Endpoint, endpoint *v1.Endpoint) bool {
+	for _, other := range endpoints {
+		if staleHealthCheckEndpoint(endpoint, other) == nil {
+			return true
+		}
 	}
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	return false
 }
 
-// configFromAnnotations populates a healthChecksConfig instance from the
-// annotations map. If no relevant annotation are found, returns nil
-func configFromAnnotations(annotations map[string]string) (*healthChecksConfig, error) {
-	if annotations == nil {
-		return nil, nil
+// registerHealthChecks registers the users of the health checks of the
+// existing DNSRecords, so that the health checks still used by other
+// DNSRecords are not deleted with the first DNSRecords reconciled. The users
+// are also registered with the health check reconcilers that count them.
+func (c *Controller) registerHealthChecks() {
+	for _, obj := range c.indexer.List() {
+		dnsRecord := obj.(*v1.DNSRecord)
+		healthCheck, err := healthCheckForRecord(dnsRecord)
+		if err != nil || healthCheck == nil || validateHealthCheck(healthCheck) != nil {
+			continue
+		}
+		for _, endpoint := range dnsRecord.Spec.Endpoints {
+			if _, ok := endpoint.GetAddress(); ok {
+				c.healthChecks.register(newHealthCheckKey(healthCheck, endpoint), newHealthCheckUser(dns.DNSRecordKey(dnsRecord), endpoint), endpoint)
+			}
+		}
+
+		// The published endpoints removed from the spec still use their health check
+		endpoints := append([]*v1.Endpoint{}, dnsRecord.Spec.Endpoints...)
+		for _, zone := range dnsRecord.Status.Zones {
+			endpoints = append(endpoints, zone.Endpoints...)
+		}
+		for _, reconciler := range c.healthCheckReconcilers(c.healthCheckZones(dnsRecord)) {
+			if registering, ok := reconciler.(dns.RegisteringHealthCheckReconciler); ok {
+				for _, endpoint := range endpoints {
+					registering.Register(endpoint)
+				}
+			}
+		}
 	}
+}
 
-	var result *healthChecksConfig
+// setHealthCheckStatuses records the health of the health checked endpoints
+// of the record in the statuses of the zones they are published to, and
+// returns whether any endpoint is health checked.
+func (c *Controller) setHealthCheckStatuses(ctx context.Context, dnsRecord *v1.DNSRecord, statuses []v1.DNSZoneStatus) bool {
+	healthChecked := false
+	if healthCheck, err := healthCheckForRecord(dnsRecord); err == nil && healthCheck != nil {
+		for _, endpoint := range dnsRecord.Spec.Endpoints {
+			if _, ok := endpoint.GetAddress(); ok {
+				healthChecked = true
+			}
+		}
+	}
 
-	for k, v := range annotations {
-		// The annotation is not for the health check. Skip it
-		if !strings.HasPrefix(k, ANNOTATION_HEALTH_CHECK_PREFIX) {
+	// The health is reported by the health check reconciler of each zone,
+	// that's only asked once for the zones it's shared by
+	healthChecksByReconciler := map[dns.HealthCheckReconciler][]v1.EndpointHealthCheckStatus{}
+	for i := range statuses {
+		status := &statuses[i]
+		status.HealthChecks = nil
+		if !healthChecked {
 			continue
 		}
-
-		// Get the configuration key
-		field := strings.TrimPrefix(k, ANNOTATION_HEALTH_CHECK_PREFIX)
-
-		// Get the set value function for the configuration key
-		setValue, ok := annotationsConfigMap[field]
+		reconciler := c.healthCheckReconcilers([]v1.DNSZone{status.DNSZone})[0]
+		healthChecks, ok := healthChecksByReconciler[reconciler]
 		if !ok {
-			return nil, fmt.Errorf("invalid value for annotation %s: %s", k, v)
+			healthChecks = c.healthCheckStatuses(ctx, reconciler, dnsRecord)
+			healthChecksByReconciler[reconciler] = healthChecks
+		}
+		for _, healthCheck := range healthChecks {
+			for _, endpoint := range status.Endpoints {
+				if endpoint.DNSName == healthCheck.DNSName && endpoint.SetIdentifier == healthCheck.SetIdentifier {
+					status.HealthChecks = append(status.HealthChecks, healthCheck)
+					break
+				}
+			}
 		}
+	}
+
+	return healthChecked
+}
 
-		if result == nil {
-			result = &healthChecksConfig{}
+// healthCheckStatuses returns the health of the health checked endpoints of
+// the record, as reported by the health check reconciler.
+func (c *Controller) healthCheckStatuses(ctx context.Context, reconciler dns.HealthCheckReconciler, dnsRecord *v1.DNSRecord) []v1.EndpointHealthCheckStatus {
+
+	var healthChecks []v1.EndpointHealthCheckStatus
+	for _, endpoint := range dnsRecord.Spec.Endpoints {
+		if _, ok := endpoint.GetAddress(); !ok {
+			continue
 		}
 
-		// Apply the value into the resulting configuration instance
-		if err := setValue(v, result); err != nil {
-			return nil, fmt.Errorf("invalid value for annotation %s: %v", k, err)
+		status, err := reconciler.Status(ctx, endpoint)
+		if err != nil {
+			c.Logger.Error(err, "Failed to get the health check status of endpoint", "record", dnsRecord, "name", endpoint.DNSName, "identifier", endpoint.SetIdentifier)
+			status = dns.HealthCheckStatus{
+				State:   v1.HealthCheckStateUnknown,
+				Message: fmt.Sprintf("Failed to get the health check status: %v", err),
+			}
 		}
 
+		healthChecks = append(healthChecks, v1.EndpointHealthCheckStatus{
+			DNSName:       endpoint.DNSName,
+			SetIdentifier: endpoint.SetIdentifier,
+			State:         status.State,
+			Message:       status.Message,
+		})
 	}
-
-	return result, nil
+	return healthChecks
 }
 
-func validateHealthChecksConfig(config *healthChecksConfig) error {
-	if config == nil {
-		return errors.New("health checks config can't be nil")
+// endpointsToPublish returns a copy of the endpoints of the record, where the
+// weighted endpoints failing the probes of the GLBC are zero-weighted, so that
+// the DNS providers stop routing traffic to them, unless all the endpoints of
+// their DNS name are failing. The endpoints routed by other policies, or not
+// routed at all, are published as is, as a weight would turn them into
+// weighted records.
+func (c *Controller) endpointsToPublish(record *v1.DNSRecord) []*v1.Endpoint {
+	endpoints := record.Spec.DeepCopy().Endpoints
+	if c.prober == nil {
+		return endpoints
 	}
 
-	if config.Endpoint == "" {
-		return errors.New("endpoint is a required value to configure health checks")
-	}
-	if config.Port == nil {
-		config.Port = aws.Int64(80)
+	var unhealthy []*v1.Endpoint
+	healthyNames := map[string]bool{}
+	for _, endpoint := range endpoints {
+		if _, ok := endpoint.GetAddress(); ok && !c.prober.Healthy(endpoint) && isWeightable(endpoint) {
+			unhealthy = append(unhealthy, endpoint)
+		} else {
+			healthyNames[endpoint.DNSName] = true
+		}
 	}
-	if config.Protocol == nil {
-		defaultProtocol := dns.HealthCheckProtocolHTTP
-		config.Protocol = &defaultProtocol
+	for _, endpoint := range unhealthy {
+		if healthyNames[endpoint.DNSName] {
+			endpoint.SetProviderSpecific(awsdns.ProviderSpecificWeight, "0")
+		}
 	}
+	return endpoints
+}
 
-	return nil
+func isWeightable(endpoint *v1.Endpoint) bool {
+	_, ok := endpoint.GetProviderSpecific(awsdns.ProviderSpecificWeight)
+	return ok
 }
 
-func configInt64(f func(int64, *healthChecksConfig)) func(string, *healthChecksConfig) error {
-	return func(s string, c *healthChecksConfig) error {
-		intValue, err := strconv.Atoi(s)
-		if err != nil {
-			return err
+// weightsEqual returns whether the endpoints have the same weights as the
+// published endpoints.
+func weightsEqual(published, endpoints []*v1.Endpoint) bool {
+	weights := map[string]string{}
+	for _, endpoint := range published {
+		weights[endpoint.DNSName+"/"+endpoint.SetIdentifier+"/"+endpoint.RecordType], _ = endpoint.GetProviderSpecific(awsdns.ProviderSpecificWeight)
+	}
+	for _, endpoint := range endpoints {
+		weight, _ := endpoint.GetProviderSpecific(awsdns.ProviderSpecificWeight)
+		if published, ok := weights[endpoint.DNSName+"/"+endpoint.SetIdentifier+"/"+endpoint.RecordType]; !ok || published != weight {
+			return false
 		}
+	}
+	return true
+}
 
-		f(int64(intValue), c)
-		return nil
+// idForEndpoint returns a unique identifier for an endpoint
+func idForEndpoint(dnsRecord *v1.DNSRecord, endpoint *v1.Endpoint) (string, error) {
+	hash := md5.New()
+	if _, err := io.WriteString(hash, fmt.Sprintf("%s/%s@%s", dnsRecord.Name, endpoint.SetIdentifier, endpoint.DNSName)); err != nil {
+		return "", fmt.Errorf("unexpected error creating ID for endpoint %s", endpoint.SetIdentifier)
 	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-func notNilConfig(f func(string, *healthChecksConfig) error) func(string, *healthChecksConfig) error {
-	return func(s string, hcc *healthChecksConfig) error {
-		if hcc == nil {
-			return errors.New("health check config can't be nil")
-		}
+// healthCheckForRecord returns the health check configured with the healthCheck
+// field of the record, or with its deprecated annotations if the field is unset.
+// It returns nil if the endpoints of the record are not health checked.
+func healthCheckForRecord(dnsRecord *v1.DNSRecord) (*v1.HealthCheckSpec, error) {
+	if dnsRecord.Spec.HealthCheck != nil {
+		return dnsRecord.Spec.HealthCheck.DeepCopy(), nil
+	}
+	return dns.HealthCheckFromAnnotations(dnsRecord.Annotations)
+}
 
-		return f(s, hcc)
+// validateHealthCheck validates the health check, that may not have been
+// validated by the CRD schema if configured with annotations, and sets the
+// default values of its optional fields.
+func validateHealthCheck(healthCheck *v1.HealthCheckSpec) error {
+	if healthCheck == nil {
+		return errors.New("health check can't be nil")
+	}
+
+	if healthCheck.Endpoint == "" {
+		return errors.New("endpoint is a required value to configure health checks")
+	}
+	if healthCheck.Protocol == nil {
+		defaultProtocol := dns.HealthCheckProtocolHTTP
+		healthCheck.Protocol = &defaultProtocol
 	}
+	if healthCheck.Port == nil && *healthCheck.Protocol == dns.HealthCheckProtocolTCP {
+		return errors.New("port is a required value to configure TCP health checks")
+	}
+	if healthCheck.Port == nil {
+		port := int64(80)
+		if *healthCheck.Protocol == dns.HealthCheckProtocolHTTPS {
+			port = 443
+		}
+		healthCheck.Port = &port
+	}
+	if *healthCheck.Port < 1 || *healthCheck.Port > 65535 {
+		return fmt.Errorf("invalid health check port %d", *healthCheck.Port)
+	}
+	if healthCheck.FailureThreshold != nil && *healthCheck.FailureThreshold < 1 {
+		return fmt.Errorf("invalid health check failure threshold %d", *healthCheck.FailureThreshold)
+	}
+	if healthCheck.Interval != nil && healthCheck.Interval.Duration <= 0 {
+		return fmt.Errorf("invalid health check interval %s", healthCheck.Interval.Duration)
+	}
+	if healthCheck.HealthThreshold != nil && *healthCheck.HealthThreshold < 0 {
+		return fmt.Errorf("invalid health check health threshold %d", *healthCheck.HealthThreshold)
+	}
+
+	return nil
 }
@@ -0,0 +1,353 @@
+package dns
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	awsdns "github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	azuredns "github.com/kuadrant/kcp-glbc/pkg/dns/azure"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/embedded"
+	googledns "github.com/kuadrant/kcp-glbc/pkg/dns/google"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/prober"
+)
+
+// healthCheckProperties are the provider specific properties the health check
+// reconcilers record the health check of an endpoint with, that are shared by
+// the endpoints sharing a health check.
+var healthCheckProperties = []string{
+	awsdns.ProviderSpecificHealthCheckID,
+	awsdns.ProviderSpecificTargetHealthCheckIDs,
+	azuredns.ProviderSpecificMonitorProtocol,
+	azuredns.ProviderSpecificMonitorPort,
+	azuredns.ProviderSpecificMonitorPath,
+	azuredns.ProviderSpecificMonitorToleratedFailures,
+	embedded.ProviderSpecificHealthCheck,
+	googledns.ProviderSpecificHealthCheck,
+	prober.ProviderSpecificHealthCheck,
+}
+
+// healthCheckKey identifies the probes of a health check, i.e., the load
+// balancer it probes, the host name it probes it with, and its settings. The
+// endpoints of all the DNSRecords with the same probes share a single health
+// check, e.g., the endpoints of a host published by several DNSRecords.
+type healthCheckKey struct {
+	address  string
+	host     string
+	port     int64
+	path     string
+	protocol v1.HealthCheckProtocol
+	// settings are the other fields of the health check configuring its probes
+	settings string
+}
+
+// newHealthCheckKey returns the key of the health check of the endpoint, for
+// the validated health check of its record.
+func newHealthCheckKey(healthCheck *v1.HealthCheckSpec, endpoint *v1.Endpoint) healthCheckKey {
+	targets := append([]string{}, endpoint.Targets...)
+	sort.Strings(targets)
+	key := healthCheckKey{
+		address:  strings.Join(targets, ","),
+		host:     strings.ToLower(strings.TrimSuffix(endpoint.DNSName, ".")),
+		port:     *healthCheck.Port,
+		path:     healthCheck.Endpoint,
+		protocol: *healthCheck.Protocol,
+		settings: healthCheckSettings(healthCheck),
+	}
+	// The TCP health checks don't send requests
+	if key.protocol == v1.HealthCheckProtocolTCP {
+		key.path = ""
+	}
+	return key
+}
+
+// healthCheckSettings returns the fields of the health check that configure
+// its probes, other than the fields of the key. The health threshold is left
+// out, as it configures the calculated health checks of the DNS names.
+func healthCheckSettings(healthCheck *v1.HealthCheckSpec) string {
+	settings := healthCheck.DeepCopy()
+	settings.Endpoint = ""
+	settings.Port = nil
+	settings.Protocol = nil
+	settings.HealthThreshold = nil
+	sort.Strings(settings.Regions)
+	// Marshalling the spec can't fail, and the fields are in a fixed order
+	value, _ := json.Marshal(settings)
+	return string(value)
+}
+
+// id returns the ID of the health check, that's the same for all its users.
+func (k healthCheckKey) id() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s://%s:%d%s@%s?%s", k.protocol, k.address, k.port, k.path, k.host, k.settings))))
+}
+
+// healthCheckUser is an endpoint of a DNSRecord that uses a health check.
+type healthCheckUser struct {
+	dnsRecord string
+	endpoint  string
+}
+
+func newHealthCheckUser(dnsRecord string, endpoint *v1.Endpoint) healthCheckUser {
+	return healthCheckUser{
+		dnsRecord: dnsRecord,
+		endpoint:  fmt.Sprintf("%s/%s@%s", endpoint.RecordType, endpoint.SetIdentifier, endpoint.DNSName),
+	}
+}
+
+// sharedHealthCheck is a health check of the DNS provider, and its users.
+type sharedHealthCheck struct {
+	users map[healthCheckUser]bool
+	// owner is the user the health check is reconciled for, so that it's
+	// configured with the settings of a single DNSRecord
+	owner healthCheckUser
+	// endpoint holds the provider specific properties of the health check,
+	// once reconciled by its owner
+	endpoint *v1.Endpoint
+}
+
+// healthCheckRegistry counts the users of the health checks of the DNS
+// provider, so that the same probes are run by a single health check,
+// that's only deleted once its last user is gone.
+type healthCheckRegistry struct {
+	mu     sync.Mutex
+	checks map[healthCheckKey]*sharedHealthCheck
+	// keys are the keys of the health checks of the users
+	keys map[healthCheckUser]healthCheckKey
+}
+
+func newHealthCheckRegistry() *healthCheckRegistry {
+	return &healthCheckRegistry{
+		checks: map[healthCheckKey]*sharedHealthCheck{},
+		keys:   map[healthCheckUser]healthCheckKey{},
+	}
+}
+
+// register records the user of the health check, along with the provider
+// specific properties of its endpoint, if the health check doesn't have any
+// yet. It's used to restore the registry from the existing DNSRecords.
+func (r *healthCheckRegistry) register(key healthCheckKey, user healthCheckUser, endpoint *v1.Endpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	check := r.add(key, user)
+	if check.endpoint == nil && hasHealthCheckProperties(endpoint) {
+		check.owner = user
+		check.endpoint = healthCheckEndpoint(endpoint)
+	}
+}
+
+// acquire records the user of the health check, and sets the provider
+// specific properties of the health check on its endpoint. It returns whether
+// the user owns the health check, and must reconcile it with the DNS provider,
+// and the endpoints of the health checks that are not used anymore, and must
+// be deleted from the DNS provider, e.g., the health check the endpoint used
+// before its address changed.
+func (r *healthCheckRegistry) acquire(key healthCheckKey, user healthCheckUser, endpoint *v1.Endpoint) (bool, []*v1.Endpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []*v1.Endpoint
+	if previous, ok := r.keys[user]; ok && previous != key {
+		if released := r.remove(user); released != nil {
+			unused = append(unused, released)
+		}
+		clearHealthCheckProperties(endpoint)
+	}
+
+	check := r.add(key, user)
+	if check.endpoint == nil {
+		return check.owner == user, unused
+	}
+	// The health check the endpoint used before being shared
+	if stale := staleHealthCheckEndpoint(endpoint, check.endpoint); stale != nil {
+		unused = append(unused, stale)
+	}
+	copyHealthCheckProperties(check.endpoint, endpoint)
+	return check.owner == user, unused
+}
+
+// reconciled records the provider specific properties of the health check,
+// once reconciled by its owner. It returns whether they changed, and must be
+// set on the endpoints of its other users.
+func (r *healthCheckRegistry) reconciled(key healthCheckKey, user healthCheckUser, endpoint *v1.Endpoint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	check, ok := r.checks[key]
+	if !ok || check.owner != user {
+		return false
+	}
+	previous := check.endpoint
+	check.endpoint = healthCheckEndpoint(endpoint)
+	return previous == nil || staleHealthCheckEndpoint(check.endpoint, previous) != nil || staleHealthCheckEndpoint(previous, check.endpoint) != nil
+}
+
+// release removes the users of the DNSRecord, except the ones to keep, and
+// returns the endpoints of the health checks that are left without users.
+func (r *healthCheckRegistry) release(dnsRecord string, keep map[healthCheckUser]bool) []*v1.Endpoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []healthCheckUser
+	for user := range r.keys {
+		if user.dnsRecord == dnsRecord && !keep[user] {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].endpoint < users[j].endpoint })
+
+	var unused []*v1.Endpoint
+	for _, user := range users {
+		if released := r.remove(user); released != nil {
+			unused = append(unused, released)
+		}
+	}
+	return unused
+}
+
+// registered returns whether the endpoint refers to a health check of the
+// registry, i.e., whether it's used by any registered user.
+func (r *healthCheckRegistry) registered(endpoint *v1.Endpoint) bool {
+	if !hasHealthCheckProperties(endpoint) {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, check := range r.checks {
+		if check.endpoint != nil && staleHealthCheckEndpoint(endpoint, check.endpoint) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsRecordsSharing returns the keys of the other DNSRecords that share a
+// health check with the DNSRecord.
+func (r *healthCheckRegistry) dnsRecordsSharing(dnsRecord string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dnsRecords := map[string]bool{}
+	for user, key := range r.keys {
+		if user.dnsRecord != dnsRecord {
+			continue
+		}
+		for other := range r.checks[key].users {
+			if other.dnsRecord != dnsRecord {
+				dnsRecords[other.dnsRecord] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(dnsRecords))
+	for key := range dnsRecords {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// add records the user of the health check, that's owned by its first user.
+func (r *healthCheckRegistry) add(key healthCheckKey, user healthCheckUser) *sharedHealthCheck {
+	check, ok := r.checks[key]
+	if !ok {
+		check = &sharedHealthCheck{users: map[healthCheckUser]bool{}, owner: user}
+		r.checks[key] = check
+	}
+	check.users[user] = true
+	r.keys[user] = key
+	return check
+}
+
+// remove removes the user of its health check, and returns the endpoint of
+// the health check if it was its last user. The ownership of the health check
+// is handed over to another user otherwise, as the owner may be gone, along
+// with the host name the health check probes the load balancer with.
+func (r *healthCheckRegistry) remove(user healthCheckUser) *v1.Endpoint {
+	key := r.keys[user]
+	delete(r.keys, user)
+	check := r.checks[key]
+	delete(check.users, user)
+
+	if len(check.users) == 0 {
+		delete(r.checks, key)
+		return check.endpoint
+	}
+	if check.owner == user {
+		var users []healthCheckUser
+		for other := range check.users {
+			users = append(users, other)
+		}
+		sort.Slice(users, func(i, j int) bool {
+			if users[i].dnsRecord != users[j].dnsRecord {
+				return users[i].dnsRecord < users[j].dnsRecord
+			}
+			return users[i].endpoint < users[j].endpoint
+		})
+		check.owner = users[0]
+	}
+	return nil
+}
+
+// healthCheckEndpoint returns a copy of the endpoint, with only the provider
+// specific properties of its health check.
+func healthCheckEndpoint(endpoint *v1.Endpoint) *v1.Endpoint {
+	checked := &v1.Endpoint{
+		DNSName:       endpoint.DNSName,
+		RecordType:    endpoint.RecordType,
+		SetIdentifier: endpoint.SetIdentifier,
+		Targets:       append(v1.Targets{}, endpoint.Targets...),
+	}
+	copyHealthCheckProperties(endpoint, checked)
+	return checked
+}
+
+// staleHealthCheckEndpoint returns a copy of the endpoint with the provider
+// specific properties of its health check that differ from the shared ones,
+// or nil if it has none.
+func staleHealthCheckEndpoint(endpoint, shared *v1.Endpoint) *v1.Endpoint {
+	stale := healthCheckEndpoint(endpoint)
+	for _, property := range healthCheckProperties {
+		value, ok := stale.GetProviderSpecific(property)
+		if !ok {
+			continue
+		}
+		if sharedValue, ok := shared.GetProviderSpecific(property); ok && sharedValue == value {
+			stale.DeleteProviderSpecific(property)
+		}
+	}
+	if !hasHealthCheckProperties(stale) {
+		return nil
+	}
+	return stale
+}
+
+func copyHealthCheckProperties(from, to *v1.Endpoint) {
+	for _, property := range healthCheckProperties {
+		if value, ok := from.GetProviderSpecific(property); ok {
+			to.SetProviderSpecific(property, value)
+		} else {
+			to.DeleteProviderSpecific(property)
+		}
+	}
+}
+
+func clearHealthCheckProperties(endpoint *v1.Endpoint) {
+	for _, property := range healthCheckProperties {
+		endpoint.DeleteProviderSpecific(property)
+	}
+}
+
+func hasHealthCheckProperties(endpoint *v1.Endpoint) bool {
+	for _, property := range healthCheckProperties {
+		if _, ok := endpoint.GetProviderSpecific(property); ok {
+			return true
+		}
+	}
+	return false
+}
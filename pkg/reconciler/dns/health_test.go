@@ -0,0 +1,535 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	awsdns "github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+	"github.com/kuadrant/kcp-glbc/pkg/reconciler"
+)
+
+type statusProvider struct {
+	dns.FakeProvider
+	reconciler *statusHealthCheckReconciler
+}
+
+func (p *statusProvider) HealthCheckReconciler() dns.HealthCheckReconciler {
+	return p.reconciler
+}
+
+// statusHealthCheckReconciler reports the health of the endpoints by set identifier
+type statusHealthCheckReconciler struct {
+	dns.HealthCheckReconciler
+	statuses map[string]dns.HealthCheckStatus
+}
+
+func (r *statusHealthCheckReconciler) Status(_ context.Context, endpoint *v1.Endpoint) (dns.HealthCheckStatus, error) {
+	status, ok := r.statuses[endpoint.SetIdentifier]
+	if !ok {
+		return dns.HealthCheckStatus{}, errors.New("throttled")
+	}
+	return status, nil
+}
+
+func TestSetHealthCheckStatuses(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	c := &Controller{
+		Controller: &reconciler.Controller{Logger: log.Logger},
+		dnsProvider: &statusProvider{reconciler: &statusHealthCheckReconciler{
+			statuses: map[string]dns.HealthCheckStatus{
+				"10.0.0.1": {State: v1.HealthCheckStateHealthy},
+				"10.0.0.2": {State: v1.HealthCheckStateUnhealthy, Message: "Failure: Connection timed out."},
+			},
+		}},
+	}
+
+	healthy := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}}
+	unhealthy := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "10.0.0.2", Targets: v1.Targets{"10.0.0.2"}}
+	failed := &v1.Endpoint{DNSName: "app.example.com", SetIdentifier: "10.0.0.3", Targets: v1.Targets{"10.0.0.3"}}
+	// Endpoints without address are not health checked
+	unchecked := &v1.Endpoint{DNSName: "www.example.com", Targets: v1.Targets{"app.example.com"}}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{healthy, unhealthy, failed, unchecked}
+	statuses := []v1.DNSZoneStatus{
+		{DNSZone: v1.DNSZone{ID: "public"}, Endpoints: []*v1.Endpoint{healthy, unhealthy, failed, unchecked}},
+		// The record is being published to the zone, from an older generation
+		{DNSZone: v1.DNSZone{ID: "private"}, Endpoints: []*v1.Endpoint{healthy}},
+	}
+
+	// The health is not recorded until the endpoints are health checked
+	g.Expect(c.setHealthCheckStatuses(context.Background(), record, statuses)).To(gomega.BeFalse())
+	g.Expect(statuses[0].HealthChecks).To(gomega.BeEmpty())
+	g.Expect(statuses[1].HealthChecks).To(gomega.BeEmpty())
+
+	record.Spec.HealthCheck = &v1.HealthCheckSpec{Endpoint: "/healthz"}
+	g.Expect(c.setHealthCheckStatuses(context.Background(), record, statuses)).To(gomega.BeTrue())
+	g.Expect(statuses[0].HealthChecks).To(gomega.Equal([]v1.EndpointHealthCheckStatus{
+		{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", State: v1.HealthCheckStateHealthy},
+		{DNSName: "app.example.com", SetIdentifier: "10.0.0.2", State: v1.HealthCheckStateUnhealthy, Message: "Failure: Connection timed out."},
+		{DNSName: "app.example.com", SetIdentifier: "10.0.0.3", State: v1.HealthCheckStateUnknown, Message: "Failed to get the health check status: throttled"},
+	}))
+	g.Expect(statuses[1].HealthChecks).To(gomega.Equal([]v1.EndpointHealthCheckStatus{
+		{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", State: v1.HealthCheckStateHealthy},
+	}))
+
+	// The health is cleared once the health check is removed
+	record.Spec.HealthCheck = nil
+	g.Expect(c.setHealthCheckStatuses(context.Background(), record, statuses)).To(gomega.BeFalse())
+	g.Expect(statuses[0].HealthChecks).To(gomega.BeEmpty())
+}
+
+func TestRequeueInterval(t *testing.T) {
+	tests := []struct {
+		name               string
+		driftCheckInterval time.Duration
+		statusInterval     time.Duration
+		healthChecked      bool
+		want               time.Duration
+	}{
+		{name: "disabled"},
+		{name: "drift checks", driftCheckInterval: 5 * time.Minute, want: 5 * time.Minute},
+		{name: "health checks", statusInterval: time.Minute, healthChecked: true, want: time.Minute},
+		{name: "less frequent drift checks", driftCheckInterval: 5 * time.Minute, statusInterval: time.Minute, healthChecked: true, want: time.Minute},
+		{name: "more frequent drift checks", driftCheckInterval: 30 * time.Second, statusInterval: time.Minute, healthChecked: true, want: 30 * time.Second},
+		{name: "configured status interval", driftCheckInterval: 5 * time.Minute, statusInterval: 2 * time.Minute, healthChecked: true, want: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{driftCheckInterval: tt.driftCheckInterval, healthCheckStatusInterval: tt.statusInterval}
+			if got := c.requeueInterval(tt.healthChecked); got != tt.want {
+				t.Errorf("requeueInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// unhealthyProber reports the endpoints with the set identifiers as unhealthy
+type unhealthyProber struct {
+	dns.HealthCheckReconciler
+	unhealthy []string
+}
+
+func (p *unhealthyProber) Healthy(endpoint *v1.Endpoint) bool {
+	for _, setIdentifier := range p.unhealthy {
+		if endpoint.SetIdentifier == setIdentifier {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *unhealthyProber) Run(context.Context) {}
+
+func TestEndpointsToPublish(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	weighted := func(dnsName, setIdentifier string) *v1.Endpoint {
+		endpoint := &v1.Endpoint{DNSName: dnsName, RecordType: "A", SetIdentifier: setIdentifier, Targets: v1.Targets{setIdentifier}}
+		endpoint.SetProviderSpecific(awsdns.ProviderSpecificWeight, "120")
+		return endpoint
+	}
+	failover := &v1.Endpoint{DNSName: "failover.example.com", RecordType: "A", SetIdentifier: "10.0.1.1", Targets: v1.Targets{"10.0.1.1"}}
+	failover.SetProviderSpecific(awsdns.ProviderSpecificFailover, "PRIMARY")
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		weighted("app.example.com", "10.0.0.1"),
+		weighted("app.example.com", "10.0.0.2"),
+		// All the endpoints of the DNS name are unhealthy
+		weighted("www.example.com", "10.0.0.3"),
+		weighted("www.example.com", "10.0.0.4"),
+		failover,
+		{DNSName: "failover.example.com", RecordType: "A", SetIdentifier: "10.0.1.2", Targets: v1.Targets{"10.0.1.2"}},
+		// The endpoints without weight are not weighted
+		{DNSName: "simple.example.com", RecordType: "A", Targets: v1.Targets{"10.0.2.1"}},
+		{DNSName: "simple.example.com", RecordType: "A", SetIdentifier: "10.0.2.2", Targets: v1.Targets{"10.0.2.2"}},
+	}
+
+	// The endpoints are published as is, unless the GLBC probes them
+	c := &Controller{}
+	g.Expect(c.endpointsToPublish(record)).To(gomega.Equal(record.Spec.Endpoints))
+
+	c.prober = &unhealthyProber{unhealthy: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.1.1", "", "10.0.2.2"}}
+	endpoints := c.endpointsToPublish(record)
+	weights := map[string]string{}
+	for _, endpoint := range endpoints {
+		weights[endpoint.SetIdentifier], _ = endpoint.GetProviderSpecific(awsdns.ProviderSpecificWeight)
+	}
+	g.Expect(weights).To(gomega.Equal(map[string]string{
+		"10.0.0.1": "120",
+		"10.0.0.2": "0",
+		"10.0.0.3": "120",
+		"10.0.0.4": "120",
+		"10.0.1.1": "",
+		"10.0.1.2": "",
+		"":         "",
+		"10.0.2.2": "",
+	}))
+	// The endpoints of the record are left unchanged
+	weight, _ := record.Spec.Endpoints[1].GetProviderSpecific(awsdns.ProviderSpecificWeight)
+	g.Expect(weight).To(gomega.Equal("120"))
+
+	g.Expect(weightsEqual(record.Spec.Endpoints, record.Spec.Endpoints)).To(gomega.BeTrue())
+	g.Expect(weightsEqual(record.Spec.Endpoints, endpoints)).To(gomega.BeFalse())
+	g.Expect(weightsEqual(record.Spec.Endpoints[:1], record.Spec.Endpoints)).To(gomega.BeFalse())
+}
+
+type calculatedProvider struct {
+	dns.FakeProvider
+	reconciler *calculatedHealthCheckReconciler
+}
+
+func (p *calculatedProvider) HealthCheckReconciler() dns.HealthCheckReconciler {
+	return p.reconciler
+}
+
+// calculatedHealthCheckReconciler records the calculated health checks by DNS name
+type calculatedHealthCheckReconciler struct {
+	dns.HealthCheckReconciler
+	calculated map[string][]string
+}
+
+func (r *calculatedHealthCheckReconciler) ReconcileCalculated(_ context.Context, spec dns.HealthCheckSpec, endpoints []*v1.Endpoint) error {
+	r.calculated[spec.Name] = nil
+	for _, endpoint := range endpoints {
+		r.calculated[spec.Name] = append(r.calculated[spec.Name], endpoint.SetIdentifier)
+	}
+	return nil
+}
+
+func (r *calculatedHealthCheckReconciler) DeleteCalculated(_ context.Context, endpoints []*v1.Endpoint) error {
+	delete(r.calculated, endpoints[0].DNSName)
+	return nil
+}
+
+func TestReconcileCalculatedHealthChecks(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	r := &calculatedHealthCheckReconciler{calculated: map[string][]string{}}
+	c := &Controller{
+		Controller:  &reconciler.Controller{Logger: log.Logger},
+		dnsProvider: &calculatedProvider{reconciler: r},
+	}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{
+		{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}},
+		{DNSName: "www.example.com", SetIdentifier: "10.0.0.2", Targets: v1.Targets{"10.0.0.2"}},
+		{DNSName: "app.example.com", SetIdentifier: "10.0.0.2", Targets: v1.Targets{"10.0.0.2"}},
+		// Endpoints without address are not health checked
+		{DNSName: "alias.example.com", Targets: v1.Targets{"app.example.com"}},
+	}
+
+	threshold := int64(1)
+	g.Expect(c.reconcileCalculatedHealthChecks(context.Background(), r, &v1.HealthCheckSpec{HealthThreshold: &threshold}, record)).To(gomega.Succeed())
+	g.Expect(r.calculated).To(gomega.Equal(map[string][]string{
+		"app.example.com": {"10.0.0.1", "10.0.0.2"},
+		"www.example.com": {"10.0.0.2"},
+	}))
+
+	// The calculated health checks are deleted once the health threshold is unset
+	g.Expect(c.reconcileCalculatedHealthChecks(context.Background(), r, &v1.HealthCheckSpec{}, record)).To(gomega.Succeed())
+	g.Expect(r.calculated).To(gomega.BeEmpty())
+}
+
+type replacingProvider struct {
+	dns.FakeProvider
+	reconciler *replacingHealthCheckReconciler
+}
+
+func (p *replacingProvider) HealthCheckReconciler() dns.HealthCheckReconciler {
+	return p.reconciler
+}
+
+// replacingHealthCheckReconciler records the endpoints whose replaced health
+// checks are deleted, with the number of published endpoints
+type replacingHealthCheckReconciler struct {
+	dns.HealthCheckReconciler
+	deleted map[string]int
+}
+
+func (r *replacingHealthCheckReconciler) DeleteReplaced(_ context.Context, endpoint *v1.Endpoint, published []*v1.Endpoint) error {
+	r.deleted[endpoint.SetIdentifier] = len(published)
+	return nil
+}
+
+func TestDeleteReplacedHealthChecks(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	r := &replacingHealthCheckReconciler{deleted: map[string]int{}}
+	c := &Controller{
+		Controller:  &reconciler.Controller{Logger: log.Logger},
+		dnsProvider: &replacingProvider{reconciler: r},
+	}
+
+	record := &v1.DNSRecord{}
+	record.Spec.Endpoints = []*v1.Endpoint{{DNSName: "app.example.com", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}}}
+	published := v1.DNSZoneCondition{Type: v1.DNSRecordFailedConditionType, Status: string(ConditionFalse)}
+	failed := v1.DNSZoneCondition{Type: v1.DNSRecordFailedConditionType, Status: string(ConditionTrue)}
+	status := func(zone, changeID string, condition v1.DNSZoneCondition) v1.DNSZoneStatus {
+		return v1.DNSZoneStatus{
+			DNSZone:    v1.DNSZone{ID: zone},
+			Conditions: []v1.DNSZoneCondition{condition},
+			Endpoints:  record.Spec.Endpoints,
+			ChangeID:   changeID,
+		}
+	}
+
+	// The replaced health checks may still be used until the changes have
+	// propagated to all the zones
+	g.Expect(c.deleteReplacedHealthChecks(ctx, record, []v1.DNSZoneStatus{status("a", "", published), status("b", "change", published)})).To(gomega.Succeed())
+	g.Expect(r.deleted).To(gomega.BeEmpty())
+	g.Expect(c.deleteReplacedHealthChecks(ctx, record, []v1.DNSZoneStatus{status("a", "", published), status("b", "", failed)})).To(gomega.Succeed())
+	g.Expect(r.deleted).To(gomega.BeEmpty())
+
+	g.Expect(c.deleteReplacedHealthChecks(ctx, record, []v1.DNSZoneStatus{status("a", "", published), status("b", "", published)})).To(gomega.Succeed())
+	g.Expect(r.deleted).To(gomega.Equal(map[string]int{"10.0.0.1": 2}))
+}
+
+type sharingProvider struct {
+	dns.FakeProvider
+	reconciler *countingHealthCheckReconciler
+}
+
+func (p *sharingProvider) HealthCheckReconciler() dns.HealthCheckReconciler {
+	return p.reconciler
+}
+
+// countingHealthCheckReconciler records the DNSRecord of the health checks by ID
+type countingHealthCheckReconciler struct {
+	dns.HealthCheckReconciler
+	created    int
+	dnsRecords map[string]string
+}
+
+func (r *countingHealthCheckReconciler) Reconcile(_ context.Context, spec dns.HealthCheckSpec, endpoint *v1.Endpoint) error {
+	id, ok := endpoint.GetProviderSpecific(awsdns.ProviderSpecificHealthCheckID)
+	if _, exists := r.dnsRecords[id]; !ok || !exists {
+		r.created++
+		id = fmt.Sprintf("hc-%d", r.created)
+		endpoint.SetProviderSpecific(awsdns.ProviderSpecificHealthCheckID, id)
+	}
+	r.dnsRecords[id] = spec.DNSRecord
+	return nil
+}
+
+func (r *countingHealthCheckReconciler) Delete(_ context.Context, endpoint *v1.Endpoint) error {
+	id, _ := endpoint.GetProviderSpecific(awsdns.ProviderSpecificHealthCheckID)
+	delete(r.dnsRecords, id)
+	endpoint.DeleteProviderSpecific(awsdns.ProviderSpecificHealthCheckID)
+	return nil
+}
+
+func TestSharedHealthChecks(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	r := &countingHealthCheckReconciler{dnsRecords: map[string]string{}}
+	newController := func(records ...*v1.DNSRecord) *Controller {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, record := range records {
+			g.Expect(indexer.Add(record)).To(gomega.Succeed())
+		}
+		c := &Controller{
+			Controller: &reconciler.Controller{
+				Logger: log.Logger,
+				Queue:  workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+			},
+			dnsProvider:  &sharingProvider{reconciler: r},
+			indexer:      indexer,
+			healthChecks: newHealthCheckRegistry(),
+		}
+		c.registerHealthChecks()
+		return c
+	}
+	record := func(name, host, path string, targets ...string) *v1.DNSRecord {
+		record := &v1.DNSRecord{}
+		record.Namespace, record.Name = "default", name
+		record.Spec.HealthCheck = &v1.HealthCheckSpec{Endpoint: path}
+		for _, target := range targets {
+			record.Spec.Endpoints = append(record.Spec.Endpoints, &v1.Endpoint{DNSName: host, RecordType: "A", SetIdentifier: target, Targets: v1.Targets{target}})
+		}
+		return record
+	}
+	healthCheckId := func(endpoint *v1.Endpoint) string {
+		id, _ := endpoint.GetProviderSpecific(awsdns.ProviderSpecificHealthCheckID)
+		return id
+	}
+	published := func(record *v1.DNSRecord) {
+		record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: v1.DNSZone{ID: "public"}, Endpoints: record.Spec.DeepCopy().Endpoints}}
+	}
+
+	a := record("a", "app.example.com", "/healthz", "10.0.0.1", "10.0.0.2")
+	b := record("b", "app.example.com", "/healthz", "10.0.0.1")
+	// Another path, or another host, of the same load balancer is probed by another health check
+	c := record("c", "app.example.com", "/ready", "10.0.0.1")
+	d := record("d", "other.example.com", "/healthz", "10.0.0.1")
+	// As well as the same path with other settings
+	e := record("e", "app.example.com", "/healthz", "10.0.0.1")
+	threshold := int64(5)
+	e.Spec.HealthCheck.FailureThreshold = &threshold
+
+	controller := newController()
+	for _, record := range []*v1.DNSRecord{a, b, c, d, e} {
+		g.Expect(controller.ReconcileHealthChecks(ctx, record)).To(gomega.Succeed())
+		published(record)
+	}
+	g.Expect(r.dnsRecords).To(gomega.Equal(map[string]string{"hc-1": "default/a", "hc-2": "default/a", "hc-3": "default/c", "hc-4": "default/d", "hc-5": "default/e"}))
+	g.Expect(healthCheckId(b.Spec.Endpoints[0])).To(gomega.Equal("hc-1"))
+
+	// The health checks of the endpoints removed from the record are deleted, once unused
+	a.Spec.Endpoints = a.Spec.Endpoints[:1]
+	g.Expect(controller.ReconcileHealthChecks(ctx, a)).To(gomega.Succeed())
+	published(a)
+	g.Expect(r.dnsRecords).To(gomega.HaveLen(4))
+	g.Expect(r.dnsRecords).To(gomega.HaveKey("hc-1"))
+
+	// The users of the health checks are restored from the existing records
+	controller = newController(a, b, c, d, e)
+
+	// The shared health check is kept until its last user is gone
+	g.Expect(controller.reconcileHealthCheckDeletion(ctx, a)).To(gomega.Succeed())
+	g.Expect(r.dnsRecords).To(gomega.HaveKey("hc-1"))
+	g.Expect(healthCheckId(a.Status.Zones[0].Endpoints[0])).To(gomega.BeEmpty())
+
+	// And reconciled for one of its remaining users
+	g.Expect(controller.ReconcileHealthChecks(ctx, b)).To(gomega.Succeed())
+	g.Expect(r.dnsRecords).To(gomega.HaveKeyWithValue("hc-1", "default/b"))
+	g.Expect(r.created).To(gomega.Equal(5))
+
+	g.Expect(controller.reconcileHealthCheckDeletion(ctx, b)).To(gomega.Succeed())
+	g.Expect(r.dnsRecords).To(gomega.Equal(map[string]string{"hc-3": "default/c", "hc-4": "default/d", "hc-5": "default/e"}))
+}
+
+func TestSharedHealthCheckPublished(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	newRecord := func(name string) *v1.DNSRecord {
+		record := &v1.DNSRecord{}
+		record.Namespace, record.Name = "default", name
+		record.Spec.HealthCheck = &v1.HealthCheckSpec{Endpoint: "/healthz"}
+		record.Spec.Endpoints = []*v1.Endpoint{{DNSName: "app.example.com", RecordType: "A", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}}}
+		return record
+	}
+	a, b := newRecord("a"), newRecord("b")
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	r := &countingHealthCheckReconciler{dnsRecords: map[string]string{}}
+	c := &Controller{
+		Controller:   &reconciler.Controller{Logger: log.Logger, Queue: queue},
+		dnsProvider:  &sharingProvider{reconciler: r},
+		healthChecks: newHealthCheckRegistry(),
+	}
+	// Both records are restored before their health check is created
+	for _, record := range []*v1.DNSRecord{a, b} {
+		healthCheck, err := healthCheckForRecord(record)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(validateHealthCheck(healthCheck)).To(gomega.Succeed())
+		endpoint := record.Spec.Endpoints[0]
+		c.healthChecks.register(newHealthCheckKey(healthCheck, endpoint), newHealthCheckUser(dns.DNSRecordKey(record), endpoint), endpoint)
+	}
+
+	// The record that doesn't own the shared health check has no ID to publish yet
+	g.Expect(c.ReconcileHealthChecks(ctx, b)).To(gomega.Succeed())
+	g.Expect(b.Spec.Endpoints[0].ProviderSpecific).To(gomega.BeEmpty())
+	g.Expect(queue.Len()).To(gomega.Equal(0))
+
+	// It's queued once the health check is created, and publishes its ID
+	g.Expect(c.ReconcileHealthChecks(ctx, a)).To(gomega.Succeed())
+	g.Expect(queue.Len()).To(gomega.Equal(1))
+	key, _ := queue.Get()
+	g.Expect(key).To(gomega.Equal("default/b"))
+
+	g.Expect(c.ReconcileHealthChecks(ctx, b)).To(gomega.Succeed())
+	id, _ := b.Spec.Endpoints[0].GetProviderSpecific(awsdns.ProviderSpecificHealthCheckID)
+	g.Expect(id).To(gomega.Equal("hc-1"))
+
+	// The unchanged health check doesn't queue its other users again
+	g.Expect(c.ReconcileHealthChecks(ctx, a)).To(gomega.Succeed())
+	g.Expect(queue.Len()).To(gomega.Equal(0))
+}
+
+func TestHealthCheckKey(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	port, protocol, tcp := int64(80), v1.HealthCheckProtocolHTTP, v1.HealthCheckProtocolTCP
+	endpoint := &v1.Endpoint{DNSName: "App.example.com.", Targets: v1.Targets{"10.0.0.2", "10.0.0.1"}}
+	spec := &v1.HealthCheckSpec{Endpoint: "/healthz", Port: &port, Protocol: &protocol, Regions: []string{"us-east-1", "eu-west-1"}}
+	key := newHealthCheckKey(spec, endpoint)
+	g.Expect(key).To(gomega.Equal(healthCheckKey{address: "10.0.0.1,10.0.0.2", host: "app.example.com", port: 80, path: "/healthz", protocol: protocol, settings: `{"endpoint":"","regions":["eu-west-1","us-east-1"]}`}))
+
+	// The path of the TCP health checks is ignored
+	tcpKey := newHealthCheckKey(&v1.HealthCheckSpec{Endpoint: "/healthz", Port: &port, Protocol: &tcp}, endpoint)
+	g.Expect(tcpKey.path).To(gomega.BeEmpty())
+	g.Expect(tcpKey.id()).NotTo(gomega.Equal(key.id()))
+
+	// The host name the load balancer is probed with is part of the key
+	otherHost := newHealthCheckKey(spec, &v1.Endpoint{DNSName: "other.example.com", Targets: endpoint.Targets})
+	g.Expect(otherHost.id()).NotTo(gomega.Equal(key.id()))
+
+	// So are the settings of the probes, except the order of the regions
+	threshold := int64(5)
+	otherSettings := spec.DeepCopy()
+	otherSettings.FailureThreshold = &threshold
+	g.Expect(newHealthCheckKey(otherSettings, endpoint)).NotTo(gomega.Equal(key))
+	otherRegions := spec.DeepCopy()
+	otherRegions.Regions = []string{"eu-west-1", "us-east-1"}
+	g.Expect(newHealthCheckKey(otherRegions, endpoint)).To(gomega.Equal(key))
+
+	// But not the health threshold of the calculated health checks
+	otherThreshold := spec.DeepCopy()
+	otherThreshold.HealthThreshold = &threshold
+	g.Expect(newHealthCheckKey(otherThreshold, endpoint)).To(gomega.Equal(key))
+}
+
+func TestHealthCheckReconcilersPerZone(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	zones, err := dns.NewZoneRegistry(
+		dns.Zone{DNSZone: v1.DNSZone{ID: "default"}, Domain: "example.com"},
+		dns.Zone{DNSZone: v1.DNSZone{ID: "other"}, Domain: "example.net", Provider: "other"},
+	)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	defaultReconciler := &countingHealthCheckReconciler{dnsRecords: map[string]string{}}
+	otherReconciler := &countingHealthCheckReconciler{dnsRecords: map[string]string{}}
+	defaultProvider := &sharingProvider{reconciler: defaultReconciler}
+	c := &Controller{
+		Controller:   &reconciler.Controller{Logger: log.Logger},
+		dnsProvider:  defaultProvider,
+		dnsProviders: map[string]dns.Provider{"": defaultProvider, "other": &sharingProvider{reconciler: otherReconciler}},
+		zones:        zones,
+		healthChecks: newHealthCheckRegistry(),
+	}
+
+	record := &v1.DNSRecord{}
+	record.Namespace, record.Name = "default", "app"
+	record.Spec.HealthCheck = &v1.HealthCheckSpec{Endpoint: "/healthz"}
+	record.Spec.Endpoints = []*v1.Endpoint{{DNSName: "app.example.net", RecordType: "A", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}}}
+
+	// The health checks are reconciled by the DNS provider of the zone of the record
+	g.Expect(c.ReconcileHealthChecks(ctx, record)).To(gomega.Succeed())
+	g.Expect(otherReconciler.dnsRecords).To(gomega.Equal(map[string]string{"hc-1": "default/app"}))
+	g.Expect(defaultReconciler.dnsRecords).To(gomega.BeEmpty())
+
+	record.Status.Zones = []v1.DNSZoneStatus{{DNSZone: v1.DNSZone{ID: "other"}, Endpoints: record.Spec.DeepCopy().Endpoints}}
+	record.Spec.HealthCheck = nil
+	g.Expect(c.ReconcileHealthChecks(ctx, record)).To(gomega.Succeed())
+	g.Expect(otherReconciler.dnsRecords).To(gomega.BeEmpty())
+}
@@ -0,0 +1,25 @@
+package dns
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kuadrant/kcp-glbc/pkg/metrics"
+)
+
+var (
+	// dnsRecordDriftTotal is a prometheus counter metrics which holds the total
+	// number of drifts detected between the published DNS records and the
+	// records of the DNS providers.
+	dnsRecordDriftTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "glbc_dns_record_drift_total",
+			Help: "GLBC DNS record total number of drifts from the published endpoints",
+		})
+)
+
+func init() {
+	// Register metrics with the global prometheus registry
+	metrics.Registry.MustRegister(
+		dnsRecordDriftTotal,
+	)
+}
@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+)
+
+// OrphanSweeperConfig is the configuration of the deletion of the resources
+// of the DNS providers that outlive the DNSRecord they were created for.
+type OrphanSweeperConfig struct {
+	// Interval is the interval the orphaned resources are looked for at, zero to disable
+	Interval time.Duration
+	// GracePeriod is the time a resource must stay orphaned for, before being deleted
+	GracePeriod time.Duration
+	// DryRun only logs the orphaned resources, rather than deleting them
+	DryRun bool
+}
+
+// runOrphanSweeper looks for orphaned resources, at the sweeper interval,
+// until the context is done.
+func (c *Controller) runOrphanSweeper(ctx context.Context) {
+	if c.orphanSweeper.Interval <= 0 {
+		return
+	}
+	c.Logger.Info("Starting orphaned DNS resources sweeper", "interval", c.orphanSweeper.Interval, "gracePeriod", c.orphanSweeper.GracePeriod, "dryRun", c.orphanSweeper.DryRun)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		c.sweepOrphans()
+	}, c.orphanSweeper.Interval)
+}
+
+// sweepOrphans lists the resources owned by the GLBC instance, for each DNS
+// provider that can identify them, and deletes the resources that have been
+// orphaned for longer than the grace period, i.e., whose DNSRecord doesn't
+// exist anymore, or doesn't use them anymore.
+func (c *Controller) sweepOrphans() {
+	now := clock.Now()
+	orphans := map[string]time.Time{}
+
+	for name, provider := range c.dnsProviders {
+		owner, ok := provider.(dns.ResourceOwner)
+		if !ok {
+			continue
+		}
+		resources, err := owner.OwnedResources(c.zonesForProvider(provider))
+		if err != nil {
+			c.Logger.Error(err, "Failed to list the resources of the DNS provider", "provider", name)
+			// Keep the orphans of the provider until the next sweep
+			for key, since := range c.orphans {
+				if strings.HasPrefix(key, name+"/") {
+					orphans[key] = since
+				}
+			}
+			continue
+		}
+
+		for _, resource := range resources {
+			if !c.isOrphan(owner, resource) {
+				continue
+			}
+			key := orphanKey(name, resource)
+			since, ok := c.orphans[key]
+			if !ok {
+				c.Logger.Info("Found orphaned DNS resource", "resource", resource.String(), "dnsRecord", resource.DNSRecord)
+				since = now
+			}
+			if now.Sub(since) < c.orphanSweeper.GracePeriod {
+				orphans[key] = since
+				continue
+			}
+			if c.orphanSweeper.DryRun {
+				c.Logger.Info("Skipping deletion of orphaned DNS resource in dry-run mode", "resource", resource.String(), "dnsRecord", resource.DNSRecord)
+				orphans[key] = since
+				continue
+			}
+			if err := owner.DeleteOwnedResource(resource); err != nil {
+				c.Logger.Error(err, "Failed to delete orphaned DNS resource", "resource", resource.String(), "dnsRecord", resource.DNSRecord)
+				orphans[key] = since
+				continue
+			}
+			c.Logger.Info("Deleted orphaned DNS resource", "resource", resource.String(), "dnsRecord", resource.DNSRecord)
+		}
+	}
+
+	c.orphans = orphans
+}
+
+// isOrphan returns whether the DNSRecord the resource was created for doesn't
+// exist anymore, or doesn't use the resource anymore. The health checks are
+// shared by the DNSRecords probing the same load balancer, so they are only
+// orphaned once no DNSRecord uses them.
+func (c *Controller) isOrphan(owner dns.ResourceOwner, resource dns.OwnedResource) bool {
+	obj, exists, err := c.indexer.GetByKey(resource.DNSRecord)
+	if err != nil {
+		c.Logger.Error(err, "Failed to get the DNSRecord of the DNS resource", "resource", resource.String(), "dnsRecord", resource.DNSRecord)
+		return false
+	}
+	if exists {
+		record := obj.(*v1.DNSRecord)
+		// The resources of the DNSRecords being deleted are deleted by the controller
+		if record.DeletionTimestamp != nil || owner.ResourceInUse(resource, record) {
+			return false
+		}
+	}
+	if resource.Kind != dns.OwnedResourceKindHealthCheck {
+		return true
+	}
+	for _, obj := range c.indexer.List() {
+		if owner.ResourceInUse(resource, obj.(*v1.DNSRecord)) {
+			return false
+		}
+	}
+	return true
+}
+
+// zonesForProvider returns the zones whose DNS provider is the provider.
+func (c *Controller) zonesForProvider(provider dns.Provider) []v1.DNSZone {
+	var zones []v1.DNSZone
+	for _, zone := range c.zones.Zones() {
+		if c.providerForZone(zone.DNSZone) == provider {
+			zones = append(zones, zone.DNSZone)
+		}
+	}
+	return zones
+}
+
+// orphanKey returns the key that identifies the resource of the DNS provider
+// across sweeps.
+func orphanKey(provider string, resource dns.OwnedResource) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", provider, resource.Kind, resource.Zone.ID, resource.ID, resource.DNSRecord)
+}
@@ -0,0 +1,174 @@
+package domainverification
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	kuadrantv1 "github.com/kuadrant/kcp-glbc/pkg/client/kuadrant/clientset/versioned"
+	"github.com/kuadrant/kcp-glbc/pkg/client/kuadrant/informers/externalversions"
+	"github.com/kuadrant/kcp-glbc/pkg/net"
+	"github.com/kuadrant/kcp-glbc/pkg/reconciler"
+)
+
+const (
+	controllerName = "kcp-glbc-domain-verification"
+
+	DefaultCheckInterval         = time.Minute
+	DefaultVerifiedCheckInterval = time.Hour
+
+	// verificationsByLogicalCluster is the name of the index of the
+	// DomainVerifications by logical cluster
+	verificationsByLogicalCluster = "logicalCluster"
+)
+
+// NewController returns a new Controller which reconciles DomainVerification.
+func NewController(config *ControllerConfig) (*Controller, error) {
+	if len(config.TokenSecret) == 0 {
+		return nil, fmt.Errorf("the secret of the domain verification tokens is required")
+	}
+
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+	c := &Controller{
+		Controller:            reconciler.NewController(controllerName, queue),
+		kuadrantClient:        config.KuadrantClient,
+		sharedInformerFactory: config.SharedInformerFactory,
+		hostResolver:          net.NewSafeHostResolver(config.HostResolver),
+		checkInterval:         config.CheckInterval,
+		verifiedCheckInterval: config.VerifiedCheckInterval,
+		tokenSecret:           config.TokenSecret,
+		now:                   time.Now,
+		verified:              newVerifiedStatuses(),
+	}
+	if c.checkInterval <= 0 {
+		c.checkInterval = DefaultCheckInterval
+	}
+	if c.verifiedCheckInterval <= 0 {
+		c.verifiedCheckInterval = DefaultVerifiedCheckInterval
+	}
+	c.Process = c.process
+
+	c.sharedInformerFactory.Kuadrant().V1().DomainVerifications().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { c.Enqueue(obj) },
+		UpdateFunc: func(old, obj interface{}) {
+			if old.(*v1.DomainVerification).ResourceVersion != obj.(*v1.DomainVerification).ResourceVersion {
+				c.Enqueue(obj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) { c.Enqueue(obj) },
+	})
+
+	c.indexer = c.sharedInformerFactory.Kuadrant().V1().DomainVerifications().Informer().GetIndexer()
+	if err := c.indexer.AddIndexers(cache.Indexers{verificationsByLogicalCluster: indexByLogicalCluster}); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type ControllerConfig struct {
+	KuadrantClient        kuadrantv1.ClusterInterface
+	SharedInformerFactory externalversions.SharedInformerFactory
+	// The resolver the TXT records of the domains are looked up with
+	HostResolver net.HostResolver
+	// The interval the TXT records of the domains not verified yet are checked at
+	CheckInterval time.Duration
+	// The interval the TXT records of the verified domains are checked at
+	VerifiedCheckInterval time.Duration
+	// The secret the tokens of the domains are computed with
+	TokenSecret []byte
+}
+
+type Controller struct {
+	*reconciler.Controller
+	sharedInformerFactory externalversions.SharedInformerFactory
+	kuadrantClient        kuadrantv1.ClusterInterface
+	indexer               cache.Indexer
+	hostResolver          net.HostResolver
+	checkInterval         time.Duration
+	verifiedCheckInterval time.Duration
+	tokenSecret           []byte
+	now                   func() time.Time
+	verified              *verifiedStatuses
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	object, exists, err := c.indexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		c.verified.forget(key)
+		return nil
+	}
+
+	current := object.(*v1.DomainVerification)
+	target := current.DeepCopy()
+
+	requeueAfter, err := c.reconcile(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if !equality.Semantic.DeepEqual(current.Status, target.Status) {
+		_, err := c.kuadrantClient.Cluster(logicalcluster.From(target)).KuadrantV1().DomainVerifications().UpdateStatus(ctx, target, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	if requeueAfter > 0 {
+		c.EnqueueAfter(target, requeueAfter)
+	}
+
+	return nil
+}
+
+// IsDomainVerified returns whether the host is within a domain whose ownership
+// has been verified by the controller for the logical cluster. An error is
+// returned while a domain of the host, verified according to the status of its
+// DomainVerification, hasn't been checked since the controller started, so
+// that the custom hosts of the verified domains are kept until checked again.
+func (c *Controller) IsDomainVerified(cluster logicalcluster.Name, host string) (bool, error) {
+	verifications, err := c.indexer.ByIndex(verificationsByLogicalCluster, cluster.String())
+	if err != nil {
+		return false, err
+	}
+	var unchecked []string
+	for _, obj := range verifications {
+		verification := obj.(*v1.DomainVerification)
+		if !verification.CoversHost(host) {
+			continue
+		}
+		if c.verified.trusted(verification) {
+			return true, nil
+		}
+		if verification.Status.Verified && !c.verified.checked(verification) {
+			unchecked = append(unchecked, verification.Spec.Domain)
+		}
+	}
+	if len(unchecked) > 0 {
+		return false, fmt.Errorf("the ownership of domain %s is not checked yet", strings.Join(unchecked, ", "))
+	}
+	return false, nil
+}
+
+// indexByLogicalCluster indexes the objects by logical cluster.
+func indexByLogicalCluster(obj interface{}) ([]string, error) {
+	metaObj, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []string{logicalcluster.From(metaObj).String()}, nil
+}
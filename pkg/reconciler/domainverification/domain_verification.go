@@ -0,0 +1,184 @@
+package domainverification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/net"
+)
+
+// reconcile sets the token of the domain, and checks whether its TXT record
+// resolves to the token, until the domain is verified, and then periodically,
+// as long as it's verified. It returns the time after which the domain must
+// be checked again.
+func (c *Controller) reconcile(ctx context.Context, verification *v1.DomainVerification) (time.Duration, error) {
+	// The ownership is verified again for another domain
+	if verification.Status.Domain != verification.Spec.Domain {
+		verification.Status = v1.DomainVerificationStatus{Domain: verification.Spec.Domain}
+	}
+
+	// The token is computed again rather than read from the status, that can
+	// be updated by the users of the workspace
+	verification.Status.Token = c.token(verification)
+
+	// Only the domains checked by the controller are verified, while the
+	// domains not checked since it started are checked right away
+	now := c.now()
+	if next := verification.Status.NextCheck; next != nil && now.Before(next.Time) && c.verified.checked(verification) {
+		verification.Status.Verified = c.verified.trusted(verification)
+		return next.Sub(now), nil
+	}
+
+	verification.Status.LastChecked = &metav1.Time{Time: now}
+	err := c.verify(ctx, verification)
+	switch {
+	case err == nil:
+		if !c.verified.trusted(verification) {
+			c.Logger.Info("Domain verified", "domain", verification.Spec.Domain)
+		}
+		c.verified.record(verification, true)
+		verification.Status.Verified = true
+		verification.Status.Message = ""
+		verification.Status.NextCheck = &metav1.Time{Time: now.Add(c.verifiedCheckInterval)}
+		return c.verifiedCheckInterval, nil
+
+	case c.verified.trusted(verification) && !confirmed(err):
+		// A verified domain is kept verified while its TXT record can't be
+		// looked up, until it's confirmed to be missing
+		c.Logger.Info("Failed to check verified domain", "domain", verification.Spec.Domain, "reason", err.Error())
+
+	default:
+		if c.verified.trusted(verification) {
+			c.Logger.Info("Domain not verified anymore", "domain", verification.Spec.Domain, "reason", err.Error())
+		} else {
+			c.Logger.V(3).Info("Domain not verified", "domain", verification.Spec.Domain, "reason", err.Error())
+		}
+		c.verified.record(verification, false)
+		verification.Status.Verified = false
+	}
+	verification.Status.Message = err.Error()
+	verification.Status.NextCheck = &metav1.Time{Time: now.Add(c.checkInterval)}
+	return c.checkInterval, nil
+}
+
+// verify returns an error describing why the ownership of the domain can't be
+// verified, or nil if one of the TXT records of the domain is the token.
+func (c *Controller) verify(ctx context.Context, verification *v1.DomainVerification) error {
+	name := verification.TXTRecordName()
+	records, err := c.hostResolver.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("TXT record %s with the token as value not found: %w", name, err)
+	}
+	token := c.token(verification)
+	for _, record := range records {
+		if hmac.Equal([]byte(record), []byte(token)) {
+			return nil
+		}
+	}
+	return &tokenNotFoundError{name: name}
+}
+
+// tokenNotFoundError is returned when none of the TXT records of the domain is
+// the token.
+type tokenNotFoundError struct {
+	name string
+}
+
+func (e *tokenNotFoundError) Error() string {
+	return fmt.Sprintf("TXT record %s doesn't have the token as value", e.name)
+}
+
+// confirmed returns whether the error of a check confirms that the TXT record
+// of the domain doesn't resolve to the token, rather than the lookup failing.
+func confirmed(err error) bool {
+	var tokenErr *tokenNotFoundError
+	return errors.As(err, &tokenErr) || net.IsNotFound(err)
+}
+
+// token returns the token of the DomainVerification, bound to its logical
+// cluster, name and domain with the secret of the controller, so that the
+// token of a DomainVerification can't verify another one.
+func (c *Controller) token(verification *v1.DomainVerification) string {
+	mac := hmac.New(sha256.New, c.tokenSecret)
+	for _, field := range []string{logicalcluster.From(verification).String(), verification.Name, strings.ToLower(verification.Spec.Domain)} {
+		// The fields are length-prefixed, so that their boundaries are signed
+		_, _ = fmt.Fprintf(mac, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifiedStatuses records the domains verified by the controller, so that
+// the verified statuses written by anyone else are not trusted. The status of
+// a DomainVerification can be updated by the users of its workspace.
+type verifiedStatuses struct {
+	mu sync.Mutex
+	// domains are the verified domains, by DomainVerification
+	domains map[string]string
+	// checkedKeys are the DomainVerifications checked since the controller
+	// started
+	checkedKeys map[string]bool
+}
+
+func newVerifiedStatuses() *verifiedStatuses {
+	return &verifiedStatuses{domains: map[string]string{}, checkedKeys: map[string]bool{}}
+}
+
+// record records whether the domain of the DomainVerification is verified,
+// once checked by the controller.
+func (s *verifiedStatuses) record(verification *v1.DomainVerification, verified bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := verificationKey(verification)
+	s.checkedKeys[key] = true
+	if verified {
+		s.domains[key] = verification.Spec.Domain
+	} else {
+		delete(s.domains, key)
+	}
+}
+
+// trusted returns whether the domain of the DomainVerification has been
+// verified by the controller.
+func (s *verifiedStatuses) trusted(verification *v1.DomainVerification) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domain, ok := s.domains[verificationKey(verification)]
+	return ok && domain == verification.Spec.Domain
+}
+
+// checked returns whether the DomainVerification has been checked since the
+// controller started.
+func (s *verifiedStatuses) checked(verification *v1.DomainVerification) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkedKeys[verificationKey(verification)]
+}
+
+// forget removes the deleted DomainVerification.
+func (s *verifiedStatuses) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.domains, key)
+	delete(s.checkedKeys, key)
+}
+
+func verificationKey(verification *v1.DomainVerification) string {
+	return clusters.ToClusterAwareKey(logicalcluster.From(verification), verification.Name)
+}
@@ -0,0 +1,279 @@
+package domainverification
+
+import (
+	"context"
+	"errors"
+	gonet "net"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+	"github.com/kuadrant/kcp-glbc/pkg/net"
+	"github.com/kuadrant/kcp-glbc/pkg/reconciler"
+)
+
+type fakeTXTResolver struct {
+	net.HostResolver
+	records map[string][]string
+	// err is returned by the lookups when set, e.g., as the nameservers fail
+	err     error
+	lookups int
+}
+
+func (r *fakeTXTResolver) LookupTXT(_ context.Context, host string) ([]string, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	records, ok := r.records[host]
+	if !ok {
+		return nil, &gonet.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func newTestController(resolver net.HostResolver, now *time.Time) *Controller {
+	return &Controller{
+		Controller:            &reconciler.Controller{Logger: log.Logger},
+		indexer:               cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{verificationsByLogicalCluster: indexByLogicalCluster}),
+		hostResolver:          resolver,
+		checkInterval:         time.Minute,
+		verifiedCheckInterval: time.Hour,
+		tokenSecret:           []byte("secret"),
+		now:                   func() time.Time { return *now },
+		verified:              newVerifiedStatuses(),
+	}
+}
+
+func TestReconcileDomainVerification(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	resolver := &fakeTXTResolver{records: map[string][]string{}}
+	c := newTestController(resolver, &now)
+
+	verification := &v1.DomainVerification{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:a", Name: "example"},
+		Spec:       v1.DomainVerificationSpec{Domain: "example.com"},
+	}
+
+	// The token is set, and the domain checked again later while its TXT record is missing
+	requeueAfter, err := c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(time.Minute))
+	token := verification.Status.Token
+	g.Expect(token).To(gomega.HaveLen(64))
+	g.Expect(verification.Status.Domain).To(gomega.Equal("example.com"))
+	g.Expect(verification.Status.Verified).To(gomega.BeFalse())
+	g.Expect(verification.Status.Message).To(gomega.ContainSubstring("_kuadrant-verification.example.com"))
+	g.Expect(verification.Status.LastChecked.Time).To(gomega.Equal(now))
+	g.Expect(verification.Status.NextCheck.Time).To(gomega.Equal(now.Add(time.Minute)))
+	g.Expect(resolver.lookups).To(gomega.Equal(1))
+
+	// The domain is not checked before its next check
+	now = now.Add(20 * time.Second)
+	requeueAfter, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(40 * time.Second))
+	g.Expect(resolver.lookups).To(gomega.Equal(1))
+
+	// The token is kept, and a TXT record with another value doesn't verify the domain
+	resolver.records["_kuadrant-verification.example.com"] = []string{"other"}
+	now = now.Add(time.Minute)
+	_, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(verification.Status.Token).To(gomega.Equal(token))
+	g.Expect(verification.Status.Verified).To(gomega.BeFalse())
+	g.Expect(verification.Status.Message).To(gomega.ContainSubstring("doesn't have the token as value"))
+	g.Expect(resolver.lookups).To(gomega.Equal(2))
+
+	// The domain is verified once one of its TXT records is the token
+	resolver.records["_kuadrant-verification.example.com"] = []string{"other", token}
+	now = now.Add(time.Minute)
+	requeueAfter, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(time.Hour))
+	g.Expect(verification.Status.Verified).To(gomega.BeTrue())
+	g.Expect(verification.Status.Message).To(gomega.BeEmpty())
+	g.Expect(verification.Status.NextCheck.Time).To(gomega.Equal(now.Add(time.Hour)))
+	g.Expect(resolver.lookups).To(gomega.Equal(3))
+	g.Expect(c.verified.trusted(verification)).To(gomega.BeTrue())
+
+	// And not checked again before the verified check interval
+	now = now.Add(30 * time.Minute)
+	requeueAfter, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(30 * time.Minute))
+	g.Expect(verification.Status.Verified).To(gomega.BeTrue())
+	g.Expect(resolver.lookups).To(gomega.Equal(3))
+
+	// The verified domain is kept verified while its TXT record can't be looked up
+	resolver.err = errors.New("nameservers failed")
+	now = now.Add(30 * time.Minute)
+	requeueAfter, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(time.Minute))
+	g.Expect(verification.Status.Verified).To(gomega.BeTrue())
+	g.Expect(verification.Status.Message).To(gomega.ContainSubstring("nameservers failed"))
+	g.Expect(resolver.lookups).To(gomega.Equal(4))
+	g.Expect(c.verified.trusted(verification)).To(gomega.BeTrue())
+
+	// And not verified anymore once its TXT record is removed
+	resolver.err = nil
+	delete(resolver.records, "_kuadrant-verification.example.com")
+	now = now.Add(time.Minute)
+	requeueAfter, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(time.Minute))
+	g.Expect(verification.Status.Verified).To(gomega.BeFalse())
+	g.Expect(resolver.lookups).To(gomega.Equal(5))
+	g.Expect(c.verified.trusted(verification)).To(gomega.BeFalse())
+}
+
+func TestDomainVerificationToken(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestController(&fakeTXTResolver{}, &now)
+
+	verification := func(cluster, name, domain string) *v1.DomainVerification {
+		return &v1.DomainVerification{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: cluster, Name: name},
+			Spec:       v1.DomainVerificationSpec{Domain: domain},
+		}
+	}
+
+	// The token is bound to the logical cluster, name and domain of the DomainVerification
+	token := c.token(verification("root:a", "example", "example.com"))
+	g.Expect(c.token(verification("root:a", "example", "example.com"))).To(gomega.Equal(token))
+	g.Expect(c.token(verification("root:b", "example", "example.com"))).NotTo(gomega.Equal(token))
+	g.Expect(c.token(verification("root:a", "other", "example.com"))).NotTo(gomega.Equal(token))
+	g.Expect(c.token(verification("root:a", "example", "example.org"))).NotTo(gomega.Equal(token))
+	g.Expect(c.token(verification("root:a:example", "", "example.com"))).NotTo(gomega.Equal(token))
+
+	// And to the secret of the controller
+	c.tokenSecret = []byte("other")
+	g.Expect(c.token(verification("root:a", "example", "example.com"))).NotTo(gomega.Equal(token))
+}
+
+func TestReconcileUntrustedDomainVerification(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	resolver := &fakeTXTResolver{records: map[string][]string{}}
+	c := newTestController(resolver, &now)
+
+	// A verified status the controller didn't write is checked right away,
+	// against the token computed by the controller
+	verification := &v1.DomainVerification{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:a", Name: "example"},
+		Spec:       v1.DomainVerificationSpec{Domain: "example.com"},
+		Status: v1.DomainVerificationStatus{
+			Domain:    "example.com",
+			Token:     "forged",
+			Verified:  true,
+			NextCheck: &metav1.Time{Time: now.Add(time.Hour)},
+		},
+	}
+	resolver.records["_kuadrant-verification.example.com"] = []string{"forged"}
+	requeueAfter, err := c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(requeueAfter).To(gomega.Equal(time.Minute))
+	g.Expect(verification.Status.Token).To(gomega.Equal(c.token(verification)))
+	g.Expect(verification.Status.Verified).To(gomega.BeFalse())
+	g.Expect(resolver.lookups).To(gomega.Equal(1))
+
+	// A verified status written before its next check isn't trusted
+	verification.Status.Verified = true
+	_, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(verification.Status.Verified).To(gomega.BeFalse())
+	g.Expect(resolver.lookups).To(gomega.Equal(1))
+
+	// A verified domain is kept verified once checked again, e.g., once the
+	// controller restarted
+	resolver.records["_kuadrant-verification.example.com"] = []string{c.token(verification)}
+	c.verified = newVerifiedStatuses()
+	verification.Status.Verified = true
+	_, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(verification.Status.Verified).To(gomega.BeTrue())
+	g.Expect(resolver.lookups).To(gomega.Equal(2))
+
+	// A status written for another domain is discarded, and checked again
+	verification.Status.Domain = "other.com"
+	now = now.Add(time.Minute)
+	_, err = c.reconcile(ctx, verification)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(verification.Status.Domain).To(gomega.Equal("example.com"))
+	g.Expect(verification.Status.Verified).To(gomega.BeTrue())
+	g.Expect(resolver.lookups).To(gomega.Equal(3))
+}
+
+func TestIsDomainVerified(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	resolver := &fakeTXTResolver{records: map[string][]string{}}
+	c := newTestController(resolver, &now)
+
+	verification := func(cluster, name, domain string, verified bool) *v1.DomainVerification {
+		return &v1.DomainVerification{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: cluster, Name: name},
+			Spec:       v1.DomainVerificationSpec{Domain: domain},
+			Status:     v1.DomainVerificationStatus{Domain: domain, Verified: verified},
+		}
+	}
+	verifications := []*v1.DomainVerification{
+		verification("root:a", "example.com", "example.com", false),
+		verification("root:a", "example.org", "example.org", false),
+		// The verified status of a domain not checked yet is not trusted
+		verification("root:a", "example.net", "example.net", true),
+		verification("root:b", "example.io", "example.io", false),
+	}
+	for _, v := range verifications {
+		g.Expect(c.indexer.Add(v)).To(gomega.Succeed())
+	}
+	for _, v := range []*v1.DomainVerification{verifications[0], verifications[3]} {
+		resolver.records[v.TXTRecordName()] = []string{c.token(v)}
+	}
+
+	isDomainVerified := func(host string) bool {
+		verified, err := c.IsDomainVerified(logicalcluster.New("root:a"), host)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return verified
+	}
+
+	// The domains are only verified once checked by the controller
+	g.Expect(isDomainVerified("api.example.com")).To(gomega.BeFalse())
+	_, err := c.IsDomainVerified(logicalcluster.New("root:a"), "api.example.net")
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("example.net")))
+
+	for _, v := range verifications {
+		_, err := c.reconcile(ctx, v)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+	g.Expect(isDomainVerified("api.example.com")).To(gomega.BeTrue())
+	g.Expect(isDomainVerified("example.com")).To(gomega.BeTrue())
+	g.Expect(isDomainVerified("api.example.org")).To(gomega.BeFalse())
+	g.Expect(isDomainVerified("api.example.net")).To(gomega.BeFalse())
+	g.Expect(isDomainVerified("apiexample.com")).To(gomega.BeFalse())
+	// The domains are only verified for their logical cluster
+	g.Expect(isDomainVerified("api.example.io")).To(gomega.BeFalse())
+
+	// The deleted DomainVerifications don't verify their domain anymore
+	g.Expect(c.indexer.Delete(verifications[0])).To(gomega.Succeed())
+	c.verified.forget(verificationKey(verifications[0]))
+	g.Expect(isDomainVerified("api.example.com")).To(gomega.BeFalse())
+}
@@ -3,6 +3,7 @@ package ingress
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"strings"
 	"time"
 
@@ -29,7 +30,10 @@ type certificateReconciler struct {
 	getCertificateStatus func(ctx context.Context, request tls.CertificateRequest) (tls.CertStatus, error)
 	copySecret           func(ctx context.Context, workspace logicalcluster.Name, namespace string, s *corev1.Secret) error
 	deleteSecret         func(ctx context.Context, workspace logicalcluster.Name, namespace, name string) error
-	log                  logr.Logger
+	// listCustomHostCertificates returns the certificates of the custom hosts
+	// of the ingress with the key
+	listCustomHostCertificates func(ingressKey string) ([]*certman.Certificate, error)
+	log                        logr.Logger
 }
 
 type enqueue bool
@@ -137,6 +141,26 @@ func TLSSecretName(ingress *networkingv1.Ingress) string {
 	return fmt.Sprintf("hcg-tls-%s", ingress.Name)
 }
 
+// customHostCertificateName returns the name of the certificate of the custom
+// host of the ingress.
+func customHostCertificateName(ingress *networkingv1.Ingress, host string) string {
+	return fmt.Sprintf("%s-%s", CertificateName(ingress), hostHash(host))
+}
+
+// customHostTLSSecretName returns the name of the secret of the certificate
+// of the custom host in the end user namespace.
+func customHostTLSSecretName(ingress *networkingv1.Ingress, host string) string {
+	return fmt.Sprintf("%s-%s", TLSSecretName(ingress), hostHash(host))
+}
+
+// hostHash returns a short hash of the host, that's valid in resource names
+// whatever the length of the host.
+func hostHash(host string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(host)))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
 func (r *certificateReconciler) reconcile(ctx context.Context, ingress *networkingv1.Ingress) (reconcileStatus, error) {
 	annotations := ingress.GetAnnotations()
 	if annotations == nil {
@@ -168,6 +192,10 @@ func (r *certificateReconciler) reconcile(ctx context.Context, ingress *networki
 		if err := r.deleteSecret(ctx, logicalcluster.From(ingress), ingress.Namespace, tlsSecretName); err != nil {
 			return reconcileStatusStop, err
 		}
+		// the certificates of the custom hosts are deleted along with the ingress
+		if err := r.reconcileCustomHostCertificates(ctx, ingress, key, nil); err != nil {
+			return reconcileStatusStop, err
+		}
 		return reconcileStatusContinue, nil
 	}
 
@@ -189,21 +217,7 @@ func (r *certificateReconciler) reconcile(ctx context.Context, ingress *networki
 		}
 		ingress.Annotations[annotationCertificateState] = "ready" // todo remote hardcoded string
 		//copy over the secret to the ingress namesapce
-		scopy := secret.DeepCopy()
-		scopy.SetOwnerReferences([]metav1.OwnerReference{
-			{
-				APIVersion:         networkingv1.SchemeGroupVersion.String(),
-				Kind:               "Ingress",
-				Name:               ingress.Name,
-				UID:                ingress.UID,
-				Controller:         pointer.Bool(true),
-				BlockOwnerDeletion: pointer.Bool(true),
-			},
-		})
-
-		scopy.Namespace = ingress.Namespace
-		scopy.Name = tlsSecretName
-		if err := r.copySecret(ctx, logicalcluster.From(ingress), ingress.Namespace, scopy); err != nil {
+		if err := r.copySecret(ctx, logicalcluster.From(ingress), ingress.Namespace, ingressTLSSecret(ingress, secret, tlsSecretName)); err != nil {
 			return reconcileStatusStop, err
 		}
 	}
@@ -213,26 +227,157 @@ func (r *certificateReconciler) reconcile(ctx context.Context, ingress *networki
 	// set tls setting on the ingress
 	upsertTLS(ingress, certReq.Host, tlsSecretName)
 
+	// the custom hosts pointing at the managed host have their own certificate
+	if err := r.reconcileCustomHostCertificates(ctx, ingress, key, certificateCustomHosts(ingress, tlsSecretName)); err != nil {
+		return reconcileStatusStop, err
+	}
+
 	return reconcileStatusContinue, nil
 }
 
-func removeHostsFromTLS(hostsToRemove []string, ingress *networkingv1.Ingress) {
-	for _, host := range hostsToRemove {
-		for i, tls := range ingress.Spec.TLS {
-			hosts := tls.Hosts
-			for j, ingressHost := range tls.Hosts {
-				if ingressHost == host {
-					hosts = append(hosts[:j], hosts[j+1:]...)
-				}
+// reconcileCustomHostCertificates issues a certificate for each of the custom
+// hosts, and sets its secret in the TLS section of the host once copied to the
+// namespace of the ingress. The certificates of the other custom hosts of the
+// ingress are deleted, along with their TLS sections.
+//
+// The custom hosts aren't added to the certificate of the managed host, as a
+// failed challenge of a custom host, whose DNS records are managed by the
+// user, would then prevent the certificate of the managed host from being
+// issued or renewed, and each custom host added or removed would re-issue it.
+func (r *certificateReconciler) reconcileCustomHostCertificates(ctx context.Context, ingress *networkingv1.Ingress, key string, hosts []string) error {
+	for _, host := range hosts {
+		certReq := customHostCertificateRequest(ingress, key, host)
+		err := r.createCertificate(ctx, certReq)
+		if !errors.IsAlreadyExists(err) {
+			// the ingress is requeued once the new certificate is ready
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		secret, err := r.getCertificateSecret(ctx, certReq)
+		if tls.IsCertNotReadyErr(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		secretName := customHostTLSSecretName(ingress, host)
+		if err := r.copySecret(ctx, logicalcluster.From(ingress), ingress.Namespace, ingressTLSSecret(ingress, secret, secretName)); err != nil {
+			return err
+		}
+		upsertTLS(ingress, host, secretName)
+	}
+
+	certificates, err := r.listCustomHostCertificates(key)
+	if err != nil {
+		return err
+	}
+	for _, certificate := range certificates {
+		host := certificate.Annotations[annotationCustomHost]
+		if slice.ContainsString(hosts, host) {
+			continue
+		}
+		r.log.Info("deleting certificate of custom host", "certificate", certificate.Name, "host", host)
+		if err := r.deleteCertificate(ctx, tls.CertificateRequest{Name: certificate.Name, Host: host, CustomHost: true}); err != nil {
+			return err
+		}
+		if err := r.deleteSecret(ctx, logicalcluster.From(ingress), ingress.Namespace, customHostTLSSecretName(ingress, host)); err != nil {
+			return err
+		}
+	}
+
+	var tlsList []networkingv1.IngressTLS
+	for _, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 1 && tls.SecretName == customHostTLSSecretName(ingress, tls.Hosts[0]) && !slice.ContainsString(hosts, tls.Hosts[0]) {
+			continue
+		}
+		tlsList = append(tlsList, tls)
+	}
+	ingress.Spec.TLS = tlsList
+
+	return nil
+}
+
+// customHostCertificateRequest returns the request of the certificate of the
+// custom host of the ingress.
+func customHostCertificateRequest(ingress *networkingv1.Ingress, key, host string) tls.CertificateRequest {
+	labels := map[string]string{}
+	for k, v := range ingress.GetLabels() {
+		labels[k] = v
+	}
+	labels[LABEL_HCG_MANAGED] = "true"
+	return tls.CertificateRequest{
+		Name:   customHostCertificateName(ingress, host),
+		Labels: labels,
+		Annotations: map[string]string{
+			annotationIngressKey: key,
+			annotationCustomHost: host,
+		},
+		Host:       host,
+		CustomHost: true,
+	}
+}
+
+// certificateCustomHosts returns the custom hosts of the ingress that have
+// their own certificate, i.e., the custom hosts that point at the managed
+// host, and have no TLS section with a secret of the user.
+func certificateCustomHosts(ingress *networkingv1.Ingress, secretName string) []string {
+	var hosts []string
+	for _, host := range cnameReadyHosts(ingress) {
+		custom := false
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName != secretName && tls.SecretName != customHostTLSSecretName(ingress, host) && slice.ContainsString(tls.Hosts, host) {
+				custom = true
 			}
-			// if there are no hosts remaining remove the entry for TLS
-			if len(hosts) == 0 {
-				ingress.Spec.TLS = append(ingress.Spec.TLS[:i], ingress.Spec.TLS[i+1:]...)
-			} else {
-				ingress.Spec.TLS[i].Hosts = hosts
+		}
+		if !custom {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// ingressTLSSecret returns a copy of the certificate secret, to be created in
+// the namespace of the ingress with the name.
+func ingressTLSSecret(ingress *networkingv1.Ingress, secret *corev1.Secret, name string) *corev1.Secret {
+	scopy := secret.DeepCopy()
+	scopy.SetOwnerReferences([]metav1.OwnerReference{
+		{
+			APIVersion:         networkingv1.SchemeGroupVersion.String(),
+			Kind:               "Ingress",
+			Name:               ingress.Name,
+			UID:                ingress.UID,
+			Controller:         pointer.Bool(true),
+			BlockOwnerDeletion: pointer.Bool(true),
+		},
+	})
+
+	scopy.Namespace = ingress.Namespace
+	scopy.Name = name
+	return scopy
+}
+
+func removeHostsFromTLS(hostsToRemove []string, ingress *networkingv1.Ingress) {
+	if len(hostsToRemove) == 0 {
+		return
+	}
+	var tlsList []networkingv1.IngressTLS
+	for _, tls := range ingress.Spec.TLS {
+		var hosts []string
+		for _, host := range tls.Hosts {
+			if !slice.ContainsString(hostsToRemove, host) {
+				hosts = append(hosts, host)
 			}
 		}
+		// if there are no hosts remaining remove the entry for TLS
+		if len(hosts) == 0 {
+			continue
+		}
+		tls.Hosts = hosts
+		tlsList = append(tlsList, tls)
 	}
+	ingress.Spec.TLS = tlsList
 }
 
 func upsertTLS(ingress *networkingv1.Ingress, host, secretName string) {
@@ -0,0 +1,135 @@
+package ingress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	certman "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/kcp-dev/logicalcluster"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kuadrant/kcp-glbc/pkg/tls"
+)
+
+func TestReconcileCertificateCustomHosts(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	certificates := map[string]*certman.Certificate{}
+	// the certificates of the custom hosts are not ready until issued
+	issued := map[string]bool{}
+	var deleted, copiedSecrets, deletedSecrets []string
+	reconciler := &certificateReconciler{
+		createCertificate: func(_ context.Context, request tls.CertificateRequest) error {
+			if _, ok := certificates[request.Name]; ok {
+				return errors.NewAlreadyExists(certman.Resource("certificates"), request.Name)
+			}
+			certificates[request.Name] = &certman.Certificate{
+				ObjectMeta: metav1.ObjectMeta{Name: request.Name, Annotations: request.Annotations},
+				Spec:       certman.CertificateSpec{DNSNames: []string{request.Host}},
+			}
+			return nil
+		},
+		deleteCertificate: func(_ context.Context, request tls.CertificateRequest) error {
+			deleted = append(deleted, request.Name)
+			delete(certificates, request.Name)
+			return nil
+		},
+		getCertificateSecret: func(_ context.Context, request tls.CertificateRequest) (*corev1.Secret, error) {
+			if request.CustomHost && !issued[request.Name] {
+				return nil, tls.CertNotReadyErr
+			}
+			return &corev1.Secret{}, nil
+		},
+		copySecret: func(_ context.Context, _ logicalcluster.Name, _ string, secret *corev1.Secret) error {
+			copiedSecrets = append(copiedSecrets, secret.Name)
+			return nil
+		},
+		deleteSecret: func(_ context.Context, _ logicalcluster.Name, _, name string) error {
+			deletedSecrets = append(deletedSecrets, name)
+			return nil
+		},
+		listCustomHostCertificates: func(string) ([]*certman.Certificate, error) {
+			var list []*certman.Certificate
+			for _, certificate := range certificates {
+				if certificate.Annotations[annotationCustomHost] != "" {
+					list = append(list, certificate)
+				}
+			}
+			return list, nil
+		},
+		log: logr.Discard(),
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			Annotations: map[string]string{
+				ANNOTATION_HCG_HOST:                "123.test.com",
+				ANNOTATION_HCG_CUSTOM_HOSTS_STATUS: `[{"host":"api.example.com","cname":"123.test.com","ready":true},{"host":"app.example.com","cname":"123.test.com","ready":true},{"host":"www.example.com","cname":"123.test.com","ready":false}]`,
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "123.test.com"}, {Host: "api.example.com"}, {Host: "app.example.com"}, {Host: "www.example.com"}},
+			// app.example.com has its own certificate
+			TLS: []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}, SecretName: "app-tls"}},
+		},
+	}
+
+	_, err := reconciler.reconcile(context.TODO(), ingress)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// The custom host pointing at the managed host has its own certificate,
+	// issued along with the certificate of the managed host
+	apiCertificate := customHostCertificateName(ingress, "api.example.com")
+	g.Expect(certificates).To(gomega.HaveLen(2))
+	g.Expect(certificates).To(gomega.HaveKey(CertificateName(ingress)))
+	g.Expect(certificates).To(gomega.HaveKey(apiCertificate))
+	g.Expect(certificates[apiCertificate].Spec.DNSNames).To(gomega.Equal([]string{"api.example.com"}))
+	g.Expect(certificates[CertificateName(ingress)].Spec.DNSNames).To(gomega.Equal([]string{"123.test.com"}))
+
+	tlsSections := []networkingv1.IngressTLS{
+		{Hosts: []string{"app.example.com"}, SecretName: "app-tls"},
+		{Hosts: []string{"123.test.com"}, SecretName: TLSSecretName(ingress)},
+		{Hosts: []string{"api.example.com"}, SecretName: customHostTLSSecretName(ingress, "api.example.com")},
+	}
+	g.Expect(ingress.Spec.TLS).To(gomega.Equal(tlsSections[:2]))
+
+	// The certificate of the managed host is served while the certificate of
+	// the custom host isn't issued, and the custom host has no TLS section
+	// until its secret is copied
+	_, err = reconciler.reconcile(context.TODO(), ingress)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(copiedSecrets).To(gomega.Equal([]string{TLSSecretName(ingress)}))
+	g.Expect(ingress.Spec.TLS).To(gomega.Equal(tlsSections[:2]))
+
+	// The custom host has its own TLS section once its certificate is issued
+	issued[apiCertificate] = true
+	copiedSecrets = nil
+	_, err = reconciler.reconcile(context.TODO(), ingress)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(copiedSecrets).To(gomega.Equal([]string{TLSSecretName(ingress), customHostTLSSecretName(ingress, "api.example.com")}))
+	g.Expect(ingress.Spec.TLS).To(gomega.Equal(tlsSections))
+
+	// The TLS sections are kept as the certificates are renewed
+	issued[apiCertificate] = false
+	_, err = reconciler.reconcile(context.TODO(), ingress)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(certificates).To(gomega.HaveLen(2))
+	g.Expect(ingress.Spec.TLS).To(gomega.Equal(tlsSections))
+	g.Expect(deleted).To(gomega.BeEmpty())
+	g.Expect(certificates[CertificateName(ingress)].Spec.DNSNames).To(gomega.Equal([]string{"123.test.com"}))
+
+	// The certificate of a custom host not pointing at the managed host anymore is deleted
+	ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOSTS_STATUS] = `[{"host":"api.example.com","cname":"123.test.com","ready":false}]`
+	_, err = reconciler.reconcile(context.TODO(), ingress)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(deleted).To(gomega.Equal([]string{apiCertificate}))
+	g.Expect(deletedSecrets).To(gomega.Equal([]string{customHostTLSSecretName(ingress, "api.example.com")}))
+	g.Expect(ingress.Spec.TLS).To(gomega.Equal(tlsSections[:2]))
+}
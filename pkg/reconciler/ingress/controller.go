@@ -9,14 +9,19 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	networkingv1lister "k8s.io/client-go/listers/networking/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
 	"k8s.io/client-go/util/workqueue"
 
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	workloadlister "github.com/kcp-dev/kcp/pkg/client/listers/workload/v1alpha1"
 	"github.com/kcp-dev/logicalcluster"
 
 	certman "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
@@ -27,15 +32,23 @@ import (
 	"github.com/kuadrant/kcp-glbc/pkg/net"
 	basereconciler "github.com/kuadrant/kcp-glbc/pkg/reconciler"
 	"github.com/kuadrant/kcp-glbc/pkg/tls"
+	"github.com/kuadrant/kcp-glbc/pkg/util/metadata"
+	"github.com/kuadrant/kcp-glbc/pkg/util/workloadMigration"
 )
 
 const (
 	controllerName                      = "kcp-glbc-ingress"
 	annotationIngressKey                = "kuadarant.dev/ingress-key"
 	annotationCertificateState          = "kuadrant.dev/certificate-status"
+	annotationDNSRecordState            = "kuadrant.dev/dns-record-status"
+	annotationHealthCheckState          = "kuadrant.dev/health-check-status"
+	annotationHealthCheckError          = "kuadrant.dev/health-check-error"
+	annotationCustomHost                = "kuadrant.dev/custom-host"
 	ANNOTATION_HCG_HOST                 = "kuadrant.dev/host.generated"
-	ANNOTATION_HEALTH_CHECK_PREFIX      = "kuadrant.experimental/health-"
 	ANNOTATION_HCG_CUSTOM_HOST_REPLACED = "kuadrant.dev/custom-hosts.replaced"
+	ANNOTATION_HCG_CUSTOM_HOST_PENDING  = "kuadrant.dev/custom-hosts.pending"
+	ANNOTATION_HCG_CUSTOM_HOSTS_STATUS  = "kuadrant.dev/custom-hosts.status"
+	ANNOTATION_DNS_RECORD_TYPE          = "kuadrant.experimental/dns-record-type"
 	LABEL_HCG_MANAGED                   = "kuadrant.dev/hcg.managed"
 )
 
@@ -62,6 +75,8 @@ func NewController(config *ControllerConfig) *Controller {
 		hostResolver:             hostResolver,
 		hostsWatcher:             net.NewHostsWatcher(&base.Logger, hostResolver, net.DefaultInterval),
 		customHostsEnabled:       config.CustomHostsEnabled,
+		isDomainVerified:         config.IsDomainVerified,
+		aliasLoadBalancers:       config.AliasLoadBalancers,
 		certInformerFactory:      config.CertificateInformer,
 		dnsRecordInformerFactory: config.DNSRecordInformer,
 	}
@@ -180,6 +195,21 @@ func NewController(config *ControllerConfig) *Controller {
 		},
 	})
 
+	// watch for workload clusters labels changes, as they drive the DNS routing policies
+	if config.WorkloadClusterInformer != nil {
+		c.workloadClusterLister = config.WorkloadClusterInformer.Workload().V1alpha1().WorkloadClusters().Lister()
+		config.WorkloadClusterInformer.Workload().V1alpha1().WorkloadClusters().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldCluster := oldObj.(*workloadv1alpha1.WorkloadCluster)
+				newCluster := newObj.(*workloadv1alpha1.WorkloadCluster)
+				if !equality.Semantic.DeepEqual(oldCluster.Labels, newCluster.Labels) {
+					c.Logger.V(3).Info("requeuing ingresses workload cluster labels updated", "workloadCluster", newCluster.Name)
+					c.enqueueIngressesForCluster(newCluster.Name)
+				}
+			},
+		})
+	}
+
 	//watch for DNSRecords
 	c.dnsRecordInformerFactory.Kuadrant().V1().DNSRecords().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		DeleteFunc: func(obj interface{}) {
@@ -205,6 +235,26 @@ func NewController(config *ControllerConfig) *Controller {
 		},
 	})
 
+	// watch for the domains being verified, so that their custom hosts are restored
+	c.dnsRecordInformerFactory.Kuadrant().V1().DomainVerifications().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldVerification := oldObj.(*kuadrantv1.DomainVerification)
+			newVerification := newObj.(*kuadrantv1.DomainVerification)
+			if oldVerification.Status.Verified != newVerification.Status.Verified || oldVerification.Status.Domain != newVerification.Status.Domain {
+				c.Logger.V(3).Info("requeuing ingresses domain verification updated", "cluster", logicalcluster.From(newVerification), "domain", newVerification.Spec.Domain)
+				c.enqueueIngressesForLogicalCluster(logicalcluster.From(newVerification))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			verification, ok := obj.(*kuadrantv1.DomainVerification)
+			if !ok {
+				return
+			}
+			c.Logger.V(3).Info("requeuing ingresses domain verification deleted", "cluster", logicalcluster.From(verification), "domain", verification.Spec.Domain)
+			c.enqueueIngressesForLogicalCluster(logicalcluster.From(verification))
+		},
+	})
+
 	return c
 }
 
@@ -220,6 +270,15 @@ type ControllerConfig struct {
 	CertProvider             tls.Provider
 	HostResolver             net.HostResolver
 	CustomHostsEnabled       bool
+	// Returns whether the host is within a domain verified for the logical
+	// cluster, by the DomainVerification controller
+	IsDomainVerified func(cluster logicalcluster.Name, host string) (bool, error)
+	// Returns whether the AWS load-balancer hostnames of the managed host are
+	// published as Route53 ALIAS records, i.e., whether the managed host is
+	// published to Route53 hosted zones only
+	AliasLoadBalancers func(host string) bool
+	// Optional informer for the workload clusters, whose labels drive the DNS routing policies
+	WorkloadClusterInformer kcpinformer.SharedInformerFactory
 }
 
 type Controller struct {
@@ -235,9 +294,12 @@ type Controller struct {
 	hostResolver             net.HostResolver
 	hostsWatcher             *net.HostsWatcher
 	customHostsEnabled       bool
+	aliasLoadBalancers       func(host string) bool
 	certInformerFactory      certmaninformer.SharedInformerFactory
 	glbcInformerFactory      informers.SharedInformerFactory
 	dnsRecordInformerFactory dnsrecordinformer.SharedInformerFactory
+	workloadClusterLister    workloadlister.WorkloadClusterLister
+	isDomainVerified         func(cluster logicalcluster.Name, host string) (bool, error)
 }
 
 func (c *Controller) enqueueIngressByKey(key string) {
@@ -253,6 +315,67 @@ func (c *Controller) enqueueIngressByKey(key string) {
 	c.Enqueue(ingress)
 }
 
+// enqueueIngressesForCluster enqueues the ingresses that are synced to the workload cluster
+func (c *Controller) enqueueIngressesForCluster(cluster string) {
+	ingresses, err := c.ingressLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, ingress := range ingresses {
+		if metadata.HasLabel(ingress, workloadMigration.WorkloadTargetLabel+"/"+cluster) {
+			c.Enqueue(ingress)
+		}
+	}
+}
+
+// enqueueIngressesForLogicalCluster enqueues the ingresses of the logical cluster
+func (c *Controller) enqueueIngressesForLogicalCluster(cluster logicalcluster.Name) {
+	ingresses, err := c.ingressLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, ingress := range ingresses {
+		if logicalcluster.From(ingress) == cluster {
+			c.Enqueue(ingress)
+		}
+	}
+}
+
+// listCustomHostCertificates returns the certificates of the custom hosts of
+// the ingress with the key.
+func (c *Controller) listCustomHostCertificates(ingressKey string) ([]*certman.Certificate, error) {
+	certificates, err := c.certificateLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var customHostCertificates []*certman.Certificate
+	for _, certificate := range certificates {
+		if certificate.Annotations[annotationIngressKey] == ingressKey && certificate.Annotations[annotationCustomHost] != "" {
+			customHostCertificates = append(customHostCertificates, certificate)
+		}
+	}
+	return customHostCertificates, nil
+}
+
+// getClusterLabels returns the labels of the workload cluster of the logical
+// cluster, or nil if the workload clusters are not watched, or the workload
+// cluster is not found.
+func (c *Controller) getClusterLabels(logicalCluster logicalcluster.Name, cluster string) (map[string]string, error) {
+	if c.workloadClusterLister == nil {
+		return nil, nil
+	}
+	workloadCluster, err := c.workloadClusterLister.Get(clusters.ToClusterAwareKey(logicalCluster, cluster))
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workloadCluster.Labels, nil
+}
+
 func (c *Controller) process(ctx context.Context, key string) error {
 	object, exists, err := c.indexer.GetByKey(key)
 	if err != nil {
@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	gonet "net"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/kcp-dev/logicalcluster"
 	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
 	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
 	"github.com/kuadrant/kcp-glbc/pkg/net"
 	"github.com/kuadrant/kcp-glbc/pkg/util/metadata"
@@ -19,11 +22,16 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/pointer"
 )
 
+// labelEndpointClusters is the label of the endpoints of the DNSRecord of an
+// ingress, with the comma-separated list of the workload clusters it targets
+const labelEndpointClusters = "kuadrant.dev/clusters"
+
 type dnsReconciler struct {
 	deleteDNS        func(ctx context.Context, ingress *networkingv1.Ingress) error
 	getDNS           func(ctx context.Context, ingress *networkingv1.Ingress) (*v1.DNSRecord, error)
@@ -33,7 +41,13 @@ type dnsReconciler struct {
 	forgetHost       func(key interface{}, host string)
 	listHostWatchers func(key interface{}) []net.RecordWatcher
 	DNSLookup        func(ctx context.Context, host string) ([]net.HostAddress, error)
-	log              logr.Logger
+	// getClusterLabels returns the labels of a workload cluster of a logical
+	// cluster, used by the routing policies
+	getClusterLabels func(logicalCluster logicalcluster.Name, cluster string) (map[string]string, error)
+	// aliasLoadBalancers returns whether the AWS load-balancer hostnames of
+	// the managed host are published as ALIAS records
+	aliasLoadBalancers func(host string) bool
+	log                logr.Logger
 }
 
 func (r *dnsReconciler) reconcile(ctx context.Context, ingress *networkingv1.Ingress) (reconcileStatus, error) {
@@ -64,9 +78,10 @@ func (r *dnsReconciler) reconcile(ctx context.Context, ingress *networkingv1.Ing
 		if err != nil {
 			return reconcileStatusStop, err
 		}
-		// Start watching for address changes in the LBs hostnames
+		// Start watching for address changes in the LBs hostnames, unless
+		// they are published as is
 		for _, lbs := range ingressStatus.LoadBalancer.Ingress {
-			if lbs.Hostname != "" {
+			if lbs.Hostname != "" && r.resolveHostname(ingress, lbs.Hostname) {
 				r.watchHost(ctx, key, lbs.Hostname)
 				activeHosts = append(activeHosts, lbs.Hostname)
 			}
@@ -119,6 +134,7 @@ func (r *dnsReconciler) reconcile(ctx context.Context, ingress *networkingv1.Ing
 		if err != nil {
 			return reconcileStatusStop, err
 		}
+		setDNSRecordState(ingress, existing)
 
 		// metric to observe the ingress admission time
 		ingressObjectTimeToAdmission.
@@ -136,11 +152,81 @@ func (r *dnsReconciler) reconcile(ctx context.Context, ingress *networkingv1.Ing
 		if err = r.updateDNS(ctx, existing); err != nil {
 			return reconcileStatusStop, err
 		}
+		// The readiness of the updated record is not known yet
+		existing.Status.Conditions = nil
 	}
+	setDNSRecordState(ingress, existing)
 
 	return reconcileStatusContinue, nil
 }
 
+// setDNSRecordState mirrors the readiness of the DNSRecord into the ingress
+// annotation, i.e., "ready" once the record is ready, the reason it's not
+// ready otherwise, or "pending" until the readiness of the current generation
+// of the record is reported.
+func setDNSRecordState(ingress *networkingv1.Ingress, record *v1.DNSRecord) {
+	state := "pending"
+	if ready := meta.FindStatusCondition(record.Status.Conditions, v1.DNSRecordReadyConditionType); ready != nil && ready.ObservedGeneration == record.Generation {
+		if ready.Status == metav1.ConditionTrue {
+			state = "ready"
+		} else {
+			state = ready.Reason
+		}
+	}
+	if ingress.Annotations == nil {
+		ingress.Annotations = map[string]string{}
+	}
+	ingress.Annotations[annotationDNSRecordState] = state
+
+	setHealthCheckState(ingress, record)
+}
+
+// setHealthCheckState summarizes the health of the endpoints of the DNSRecord
+// into the ingress annotation, as a JSON object of the health check state by
+// workload cluster. A cluster is unhealthy if any of the endpoints targeting
+// it is unhealthy in any zone. The annotation is removed if the endpoints are
+// not health checked.
+func setHealthCheckState(ingress *networkingv1.Ingress, record *v1.DNSRecord) {
+	states := map[string]v1.HealthCheckState{}
+	for _, zone := range record.Status.Zones {
+		for _, healthCheck := range zone.HealthChecks {
+			for _, endpoint := range zone.Endpoints {
+				if endpoint.DNSName != healthCheck.DNSName || endpoint.SetIdentifier != healthCheck.SetIdentifier {
+					continue
+				}
+				for _, cluster := range strings.Split(endpoint.Labels[labelEndpointClusters], ",") {
+					if cluster != "" && healthCheckStateSeverity(healthCheck.State) >= healthCheckStateSeverity(states[cluster]) {
+						states[cluster] = healthCheck.State
+					}
+				}
+			}
+		}
+	}
+
+	if len(states) == 0 {
+		delete(ingress.Annotations, annotationHealthCheckState)
+		return
+	}
+	// Marshalling a map of strings can't fail, and sorts the clusters
+	value, _ := json.Marshal(states)
+	ingress.Annotations[annotationHealthCheckState] = string(value)
+}
+
+// healthCheckStateSeverity orders the health check states, so that the most
+// severe state of the endpoints of a cluster is reported.
+func healthCheckStateSeverity(state v1.HealthCheckState) int {
+	switch state {
+	case v1.HealthCheckStateHealthy:
+		return 1
+	case v1.HealthCheckStateUnknown:
+		return 2
+	case v1.HealthCheckStateUnhealthy:
+		return 3
+	default:
+		return 0
+	}
+}
+
 func (r *dnsReconciler) setDnsRecordFromIngress(ctx context.Context, ingress *networkingv1.Ingress, dnsRecord *v1.DNSRecord) error {
 	key, err := cache.MetaNamespaceKeyFunc(ingress)
 	if err != nil {
@@ -154,9 +240,49 @@ func (r *dnsReconciler) setDnsRecordFromIngress(ctx context.Context, ingress *ne
 		dnsRecord.Annotations[annotationIngressKey] = key
 	}
 	metadata.CopyAnnotationsPredicate(ingress, dnsRecord, metadata.KeyPredicate(func(key string) bool {
-		return strings.HasPrefix(key, ANNOTATION_HEALTH_CHECK_PREFIX)
+		return key == dns.ZoneVisibilityAnnotation
 	}))
-	return r.setEndpointsFromIngress(ctx, ingress, dnsRecord)
+
+	// The health check annotations of the ingress are set as the health check
+	// of the DNSRecord, rather than copied as the deprecated annotations that
+	// would take over once the health check is removed. An invalid health
+	// check doesn't prevent the ingress from being published: it's published
+	// without health check, and the error is reported on the ingress.
+	healthCheck, err := dns.HealthCheckFromAnnotations(ingress.Annotations)
+	if err != nil {
+		r.log.Error(err, "invalid health check, publishing the ingress without health check", "ingress", key)
+		healthCheck = nil
+		ingress.Annotations[annotationHealthCheckError] = err.Error()
+	} else {
+		delete(ingress.Annotations, annotationHealthCheckError)
+	}
+	if healthCheck != nil && healthCheck.Endpoint == "" {
+		healthCheck.Endpoint = "/"
+	}
+	dnsRecord.Spec.HealthCheck = healthCheck
+	for key := range dnsRecord.Annotations {
+		if strings.HasPrefix(key, dns.HealthCheckAnnotationPrefix) {
+			delete(dnsRecord.Annotations, key)
+		}
+	}
+
+	if err := r.setEndpointsFromIngress(ctx, ingress, dnsRecord); err != nil {
+		return err
+	}
+
+	// The DNS provider can only tell the primary endpoints are unhealthy, and
+	// fail over to the secondary ones, from their health checks, or from the
+	// health of the load balancers they alias
+	if policy, _ := routingPolicyForIngress(ingress); policy == routingPolicyFailover && healthCheck == nil {
+		for _, endpoint := range dnsRecord.Spec.Endpoints {
+			failover, _ := endpoint.GetProviderSpecific(aws.ProviderSpecificFailover)
+			if _, ok := endpoint.GetProviderSpecific(aws.ProviderSpecificEvaluateTargetHealth); failover == strings.ToUpper(failoverRolePrimary) && !ok {
+				return fmt.Errorf("the failover routing policy of ingress %s requires a health check, configured with the %sendpoint annotation", ingress.Name, dns.HealthCheckAnnotationPrefix)
+			}
+		}
+	}
+
+	return nil
 }
 
 func (r *dnsReconciler) setEndpointsFromIngress(ctx context.Context, ingress *networkingv1.Ingress, dnsRecord *v1.DNSRecord) error {
@@ -165,42 +291,93 @@ func (r *dnsReconciler) setEndpointsFromIngress(ctx context.Context, ingress *ne
 		return err
 	}
 
+	routingEndpoints, err := r.routingEndpoints(ingress, targets)
+	if err != nil {
+		return err
+	}
+
 	hostname := ingress.Annotations[ANNOTATION_HCG_HOST]
 
-	// Build a map[Address]Endpoint with the current endpoints to assist
-	// finding endpoints that match the targets
+	// Build a map[DNSName/SetIdentifier/RecordType]Endpoint with the current
+	// endpoints to assist finding endpoints that match the routing endpoints
 	currentEndpoints := make(map[string]*v1.Endpoint, len(dnsRecord.Spec.Endpoints))
 	for _, endpoint := range dnsRecord.Spec.Endpoints {
-		address, ok := endpoint.GetAddress()
-		if !ok {
+		if _, ok := endpoint.GetAddress(); !ok {
 			continue
 		}
 
-		currentEndpoints[address] = endpoint
+		currentEndpoints[endpoint.DNSName+"/"+endpoint.SetIdentifier+"/"+endpoint.RecordType] = endpoint
 	}
 
 	var newEndpoints []*v1.Endpoint
 
-	for _, ingressTargets := range targets {
-		for _, target := range ingressTargets {
-			var endpoint *v1.Endpoint
-			ok := false
+	for _, routingEndpoint := range routingEndpoints {
+		var endpoint *v1.Endpoint
+		ok := false
 
-			// If the endpoint for this target does not exist, add a new one
-			if endpoint, ok = currentEndpoints[target]; !ok {
-				endpoint = &v1.Endpoint{
-					SetIdentifier: target,
-				}
+		dnsName := hostname
+		if routingEndpoint.dnsName != "" {
+			dnsName = routingEndpoint.dnsName
+		}
+
+		// If the endpoint for this set identifier does not exist, add a new one
+		if endpoint, ok = currentEndpoints[dnsName+"/"+routingEndpoint.setIdentifier+"/"+string(routingEndpoint.recordType)]; !ok {
+			endpoint = &v1.Endpoint{
+				SetIdentifier: routingEndpoint.setIdentifier,
 			}
+		}
 
-			newEndpoints = append(newEndpoints, endpoint)
+		newEndpoints = append(newEndpoints, endpoint)
+
+		// Update the endpoint fields
+		endpoint.DNSName = dnsName
+		endpoint.RecordType = string(routingEndpoint.recordType)
+		endpoint.Targets = routingEndpoint.targets
+		endpoint.RecordTTL = 60
+		if endpoint.Labels == nil {
+			endpoint.Labels = v1.Labels{}
+		}
+		clusters := append([]string{}, routingEndpoint.clusters...)
+		sort.Strings(clusters)
+		endpoint.Labels[labelEndpointClusters] = strings.Join(clusters, ",")
+		// Reset the routing properties, in case the routing policy has changed
+		for _, property := range routingProperties {
+			endpoint.DeleteProviderSpecific(property)
+		}
+		for property, value := range routingEndpoint.properties {
+			endpoint.SetProviderSpecific(property, value)
+		}
+		if recordTypeForTarget(routingEndpoint.targets[0]) == v1.CNAMERecordType && routingEndpoint.recordType == v1.ARecordType {
+			// ALIAS records fail over when the load balancer has no healthy targets
+			endpoint.SetProviderSpecific(aws.ProviderSpecificEvaluateTargetHealth, "true")
+		} else {
+			endpoint.DeleteProviderSpecific(aws.ProviderSpecificEvaluateTargetHealth)
+		}
+	}
 
-			// Update the endpoint fields
-			endpoint.DNSName = hostname
-			endpoint.RecordType = "A"
-			endpoint.Targets = []string{target}
-			endpoint.RecordTTL = 60
-			endpoint.SetProviderSpecific(aws.ProviderSpecificWeight, awsEndpointWeight(len(ingressTargets)))
+	// Sort the endpoints, so that the DNSRecord is only updated when they change
+	sort.Slice(newEndpoints, func(i, j int) bool {
+		if newEndpoints[i].DNSName != newEndpoints[j].DNSName {
+			return newEndpoints[i].DNSName < newEndpoints[j].DNSName
+		}
+		if newEndpoints[i].SetIdentifier != newEndpoints[j].SetIdentifier {
+			return newEndpoints[i].SetIdentifier < newEndpoints[j].SetIdentifier
+		}
+		return newEndpoints[i].RecordType < newEndpoints[j].RecordType
+	})
+
+	// A CNAME record can't coexist with other records with the same name
+	hasCNAME, hasAddress := map[string]bool{}, map[string]bool{}
+	for _, endpoint := range newEndpoints {
+		if endpoint.RecordType == string(v1.CNAMERecordType) {
+			hasCNAME[endpoint.DNSName] = true
+		} else {
+			hasAddress[endpoint.DNSName] = true
+		}
+	}
+	for dnsName := range hasCNAME {
+		if hasAddress[dnsName] {
+			return fmt.Errorf("ingress %s load balancers have both hostnames and IP addresses, which can't be published as CNAME records", ingress.Name)
 		}
 	}
 
@@ -208,9 +385,53 @@ func (r *dnsReconciler) setEndpointsFromIngress(ctx context.Context, ingress *ne
 	return nil
 }
 
-// targetsFromIngressStatus returns a map of all the IPs associated with a single ingress(cluster)
-func (r *dnsReconciler) targetsFromIngress(ctx context.Context, ingress *networkingv1.Ingress) (map[string][]string, error) {
-	targets := map[string][]string{}
+// recordTypeForTarget returns the type of the record that points to target,
+// i.e., A or AAAA for IPv4 or IPv6 addresses, and CNAME for hostnames.
+func recordTypeForTarget(target string) v1.DNSRecordType {
+	ip := gonet.ParseIP(target)
+	switch {
+	case ip == nil:
+		return v1.CNAMERecordType
+	case ip.To4() == nil:
+		return v1.AAAARecordType
+	default:
+		return v1.ARecordType
+	}
+}
+
+// recordTypeForTarget returns the type of the record that points to target
+// for the ingress, that's an A record for the hostnames published as ALIAS
+// records.
+func (r *dnsReconciler) recordTypeForTarget(ingress *networkingv1.Ingress, target string) v1.DNSRecordType {
+	recordType := recordTypeForTarget(target)
+	if recordType == v1.CNAMERecordType && !publishHostnames(ingress) {
+		return v1.ARecordType
+	}
+	return recordType
+}
+
+// publishHostnames returns whether the load-balancer hostnames of the ingress
+// are published as CNAME records, rather than resolved into A/AAAA records.
+func publishHostnames(ingress *networkingv1.Ingress) bool {
+	return ingress.Annotations[ANNOTATION_DNS_RECORD_TYPE] == string(v1.CNAMERecordType)
+}
+
+// resolveHostname returns whether the load-balancer hostname is resolved into
+// A/AAAA records, rather than published as a CNAME or an ALIAS record.
+func (r *dnsReconciler) resolveHostname(ingress *networkingv1.Ingress, hostname string) bool {
+	if publishHostnames(ingress) {
+		return false
+	}
+	if r.aliasLoadBalancers == nil || !r.aliasLoadBalancers(ingress.Annotations[ANNOTATION_HCG_HOST]) {
+		return true
+	}
+	return aws.CanonicalHostedZone(hostname) == ""
+}
+
+// targetsFromIngressStatus returns, for each workload cluster, a map of all the IPs associated with a single ingress(cluster),
+// or of the load-balancer hostnames, if they are published as CNAME or ALIAS records
+func (r *dnsReconciler) targetsFromIngress(ctx context.Context, ingress *networkingv1.Ingress) (map[string]clusterTargets, error) {
+	targets := map[string]clusterTargets{}
 
 	ingressStatus := &networkingv1.IngressStatus{}
 	for k, v := range ingress.Annotations {
@@ -231,18 +452,24 @@ func (r *dnsReconciler) targetsFromIngress(ctx context.Context, ingress *network
 		if err != nil {
 			return nil, err
 		}
+		cluster := annotationParts[1]
+		if _, ok := targets[cluster]; !ok {
+			targets[cluster] = clusterTargets{}
+		}
 		for _, lb := range ingressStatus.LoadBalancer.Ingress {
 			if lb.IP != "" {
-				targets[lb.IP] = []string{lb.IP}
+				targets[cluster][lb.IP] = []string{lb.IP}
 			}
-			if lb.Hostname != "" {
+			if lb.Hostname != "" && !r.resolveHostname(ingress, lb.Hostname) {
+				targets[cluster][lb.Hostname] = []string{lb.Hostname}
+			} else if lb.Hostname != "" {
 				ips, err := r.DNSLookup(ctx, lb.Hostname)
 				if err != nil {
 					return nil, err
 				}
-				targets[lb.Hostname] = []string{}
+				targets[cluster][lb.Hostname] = []string{}
 				for _, ip := range ips {
-					targets[lb.Hostname] = append(targets[lb.Hostname], ip.IP.String())
+					targets[cluster][lb.Hostname] = append(targets[cluster][lb.Hostname], ip.IP.String())
 				}
 			}
 		}
@@ -262,11 +489,34 @@ func (r *dnsReconciler) targetsFromIngress(ctx context.Context, ingress *network
 // The aws weight value must be an integer between 0 and 255.
 // https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/resource-record-sets-values-weighted.html#rrsets-values-weighted-weight
 func awsEndpointWeight(numIPs int) string {
+	return awsWeightedEndpointWeight(1, 1, numIPs)
+}
+
+// awsWeightedEndpointWeight returns the weight value for a single AWS record in a set of records where the traffic is
+// split between a number of clusters/ingresses, according to their relative weights, each splitting traffic evenly to
+// a number of IPs (numIPs)
+//
+// Scales the weight allowance of the cluster/ingress with the highest weight (maxClusterWeight) by the relative weight
+// of the cluster (clusterWeight), and divides it by the number of IPs, note that this means:
+// * Will always return 1 for a cluster with a non-zero weight after a certain number of ips is reached, 61 in the
+// case of the highest weight (maxWeight / 2 + 1)
+// * Will return 0 for a cluster with a zero weight, so that it's drained
+//
+// The aws weight value must be an integer between 0 and 255.
+// https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/resource-record-sets-values-weighted.html#rrsets-values-weighted-weight
+func awsWeightedEndpointWeight(clusterWeight, maxClusterWeight, numIPs int) string {
 	maxWeight := 120
-	if numIPs > maxWeight {
-		numIPs = maxWeight
+	if clusterWeight <= 0 || maxClusterWeight <= 0 || numIPs <= 0 {
+		return "0"
+	}
+	weight := maxWeight * clusterWeight / (maxClusterWeight * numIPs)
+	if weight < 1 {
+		weight = 1
+	}
+	if weight > maxWeight {
+		weight = maxWeight
 	}
-	return strconv.Itoa(maxWeight / numIPs)
+	return strconv.Itoa(weight)
 }
 
 func (c *Controller) updateDNS(ctx context.Context, dns *v1.DNSRecord) error {
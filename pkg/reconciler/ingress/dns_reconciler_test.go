@@ -0,0 +1,674 @@
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	gonet "net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster"
+	"github.com/onsi/gomega"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/net"
+	"github.com/kuadrant/kcp-glbc/pkg/util/slice"
+	"github.com/kuadrant/kcp-glbc/pkg/util/workloadMigration"
+)
+
+func TestSetEndpointsFromIngress(t *testing.T) {
+	ingress := func(annotations map[string]string, lbs ...corev1.LoadBalancerIngress) *networkingv1.Ingress {
+		status, err := json.Marshal(networkingv1.IngressStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{Ingress: lbs},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := &networkingv1.Ingress{}
+		i.Name = "test"
+		i.Namespace = "default"
+		i.Labels = map[string]string{workloadMigration.WorkloadTargetLabel + "/c1": "Sync"}
+		i.Annotations = map[string]string{
+			ANNOTATION_HCG_HOST: "app.test.com",
+			workloadMigration.WorkloadStatusAnnotation + "c1": string(status),
+		}
+		for k, v := range annotations {
+			i.Annotations[k] = v
+		}
+		return i
+	}
+
+	r := &dnsReconciler{
+		DNSLookup: func(ctx context.Context, host string) ([]net.HostAddress, error) {
+			return []net.HostAddress{
+				{Host: host, IP: gonet.ParseIP("10.0.0.1")},
+				{Host: host, IP: gonet.ParseIP("10.0.0.2")},
+				{Host: host, IP: gonet.ParseIP("2001:db8::1")},
+			}, nil
+		},
+	}
+
+	type expectedEndpoint struct {
+		recordType string
+		weight     string
+		alias      bool
+	}
+
+	cases := []struct {
+		Name      string
+		Ingress   *networkingv1.Ingress
+		Alias     bool
+		Endpoints map[string]expectedEndpoint
+		Err       bool
+	}{
+		{
+			Name:    "IPv4 and IPv6 load balancer addresses",
+			Ingress: ingress(nil, corev1.LoadBalancerIngress{IP: "10.0.0.1"}, corev1.LoadBalancerIngress{IP: "2001:db8::1"}),
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1":    {recordType: "A", weight: "120"},
+				"2001:db8::1": {recordType: "AAAA", weight: "120"},
+			},
+		},
+		{
+			Name:    "load balancer hostname resolved into A and AAAA records",
+			Ingress: ingress(nil, corev1.LoadBalancerIngress{Hostname: "lb.example.com"}),
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1":    {recordType: "A", weight: "60"},
+				"10.0.0.2":    {recordType: "A", weight: "60"},
+				"2001:db8::1": {recordType: "AAAA", weight: "120"},
+			},
+		},
+		{
+			Name: "load balancer hostname published as CNAME record",
+			Ingress: ingress(map[string]string{ANNOTATION_DNS_RECORD_TYPE: "CNAME"},
+				corev1.LoadBalancerIngress{Hostname: "lb.example.com"}),
+			Endpoints: map[string]expectedEndpoint{
+				"lb.example.com": {recordType: "CNAME", weight: "120"},
+			},
+		},
+		{
+			Name:  "AWS load balancer hostname published as ALIAS record",
+			Alias: true,
+			Ingress: ingress(nil,
+				corev1.LoadBalancerIngress{Hostname: "a1b2c3-123.us-east-1.elb.amazonaws.com"},
+				corev1.LoadBalancerIngress{IP: "10.0.0.3"}),
+			Endpoints: map[string]expectedEndpoint{
+				"a1b2c3-123.us-east-1.elb.amazonaws.com": {recordType: "A", weight: "60", alias: true},
+				"10.0.0.3":                               {recordType: "A", weight: "60"},
+			},
+		},
+		{
+			Name:    "AWS load balancer hostname resolved when ALIAS records are disabled",
+			Ingress: ingress(nil, corev1.LoadBalancerIngress{Hostname: "a1b2c3-123.us-east-1.elb.amazonaws.com"}),
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1":    {recordType: "A", weight: "60"},
+				"10.0.0.2":    {recordType: "A", weight: "60"},
+				"2001:db8::1": {recordType: "AAAA", weight: "120"},
+			},
+		},
+		{
+			Name:    "non AWS load balancer hostname resolved when ALIAS records are enabled",
+			Alias:   true,
+			Ingress: ingress(nil, corev1.LoadBalancerIngress{Hostname: "lb.example.com"}),
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1":    {recordType: "A", weight: "60"},
+				"10.0.0.2":    {recordType: "A", weight: "60"},
+				"2001:db8::1": {recordType: "AAAA", weight: "120"},
+			},
+		},
+		{
+			Name: "CNAME record mixed with IP addresses",
+			Ingress: ingress(map[string]string{ANNOTATION_DNS_RECORD_TYPE: "CNAME"},
+				corev1.LoadBalancerIngress{Hostname: "lb.example.com"},
+				corev1.LoadBalancerIngress{IP: "10.0.0.3"}),
+			Err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			alias := tc.Alias
+			r.aliasLoadBalancers = func(host string) bool { return alias }
+			record := &v1.DNSRecord{}
+			err := r.setEndpointsFromIngress(context.TODO(), tc.Ingress, record)
+			if tc.Err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(record.Spec.Endpoints) != len(tc.Endpoints) {
+				t.Fatalf("expected %d endpoints, got %d", len(tc.Endpoints), len(record.Spec.Endpoints))
+			}
+			for _, endpoint := range record.Spec.Endpoints {
+				target := endpoint.Targets[0]
+				expected, ok := tc.Endpoints[target]
+				if !ok {
+					t.Errorf("unexpected endpoint for target %s", target)
+					continue
+				}
+				if endpoint.DNSName != "app.test.com" {
+					t.Errorf("unexpected DNS name %s", endpoint.DNSName)
+				}
+				if endpoint.RecordType != expected.recordType {
+					t.Errorf("expected record type %s for target %s, got %s", expected.recordType, target, endpoint.RecordType)
+				}
+				if weight, _ := endpoint.GetProviderSpecific(aws.ProviderSpecificWeight); weight != expected.weight {
+					t.Errorf("expected weight %s for target %s, got %s", expected.weight, target, weight)
+				}
+				if _, alias := endpoint.GetProviderSpecific(aws.ProviderSpecificEvaluateTargetHealth); alias != expected.alias {
+					t.Errorf("expected target health evaluation to be %t for target %s", expected.alias, target)
+				}
+			}
+		})
+	}
+}
+
+func TestSetEndpointsFromIngressRoutingPolicy(t *testing.T) {
+	status := func(ips ...string) string {
+		ingressStatus := networkingv1.IngressStatus{}
+		for _, ip := range ips {
+			ingressStatus.LoadBalancer.Ingress = append(ingressStatus.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: ip})
+		}
+		s, err := json.Marshal(ingressStatus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(s)
+	}
+
+	ingress := func(policy, weights, primary string) *networkingv1.Ingress {
+		i := &networkingv1.Ingress{}
+		i.Name = "test"
+		i.Namespace = "default"
+		i.Labels = map[string]string{
+			workloadMigration.WorkloadTargetLabel + "/c1": "Sync",
+			workloadMigration.WorkloadTargetLabel + "/c2": "Sync",
+			workloadMigration.WorkloadTargetLabel + "/c3": "Sync",
+		}
+		i.Annotations = map[string]string{
+			ANNOTATION_HCG_HOST:                               "app.test.com",
+			ANNOTATION_DNS_ROUTING_POLICY:                     policy,
+			ANNOTATION_DNS_WEIGHTS:                            weights,
+			ANNOTATION_DNS_FAILOVER_PRIMARY:                   primary,
+			workloadMigration.WorkloadStatusAnnotation + "c1": status("10.0.0.1"),
+			workloadMigration.WorkloadStatusAnnotation + "c2": status("10.0.0.2"),
+			workloadMigration.WorkloadStatusAnnotation + "c3": status("10.0.0.3", "2001:db8::3"),
+		}
+		return i
+	}
+
+	clusterLabels := map[string]map[string]string{
+		"c1": {corev1.LabelTopologyRegion: "us-east-1", LABEL_FAILOVER_ROLE: "primary"},
+		"c2": {corev1.LabelTopologyRegion: "eu-west-1"},
+		"c3": {corev1.LabelTopologyRegion: "eu-central-1", LABEL_GEO_COUNTRY_CODE: "DE"},
+	}
+
+	targetClusters := map[string]string{
+		"10.0.0.1":    "c1",
+		"10.0.0.2":    "c2",
+		"10.0.0.3":    "c3",
+		"2001:db8::3": "c3",
+	}
+
+	type expectedEndpoint struct {
+		targets    []string
+		properties map[string]string
+	}
+
+	cases := []struct {
+		Name      string
+		Policy    string
+		Weights   string
+		Primary   string
+		Labels    map[string]map[string]string
+		Endpoints map[string]expectedEndpoint
+		Err       bool
+	}{
+		{
+			Name:   "weighted",
+			Policy: "weighted",
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1/A":       {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+				"10.0.0.2/A":       {[]string{"10.0.0.2"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+				"10.0.0.3/A":       {[]string{"10.0.0.3"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+				"2001:db8::3/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+			},
+		},
+		{
+			Name:    "weighted with cluster weights",
+			Policy:  "weighted",
+			Weights: "c1=90, c2=10",
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1/A":       {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificWeight: "108"}},
+				"10.0.0.2/A":       {[]string{"10.0.0.2"}, map[string]string{aws.ProviderSpecificWeight: "12"}},
+				"10.0.0.3/A":       {[]string{"10.0.0.3"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+				"2001:db8::3/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+			},
+		},
+		{
+			Name:    "weighted with drained cluster",
+			Policy:  "weighted",
+			Weights: "c1=1,c2=0,c3=1",
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1/A":       {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+				"10.0.0.2/A":       {[]string{"10.0.0.2"}, map[string]string{aws.ProviderSpecificWeight: "0"}},
+				"10.0.0.3/A":       {[]string{"10.0.0.3"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+				"2001:db8::3/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificWeight: "120"}},
+			},
+		},
+		{
+			Name:    "invalid cluster weight",
+			Policy:  "weighted",
+			Weights: "c1=-1",
+			Err:     true,
+		},
+		{
+			Name:   "latency",
+			Policy: "latency",
+			Labels: clusterLabels,
+			Endpoints: map[string]expectedEndpoint{
+				"10.0.0.1/A":       {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificRegion: "us-east-1"}},
+				"10.0.0.2/A":       {[]string{"10.0.0.2"}, map[string]string{aws.ProviderSpecificRegion: "eu-west-1"}},
+				"10.0.0.3/A":       {[]string{"10.0.0.3"}, map[string]string{aws.ProviderSpecificRegion: "eu-central-1"}},
+				"2001:db8::3/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificRegion: "eu-central-1"}},
+			},
+		},
+		{
+			Name:   "latency without region label",
+			Policy: "latency",
+			Labels: map[string]map[string]string{},
+			Err:    true,
+		},
+		{
+			Name:   "geolocation",
+			Policy: "geolocation",
+			Labels: clusterLabels,
+			Endpoints: map[string]expectedEndpoint{
+				"geo-continent-na/A":  {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificGeolocationContinentCode: "NA"}},
+				"geo-continent-eu/A":  {[]string{"10.0.0.2"}, map[string]string{aws.ProviderSpecificGeolocationContinentCode: "EU"}},
+				"geo-country-de/A":    {[]string{"10.0.0.3"}, map[string]string{aws.ProviderSpecificGeolocationCountryCode: "DE"}},
+				"geo-country-de/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificGeolocationCountryCode: "DE"}},
+				"default/A":           {[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, map[string]string{aws.ProviderSpecificGeolocationCountryCode: "*"}},
+				"default/AAAA":        {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificGeolocationCountryCode: "*"}},
+			},
+		},
+		{
+			Name:   "failover",
+			Policy: "failover",
+			Labels: clusterLabels,
+			Endpoints: map[string]expectedEndpoint{
+				"failover-primary/A":      {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificFailover: "PRIMARY"}},
+				"failover-secondary/A":    {[]string{"10.0.0.2", "10.0.0.3"}, map[string]string{aws.ProviderSpecificFailover: "SECONDARY"}},
+				"failover-secondary/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificFailover: "SECONDARY"}},
+			},
+		},
+		{
+			Name:   "failover without primary cluster",
+			Policy: "failover",
+			Labels: map[string]map[string]string{},
+			Err:    true,
+		},
+		{
+			Name:    "failover with primary clusters",
+			Policy:  "failover",
+			Primary: "c2, c3",
+			Labels:  clusterLabels,
+			Endpoints: map[string]expectedEndpoint{
+				"failover-primary/A":    {[]string{"10.0.0.2", "10.0.0.3"}, map[string]string{aws.ProviderSpecificFailover: "PRIMARY"}},
+				"failover-primary/AAAA": {[]string{"2001:db8::3"}, map[string]string{aws.ProviderSpecificFailover: "PRIMARY"}},
+				"failover-secondary/A":  {[]string{"10.0.0.1"}, map[string]string{aws.ProviderSpecificFailover: "SECONDARY"}},
+			},
+		},
+		{
+			Name:    "failover with unknown primary cluster",
+			Policy:  "failover",
+			Primary: "c4",
+			Labels:  clusterLabels,
+			Err:     true,
+		},
+		{
+			Name:   "unsupported routing policy",
+			Policy: "random",
+			Labels: clusterLabels,
+			Err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := &dnsReconciler{
+				getClusterLabels: func(_ logicalcluster.Name, cluster string) (map[string]string, error) {
+					return tc.Labels[cluster], nil
+				},
+			}
+
+			// Start from weighted endpoints, to check the routing properties are reset
+			record := &v1.DNSRecord{}
+			if err := r.setEndpointsFromIngress(context.TODO(), ingress("weighted", "", ""), record); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err := r.setEndpointsFromIngress(context.TODO(), ingress(tc.Policy, tc.Weights, tc.Primary), record)
+			if tc.Err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(record.Spec.Endpoints) != len(tc.Endpoints) {
+				t.Fatalf("expected %d endpoints, got %d", len(tc.Endpoints), len(record.Spec.Endpoints))
+			}
+			for _, endpoint := range record.Spec.Endpoints {
+				key := endpoint.SetIdentifier + "/" + endpoint.RecordType
+				expected, ok := tc.Endpoints[key]
+				if !ok {
+					t.Errorf("unexpected endpoint %s", key)
+					continue
+				}
+				if !reflect.DeepEqual([]string(endpoint.Targets), expected.targets) {
+					t.Errorf("expected targets %v for endpoint %s, got %v", expected.targets, key, endpoint.Targets)
+				}
+				properties := map[string]string{}
+				for _, property := range endpoint.ProviderSpecific {
+					properties[property.Name] = property.Value
+				}
+				if !reflect.DeepEqual(properties, expected.properties) {
+					t.Errorf("expected properties %v for endpoint %s, got %v", expected.properties, key, properties)
+				}
+				// The endpoints are labelled with the clusters of their targets
+				var clusters []string
+				for _, target := range expected.targets {
+					if cluster := targetClusters[target]; !slice.ContainsString(clusters, cluster) {
+						clusters = append(clusters, cluster)
+					}
+				}
+				sort.Strings(clusters)
+				if label := endpoint.Labels[labelEndpointClusters]; label != strings.Join(clusters, ",") {
+					t.Errorf("expected clusters %v for endpoint %s, got %s", clusters, key, label)
+				}
+			}
+		})
+	}
+}
+
+func TestSetEndpointsFromIngressSplitsGroupedHostnames(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	status := func(hostnames ...string) string {
+		ingressStatus := networkingv1.IngressStatus{}
+		for _, hostname := range hostnames {
+			ingressStatus.LoadBalancer.Ingress = append(ingressStatus.LoadBalancer.Ingress, corev1.LoadBalancerIngress{Hostname: hostname})
+		}
+		s, err := json.Marshal(ingressStatus)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return string(s)
+	}
+
+	ingress := &networkingv1.Ingress{}
+	ingress.Name = "test"
+	ingress.Namespace = "default"
+	ingress.Labels = map[string]string{
+		workloadMigration.WorkloadTargetLabel + "/c1": "Sync",
+		workloadMigration.WorkloadTargetLabel + "/c2": "Sync",
+	}
+	ingress.Annotations = map[string]string{
+		ANNOTATION_HCG_HOST:                               "app.test.com",
+		ANNOTATION_DNS_ROUTING_POLICY:                     "geolocation",
+		workloadMigration.WorkloadStatusAnnotation + "c1": status("nlb-1.elb.eu-west-1.amazonaws.com"),
+		workloadMigration.WorkloadStatusAnnotation + "c2": status("nlb-2.elb.eu-west-1.amazonaws.com", "nlb-3.elb.eu-west-1.amazonaws.com"),
+	}
+
+	r := &dnsReconciler{
+		getClusterLabels: func(_ logicalcluster.Name, cluster string) (map[string]string, error) {
+			return map[string]string{corev1.LabelTopologyRegion: "eu-west-1"}, nil
+		},
+		aliasLoadBalancers: func(string) bool { return true },
+	}
+	record := &v1.DNSRecord{}
+	g.Expect(r.setEndpointsFromIngress(context.TODO(), ingress, record)).To(gomega.Succeed())
+
+	type endpoint struct {
+		dnsName, setIdentifier, target, weight, clusters string
+	}
+	var endpoints []endpoint
+	for _, e := range record.Spec.Endpoints {
+		g.Expect(e.Targets).To(gomega.HaveLen(1))
+		g.Expect(e.RecordType).To(gomega.Equal("A"))
+		weight, _ := e.GetProviderSpecific(aws.ProviderSpecificWeight)
+		endpoints = append(endpoints, endpoint{e.DNSName, e.SetIdentifier, e.Targets[0], weight, e.Labels[labelEndpointClusters]})
+	}
+
+	// The ALIAS records of each group target an intermediate name, that splits
+	// the traffic evenly between the clusters, and then their load balancers
+	g.Expect(endpoints).To(gomega.Equal([]endpoint{
+		{"app.test.com", "default", "default.app.test.com", "", "c1,c2"},
+		{"app.test.com", "geo-continent-eu", "geo-continent-eu.app.test.com", "", "c1,c2"},
+		{"default.app.test.com", "nlb-1.elb.eu-west-1.amazonaws.com", "nlb-1.elb.eu-west-1.amazonaws.com", "120", "c1"},
+		{"default.app.test.com", "nlb-2.elb.eu-west-1.amazonaws.com", "nlb-2.elb.eu-west-1.amazonaws.com", "60", "c2"},
+		{"default.app.test.com", "nlb-3.elb.eu-west-1.amazonaws.com", "nlb-3.elb.eu-west-1.amazonaws.com", "60", "c2"},
+		{"geo-continent-eu.app.test.com", "nlb-1.elb.eu-west-1.amazonaws.com", "nlb-1.elb.eu-west-1.amazonaws.com", "120", "c1"},
+		{"geo-continent-eu.app.test.com", "nlb-2.elb.eu-west-1.amazonaws.com", "nlb-2.elb.eu-west-1.amazonaws.com", "60", "c2"},
+		{"geo-continent-eu.app.test.com", "nlb-3.elb.eu-west-1.amazonaws.com", "nlb-3.elb.eu-west-1.amazonaws.com", "60", "c2"},
+	}))
+}
+
+func TestContinentForRegion(t *testing.T) {
+	cases := map[string]string{
+		"us-east-1":            "NA",
+		"eu-west-1":            "EU",
+		"ap-southeast-2":       "OC",
+		"ap-northeast-1":       "AS",
+		"europe-west1":         "EU",
+		"australia-southeast1": "OC",
+		"southamerica-east1":   "SA",
+		"eastus":               "",
+	}
+	for region, expected := range cases {
+		if continent := continentForRegion(region); continent != expected {
+			t.Errorf("expected continent %q for region %s, got %q", expected, region, continent)
+		}
+	}
+}
+
+func TestSetDNSRecordState(t *testing.T) {
+	record := func(generation int64, status metav1.ConditionStatus, reason string) *v1.DNSRecord {
+		r := &v1.DNSRecord{}
+		r.Generation = 2
+		r.Status.Conditions = []metav1.Condition{{
+			Type:               v1.DNSRecordReadyConditionType,
+			Status:             status,
+			Reason:             reason,
+			ObservedGeneration: generation,
+		}}
+		return r
+	}
+
+	cases := []struct {
+		name   string
+		record *v1.DNSRecord
+		state  string
+	}{
+		{name: "no readiness", record: &v1.DNSRecord{}, state: "pending"},
+		{name: "ready", record: record(2, metav1.ConditionTrue, "Ready"), state: "ready"},
+		{name: "not ready", record: record(2, metav1.ConditionFalse, "PropagationPending"), state: "PropagationPending"},
+		{name: "readiness of a previous generation", record: record(1, metav1.ConditionTrue, "Ready"), state: "pending"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ingress := &networkingv1.Ingress{}
+			setDNSRecordState(ingress, tc.record)
+			if state := ingress.Annotations[annotationDNSRecordState]; state != tc.state {
+				t.Errorf("expected state %q, got %q", tc.state, state)
+			}
+		})
+	}
+}
+
+func TestSetHealthCheckState(t *testing.T) {
+	endpoint := func(setIdentifier, clusters string) *v1.Endpoint {
+		return &v1.Endpoint{DNSName: "app.test.com", SetIdentifier: setIdentifier, Labels: v1.Labels{labelEndpointClusters: clusters}}
+	}
+	healthCheck := func(setIdentifier string, state v1.HealthCheckState) v1.EndpointHealthCheckStatus {
+		return v1.EndpointHealthCheckStatus{DNSName: "app.test.com", SetIdentifier: setIdentifier, State: state}
+	}
+
+	record := &v1.DNSRecord{}
+	record.Status.Zones = []v1.DNSZoneStatus{
+		{
+			DNSZone:   v1.DNSZone{ID: "public"},
+			Endpoints: []*v1.Endpoint{endpoint("10.0.0.1", "c1"), endpoint("10.0.0.2", "c2"), endpoint("eu", "c3,c4")},
+			HealthChecks: []v1.EndpointHealthCheckStatus{
+				healthCheck("10.0.0.1", v1.HealthCheckStateHealthy),
+				healthCheck("10.0.0.2", v1.HealthCheckStateUnhealthy),
+				healthCheck("eu", v1.HealthCheckStateHealthy),
+			},
+		},
+		{
+			DNSZone:   v1.DNSZone{ID: "private"},
+			Endpoints: []*v1.Endpoint{endpoint("10.0.0.1", "c1"), endpoint("eu", "c3,c4")},
+			HealthChecks: []v1.EndpointHealthCheckStatus{
+				healthCheck("10.0.0.1", v1.HealthCheckStateHealthy),
+				healthCheck("eu", v1.HealthCheckStateUnknown),
+			},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{}
+	setDNSRecordState(ingress, record)
+	expected := `{"c1":"Healthy","c2":"Unhealthy","c3":"Unknown","c4":"Unknown"}`
+	if state := ingress.Annotations[annotationHealthCheckState]; state != expected {
+		t.Errorf("expected health check state %s, got %s", expected, state)
+	}
+
+	// The annotation is removed once the endpoints are no longer health checked
+	for i := range record.Status.Zones {
+		record.Status.Zones[i].HealthChecks = nil
+	}
+	setDNSRecordState(ingress, record)
+	if state, ok := ingress.Annotations[annotationHealthCheckState]; ok {
+		t.Errorf("expected no health check state, got %s", state)
+	}
+}
+
+func TestSetDnsRecordHealthCheckFromIngress(t *testing.T) {
+	r := &dnsReconciler{log: logr.Discard()}
+	ingress := &networkingv1.Ingress{}
+	ingress.Name = "test"
+	ingress.Namespace = "default"
+	ingress.Annotations = map[string]string{
+		ANNOTATION_HCG_HOST:                          "app.test.com",
+		dns.HealthCheckAnnotationPrefix + "endpoint": "/healthz",
+		dns.HealthCheckAnnotationPrefix + "port":     "8080",
+	}
+
+	// The health check annotations copied by earlier versions are removed
+	record := &v1.DNSRecord{}
+	record.Annotations = map[string]string{dns.HealthCheckAnnotationPrefix + "endpoint": "/ready"}
+
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	port := int64(8080)
+	if expected := (&v1.HealthCheckSpec{Endpoint: "/healthz", Port: &port}); !reflect.DeepEqual(record.Spec.HealthCheck, expected) {
+		t.Errorf("expected health check %+v, got %+v", expected, record.Spec.HealthCheck)
+	}
+	if _, ok := record.Annotations[dns.HealthCheckAnnotationPrefix+"endpoint"]; ok {
+		t.Errorf("expected health check annotations to be removed, got %v", record.Annotations)
+	}
+
+	// The health check is removed with the annotations of the ingress
+	delete(ingress.Annotations, dns.HealthCheckAnnotationPrefix+"endpoint")
+	delete(ingress.Annotations, dns.HealthCheckAnnotationPrefix+"port")
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Spec.HealthCheck != nil {
+		t.Errorf("expected no health check, got %+v", record.Spec.HealthCheck)
+	}
+
+	// The endpoint defaults to the root path
+	ingress.Annotations[dns.HealthCheckAnnotationPrefix+"port"] = "8080"
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (&v1.HealthCheckSpec{Endpoint: "/", Port: &port}); !reflect.DeepEqual(record.Spec.HealthCheck, expected) {
+		t.Errorf("expected health check %+v, got %+v", expected, record.Spec.HealthCheck)
+	}
+
+	// An invalid health check is reported on the ingress, which is published
+	// without health check
+	ingress.Annotations[dns.HealthCheckAnnotationPrefix+"protocol"] = "UDP"
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Spec.HealthCheck != nil {
+		t.Errorf("expected no health check, got %+v", record.Spec.HealthCheck)
+	}
+	if _, ok := ingress.Annotations[annotationHealthCheckError]; !ok {
+		t.Errorf("expected the health check error to be reported, got %v", ingress.Annotations)
+	}
+
+	delete(ingress.Annotations, dns.HealthCheckAnnotationPrefix+"protocol")
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ingress.Annotations[annotationHealthCheckError]; ok {
+		t.Errorf("expected the health check error to be removed, got %v", ingress.Annotations)
+	}
+}
+
+func TestSetDnsRecordFailoverHealthCheck(t *testing.T) {
+	ingressStatus, err := json.Marshal(networkingv1.IngressStatus{LoadBalancer: corev1.LoadBalancerStatus{
+		Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &dnsReconciler{}
+	ingress := &networkingv1.Ingress{}
+	ingress.Name = "test"
+	ingress.Namespace = "default"
+	ingress.Labels = map[string]string{
+		workloadMigration.WorkloadTargetLabel + "/c1": "Sync",
+	}
+	ingress.Annotations = map[string]string{
+		ANNOTATION_HCG_HOST:                               "app.test.com",
+		ANNOTATION_DNS_ROUTING_POLICY:                     "failover",
+		ANNOTATION_DNS_FAILOVER_PRIMARY:                   "c1",
+		workloadMigration.WorkloadStatusAnnotation + "c1": string(ingressStatus),
+	}
+
+	// The traffic can't fail over without health checks
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, &v1.DNSRecord{}); err == nil {
+		t.Errorf("expected error for failover without health check")
+	}
+
+	ingress.Annotations[dns.HealthCheckAnnotationPrefix+"endpoint"] = "/healthz"
+	record := &v1.DNSRecord{}
+	if err := r.setDnsRecordFromIngress(context.Background(), ingress, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(record.Spec.Endpoints) != 1 || record.Spec.HealthCheck == nil {
+		t.Errorf("expected a health checked primary endpoint, got %+v", record.Spec)
+	}
+}
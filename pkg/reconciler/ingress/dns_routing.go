@@ -0,0 +1,414 @@
+package ingress
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+	"github.com/kuadrant/kcp-glbc/pkg/util/slice"
+)
+
+const (
+	ANNOTATION_DNS_ROUTING_POLICY = "kuadrant.experimental/dns-routing-policy"
+	// ANNOTATION_DNS_WEIGHTS is a comma-separated list of <workload cluster>=<weight> pairs,
+	// of the relative weights of the workload clusters for the weighted routing policy
+	ANNOTATION_DNS_WEIGHTS = "kuadrant.experimental/dns-weights"
+	// ANNOTATION_DNS_FAILOVER_PRIMARY is a comma-separated list of the primary
+	// workload clusters for the failover routing policy, the other ones being
+	// secondary. It takes precedence over the failover role label of the
+	// workload clusters.
+	ANNOTATION_DNS_FAILOVER_PRIMARY = "kuadrant.experimental/dns-failover-primary"
+
+	// Workload cluster labels used to route the traffic, in addition to the
+	// well-known topology.kubernetes.io/region label
+	LABEL_GEO_CONTINENT_CODE   = "kuadrant.experimental/geo-continent-code"
+	LABEL_GEO_COUNTRY_CODE     = "kuadrant.experimental/geo-country-code"
+	LABEL_GEO_SUBDIVISION_CODE = "kuadrant.experimental/geo-subdivision-code"
+	LABEL_FAILOVER_ROLE        = "kuadrant.experimental/failover-role"
+)
+
+type routingPolicy string
+
+const (
+	routingPolicyWeighted    routingPolicy = "weighted"
+	routingPolicyLatency     routingPolicy = "latency"
+	routingPolicyGeolocation routingPolicy = "geolocation"
+	routingPolicyFailover    routingPolicy = "failover"
+)
+
+// defaultClusterWeight is the relative weight of the workload clusters that
+// are not listed in the weights annotation of the ingress.
+const defaultClusterWeight = 100
+
+const (
+	failoverRolePrimary   = "primary"
+	failoverRoleSecondary = "secondary"
+)
+
+// routingProperties are the provider specific properties that are set
+// according to the routing policy of the ingress.
+var routingProperties = []string{
+	aws.ProviderSpecificWeight,
+	aws.ProviderSpecificRegion,
+	aws.ProviderSpecificFailover,
+	aws.ProviderSpecificGeolocationContinentCode,
+	aws.ProviderSpecificGeolocationCountryCode,
+	aws.ProviderSpecificGeolocationSubdivisionCode,
+}
+
+// clusterTargets are the targets of the load balancers of an ingress in a
+// workload cluster, keyed by load balancer.
+type clusterTargets map[string][]string
+
+// routingEndpoint is an endpoint to be published for an ingress, according to
+// its routing policy.
+type routingEndpoint struct {
+	// dnsName is the name of the endpoint, if it's not the managed host of the ingress
+	dnsName       string
+	setIdentifier string
+	recordType    v1.DNSRecordType
+	targets       []string
+	properties    map[string]string
+	// clusters are the workload clusters of the load balancers the endpoint targets
+	clusters []string
+}
+
+// continentsByRegionPrefix maps cloud region name prefixes to continent codes,
+// e.g. eu-west-1 or europe-west1 to EU. Longer prefixes come first.
+var continentsByRegionPrefix = []struct {
+	prefix    string
+	continent string
+}{
+	{"ap-southeast-2", "OC"},
+	{"ap-southeast-4", "OC"},
+	{"northamerica-", "NA"},
+	{"southamerica-", "SA"},
+	{"australia-", "OC"},
+	{"europe-", "EU"},
+	{"africa-", "AF"},
+	{"asia-", "AS"},
+	{"us-", "NA"},
+	{"ca-", "NA"},
+	{"mx-", "NA"},
+	{"sa-", "SA"},
+	{"eu-", "EU"},
+	{"af-", "AF"},
+	{"ap-", "AS"},
+	{"me-", "AS"},
+	{"il-", "AS"},
+}
+
+func routingPolicyForIngress(ingress *networkingv1.Ingress) (routingPolicy, error) {
+	policy := routingPolicy(ingress.Annotations[ANNOTATION_DNS_ROUTING_POLICY])
+	switch policy {
+	case "":
+		return routingPolicyWeighted, nil
+	case routingPolicyWeighted, routingPolicyLatency, routingPolicyGeolocation, routingPolicyFailover:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported DNS routing policy %q for ingress %s", policy, ingress.Name)
+	}
+}
+
+// routingEndpoints returns the endpoints for the targets of the ingress in
+// each workload cluster, according to the routing policy of the ingress.
+func (r *dnsReconciler) routingEndpoints(ingress *networkingv1.Ingress, targets map[string]clusterTargets) ([]routingEndpoint, error) {
+	policy, err := routingPolicyForIngress(ingress)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy {
+	case routingPolicyLatency:
+		return r.perTargetEndpoints(ingress, targets, func(cluster string, _ int) (map[string]string, error) {
+			labels, err := r.clusterLabels(ingress, cluster)
+			if err != nil {
+				return nil, err
+			}
+			region := labels[corev1.LabelTopologyRegion]
+			if region == "" {
+				return nil, fmt.Errorf("workload cluster %s has no %s label for the latency routing policy", cluster, corev1.LabelTopologyRegion)
+			}
+			return map[string]string{aws.ProviderSpecificRegion: region}, nil
+		})
+
+	case routingPolicyGeolocation:
+		endpoints, err := r.groupedEndpoints(ingress, targets, func(cluster string) (string, map[string]string, error) {
+			labels, err := r.clusterLabels(ingress, cluster)
+			if err != nil {
+				return "", nil, err
+			}
+			return geolocationForCluster(cluster, labels)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Queries from locations that aren't covered by any cluster are answered with all the targets
+		defaults, err := r.groupedEndpoints(ingress, targets, func(string) (string, map[string]string, error) {
+			return "default", map[string]string{aws.ProviderSpecificGeolocationCountryCode: "*"}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(endpoints, defaults...), nil
+
+	case routingPolicyFailover:
+		primaries := failoverPrimaries(ingress)
+		endpoints, err := r.groupedEndpoints(ingress, targets, func(cluster string) (string, map[string]string, error) {
+			role := failoverRoleSecondary
+			if primaries != nil {
+				if slice.ContainsString(primaries, cluster) {
+					role = failoverRolePrimary
+				}
+			} else {
+				labels, err := r.clusterLabels(ingress, cluster)
+				if err != nil {
+					return "", nil, err
+				}
+				if labels[LABEL_FAILOVER_ROLE] == failoverRolePrimary {
+					role = failoverRolePrimary
+				}
+			}
+			return "failover-" + role, map[string]string{aws.ProviderSpecificFailover: strings.ToUpper(role)}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.setIdentifier == "failover-"+failoverRolePrimary {
+				return endpoints, nil
+			}
+		}
+		if len(endpoints) > 0 && primaries != nil {
+			return nil, fmt.Errorf("none of the workload clusters of ingress %s is listed in the %s annotation for the failover routing policy", ingress.Name, ANNOTATION_DNS_FAILOVER_PRIMARY)
+		}
+		if len(endpoints) > 0 {
+			return nil, fmt.Errorf("no workload cluster of ingress %s has the %s=%s label for the failover routing policy", ingress.Name, LABEL_FAILOVER_ROLE, failoverRolePrimary)
+		}
+		return endpoints, nil
+
+	default:
+		weights, err := clusterWeights(ingress)
+		if err != nil {
+			return nil, err
+		}
+		weightOf := func(cluster string) int {
+			if weight, ok := weights[cluster]; ok {
+				return weight
+			}
+			return defaultClusterWeight
+		}
+		maxWeight := 0
+		for cluster := range targets {
+			if weight := weightOf(cluster); weight > maxWeight {
+				maxWeight = weight
+			}
+		}
+		return r.perTargetEndpoints(ingress, targets, func(cluster string, numTargets int) (map[string]string, error) {
+			return map[string]string{aws.ProviderSpecificWeight: awsWeightedEndpointWeight(weightOf(cluster), maxWeight, numTargets)}, nil
+		})
+	}
+}
+
+// clusterWeights returns the relative weights of the workload clusters, from
+// the weights annotation of the ingress.
+func clusterWeights(ingress *networkingv1.Ingress) (map[string]int, error) {
+	weights := map[string]int{}
+	annotation := strings.TrimSpace(ingress.Annotations[ANNOTATION_DNS_WEIGHTS])
+	if annotation == "" {
+		return weights, nil
+	}
+	for _, pair := range strings.Split(annotation, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid weight %q for ingress %s, expected <workload cluster>=<weight>", pair, ingress.Name)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for ingress %s, expected a non-negative integer", pair, ingress.Name)
+		}
+		weights[strings.TrimSpace(parts[0])] = weight
+	}
+	return weights, nil
+}
+
+// failoverPrimaries returns the primary workload clusters, from the failover
+// primary annotation of the ingress, or nil if it's not set.
+func failoverPrimaries(ingress *networkingv1.Ingress) []string {
+	annotation := strings.TrimSpace(ingress.Annotations[ANNOTATION_DNS_FAILOVER_PRIMARY])
+	if annotation == "" {
+		return nil
+	}
+	primaries := []string{}
+	for _, cluster := range strings.Split(annotation, ",") {
+		if cluster = strings.TrimSpace(cluster); cluster != "" {
+			primaries = append(primaries, cluster)
+		}
+	}
+	return primaries
+}
+
+// perTargetEndpoints returns an endpoint per target, with the properties
+// returned by the properties function for the cluster of the target, and the
+// number of targets of the same record type of the cluster, across all its
+// load balancers.
+func (r *dnsReconciler) perTargetEndpoints(ingress *networkingv1.Ingress, targets map[string]clusterTargets, properties func(cluster string, numTargets int) (map[string]string, error)) ([]routingEndpoint, error) {
+	var endpoints []routingEndpoint
+	for cluster, loadBalancers := range targets {
+		// Count the targets of the cluster by record type, as the traffic of
+		// the cluster is split between its records of the same type
+		targetsByType := map[v1.DNSRecordType]int{}
+		for _, lbTargets := range loadBalancers {
+			for _, target := range lbTargets {
+				targetsByType[r.recordTypeForTarget(ingress, target)]++
+			}
+		}
+
+		for _, lbTargets := range loadBalancers {
+			for _, target := range lbTargets {
+				recordType := r.recordTypeForTarget(ingress, target)
+				props, err := properties(cluster, targetsByType[recordType])
+				if err != nil {
+					return nil, err
+				}
+				endpoints = append(endpoints, routingEndpoint{
+					setIdentifier: target,
+					recordType:    recordType,
+					targets:       []string{target},
+					properties:    props,
+					clusters:      []string{cluster},
+				})
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// groupedEndpoints returns an endpoint per group of clusters and record type,
+// that targets all the load balancers of the clusters in the group. The group
+// function returns the set identifier and the properties for a cluster.
+//
+// CNAME and ALIAS records can only have a single target, so the endpoint of a
+// group with several load-balancer hostnames targets an intermediate name
+// instead, <set identifier>.<managed host>, with a weighted endpoint per
+// hostname, that splits the traffic evenly between the clusters of the group.
+func (r *dnsReconciler) groupedEndpoints(ingress *networkingv1.Ingress, targets map[string]clusterTargets, group func(cluster string) (string, map[string]string, error)) ([]routingEndpoint, error) {
+	type groupKey struct {
+		setIdentifier string
+		recordType    v1.DNSRecordType
+	}
+	groups := map[groupKey]*routingEndpoint{}
+	targetClusters := map[string]string{}
+
+	for cluster, loadBalancers := range targets {
+		setIdentifier, props, err := group(cluster)
+		if err != nil {
+			return nil, err
+		}
+		for _, lbTargets := range loadBalancers {
+			for _, target := range lbTargets {
+				targetClusters[target] = cluster
+				key := groupKey{setIdentifier: setIdentifier, recordType: r.recordTypeForTarget(ingress, target)}
+				endpoint, ok := groups[key]
+				if !ok {
+					endpoint = &routingEndpoint{
+						setIdentifier: setIdentifier,
+						recordType:    key.recordType,
+						properties:    props,
+					}
+					groups[key] = endpoint
+				}
+				if !slice.ContainsString(endpoint.targets, target) {
+					endpoint.targets = append(endpoint.targets, target)
+				}
+				if !slice.ContainsString(endpoint.clusters, cluster) {
+					endpoint.clusters = append(endpoint.clusters, cluster)
+				}
+			}
+		}
+	}
+
+	endpoints := make([]routingEndpoint, 0, len(groups))
+	for _, endpoint := range groups {
+		sort.Strings(endpoint.targets)
+		sort.Strings(endpoint.clusters)
+		if len(endpoint.targets) > 1 && recordTypeForTarget(endpoint.targets[0]) == v1.CNAMERecordType {
+			hostname := ingress.Annotations[ANNOTATION_HCG_HOST]
+			if hostname == "" {
+				return nil, fmt.Errorf("ingress %s has multiple load-balancer hostnames for the %s routing endpoint, and no managed host to split them under", ingress.Name, endpoint.setIdentifier)
+			}
+			dnsName := endpoint.setIdentifier + "." + hostname
+			hostnamesPerCluster := map[string]int{}
+			for _, target := range endpoint.targets {
+				hostnamesPerCluster[targetClusters[target]]++
+			}
+			for _, target := range endpoint.targets {
+				cluster := targetClusters[target]
+				endpoints = append(endpoints, routingEndpoint{
+					dnsName:       dnsName,
+					setIdentifier: target,
+					recordType:    endpoint.recordType,
+					targets:       []string{target},
+					properties:    map[string]string{aws.ProviderSpecificWeight: awsEndpointWeight(hostnamesPerCluster[cluster])},
+					clusters:      []string{cluster},
+				})
+			}
+			endpoint.targets = []string{dnsName}
+		}
+		endpoints = append(endpoints, *endpoint)
+	}
+	return endpoints, nil
+}
+
+// geolocationForCluster returns the set identifier and the geolocation
+// properties for the workload cluster, from its geolocation labels, or from
+// the continent of its region.
+func geolocationForCluster(cluster string, labels map[string]string) (string, map[string]string, error) {
+	if country := labels[LABEL_GEO_COUNTRY_CODE]; country != "" {
+		props := map[string]string{aws.ProviderSpecificGeolocationCountryCode: country}
+		setIdentifier := "geo-country-" + strings.ToLower(country)
+		if subdivision := labels[LABEL_GEO_SUBDIVISION_CODE]; subdivision != "" {
+			props[aws.ProviderSpecificGeolocationSubdivisionCode] = subdivision
+			setIdentifier += "-" + strings.ToLower(subdivision)
+		}
+		return setIdentifier, props, nil
+	}
+
+	continent := labels[LABEL_GEO_CONTINENT_CODE]
+	if continent == "" {
+		continent = continentForRegion(labels[corev1.LabelTopologyRegion])
+	}
+	if continent == "" {
+		return "", nil, fmt.Errorf("workload cluster %s has no geolocation labels, nor a known %s label, for the geolocation routing policy", cluster, corev1.LabelTopologyRegion)
+	}
+	return "geo-continent-" + strings.ToLower(continent), map[string]string{aws.ProviderSpecificGeolocationContinentCode: continent}, nil
+}
+
+// continentForRegion returns the continent code of the cloud region, or an
+// empty string if the region is unknown.
+func continentForRegion(region string) string {
+	region = strings.ToLower(region)
+	for _, c := range continentsByRegionPrefix {
+		if strings.HasPrefix(region, c.prefix) {
+			return c.continent
+		}
+	}
+	return ""
+}
+
+// clusterLabels returns the labels of the workload cluster of the ingress, or
+// nil if they can't be looked up.
+func (r *dnsReconciler) clusterLabels(ingress *networkingv1.Ingress, cluster string) (map[string]string, error) {
+	if r.getClusterLabels == nil {
+		return nil, nil
+	}
+	return r.getClusterLabels(logicalcluster.From(ingress), cluster)
+}
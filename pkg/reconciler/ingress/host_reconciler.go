@@ -2,16 +2,60 @@ package ingress
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/rs/xid"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	"github.com/kuadrant/kcp-glbc/pkg/net"
+	"github.com/kuadrant/kcp-glbc/pkg/util/slice"
 )
 
 type hostReconciler struct {
 	managedDomain string
-	log           logr.Logger
+	// customHostsEnabled is whether the custom hosts of the domains verified
+	// for the logical cluster of the ingress are kept
+	customHostsEnabled bool
+	// isDomainVerified returns whether the host is within a domain verified
+	// for the logical cluster
+	isDomainVerified func(cluster logicalcluster.Name, host string) (bool, error)
+	// lookupCNAME returns the canonical name of the host
+	lookupCNAME func(ctx context.Context, host string) (string, error)
+	// enqueueAfter requeues the ingress, while the CNAME records of its
+	// custom hosts are not set up
+	enqueueAfter func(obj interface{}, duration time.Duration)
+	log          logr.Logger
+}
+
+// customHostCNAMECheckInterval is the interval the CNAME records of the custom
+// hosts are checked at, until they point at the managed host.
+const customHostCNAMECheckInterval = time.Minute
+
+// customHostStatus is the status of the CNAME record of a custom host, that
+// must point at the managed host.
+type customHostStatus struct {
+	Host string `json:"host"`
+	// CNAME is the target of the CNAME record of the host, i.e., the managed host
+	CNAME string `json:"cname"`
+	// Ready is whether the CNAME record of the host points at the managed host
+	Ready bool `json:"ready"`
+	// Message describes the CNAME record to create, while it's not ready
+	Message string `json:"message,omitempty"`
+}
+
+// pendingCustomHosts are the rules and TLS sections of the custom hosts that
+// are replaced with the managed host until their domain is verified.
+type pendingCustomHosts struct {
+	Rules []networkingv1.IngressRule `json:"rules,omitempty"`
+	TLS   []networkingv1.IngressTLS  `json:"tls,omitempty"`
 }
 
 func (r *hostReconciler) reconcile(ctx context.Context, ingress *networkingv1.Ingress) (reconcileStatus, error) {
@@ -29,20 +73,291 @@ func (r *hostReconciler) reconcile(ctx context.Context, ingress *networkingv1.In
 	}
 	//once the annotation is definintely saved continue on
 	managedHost := ingress.Annotations[ANNOTATION_HCG_HOST]
+
+	if !r.customHostsEnabled {
+		var customHosts []string
+		for i, rule := range ingress.Spec.Rules {
+			if rule.Host != managedHost {
+				ingress.Spec.Rules[i].Host = managedHost
+				customHosts = append(customHosts, rule.Host)
+			}
+		}
+		// clean up replaced hosts from the tls list
+		removeHostsFromTLS(customHosts, ingress)
+
+		if len(customHosts) > 0 {
+			ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOST_REPLACED] = fmt.Sprintf(" replaced custom hosts %v to the glbc host due to custom host policy not being allowed",
+				customHosts)
+		}
+
+		return reconcileStatusContinue, nil
+	}
+
+	if status, err := r.reconcileCustomHosts(ingress, managedHost); err != nil || status == reconcileStatusStop {
+		return status, err
+	}
+
+	return r.reconcileCustomHostsCNAME(ctx, ingress, managedHost)
+}
+
+// reconcileCustomHosts keeps the custom hosts whose domain is verified for the
+// logical cluster of the ingress, alongside the managed host, and replaces the
+// others with the managed host, until their domain is verified. The replaced
+// rules and TLS sections are stored in an annotation, and restored once their
+// domain is verified.
+func (r *hostReconciler) reconcileCustomHosts(ingress *networkingv1.Ingress, managedHost string) (reconcileStatus, error) {
+	pending, err := getPendingCustomHosts(ingress)
+	if err != nil {
+		return reconcileStatusStop, err
+	}
+
+	verified := map[string]bool{}
+	isVerified := func(host string) (bool, error) {
+		if v, ok := verified[host]; ok {
+			return v, nil
+		}
+		// The hosts of the managed domain can only be managed hosts
+		v := host != "" && !hostInDomain(host, r.managedDomain)
+		if v {
+			var err error
+			if v, err = r.isDomainVerified(logicalcluster.From(ingress), host); err != nil {
+				return false, err
+			}
+		}
+		verified[host] = v
+		return v, nil
+	}
+
+	// Restore the pending custom hosts whose domain is verified
+	var stillPending pendingCustomHosts
+	for _, rule := range pending.Rules {
+		v, err := isVerified(rule.Host)
+		if err != nil {
+			return reconcileStatusStop, err
+		}
+		if !v {
+			stillPending.Rules = append(stillPending.Rules, rule)
+			continue
+		}
+		r.log.Info("restoring custom host of verified domain", "host", rule.Host, "ingress", ingress.Name)
+		ingress.Spec.Rules = append(ingress.Spec.Rules, rule)
+	}
+	for _, tls := range pending.TLS {
+		v, err := isVerified(tls.Hosts[0])
+		if err != nil {
+			return reconcileStatusStop, err
+		}
+		if !v {
+			stillPending.TLS = append(stillPending.TLS, tls)
+			continue
+		}
+		ingress.Spec.TLS = append(ingress.Spec.TLS, tls)
+	}
+
+	// Replace the custom hosts whose domain is not verified
 	var customHosts []string
 	for i, rule := range ingress.Spec.Rules {
-		if rule.Host != managedHost {
-			ingress.Spec.Rules[i].Host = managedHost
-			customHosts = append(customHosts, rule.Host)
+		if rule.Host == managedHost {
+			continue
+		}
+		v, err := isVerified(rule.Host)
+		if err != nil {
+			return reconcileStatusStop, err
+		}
+		if v {
+			continue
+		}
+		ingress.Spec.Rules[i].Host = managedHost
+		customHosts = append(customHosts, rule.Host)
+		// The rules without host are not custom hosts
+		if rule.Host != "" && !containsRule(stillPending.Rules, rule) {
+			stillPending.Rules = append(stillPending.Rules, *rule.DeepCopy())
+		}
+		for _, tls := range ingress.Spec.TLS {
+			// The certificates issued for the custom hosts are not kept
+			if tls.SecretName == customHostTLSSecretName(ingress, rule.Host) {
+				continue
+			}
+			if rule.Host != "" && slice.ContainsString(tls.Hosts, rule.Host) {
+				pendingTLS := networkingv1.IngressTLS{Hosts: []string{rule.Host}, SecretName: tls.SecretName}
+				if !containsTLS(stillPending.TLS, pendingTLS) {
+					stillPending.TLS = append(stillPending.TLS, pendingTLS)
+				}
+			}
 		}
 	}
 	// clean up replaced hosts from the tls list
 	removeHostsFromTLS(customHosts, ingress)
 
-	if len(customHosts) > 0 {
-		ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOST_REPLACED] = fmt.Sprintf(" replaced custom hosts %v to the glbc host due to custom host policy not being allowed",
-			customHosts)
+	// The verified custom hosts are served alongside the managed host, that
+	// the DNS records and health checks are set up for
+	if len(ingress.Spec.Rules) > 0 && !hasRuleForHost(ingress.Spec.Rules, managedHost) {
+		managedRule := *ingress.Spec.Rules[0].DeepCopy()
+		managedRule.Host = managedHost
+		ingress.Spec.Rules = append(ingress.Spec.Rules, managedRule)
+	}
+
+	if err := setPendingCustomHosts(ingress, stillPending); err != nil {
+		return reconcileStatusStop, err
+	}
+	if len(stillPending.Rules) > 0 {
+		var hosts []string
+		for _, rule := range stillPending.Rules {
+			hosts = append(hosts, rule.Host)
+		}
+		ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOST_REPLACED] = fmt.Sprintf(" replaced custom hosts %v to the glbc host pending the verification of their domain",
+			hosts)
+	} else {
+		delete(ingress.Annotations, ANNOTATION_HCG_CUSTOM_HOST_REPLACED)
 	}
 
 	return reconcileStatusContinue, nil
 }
+
+// reconcileCustomHostsCNAME checks that the custom hosts of the ingress are
+// CNAME records pointing at the managed host, so that the traffic is steered
+// by the DNS records of the managed host, and reports the CNAME records to
+// create in an annotation.
+func (r *hostReconciler) reconcileCustomHostsCNAME(ctx context.Context, ingress *networkingv1.Ingress, managedHost string) (reconcileStatus, error) {
+	var hosts []string
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host != managedHost && !slice.ContainsString(hosts, rule.Host) {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		delete(ingress.Annotations, ANNOTATION_HCG_CUSTOM_HOSTS_STATUS)
+		return reconcileStatusContinue, nil
+	}
+	sort.Strings(hosts)
+
+	previous := map[string]customHostStatus{}
+	for _, status := range getCustomHostStatuses(ingress) {
+		previous[status.Host] = status
+	}
+
+	ready := true
+	statuses := make([]customHostStatus, 0, len(hosts))
+	for _, host := range hosts {
+		status := customHostStatus{Host: host, CNAME: managedHost}
+		cname, err := r.lookupCNAME(ctx, host)
+		switch {
+		case err != nil && !net.IsNotFound(err):
+			// The host is only dropped once its CNAME record is confirmed to be
+			// missing or to point elsewhere, not when the lookup fails
+			r.log.Error(err, "failed to look up the CNAME record of custom host", "host", host, "ingress", ingress.Name)
+			if p, ok := previous[host]; ok && p.CNAME == managedHost {
+				status = p
+			} else {
+				status.Message = fmt.Sprintf("failed to look up the DNS record: %s CNAME %s", host, managedHost)
+			}
+			// The lookup is retried
+			ready = false
+		case err != nil:
+			status.Message = fmt.Sprintf("create the DNS record: %s CNAME %s", host, managedHost)
+		case !strings.EqualFold(strings.TrimSuffix(cname, "."), managedHost):
+			status.Message = fmt.Sprintf("%s is a CNAME to %s, update the DNS record to: %s CNAME %s", host, cname, host, managedHost)
+		default:
+			status.Ready = true
+		}
+		ready = ready && status.Ready
+		statuses = append(statuses, status)
+	}
+
+	value, err := json.Marshal(statuses)
+	if err != nil {
+		return reconcileStatusStop, err
+	}
+	ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOSTS_STATUS] = string(value)
+
+	if !ready {
+		r.enqueueAfter(ingress, customHostCNAMECheckInterval)
+	}
+
+	return reconcileStatusContinue, nil
+}
+
+// getCustomHostStatuses returns the statuses of the CNAME records of the
+// custom hosts of the ingress.
+func getCustomHostStatuses(ingress *networkingv1.Ingress) []customHostStatus {
+	value, ok := ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOSTS_STATUS]
+	if !ok {
+		return nil
+	}
+	var statuses []customHostStatus
+	if err := json.Unmarshal([]byte(value), &statuses); err != nil {
+		return nil
+	}
+	return statuses
+}
+
+// cnameReadyHosts returns the custom hosts of the ingress whose CNAME record
+// points at the managed host.
+func cnameReadyHosts(ingress *networkingv1.Ingress) []string {
+	var hosts []string
+	for _, status := range getCustomHostStatuses(ingress) {
+		if status.Ready && hasRuleForHost(ingress.Spec.Rules, status.Host) {
+			hosts = append(hosts, status.Host)
+		}
+	}
+	return hosts
+}
+
+func getPendingCustomHosts(ingress *networkingv1.Ingress) (pendingCustomHosts, error) {
+	pending := pendingCustomHosts{}
+	value, ok := ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOST_PENDING]
+	if !ok {
+		return pending, nil
+	}
+	if err := json.Unmarshal([]byte(value), &pending); err != nil {
+		return pending, fmt.Errorf("invalid %s annotation: %v", ANNOTATION_HCG_CUSTOM_HOST_PENDING, err)
+	}
+	return pending, nil
+}
+
+func setPendingCustomHosts(ingress *networkingv1.Ingress, pending pendingCustomHosts) error {
+	if len(pending.Rules) == 0 && len(pending.TLS) == 0 {
+		delete(ingress.Annotations, ANNOTATION_HCG_CUSTOM_HOST_PENDING)
+		return nil
+	}
+	value, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	ingress.Annotations[ANNOTATION_HCG_CUSTOM_HOST_PENDING] = string(value)
+	return nil
+}
+
+// hostInDomain returns whether the host is the domain, or one of its subdomains.
+func hostInDomain(host, domain string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+func containsRule(rules []networkingv1.IngressRule, rule networkingv1.IngressRule) bool {
+	for _, r := range rules {
+		if equality.Semantic.DeepEqual(r, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRuleForHost(rules []networkingv1.IngressRule, host string) bool {
+	for _, r := range rules {
+		if r.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTLS(tlsList []networkingv1.IngressTLS, tls networkingv1.IngressTLS) bool {
+	for _, t := range tlsList {
+		if equality.Semantic.DeepEqual(t, tls) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,18 @@ package ingress
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	gonet "net"
 	"testing"
+	"time"
 
+	"github.com/go-logr/logr"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kcp-dev/logicalcluster"
 )
 
 type hostResult struct {
@@ -113,3 +121,251 @@ func TestReconcileHost(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileCustomHosts(t *testing.T) {
+	verifiedDomains := map[string]string{"root:org:ws": "example.com"}
+	isDomainVerified := func(cluster logicalcluster.Name, host string) (bool, error) {
+		domain, ok := verifiedDomains[cluster.String()]
+		return ok && hostInDomain(host, domain), nil
+	}
+	rule := func(host, path string) networkingv1.IngressRule {
+		return networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{Path: path}}},
+			},
+		}
+	}
+	ingress := func(cluster string, rules ...networkingv1.IngressRule) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				ClusterName: cluster,
+				Annotations: map[string]string{ANNOTATION_HCG_HOST: "123.test.com"},
+			},
+			Spec: networkingv1.IngressSpec{
+				Rules: rules,
+				TLS:   []networkingv1.IngressTLS{{Hosts: []string{"api.example.com", "api.other.com"}, SecretName: "custom"}},
+			},
+		}
+	}
+
+	cases := []struct {
+		Name     string
+		Ingress  func() *networkingv1.Ingress
+		Validate func(i *networkingv1.Ingress) error
+	}{
+		{
+			Name: "test custom host of verified domain kept alongside managed host",
+			Ingress: func() *networkingv1.Ingress {
+				return ingress("root:org:ws", rule("api.example.com", "/"))
+			},
+			Validate: func(i *networkingv1.Ingress) error {
+				expected := []networkingv1.IngressRule{rule("api.example.com", "/"), rule("123.test.com", "/")}
+				if !equality.Semantic.DeepEqual(i.Spec.Rules, expected) {
+					return fmt.Errorf("expected rules %v, got %v", expected, i.Spec.Rules)
+				}
+				if len(i.Spec.TLS) != 1 || len(i.Spec.TLS[0].Hosts) != 2 {
+					return fmt.Errorf("expected the tls section to be kept, got %v", i.Spec.TLS)
+				}
+				if _, ok := i.Annotations[ANNOTATION_HCG_CUSTOM_HOST_PENDING]; ok {
+					return fmt.Errorf("expected no pending custom hosts")
+				}
+				if hosts := cnameReadyHosts(i); !equality.Semantic.DeepEqual(hosts, []string{"api.example.com"}) {
+					return fmt.Errorf("expected the CNAME of api.example.com to be ready, got %v", hosts)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "test custom host of domain verified for another logical cluster replaced",
+			Ingress: func() *networkingv1.Ingress {
+				return ingress("root:org:other", rule("api.example.com", "/"))
+			},
+			Validate: func(i *networkingv1.Ingress) error {
+				if len(i.Spec.Rules) != 1 || i.Spec.Rules[0].Host != "123.test.com" {
+					return fmt.Errorf("expected the custom host to be replaced, got %v", i.Spec.Rules)
+				}
+				if _, ok := i.Annotations[ANNOTATION_HCG_CUSTOM_HOST_REPLACED]; !ok {
+					return fmt.Errorf("expected the custom host annotation to be present")
+				}
+				pending, err := getPendingCustomHosts(i)
+				if err != nil {
+					return err
+				}
+				expected := pendingCustomHosts{
+					Rules: []networkingv1.IngressRule{rule("api.example.com", "/")},
+					TLS:   []networkingv1.IngressTLS{{Hosts: []string{"api.example.com"}, SecretName: "custom"}},
+				}
+				if !equality.Semantic.DeepEqual(pending, expected) {
+					return fmt.Errorf("expected pending custom hosts %v, got %v", expected, pending)
+				}
+				if len(i.Spec.TLS) != 1 || !equality.Semantic.DeepEqual(i.Spec.TLS[0].Hosts, []string{"api.other.com"}) {
+					return fmt.Errorf("expected the custom host to be removed from the tls section, got %v", i.Spec.TLS)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "test pending custom host restored once its domain is verified",
+			Ingress: func() *networkingv1.Ingress {
+				i := ingress("root:org:ws", rule("123.test.com", "/"), rule("api.other.com", "/other"))
+				i.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{"api.other.com"}, SecretName: "custom"}}
+				i.Annotations[ANNOTATION_HCG_CUSTOM_HOST_REPLACED] = "replaced"
+				i.Annotations[ANNOTATION_HCG_CUSTOM_HOST_PENDING] = `{"rules":[{"host":"api.example.com","http":{"paths":[{"path":"/"}]}}],"tls":[{"hosts":["api.example.com"],"secretName":"custom"}]}`
+				return i
+			},
+			Validate: func(i *networkingv1.Ingress) error {
+				expected := []networkingv1.IngressRule{rule("123.test.com", "/"), rule("123.test.com", "/other"), rule("api.example.com", "/")}
+				if !equality.Semantic.DeepEqual(i.Spec.Rules, expected) {
+					return fmt.Errorf("expected rules %v, got %v", expected, i.Spec.Rules)
+				}
+				expectedTLS := []networkingv1.IngressTLS{{Hosts: []string{"api.example.com"}, SecretName: "custom"}}
+				if !equality.Semantic.DeepEqual(i.Spec.TLS, expectedTLS) {
+					return fmt.Errorf("expected tls %v, got %v", expectedTLS, i.Spec.TLS)
+				}
+				pending, err := getPendingCustomHosts(i)
+				if err != nil {
+					return err
+				}
+				if len(pending.Rules) != 1 || pending.Rules[0].Host != "api.other.com" {
+					return fmt.Errorf("expected api.other.com to be pending, got %v", pending.Rules)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "test hosts of the managed domain never verified",
+			Ingress: func() *networkingv1.Ingress {
+				verifiedDomains["root:org:managed"] = "test.com"
+				return ingress("root:org:managed", rule("other.test.com", "/"))
+			},
+			Validate: func(i *networkingv1.Ingress) error {
+				if len(i.Spec.Rules) != 1 || i.Spec.Rules[0].Host != "123.test.com" {
+					return fmt.Errorf("expected the host to be replaced, got %v", i.Spec.Rules)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "test empty host not pending",
+			Ingress: func() *networkingv1.Ingress {
+				return ingress("root:org:ws", rule("", "/"))
+			},
+			Validate: func(i *networkingv1.Ingress) error {
+				if len(i.Spec.Rules) != 1 || i.Spec.Rules[0].Host != "123.test.com" {
+					return fmt.Errorf("expected the managed host to be set, got %v", i.Spec.Rules)
+				}
+				if _, ok := i.Annotations[ANNOTATION_HCG_CUSTOM_HOST_PENDING]; ok {
+					return fmt.Errorf("expected no pending custom hosts")
+				}
+				if _, ok := i.Annotations[ANNOTATION_HCG_CUSTOM_HOST_REPLACED]; ok {
+					return fmt.Errorf("expected the custom host annotation not to be present")
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			reconciler := &hostReconciler{
+				managedDomain:      "test.com",
+				customHostsEnabled: true,
+				isDomainVerified:   isDomainVerified,
+				lookupCNAME: func(_ context.Context, host string) (string, error) {
+					return "123.test.com", nil
+				},
+				enqueueAfter: func(interface{}, time.Duration) {},
+				log:          logr.Discard(),
+			}
+
+			i := tc.Ingress()
+			status, err := reconciler.reconcile(context.TODO(), i)
+			if err != nil {
+				t.Fatalf("unexpected error from reconcile : %s", err)
+			}
+			if status != reconcileStatusContinue {
+				t.Fatalf("unexpected status %v", status)
+			}
+			if err := tc.Validate(i); err != nil {
+				t.Fatalf("fail: %s", err)
+			}
+		})
+	}
+}
+
+func TestReconcileCustomHostsCNAME(t *testing.T) {
+	cnames := map[string]string{"api.example.com": "123.test.com.", "www.example.com": "other.test.com"}
+	var requeued []time.Duration
+	var lookupErr error
+	reconciler := &hostReconciler{
+		managedDomain:      "test.com",
+		customHostsEnabled: true,
+		isDomainVerified: func(_ logicalcluster.Name, host string) (bool, error) {
+			return hostInDomain(host, "example.com"), nil
+		},
+		lookupCNAME: func(_ context.Context, host string) (string, error) {
+			if lookupErr != nil {
+				return "", lookupErr
+			}
+			cname, ok := cnames[host]
+			if !ok {
+				return "", &gonet.DNSError{Err: "no CNAME record found for host", Name: host, IsNotFound: true}
+			}
+			return cname, nil
+		},
+		enqueueAfter: func(_ interface{}, duration time.Duration) { requeued = append(requeued, duration) },
+		log:          logr.Discard(),
+	}
+
+	i := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{ANNOTATION_HCG_HOST: "123.test.com"}},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "123.test.com"}, {Host: "api.example.com"}, {Host: "www.example.com"}, {Host: "app.example.com"}},
+		},
+	}
+	if _, err := reconciler.reconcile(context.TODO(), i); err != nil {
+		t.Fatalf("unexpected error from reconcile : %s", err)
+	}
+
+	var statuses []customHostStatus
+	if err := json.Unmarshal([]byte(i.Annotations[ANNOTATION_HCG_CUSTOM_HOSTS_STATUS]), &statuses); err != nil {
+		t.Fatalf("invalid %s annotation: %s", ANNOTATION_HCG_CUSTOM_HOSTS_STATUS, err)
+	}
+	expected := []customHostStatus{
+		{Host: "api.example.com", CNAME: "123.test.com", Ready: true},
+		{Host: "app.example.com", CNAME: "123.test.com", Message: "create the DNS record: app.example.com CNAME 123.test.com"},
+		{Host: "www.example.com", CNAME: "123.test.com", Message: "www.example.com is a CNAME to other.test.com, update the DNS record to: www.example.com CNAME 123.test.com"},
+	}
+	if !equality.Semantic.DeepEqual(statuses, expected) {
+		t.Fatalf("expected custom hosts status %v, got %v", expected, statuses)
+	}
+	if hosts := cnameReadyHosts(i); !equality.Semantic.DeepEqual(hosts, []string{"api.example.com"}) {
+		t.Fatalf("expected only the CNAME of api.example.com to be ready, got %v", hosts)
+	}
+	if !equality.Semantic.DeepEqual(requeued, []time.Duration{customHostCNAMECheckInterval}) {
+		t.Fatalf("expected the ingress to be requeued until the CNAME records are ready, got %v", requeued)
+	}
+
+	// The statuses are kept while the CNAME records can't be looked up
+	lookupErr = &gonet.DNSError{Err: "server answered SERVFAIL", IsTemporary: true}
+	if _, err := reconciler.reconcile(context.TODO(), i); err != nil {
+		t.Fatalf("unexpected error from reconcile : %s", err)
+	}
+	if hosts := cnameReadyHosts(i); !equality.Semantic.DeepEqual(hosts, []string{"api.example.com"}) {
+		t.Fatalf("expected the CNAME of api.example.com to be kept ready, got %v", hosts)
+	}
+	if len(requeued) != 2 {
+		t.Fatalf("expected the ingress to be requeued until the CNAME records are looked up, got %v", requeued)
+	}
+	lookupErr = nil
+
+	// The status is removed along with the custom hosts
+	i.Spec.Rules = i.Spec.Rules[:1]
+	if _, err := reconciler.reconcile(context.TODO(), i); err != nil {
+		t.Fatalf("unexpected error from reconcile : %s", err)
+	}
+	if _, ok := i.Annotations[ANNOTATION_HCG_CUSTOM_HOSTS_STATUS]; ok {
+		t.Fatalf("expected the %s annotation to be removed", ANNOTATION_HCG_CUSTOM_HOSTS_STATUS)
+	}
+}
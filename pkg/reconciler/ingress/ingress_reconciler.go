@@ -35,29 +35,36 @@ func (c *Controller) reconcile(ctx context.Context, ingress *networkingv1.Ingres
 	reconcilers := []reconciler{
 		//hostReconciler is first as the others depends on it for the host to be set on the ingress
 		&hostReconciler{
-			managedDomain: c.domain,
-			log:           c.Logger,
+			managedDomain:      c.domain,
+			customHostsEnabled: c.customHostsEnabled,
+			isDomainVerified:   c.isDomainVerified,
+			lookupCNAME:        c.hostResolver.LookupCNAME,
+			enqueueAfter:       c.EnqueueAfter,
+			log:                c.Logger,
 		},
 		&certificateReconciler{
-			createCertificate:    c.certProvider.Create,
-			deleteCertificate:    c.certProvider.Delete,
-			getCertificateSecret: c.certProvider.GetCertificateSecret,
-			updateCertificate:    c.certProvider.Update,
-			getCertificateStatus: c.certProvider.GetCertificateStatus,
-			copySecret:           c.copySecret,
-			deleteSecret:         c.deleteTLSSecret,
-			log:                  c.Logger,
+			createCertificate:          c.certProvider.Create,
+			deleteCertificate:          c.certProvider.Delete,
+			getCertificateSecret:       c.certProvider.GetCertificateSecret,
+			updateCertificate:          c.certProvider.Update,
+			getCertificateStatus:       c.certProvider.GetCertificateStatus,
+			copySecret:                 c.copySecret,
+			deleteSecret:               c.deleteTLSSecret,
+			listCustomHostCertificates: c.listCustomHostCertificates,
+			log:                        c.Logger,
 		},
 		&dnsReconciler{
-			deleteDNS:        c.deleteDNS,
-			DNSLookup:        c.hostResolver.LookupIPAddr,
-			getDNS:           c.getDNS,
-			createDNS:        c.createDNS,
-			updateDNS:        c.updateDNS,
-			watchHost:        c.hostsWatcher.StartWatching,
-			forgetHost:       c.hostsWatcher.StopWatching,
-			listHostWatchers: c.hostsWatcher.ListHostRecordWatchers,
-			log:              c.Logger,
+			deleteDNS:          c.deleteDNS,
+			DNSLookup:          c.hostResolver.LookupIPAddr,
+			getDNS:             c.getDNS,
+			createDNS:          c.createDNS,
+			updateDNS:          c.updateDNS,
+			watchHost:          c.hostsWatcher.StartWatching,
+			forgetHost:         c.hostsWatcher.StopWatching,
+			listHostWatchers:   c.hostsWatcher.ListHostRecordWatchers,
+			getClusterLabels:   c.getClusterLabels,
+			aliasLoadBalancers: c.aliasLoadBalancers,
+			log:                c.Logger,
 		},
 	}
 	var errs []error
@@ -76,3 +76,78 @@ func Test_awsEndpointWeight(t *testing.T) {
 		})
 	}
 }
+
+func Test_awsWeightedEndpointWeight(t *testing.T) {
+	type args struct {
+		clusterWeight    int
+		maxClusterWeight int
+		numIPs           int
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "highest cluster weight",
+			args: args{
+				clusterWeight:    100,
+				maxClusterWeight: 100,
+				numIPs:           2,
+			},
+			want: "60",
+		},
+		{
+			name: "half the highest cluster weight",
+			args: args{
+				clusterWeight:    50,
+				maxClusterWeight: 100,
+				numIPs:           1,
+			},
+			want: "60",
+		},
+		{
+			name: "tenth of the highest cluster weight with multiple ips",
+			args: args{
+				clusterWeight:    10,
+				maxClusterWeight: 100,
+				numIPs:           4,
+			},
+			want: "3",
+		},
+		{
+			name: "low cluster weight with many ips",
+			args: args{
+				clusterWeight:    1,
+				maxClusterWeight: 100,
+				numIPs:           10,
+			},
+			want: "1",
+		},
+		{
+			name: "zero cluster weight",
+			args: args{
+				clusterWeight:    0,
+				maxClusterWeight: 100,
+				numIPs:           1,
+			},
+			want: "0",
+		},
+		{
+			name: "all cluster weights zero",
+			args: args{
+				clusterWeight:    0,
+				maxClusterWeight: 0,
+				numIPs:           1,
+			},
+			want: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := awsWeightedEndpointWeight(tt.args.clusterWeight, tt.args.maxClusterWeight, tt.args.numIPs); got != tt.want {
+				t.Errorf("awsWeightedEndpointWeight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -138,7 +138,7 @@ func (cm *certManager) GetCertificateStatus(ctx context.Context, certReq Certifi
 }
 
 func (cm *certManager) Create(ctx context.Context, cr CertificateRequest) error {
-	if !isValidDomain(cr.Host, cm.validDomains) {
+	if !cr.CustomHost && !isValidDomain(cr.Host, cm.validDomains) {
 		return fmt.Errorf("cannot create certificate for host %s invalid domain", cr.Host)
 	}
 	cert := cm.certificate(cr)
@@ -35,10 +35,13 @@ type Provider interface {
 }
 
 type CertificateRequest struct {
-	Name             string
-	Labels           map[string]string
-	Annotations      map[string]string
-	Host             string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	Host        string
+	// CustomHost is whether the host is a custom host, whose use has been
+	// verified, so that it's not restricted to the domains of the provider
+	CustomHost       bool
 	cleanUpFinalizer bool
 }
 
@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 const namespaceEnvVariable = "NAMESPACE"
@@ -27,6 +28,30 @@ func GetEnvBool(key string, fallback bool) bool {
 	return value
 }
 
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	strValue, found := os.LookupEnv(key)
+	if !found {
+		return fallback
+	}
+	value, err := time.ParseDuration(strValue)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func GetEnvInt(key string, fallback int) int {
+	strValue, found := os.LookupEnv(key)
+	if !found {
+		return fallback
+	}
+	value, err := strconv.Atoi(strValue)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
 func GetNamespace() string {
 	return GetEnvString(namespaceEnvVariable, "")
 }
@@ -0,0 +1,274 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+)
+
+const (
+	// DefaultRecordTTL is the TTL of the endpoints that don't set one
+	DefaultRecordTTL = 60
+	// MaxRecordTTL is the maximum TTL of an endpoint, i.e., two days
+	MaxRecordTTL = 172800
+	// MaxWeight is the maximum weight of a weighted endpoint
+	MaxWeight = 255
+)
+
+// DNSRecordWebhook validates and defaults the DNSRecords.
+type DNSRecordWebhook struct {
+	// Domains are the managed domains the DNS names of the records must be
+	// within. The DNS names are not restricted if empty.
+	Domains []string
+	// AliasLoadBalancers returns whether the AWS load-balancer hostnames of a
+	// host are published as ALIAS records, i.e., as A records with the
+	// load-balancer hostname as target, rather than as CNAME records. The
+	// hostnames are published as CNAME records if nil.
+	AliasLoadBalancers func(host string) bool
+}
+
+// Default returns the JSON patch that sets the default values of the
+// endpoints of the DNSRecord, i.e., the TTL, and the record type inferred
+// from the targets, following the ALIAS records convention for the AWS
+// load-balancer hostnames.
+func (w *DNSRecordWebhook) Default(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	record := &v1.DNSRecord{}
+	if err := json.Unmarshal(request.Object.Raw, record); err != nil {
+		return errorResponse(request, metav1.StatusReasonBadRequest, fmt.Errorf("failed to decode DNSRecord: %v", err))
+	}
+
+	type patchOperation struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+	var patch []patchOperation
+	for i, endpoint := range record.Spec.Endpoints {
+		if endpoint == nil {
+			continue
+		}
+		if endpoint.RecordTTL == 0 {
+			patch = append(patch, patchOperation{Op: "add", Path: fmt.Sprintf("/spec/endpoints/%d/recordTTL", i), Value: DefaultRecordTTL})
+		}
+		if endpoint.RecordType == "" && len(endpoint.Targets) > 0 {
+			patch = append(patch, patchOperation{Op: "add", Path: fmt.Sprintf("/spec/endpoints/%d/recordType", i), Value: w.recordTypeForEndpoint(endpoint)})
+		}
+	}
+
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if len(patch) > 0 {
+		patchBytes, err := json.Marshal(patch)
+		if err != nil {
+			return errorResponse(request, metav1.StatusReasonInternalError, err)
+		}
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patchBytes
+		response.PatchType = &patchType
+	}
+	return response
+}
+
+// Validate rejects the DNSRecords whose endpoints would fail to be published.
+func (w *DNSRecordWebhook) Validate(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if request.Operation == admissionv1.Delete {
+		return &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	}
+	record := &v1.DNSRecord{}
+	if err := json.Unmarshal(request.Object.Raw, record); err != nil {
+		return errorResponse(request, metav1.StatusReasonBadRequest, fmt.Errorf("failed to decode DNSRecord: %v", err))
+	}
+
+	if errs := w.validateSpec(&record.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return errorResponse(request, metav1.StatusReasonInvalid, errs.ToAggregate())
+	}
+	return &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+}
+
+func (w *DNSRecordWebhook) validateSpec(spec *v1.DNSRecordSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	setIdentifiers := map[string]int{}
+	for i, endpoint := range spec.Endpoints {
+		endpointPath := path.Child("endpoints").Index(i)
+		if endpoint == nil {
+			errs = append(errs, field.Required(endpointPath, "endpoint must not be null"))
+			continue
+		}
+		errs = append(errs, w.validateEndpoint(endpoint, endpointPath)...)
+
+		// The endpoints with the same name and type are distinguished by their set identifier
+		key := strings.ToLower(endpoint.DNSName) + "/" + endpoint.RecordType + "/" + endpoint.SetIdentifier
+		if j, ok := setIdentifiers[key]; ok {
+			errs = append(errs, field.Duplicate(endpointPath.Child("setIdentifier"), fmt.Sprintf("%q is also the set identifier of endpoint %d", endpoint.SetIdentifier, j)))
+		} else {
+			setIdentifiers[key] = i
+		}
+	}
+	return errs
+}
+
+func (w *DNSRecordWebhook) validateEndpoint(endpoint *v1.Endpoint, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if endpoint.DNSName == "" {
+		errs = append(errs, field.Required(path.Child("dnsName"), ""))
+	} else if msgs := validateHostname(endpoint.DNSName, true); len(msgs) > 0 {
+		errs = append(errs, field.Invalid(path.Child("dnsName"), endpoint.DNSName, strings.Join(msgs, ", ")))
+	} else if !w.inManagedDomain(endpoint.DNSName) {
+		errs = append(errs, field.Invalid(path.Child("dnsName"), endpoint.DNSName, fmt.Sprintf("must be within the managed domains %s", strings.Join(w.Domains, ", "))))
+	}
+
+	if endpoint.RecordTTL < 0 || endpoint.RecordTTL > MaxRecordTTL {
+		errs = append(errs, field.Invalid(path.Child("recordTTL"), endpoint.RecordTTL, fmt.Sprintf("must be between 0 and %d", MaxRecordTTL)))
+	}
+
+	recordType := v1.DNSRecordType(endpoint.RecordType)
+	switch recordType {
+	case v1.ARecordType, v1.AAAARecordType, v1.CNAMERecordType:
+	case "":
+		errs = append(errs, field.Required(path.Child("recordType"), ""))
+	default:
+		errs = append(errs, field.NotSupported(path.Child("recordType"), endpoint.RecordType,
+			[]string{string(v1.ARecordType), string(v1.AAAARecordType), string(v1.CNAMERecordType)}))
+	}
+
+	targetsPath := path.Child("targets")
+	if len(endpoint.Targets) == 0 {
+		errs = append(errs, field.Required(targetsPath, "at least one target is required"))
+	}
+	for i, target := range endpoint.Targets {
+		if msg := validateTarget(recordType, target, len(endpoint.Targets)); msg != "" {
+			errs = append(errs, field.Invalid(targetsPath.Index(i), target, msg))
+		}
+	}
+
+	if weight, ok := endpoint.GetProviderSpecificProperty(aws.ProviderSpecificWeight); ok {
+		if value, err := strconv.Atoi(weight.Value); err != nil || value < 0 || value > MaxWeight {
+			errs = append(errs, field.Invalid(path.Child("providerSpecific").Key(aws.ProviderSpecificWeight), weight.Value, fmt.Sprintf("must be an integer between 0 and %d", MaxWeight)))
+		} else if endpoint.SetIdentifier == "" {
+			errs = append(errs, field.Required(path.Child("setIdentifier"), "weighted endpoints require a set identifier"))
+		}
+	}
+
+	return errs
+}
+
+// validateTarget returns why the target of an endpoint of the record type is
+// invalid, or an empty string if it's valid. A and AAAA endpoints can alias a
+// single load balancer hostname.
+func validateTarget(recordType v1.DNSRecordType, target string, numTargets int) string {
+	ip := net.ParseIP(target)
+	switch recordType {
+	case v1.ARecordType, v1.AAAARecordType:
+		if ip == nil {
+			if numTargets > 1 {
+				return "must be an IP address, or the only target to alias a hostname"
+			}
+			if msgs := validateHostname(target, false); len(msgs) > 0 {
+				return strings.Join(msgs, ", ")
+			}
+			return ""
+		}
+		if recordType == v1.ARecordType && ip.To4() == nil {
+			return "must be an IPv4 address"
+		}
+		if recordType == v1.AAAARecordType && ip.To4() != nil {
+			return "must be an IPv6 address"
+		}
+	case v1.CNAMERecordType:
+		if numTargets > 1 {
+			return "CNAME endpoints must have a single target"
+		}
+		if ip != nil {
+			return "must be a hostname"
+		}
+		if msgs := validateHostname(target, false); len(msgs) > 0 {
+			return strings.Join(msgs, ", ")
+		}
+	}
+	return ""
+}
+
+// validateHostname returns the reasons the hostname is not a valid DNS name,
+// optionally with a leading wildcard label.
+func validateHostname(hostname string, wildcard bool) []string {
+	hostname = strings.TrimSuffix(hostname, ".")
+	if wildcard && strings.HasPrefix(hostname, "*.") {
+		return validation.IsWildcardDNS1123Subdomain(hostname)
+	}
+	return validation.IsDNS1123Subdomain(hostname)
+}
+
+// inManagedDomain returns whether the DNS name is one of the managed domains,
+// or a subdomain of one.
+func (w *DNSRecordWebhook) inManagedDomain(dnsName string) bool {
+	if len(w.Domains) == 0 {
+		return true
+	}
+	name := strings.ToLower(strings.TrimSuffix(dnsName, "."))
+	for _, domain := range w.Domains {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTypeForEndpoint returns the record type of the endpoint inferred from
+// its first target, i.e., A for the single AWS load-balancer hostname targets
+// published as ALIAS records, CNAME for the other hostnames, and A or AAAA for
+// IP addresses.
+func (w *DNSRecordWebhook) recordTypeForEndpoint(endpoint *v1.Endpoint) v1.DNSRecordType {
+	target := endpoint.Targets[0]
+	ip := net.ParseIP(target)
+	switch {
+	case ip == nil && w.aliasLoadBalancer(endpoint):
+		return v1.ARecordType
+	case ip == nil:
+		return v1.CNAMERecordType
+	case ip.To4() != nil:
+		return v1.ARecordType
+	default:
+		return v1.AAAARecordType
+	}
+}
+
+// aliasLoadBalancer returns whether the endpoint aliases an AWS load-balancer
+// hostname.
+func (w *DNSRecordWebhook) aliasLoadBalancer(endpoint *v1.Endpoint) bool {
+	if w.AliasLoadBalancers == nil || len(endpoint.Targets) != 1 {
+		return false
+	}
+	return aws.CanonicalHostedZone(endpoint.Targets[0]) != "" && w.AliasLoadBalancers(endpoint.DNSName)
+}
+
+func errorResponse(request *admissionv1.AdmissionRequest, reason metav1.StatusReason, err error) *admissionv1.AdmissionResponse {
+	code := int32(http.StatusBadRequest)
+	switch reason {
+	case metav1.StatusReasonInvalid:
+		code = http.StatusUnprocessableEntity
+	case metav1.StatusReasonInternalError:
+		code = http.StatusInternalServerError
+	}
+	return &admissionv1.AdmissionResponse{
+		UID:     request.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Reason:  reason,
+			Message: err.Error(),
+		},
+	}
+}
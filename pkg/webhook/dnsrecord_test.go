@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	v1 "github.com/kuadrant/kcp-glbc/pkg/apis/kuadrant/v1"
+	"github.com/kuadrant/kcp-glbc/pkg/dns/aws"
+)
+
+func admissionRequest(t *testing.T, operation admissionv1.Operation, endpoints ...*v1.Endpoint) *admissionv1.AdmissionRequest {
+	record := &v1.DNSRecord{}
+	record.Name = "app"
+	record.Spec.Endpoints = endpoints
+	raw, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Operation: operation,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func weighted(endpoint *v1.Endpoint, weight string) *v1.Endpoint {
+	endpoint.SetProviderSpecific(aws.ProviderSpecificWeight, weight)
+	return endpoint
+}
+
+func TestValidate(t *testing.T) {
+	webhook := &DNSRecordWebhook{Domains: []string{"hcpapps.net"}}
+
+	tests := []struct {
+		name      string
+		endpoints []*v1.Endpoint
+		// errors are the fields expected in the message of the rejected request
+		errors []string
+	}{
+		{
+			name: "valid endpoints",
+			endpoints: []*v1.Endpoint{
+				weighted(&v1.Endpoint{DNSName: "app.hcpapps.net", RecordType: "A", SetIdentifier: "10.0.0.1", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60}, "120"),
+				weighted(&v1.Endpoint{DNSName: "app.hcpapps.net", RecordType: "A", SetIdentifier: "10.0.0.2", Targets: v1.Targets{"10.0.0.2"}, RecordTTL: 60}, "120"),
+				{DNSName: "lb.hcpapps.net", RecordType: "A", Targets: v1.Targets{"lb.eu-west-1.elb.amazonaws.com"}},
+				{DNSName: "*.app.hcpapps.net", RecordType: "CNAME", Targets: v1.Targets{"app.hcpapps.net"}},
+				{DNSName: "v6.hcpapps.net", RecordType: "AAAA", Targets: v1.Targets{"2001:db8::1"}},
+			},
+		},
+		{
+			name: "unsupported record type",
+			endpoints: []*v1.Endpoint{
+				{DNSName: "app.hcpapps.net", RecordType: "TXT", Targets: v1.Targets{"text"}},
+			},
+			errors: []string{"spec.endpoints[0].recordType"},
+		},
+		{
+			name: "invalid hostname",
+			endpoints: []*v1.Endpoint{
+				{DNSName: "app_1.hcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}},
+			},
+			errors: []string{"spec.endpoints[0].dnsName"},
+		},
+		{
+			name: "name outside of the managed domains",
+			endpoints: []*v1.Endpoint{
+				{DNSName: "app.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}},
+				{DNSName: "evilhcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}},
+			},
+			errors: []string{"spec.endpoints[0].dnsName", "spec.endpoints[1].dnsName"},
+		},
+		{
+			name: "TTL out of bounds",
+			endpoints: []*v1.Endpoint{
+				{DNSName: "app.hcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: -1},
+				{DNSName: "www.hcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: MaxRecordTTL + 1},
+			},
+			errors: []string{"spec.endpoints[0].recordTTL", "spec.endpoints[1].recordTTL"},
+		},
+		{
+			name: "weight out of range",
+			endpoints: []*v1.Endpoint{
+				weighted(&v1.Endpoint{DNSName: "app.hcpapps.net", RecordType: "A", SetIdentifier: "a", Targets: v1.Targets{"10.0.0.1"}}, "256"),
+				weighted(&v1.Endpoint{DNSName: "app.hcpapps.net", RecordType: "A", SetIdentifier: "b", Targets: v1.Targets{"10.0.0.2"}}, "heavy"),
+			},
+			errors: []string{"spec.endpoints[0].providerSpecific[aws/weight]", "spec.endpoints[1].providerSpecific[aws/weight]"},
+		},
+		{
+			name: "weighted endpoint without set identifier",
+			endpoints: []*v1.Endpoint{
+				weighted(&v1.Endpoint{DNSName: "app.hcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}}, "120"),
+			},
+			errors: []string{"spec.endpoints[0].setIdentifier"},
+		},
+		{
+			name: "duplicate set identifiers",
+			endpoints: []*v1.Endpoint{
+				{DNSName: "app.hcpapps.net", RecordType: "A", SetIdentifier: "a", Targets: v1.Targets{"10.0.0.1"}},
+				{DNSName: "app.hcpapps.net", RecordType: "A", SetIdentifier: "a", Targets: v1.Targets{"10.0.0.2"}},
+			},
+			errors: []string{"spec.endpoints[1].setIdentifier"},
+		},
+		{
+			name: "mismatched targets",
+			endpoints: []*v1.Endpoint{
+				{DNSName: "app.hcpapps.net", RecordType: "A", Targets: v1.Targets{"2001:db8::1"}},
+				{DNSName: "v6.hcpapps.net", RecordType: "AAAA", Targets: v1.Targets{"10.0.0.1"}},
+				{DNSName: "www.hcpapps.net", RecordType: "CNAME", Targets: v1.Targets{"10.0.0.1"}},
+				{DNSName: "lb.hcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1", "lb.eu-west-1.elb.amazonaws.com"}},
+				{DNSName: "empty.hcpapps.net", RecordType: "A"},
+			},
+			errors: []string{
+				"spec.endpoints[0].targets[0]",
+				"spec.endpoints[1].targets[0]",
+				"spec.endpoints[2].targets[0]",
+				"spec.endpoints[3].targets[1]",
+				"spec.endpoints[4].targets",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := webhook.Validate(admissionRequest(t, admissionv1.Create, tt.endpoints...))
+			if response.UID != "uid" {
+				t.Errorf("expected response for request uid, got %q", response.UID)
+			}
+			if len(tt.errors) == 0 {
+				if !response.Allowed {
+					t.Errorf("expected request to be allowed, got %q", response.Result.Message)
+				}
+				return
+			}
+			if response.Allowed {
+				t.Fatalf("expected request to be rejected")
+			}
+			if response.Result.Code != http.StatusUnprocessableEntity {
+				t.Errorf("expected code %d, got %d", http.StatusUnprocessableEntity, response.Result.Code)
+			}
+			for _, field := range tt.errors {
+				if !strings.Contains(response.Result.Message, field+":") {
+					t.Errorf("expected error for %s, got %q", field, response.Result.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAnyDomain(t *testing.T) {
+	webhook := &DNSRecordWebhook{}
+	response := webhook.Validate(admissionRequest(t, admissionv1.Update,
+		&v1.Endpoint{DNSName: "app.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}}))
+	if !response.Allowed {
+		t.Errorf("expected request to be allowed, got %q", response.Result.Message)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	webhook := &DNSRecordWebhook{}
+	response := webhook.Default(admissionRequest(t, admissionv1.Create,
+		&v1.Endpoint{DNSName: "app.hcpapps.net", Targets: v1.Targets{"10.0.0.1"}},
+		&v1.Endpoint{DNSName: "v6.hcpapps.net", Targets: v1.Targets{"2001:db8::1"}, RecordTTL: 300},
+		&v1.Endpoint{DNSName: "www.hcpapps.net", Targets: v1.Targets{"app.hcpapps.net"}},
+		&v1.Endpoint{DNSName: "lb.hcpapps.net", RecordType: "A", Targets: v1.Targets{"lb.eu-west-1.elb.amazonaws.com"}, RecordTTL: 60},
+	))
+	if !response.Allowed {
+		t.Fatalf("expected request to be allowed, got %q", response.Result.Message)
+	}
+	if response.PatchType == nil || *response.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("expected JSON patch, got %v", response.PatchType)
+	}
+
+	expected := `[` +
+		`{"op":"add","path":"/spec/endpoints/0/recordTTL","value":60},` +
+		`{"op":"add","path":"/spec/endpoints/0/recordType","value":"A"},` +
+		`{"op":"add","path":"/spec/endpoints/1/recordType","value":"AAAA"},` +
+		`{"op":"add","path":"/spec/endpoints/2/recordTTL","value":60},` +
+		`{"op":"add","path":"/spec/endpoints/2/recordType","value":"CNAME"}` +
+		`]`
+	if string(response.Patch) != expected {
+		t.Errorf("expected patch %s, got %s", expected, response.Patch)
+	}
+
+	// The AWS load-balancer hostnames are ALIAS records if the zones of the host support them
+	webhook.AliasLoadBalancers = func(host string) bool { return host != "cname.hcpapps.net" }
+	response = webhook.Default(admissionRequest(t, admissionv1.Create,
+		&v1.Endpoint{DNSName: "lb.hcpapps.net", Targets: v1.Targets{"lb.eu-west-1.elb.amazonaws.com"}, RecordTTL: 60},
+		&v1.Endpoint{DNSName: "cname.hcpapps.net", Targets: v1.Targets{"lb.eu-west-1.elb.amazonaws.com"}, RecordTTL: 60},
+		&v1.Endpoint{DNSName: "www.hcpapps.net", Targets: v1.Targets{"app.hcpapps.net"}, RecordTTL: 60},
+	))
+	expected = `[` +
+		`{"op":"add","path":"/spec/endpoints/0/recordType","value":"A"},` +
+		`{"op":"add","path":"/spec/endpoints/1/recordType","value":"CNAME"},` +
+		`{"op":"add","path":"/spec/endpoints/2/recordType","value":"CNAME"}` +
+		`]`
+	if string(response.Patch) != expected {
+		t.Errorf("expected patch %s, got %s", expected, response.Patch)
+	}
+
+	// Nothing to default
+	response = webhook.Default(admissionRequest(t, admissionv1.Create,
+		&v1.Endpoint{DNSName: "app.hcpapps.net", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}, RecordTTL: 60}))
+	if !response.Allowed || response.Patch != nil {
+		t.Errorf("expected request to be allowed without patch, got %s", response.Patch)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(NewHandler(&DNSRecordWebhook{Domains: []string{"hcpapps.net"}}))
+	defer server.Close()
+
+	review := admissionv1.AdmissionReview{
+		Request: admissionRequest(t, admissionv1.Create, &v1.Endpoint{DNSName: "app.example.com", RecordType: "A", Targets: v1.Targets{"10.0.0.1"}}),
+	}
+	review.APIVersion = "admission.k8s.io/v1"
+	review.Kind = "AdmissionReview"
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(server.URL+ValidateDNSRecordPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	result := admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != "AdmissionReview" || result.Request != nil {
+		t.Errorf("unexpected admission review %+v", result)
+	}
+	if result.Response == nil || result.Response.Allowed || result.Response.UID != "uid" {
+		t.Errorf("expected request uid to be rejected, got %+v", result.Response)
+	}
+
+	resp, err = http.Post(server.URL+MutateDNSRecordPath, "application/json", strings.NewReader("{"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
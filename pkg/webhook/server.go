@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"github.com/kuadrant/kcp-glbc/pkg/log"
+)
+
+const (
+	ValidateDNSRecordPath = "/validate-dnsrecord"
+	MutateDNSRecordPath   = "/mutate-dnsrecord"
+
+	certFileName = "tls.crt"
+	keyFileName  = "tls.key"
+)
+
+type Server struct {
+	httpServer http.Server
+	listener   net.Listener
+	certDir    string
+}
+
+// NewServer returns a server serving the DNSRecord webhook over HTTPS, with
+// the certificate and key in the certificate directory. The server is disabled
+// if the port is 0.
+func NewServer(port int, certDir string, dnsRecordWebhook *DNSRecordWebhook) (*Server, error) {
+	if port == 0 {
+		return &Server{}, nil
+	}
+
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		listener: listener,
+		certDir:  certDir,
+		httpServer: http.Server{
+			Handler: NewHandler(dnsRecordWebhook),
+		},
+	}, nil
+}
+
+// NewHandler returns the handler of the admission reviews of the DNSRecord webhook.
+func NewHandler(dnsRecordWebhook *DNSRecordWebhook) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(ValidateDNSRecordPath, admitFunc(dnsRecordWebhook.Validate))
+	mux.Handle(MutateDNSRecordPath, admitFunc(dnsRecordWebhook.Default))
+	return mux
+}
+
+func (s *Server) Start() (err error) {
+	if s.listener == nil {
+		log.Logger.Info("Serving webhooks is disabled")
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("serving webhooks failed: %v", r)
+		}
+	}()
+	log.Logger.Info("Started serving webhooks", "address", s.listener.Addr())
+	if e := s.httpServer.ServeTLS(s.listener, filepath.Join(s.certDir, certFileName), filepath.Join(s.certDir, keyFileName)); e != http.ErrServerClosed {
+		err = e
+	}
+	return
+}
+
+func (s *Server) Shutdown() error {
+	if s.listener == nil {
+		return nil
+	}
+	log.Logger.Info("Stopping webhook server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.httpServer.Shutdown(shutdownCtx)
+}
+
+// admitFunc serves the admission reviews, with the responses of the wrapped function.
+type admitFunc func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+
+func (f admitFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "admission review has no request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = f(review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Logger.Error(err, "Failed to encode admission review")
+	}
+}